@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/iovisor/kubectl-trace/pkg/cmd"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
 	"github.com/spf13/pflag"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/azure"
@@ -21,8 +24,13 @@ func main() {
 		ErrOut: os.Stderr,
 	}
 
+	// The help of the commands is translated when they are created.
+	if err := i18n.LoadTranslations(os.Getenv(i18n.EnvTranslations), nil); err != nil {
+		fmt.Fprintf(streams.ErrOut, "warning: %v\n", err)
+	}
+
 	root := cmd.NewTraceCommand(streams)
 	if err := root.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(errdefs.ExitCode(err))
 	}
 }
@@ -1,6 +1,6 @@
 module github.com/iovisor/kubectl-trace
 
-go 1.12
+go 1.13
 
 replace (
 	github.com/docker/docker => github.com/docker/docker v0.7.3-0.20190327010347-be7ac8be2ae0
@@ -18,7 +18,7 @@ require (
 	github.com/elazarl/goproxy/ext v0.0.0-20190410145444-c548f45dcf1d // indirect
 	github.com/exponent-io/jsonpath v0.0.0-20151013193312-d6023ce2651d // indirect
 	github.com/fntlnz/mountinfo v0.0.0-20171106231217-40cb42681fad
-	github.com/ghodss/yaml v1.0.0 // indirect
+	github.com/ghodss/yaml v1.0.0
 	github.com/go-check/check v0.0.0-20180628173108-788fd7840127
 	github.com/google/btree v0.0.0-20180813153112-4030bb1f1f0c // indirect
 	github.com/google/go-cmp v0.2.0 // indirect
@@ -37,6 +37,7 @@ require (
 	k8s.io/apimachinery v0.0.0-20190404173353-6a84e37a896d
 	k8s.io/cli-runtime v0.0.0-20190409023024-d644b00f3b79
 	k8s.io/client-go v11.0.0+incompatible
+	k8s.io/klog v0.3.3
 	k8s.io/kubernetes v1.14.1
 	k8s.io/utils v0.0.0-20190308190857-21c4ce38f2a7 // indirect
 	sigs.k8s.io/kind v0.5.1
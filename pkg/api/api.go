@@ -0,0 +1,405 @@
+// Package api is the supported Go API to run kubectl-trace programmatically.
+//
+// Unlike the other packages of this module, which back the kubectl-trace commands and change with them,
+// the types and functions of this package only change in a backward compatible way within a Version.
+//
+// The errors are classified with the classes of the errdefs package, to be checked with errors.Is.
+package api
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/logs"
+	"github.com/iovisor/kubectl-trace/pkg/telemetry"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Version is the version of this API.
+const Version = "v1alpha1"
+
+var (
+	// DefaultImageName is the tracerunner image used when the spec does not set one.
+	DefaultImageName = "quay.io/iovisor/kubectl-trace-bpftrace:latest"
+	// DefaultInitImageName is the init container image used when the spec does not set one.
+	DefaultInitImageName = "quay.io/iovisor/kubectl-trace-init:latest"
+	// DefaultDeadline is the maximum time a trace runs when the spec does not set one.
+	DefaultDeadline = time.Hour
+	// DefaultDeadlineGracePeriod is the time left to print the maps after the deadline when the spec does not set one.
+	DefaultDeadlineGracePeriod = 30 * time.Second
+)
+
+// pollInterval is how often Wait checks the status of a trace.
+const pollInterval = time.Second
+
+// Status is the status of a trace.
+type Status = tracejob.TraceJobStatus
+
+// The statuses of a trace.
+const (
+	StatusRunning   = tracejob.TraceJobRunning
+	StatusCompleted = tracejob.TraceJobCompleted
+	StatusFailed    = tracejob.TraceJobFailed
+	// StatusDeadlineExceeded is the status of the traces killed for running past their deadline and grace period.
+	StatusDeadlineExceeded = tracejob.TraceJobDeadlineExceeded
+	StatusUnknown          = tracejob.TraceJobUnknown
+)
+
+// Target is what a trace runs against: a node, or a container of a pod.
+type Target struct {
+	// Node is the name of the node to trace, when tracing a node.
+	Node string
+	// Pod is the name of the pod to trace, when tracing a pod.
+	Pod string
+	// Container is the container of the pod to trace, the first one when empty.
+	Container string
+}
+
+// TraceSpec describes a trace to create.
+type TraceSpec struct {
+	// Target is what to trace.
+	Target Target
+	// Program is the bpftrace program.
+	Program string
+	// Binary is a statically linked binary, like a libbpf based tool, run instead of a bpftrace program.
+	Binary []byte
+	// ServiceAccount is the service account of the trace job pod, default when empty.
+	ServiceAccount string
+	// ImageName is the tracerunner image, DefaultImageName when empty.
+	ImageName string
+	// InitImageName is the image fetching the linux headers, DefaultInitImageName when empty.
+	InitImageName string
+	// FetchHeaders tells whether to fetch the linux headers.
+	FetchHeaders bool
+	// Deadline is the maximum time the trace runs, DefaultDeadline when zero.
+	Deadline time.Duration
+	// DeadlineGracePeriod is the time left to print the maps after the deadline, DefaultDeadlineGracePeriod when zero.
+	DeadlineGracePeriod time.Duration
+	// Exclusive tells whether to refuse to run when another exclusive trace runs on the same node.
+	Exclusive bool
+	// Unsafe runs bpftrace in unsafe mode, allowing actions like system() and signal().
+	Unsafe bool
+	// Tunables are the limits of bpftrace, like the length of the strings, its defaults when zero.
+	Tunables tracejob.Tunables
+	// Buffering is the output buffering mode of bpftrace, one of none, line or full, its default when empty.
+	Buffering string
+	// TracerFlags are appended verbatim to the bpftrace command line, split on white spaces.
+	TracerFlags string
+	// SnapshotInterval is the interval at which bpftrace prints its maps while the trace runs, never when 0.
+	SnapshotInterval time.Duration
+	// Resources are the compute resources of the tracerunner, the kubectl-trace defaults when nil.
+	Resources *corev1.ResourceRequirements
+}
+
+// Trace is a trace in the cluster.
+type Trace struct {
+	// ID identifies the trace.
+	ID types.UID
+	// Name is the name of the objects of the trace.
+	Name string
+	// Namespace is the namespace of the objects of the trace.
+	Namespace string
+	// Node is the hostname of the node the trace runs on.
+	Node string
+	// Status is the status of the trace when it was read.
+	Status Status
+	// StartTime is when the trace job started, nil if it did not yet.
+	StartTime *metav1.Time
+	// Phase is the phase reported by the trace runner, like Compiling or Running, empty when unknown.
+	Phase string
+	// Reason explains the status, like why the trace is pending or why it failed, empty when there is none.
+	Reason string
+}
+
+// Client creates and manages the traces of a namespace.
+type Client struct {
+	namespace string
+	config    *rest.Config
+	core      corev1client.CoreV1Interface
+	jobs      *tracejob.TraceJobClient
+	observer  lifecycle.Observer
+	metrics   telemetry.Metrics
+}
+
+// NewClient provides a client for the traces of the namespace, talking to the cluster described by config.
+func NewClient(config *rest.Config, namespace string) (*Client, error) {
+	jobsClient, err := batchv1client.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	coreClient, err := corev1client.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	coordinationClient, err := coordinationv1client.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(namespace),
+		ConfigClient:        coreClient.ConfigMaps(namespace),
+		PodClient:           coreClient.Pods(namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	return &Client{
+		namespace: namespace,
+		config:    config,
+		core:      coreClient,
+		jobs:      tc,
+	}, nil
+}
+
+// NewClientFromEnvironment provides a client configured like kubectl: from the kubeconfig files
+// in KUBECONFIG or ~/.kube/config, or from the service account of the pod it runs in when there is none.
+// The namespace defaults to the one of the current context, or to the one of the pod.
+func NewClientFromEnvironment(namespace string) (*Client, error) {
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.Context.Namespace = namespace
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), overrides)
+
+	config, err := cc.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(namespace) == 0 {
+		if namespace, _, err = cc.Namespace(); err != nil {
+			return nil, err
+		}
+	}
+	return NewClient(config, namespace)
+}
+
+// WithObserver notifies the observer of the lifecycle of the traces created and attached by the client.
+func (c *Client) WithObserver(o lifecycle.Observer) *Client {
+	c.observer = o
+	return c
+}
+
+// WithLockNamespace sets the namespace of the leases locking the nodes of the exclusive traces,
+// tracejob.DefaultLockNamespace by default.
+func (c *Client) WithLockNamespace(namespace string) *Client {
+	c.jobs.LockNamespace = namespace
+	return c
+}
+
+// WithMetrics collects the metrics of the traces created and attached by the client in m.
+func (c *Client) WithMetrics(m telemetry.Metrics) *Client {
+	c.metrics = m
+	c.jobs.Metrics = m
+	return c
+}
+
+// Create starts a trace.
+func (c *Client) Create(spec TraceSpec) (*Trace, error) {
+	return c.CreateContext(context.Background(), spec)
+}
+
+// CreateContext starts a trace. When ctx is done before the trace is fully created, what was created is removed.
+func (c *Client) CreateContext(ctx context.Context, spec TraceSpec) (*Trace, error) {
+	if len(spec.Program) == 0 && len(spec.Binary) == 0 {
+		return nil, errdefs.Errorf(errdefs.ErrProgramInvalid, "the bpftrace program is mandatory")
+	}
+	target, err := resolveTarget(c.core, c.namespace, spec.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	b := tracejob.New(target).
+		WithNamespace(c.namespace).
+		WithServiceAccount(orDefault(spec.ServiceAccount, "default"))
+	if len(spec.Binary) > 0 {
+		b.WithBinary(spec.Binary)
+	} else {
+		b.WithProgram(spec.Program)
+	}
+	tj, err := b.
+		WithImage(orDefault(spec.ImageName, DefaultImageName)).
+		WithInitImage(orDefault(spec.InitImageName, DefaultInitImageName)).
+		WithFetchHeaders(spec.FetchHeaders).
+		WithDeadline(seconds(spec.Deadline, DefaultDeadline)).
+		WithDeadlineGracePeriod(seconds(spec.DeadlineGracePeriod, DefaultDeadlineGracePeriod)).
+		WithExclusive(spec.Exclusive).
+		WithUnsafe(spec.Unsafe).
+		WithTunables(spec.Tunables).
+		WithBuffering(spec.Buffering).
+		WithTracerFlags(spec.TracerFlags).
+		WithSnapshotInterval(spec.SnapshotInterval).
+		WithResources(spec.Resources).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := c.jobs.CreateJob(ctx, tj)
+	if err != nil {
+		return nil, err
+	}
+	if c.observer != nil {
+		c.observer.OnCreated(lifecycle.Event{
+			TraceID:   tj.ID,
+			Namespace: job.Namespace,
+			Node:      tj.Hostname,
+			Time:      time.Now(),
+		})
+	}
+	return &Trace{
+		ID:        tj.ID,
+		Name:      job.Name,
+		Namespace: job.Namespace,
+		Node:      tj.Hostname,
+		Status:    StatusUnknown,
+	}, nil
+}
+
+// Get returns the trace with the given ID.
+func (c *Client) Get(id types.UID) (*Trace, error) {
+	return c.GetContext(context.Background(), id)
+}
+
+// GetContext returns the trace with the given ID, unless ctx is done.
+func (c *Client) GetContext(ctx context.Context, id types.UID) (*Trace, error) {
+	tjs, err := c.jobs.GetJob(ctx, tracejob.TraceJobFilter{ID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if len(tjs) == 0 {
+		return nil, errdefs.Errorf(errdefs.ErrTraceNotFound, "trace %s not found", id)
+	}
+	t := toTrace(tjs[0])
+	return &t, nil
+}
+
+// List returns all the traces of the namespace.
+func (c *Client) List() ([]Trace, error) {
+	return c.ListContext(context.Background())
+}
+
+// ListContext returns all the traces of the namespace, unless ctx is done.
+func (c *Client) ListContext(ctx context.Context) ([]Trace, error) {
+	tjs, err := c.jobs.GetJob(ctx, tracejob.TraceJobFilter{})
+	if err != nil {
+		return nil, err
+	}
+	traces := make([]Trace, 0, len(tjs))
+	for _, tj := range tjs {
+		traces = append(traces, toTrace(tj))
+	}
+	return traces, nil
+}
+
+// Delete stops the trace and deletes its objects.
+func (c *Client) Delete(id types.UID) error {
+	return c.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext stops the trace and deletes its objects, stopping before the next deletion when ctx is done.
+func (c *Client) DeleteContext(ctx context.Context, id types.UID) error {
+	return c.jobs.DeleteJobs(ctx, tracejob.TraceJobFilter{ID: &id})
+}
+
+// Wait waits until the status of the trace is one of the given ones, or until ctx is done.
+func (c *Client) Wait(ctx context.Context, id types.UID, statuses ...Status) (*Trace, error) {
+	var t *Trace
+	err := wait.PollImmediateUntil(pollInterval, func() (bool, error) {
+		var err error
+		if t, err = c.GetContext(ctx, id); err != nil {
+			return false, err
+		}
+		for _, s := range statuses {
+			if t.Status == s {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return t, ctx.Err()
+	}
+	return t, err
+}
+
+// Attach streams the output of the trace to the streams until ctx is done, or until attaching fails.
+// The input stream must be a terminal, like for kubectl attach.
+func (c *Client) Attach(ctx context.Context, id types.UID, streams genericclioptions.IOStreams) error {
+	a := attacher.NewAttacher(c.core, c.config, streams)
+	a.WithContext(ctx)
+	a.WithObserver(c.observer)
+	a.WithMetrics(c.metrics)
+	return a.AttachJob(id, c.namespace)
+}
+
+// AttachOutput streams the output of the trace to out, and the startup progress and errors to errOut, until ctx is done.
+// Unlike Attach it needs no terminal, the trace then runs until its deadline or until it is deleted.
+func (c *Client) AttachOutput(ctx context.Context, id types.UID, out, errOut io.Writer) error {
+	a := attacher.NewAttacher(c.core, c.config, genericclioptions.IOStreams{})
+	a.WithContext(ctx)
+	a.WithObserver(c.observer)
+	a.WithMetrics(c.metrics)
+	return a.AttachJobTo(id, c.namespace, attacher.Streams{Out: out, ErrOut: errOut})
+}
+
+// Logs writes the output of the trace to out, following it until it ends when follow is true.
+func (c *Client) Logs(id types.UID, follow bool, out io.Writer) error {
+	core := c.core
+	if follow {
+		config := rest.CopyConfig(c.config)
+		config.Timeout = 0
+		var err error
+		if core, err = corev1client.NewForConfig(config); err != nil {
+			return err
+		}
+	}
+	return logs.NewLogs(core, genericclioptions.IOStreams{Out: out, ErrOut: ioutil.Discard}).Run(id, c.namespace, follow, false)
+}
+
+func toTrace(tj tracejob.TraceJob) Trace {
+	status := tj.Status
+	if len(status) == 0 {
+		status = StatusUnknown
+	}
+	return Trace{
+		ID:        tj.ID,
+		Name:      tj.Name,
+		Namespace: tj.Namespace,
+		Node:      tj.Hostname,
+		Status:    status,
+		StartTime: tj.StartTime,
+		Phase:     tj.Phase,
+		Reason:    tj.Reason,
+	}
+}
+
+func orDefault(s, def string) string {
+	if len(s) == 0 {
+		return def
+	}
+	return s
+}
+
+func seconds(d, def time.Duration) int64 {
+	if d == 0 {
+		d = def
+	}
+	return int64(d / time.Second)
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/tracetest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+const testProgram = "kprobe:do_sys_open { @ = count(); }"
+
+// newTestClient provides a client of the default namespace of a cluster with a node and a pod running on it.
+func newTestClient(t *testing.T) (*Client, *tracetest.APIServer) {
+	s := tracetest.NewAPIServer()
+	err := s.Add(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"kubernetes.io/hostname": "node-1.internal"}}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "pod-uid"},
+			Spec:       corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Name: "nginx"}, {Name: "sidecar"}}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"}},
+	)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	c, err := NewClient(s.Config(), "default")
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return c, s
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          TraceSpec
+		wantNode      string
+		wantContainer string
+		wantErr       error
+	}{
+		{
+			name:     "node",
+			spec:     TraceSpec{Target: Target{Node: "node-1"}, Program: testProgram},
+			wantNode: "node-1.internal",
+		},
+		{
+			name:          "first container of a pod",
+			spec:          TraceSpec{Target: Target{Pod: "nginx"}, Program: testProgram},
+			wantNode:      "node-1.internal",
+			wantContainer: "nginx",
+		},
+		{
+			name:          "container of a pod",
+			spec:          TraceSpec{Target: Target{Pod: "nginx", Container: "sidecar"}, Program: testProgram},
+			wantNode:      "node-1.internal",
+			wantContainer: "sidecar",
+		},
+		{
+			name:    "missing node",
+			spec:    TraceSpec{Target: Target{Node: "node-2"}, Program: testProgram},
+			wantErr: errdefs.ErrTargetNotFound,
+		},
+		{
+			name:    "missing pod",
+			spec:    TraceSpec{Target: Target{Pod: "redis"}, Program: testProgram},
+			wantErr: errdefs.ErrTargetNotFound,
+		},
+		{
+			name:    "missing container",
+			spec:    TraceSpec{Target: Target{Pod: "nginx", Container: "redis"}, Program: testProgram},
+			wantErr: errdefs.ErrContainerNotFound,
+		},
+		{
+			name:    "no program",
+			spec:    TraceSpec{Target: Target{Node: "node-1"}},
+			wantErr: errdefs.ErrProgramInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, s := newTestClient(t)
+			defer s.Close()
+
+			trace, err := c.Create(tt.spec)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+				}
+				if got := s.Names("jobs"); len(got) > 0 {
+					t.Errorf("Create() failing created jobs %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if trace.Node != tt.wantNode || trace.Namespace != "default" || trace.Status != StatusUnknown {
+				t.Errorf("Create() = %+v, want a trace of node %s in the default namespace", trace, tt.wantNode)
+			}
+			want := []string{"default/" + trace.Name}
+			if got := s.Names("jobs"); !reflect.DeepEqual(got, want) {
+				t.Errorf("Create() created jobs %v, want %v", got, want)
+			}
+			if got := s.Names("configmaps"); !reflect.DeepEqual(got, want) {
+				t.Errorf("Create() created configmaps %v, want %v", got, want)
+			}
+
+			got, err := c.Get(trace.ID)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.ID != trace.ID || got.Node != tt.wantNode {
+				t.Errorf("Get() = %+v, want the created trace %+v", got, trace)
+			}
+			batch, err := batchv1client.NewForConfig(s.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			job, err := batch.Jobs("default").Get(trace.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.wantContainer) > 0 {
+				command := strings.Join(job.Spec.Template.Spec.Containers[0].Command, " ")
+				if want := "--container=" + tt.wantContainer + " --poduid=pod-uid"; !strings.Contains(command, want) {
+					t.Errorf("Create() job command = %s, want the trace of %s", command, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreatePendingPod(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	if _, err := c.Create(TraceSpec{Target: Target{Pod: "pending"}, Program: testProgram}); err == nil {
+		t.Errorf("Create() of a pod not scheduled yet should fail")
+	}
+}
+
+func TestWait(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	trace, err := c.Create(TraceSpec{Target: Target{Node: "node-1"}, Program: testProgram})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Wait(ctx, trace.ID, StatusCompleted); err != context.DeadlineExceeded {
+		t.Errorf("Wait() of a running trace error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	batch, err := batchv1client.NewForConfig(s.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := batch.Jobs("default").Get(trace.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.Status = batchv1.JobStatus{Succeeded: 1}
+	if _, err := batch.Jobs("default").Update(job); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Wait(context.Background(), trace.ID, StatusFailed, StatusCompleted)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if got.Status != StatusCompleted {
+		t.Errorf("Wait() = %+v, want a completed trace", got)
+	}
+
+	if _, err := c.Wait(context.Background(), "missing", StatusCompleted); !errors.Is(err, errdefs.ErrTraceNotFound) {
+		t.Errorf("Wait() of a missing trace error = %v, want %v", err, errdefs.ErrTraceNotFound)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+	kept, err := c.Create(TraceSpec{Target: Target{Node: "node-1"}, Program: testProgram})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := c.Create(TraceSpec{Target: Target{Pod: "nginx"}, Program: testProgram})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(deleted.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	want := []string{"default/" + kept.Name}
+	for _, resource := range []string{"jobs", "configmaps"} {
+		if got := s.Names(resource); !reflect.DeepEqual(got, want) {
+			t.Errorf("Delete() left %s %v, want %v", resource, got, want)
+		}
+	}
+	if _, err := c.Get(deleted.ID); !errors.Is(err, errdefs.ErrTraceNotFound) {
+		t.Errorf("Get() of the deleted trace error = %v, want %v", err, errdefs.ErrTraceNotFound)
+	}
+}
+
+// setenv sets the environment variable, returning the function restoring it.
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestNewClientFromEnvironment(t *testing.T) {
+	s := tracetest.NewAPIServer()
+	defer s.Close()
+	if err := s.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"kubernetes.io/hostname": "node-1"}}}); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "kubectl-trace-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: `+s.Config().Host+`
+contexts:
+- name: test
+  context:
+    cluster: test
+    namespace: tracing
+current-context: test
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pod kubectl-trace runs in has the address of the API server in its environment.
+	defer setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")()
+	defer setenv("KUBERNETES_SERVICE_PORT", "443")()
+	defer setenv("POD_NAMESPACE", "")()
+
+	t.Run("kubeconfig", func(t *testing.T) {
+		defer setenv("KUBECONFIG", kubeconfig)()
+		c, err := NewClientFromEnvironment("")
+		if err != nil {
+			t.Fatalf("NewClientFromEnvironment() error = %v", err)
+		}
+		if c.config.Host != s.Config().Host || c.namespace != "tracing" {
+			t.Errorf("NewClientFromEnvironment() = %s in %s, want the server and namespace of the kubeconfig", c.config.Host, c.namespace)
+		}
+		trace, err := c.Create(TraceSpec{Target: Target{Node: "node-1"}, Program: testProgram})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if want := []string{"tracing/" + trace.Name}; !reflect.DeepEqual(s.Names("jobs"), want) {
+			t.Errorf("Create() created jobs %v, want %v", s.Names("jobs"), want)
+		}
+	})
+
+	t.Run("in cluster", func(t *testing.T) {
+		defer setenv("KUBECONFIG", filepath.Join(dir, "missing"))()
+		c, err := NewClientFromEnvironment("default")
+		if _, statErr := os.Stat("/var/run/secrets/kubernetes.io/serviceaccount/token"); statErr != nil {
+			// Outside of a pod, there is no service account token to use the API server of the environment with.
+			if err == nil {
+				t.Errorf("NewClientFromEnvironment() without a kubeconfig or a service account token = %s, want an error", c.config.Host)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("NewClientFromEnvironment() error = %v", err)
+		}
+		if want := "https://10.96.0.1:443"; c.config.Host != want {
+			t.Errorf("NewClientFromEnvironment() = %s, want the API server of the environment %s", c.config.Host, want)
+		}
+	})
+}
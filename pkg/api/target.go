@@ -0,0 +1,31 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// resolveTarget looks up the node, or the pod and its node, the trace runs against.
+func resolveTarget(client corev1client.CoreV1Interface, namespace string, t Target) (tracejob.Target, error) {
+	if (len(t.Node) == 0) == (len(t.Pod) == 0) {
+		return tracejob.Target{}, fmt.Errorf("the target must be either a node or a pod")
+	}
+	if len(t.Node) > 0 {
+		return tracejob.ResolveNodeTarget(client, t.Node)
+	}
+
+	pod, err := client.Pods(namespace).Get(t.Pod, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return tracejob.Target{}, errdefs.Wrap(errdefs.ErrTargetNotFound, err)
+	}
+	if err != nil {
+		return tracejob.Target{}, err
+	}
+	return tracejob.ResolvePodTarget(client, pod, t.Container)
+}
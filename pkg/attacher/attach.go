@@ -5,13 +5,23 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"regexp"
 	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/color"
+	"github.com/iovisor/kubectl-trace/pkg/diagnostics"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/logging"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/pids"
+	"github.com/iovisor/kubectl-trace/pkg/redact"
+	"github.com/iovisor/kubectl-trace/pkg/telemetry"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
 	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/kubectl/util/term"
 
 	corev1 "k8s.io/api/core/v1"
@@ -21,11 +31,37 @@ import (
 	"k8s.io/client-go/tools/remotecommand"
 )
 
+// Streams are where an attached trace job reads its input from and writes its output to.
+type Streams struct {
+	// In is forwarded to the trace runner, which must be a terminal.
+	// When nil the trace job is attached without input and the program can only be stopped by deleting the trace.
+	In io.Reader
+	// Out receives the output of the program.
+	Out io.Writer
+	// ErrOut receives the startup progress and the errors.
+	ErrOut io.Writer
+}
+
+// Interface attaches to trace jobs, it is implemented by Attacher and by the fake of the tracetest package.
+type Interface interface {
+	AttachJob(traceJobID types.UID, namespace string) error
+	AttachJobTo(traceJobID types.UID, namespace string, s Streams) error
+}
+
+var _ Interface = &Attacher{}
+
 type Attacher struct {
 	genericclioptions.IOStreams
-	ctx          context.Context
-	CoreV1Client tcorev1.CoreV1Interface
-	Config       *restclient.Config
+	ctx      context.Context
+	quiet    bool
+	observer lifecycle.Observer
+	metrics  telemetry.Metrics
+	// deadlineWarning is how long before the deadline of the trace a warning is printed, never when 0.
+	deadlineWarning time.Duration
+	resolvePIDs     bool
+	redact          []*regexp.Regexp
+	CoreV1Client    tcorev1.CoreV1Interface
+	Config          *restclient.Config
 }
 
 func NewAttacher(client tcorev1.CoreV1Interface, config *restclient.Config, streams genericclioptions.IOStreams) *Attacher {
@@ -41,18 +77,94 @@ const (
 	podNotFoundError              = "no pod found to attach with the given selector"
 	podPhaseNotAcceptedError      = "cannot attach into a container in a completed pod; current phase is %s"
 	invalidPodContainersSizeError = "unexpected number of containers in trace job pod"
+	podStartupFailedError         = "the trace job pod failed to start"
+	podUnschedulableError         = "the trace job pod cannot be scheduled"
+	programFailedError            = "the trace program failed"
+	deadlineExceededError         = "the trace did not stop within its deadline and grace period"
+	traceFailedError              = "the trace job pod failed"
+	attachTimeoutError            = "timed out attaching to the trace job pod"
+	nodeDrainedError              = "the node %s of the trace is drained"
 )
 
 func (a *Attacher) WithContext(c context.Context) {
 	a.ctx = c
 }
 
-func (a *Attacher) AttachJob(traceJobID types.UID, namespace string) {
-	a.Attach(fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, traceJobID), namespace)
+// WithQuiet leaves out the banners of the trace runner and of bpftrace from the output, leaving only the program output.
+func (a *Attacher) WithQuiet(q bool) {
+	a.quiet = q
+}
+
+// WithResolvePIDs annotates the PIDs printed by the program with the pod and the container running them,
+// resolved from the trace job pod while the trace runs.
+func (a *Attacher) WithResolvePIDs(r bool) {
+	a.resolvePIDs = r
+}
+
+// WithRedact replaces the text of the output matched by the regular expressions, see redact.Line,
+// before it reaches the streams or the observer.
+func (a *Attacher) WithRedact(res []*regexp.Regexp) {
+	a.redact = res
+}
+
+// WithObserver notifies the observer of the lifecycle of the attached trace jobs,
+// from their scheduling to their completion, and of each line of their output.
+func (a *Attacher) WithObserver(o lifecycle.Observer) {
+	a.observer = o
+}
+
+// WithMetrics measures the attach durations and counts the traces seen failing in m.
+func (a *Attacher) WithMetrics(m telemetry.Metrics) {
+	a.metrics = m
+}
+
+// AttachJob attaches to the trace job with the given ID, until the context of the attacher is done.
+// The errors are classified as errdefs.ErrAttachFailed, and more precisely by the outcome of the trace when it failed:
+// errdefs.ErrSchedulingFailed, errdefs.ErrProgramInvalid or errdefs.ErrDeadlineExceeded.
+func (a *Attacher) AttachJob(traceJobID types.UID, namespace string) error {
+	return a.AttachJobTo(traceJobID, namespace, a.streams())
+}
+
+func (a *Attacher) Attach(selector, namespace string) error {
+	return a.AttachTo(selector, namespace, a.streams())
+}
+
+// AttachJobTo attaches to the trace job with the given ID using the given streams instead of the ones of the attacher.
+// It can be called concurrently to attach to several trace jobs.
+func (a *Attacher) AttachJobTo(traceJobID types.UID, namespace string, s Streams) error {
+	return a.AttachTo(fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, traceJobID), namespace, s)
+}
+
+// AttachTo attaches to the trace job pod matching the selector using the given streams instead of the ones of the attacher.
+// It returns once the trace ended, or as soon as the context of the attacher is done.
+func (a *Attacher) AttachTo(selector, namespace string, s Streams) error {
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- a.attachWithBackoff(selector, namespace, s)
+	}()
+	select {
+	case err := <-errCh:
+		telemetry.OrNop(a.metrics).AttachDuration(namespace, time.Since(start), err != nil)
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrAttachFailed, err)
+		}
+		return nil
+	case <-a.ctx.Done():
+		telemetry.OrNop(a.metrics).AttachDuration(namespace, time.Since(start), false)
+		return nil
+	}
 }
 
-func (a *Attacher) Attach(selector, namespace string) {
-	go wait.ExponentialBackoff(wait.Backoff{
+func (a *Attacher) streams() Streams {
+	return Streams{In: a.IOStreams.In, Out: a.IOStreams.Out, ErrOut: a.IOStreams.ErrOut}
+}
+
+func (a *Attacher) attachWithBackoff(selector, namespace string, s Streams) error {
+	podFound := false
+	p := &progress{}
+	tr := newTracker(a.observer, a.metrics)
+	err := wait.ExponentialBackoff(wait.Backoff{
 		Duration: time.Second * 1,
 		Factor:   0.01,
 		Jitter:   0.0,
@@ -67,13 +179,42 @@ func (a *Attacher) Attach(selector, namespace string) {
 		}
 
 		if len(pl.Items) == 0 {
-			return false, fmt.Errorf(podNotFoundError)
+			// the job controller might not have created the pod yet
+			klog.V(logging.LevelStatus).Infof("waiting for the trace job pod: selector=%s namespace=%s", selector, namespace)
+			p.update(a, s.ErrOut, nil)
+			return false, nil
 		}
+		podFound = true
 		pod := &pl.Items[0]
+		klog.V(logging.LevelStatus).Infof("trace job pod status: pod=%s namespace=%s phase=%s node=%s containers=%v", pod.Name, pod.Namespace, pod.Status.Phase, pod.Spec.NodeName, diagnostics.ContainerStates(pod))
+		tr.update(pod)
 		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
 			return false, fmt.Errorf(podPhaseNotAcceptedError, pod.Status.Phase)
 		}
 
+		p.update(a, s.ErrOut, pod)
+
+		if reason, failed := diagnostics.StartupFailure(pod); failed {
+			if _, unschedulable := diagnostics.Unschedulable(pod); unschedulable {
+				// The pod of a trace evicted by a drain is replaced by one that cannot be scheduled.
+				if node, drained := diagnostics.Drained(a.CoreV1Client, pod); drained {
+					err := errdefs.Errorf(errdefs.ErrNodeDrained, nodeDrainedError, node)
+					fmt.Fprintf(s.ErrOut, "%s %v\n", color.Sprint(s.ErrOut, color.Red, "trace could not run:"), err)
+					tr.failed(pod, err)
+					return false, err
+				}
+			}
+			fmt.Fprintf(s.ErrOut, "%s %s\n", color.Sprint(s.ErrOut, color.Red, "trace could not start:"), reason)
+			if err := diagnostics.Describe(a.CoreV1Client, pod, s.ErrOut); err != nil {
+				return false, err
+			}
+			tr.failed(pod, fmt.Errorf("%s: %s", podStartupFailedError, reason))
+			if _, unschedulable := diagnostics.Unschedulable(pod); unschedulable {
+				return false, errdefs.Errorf(errdefs.ErrSchedulingFailed, podUnschedulableError)
+			}
+			return false, fmt.Errorf(podStartupFailedError)
+		}
+
 		if len(pod.Spec.Containers) != 1 {
 			return false, fmt.Errorf(invalidPodContainersSizeError)
 		}
@@ -81,7 +222,29 @@ func (a *Attacher) Attach(selector, namespace string) {
 		restClient := a.CoreV1Client.RESTClient().(*restclient.RESTClient)
 		containerName := pod.Spec.Containers[0].Name
 
-		t, err := setupTTY(a.IOStreams.Out, a.IOStreams.In)
+		out := s.Out
+		var annotator *pids.Annotator
+		if a.resolvePIDs {
+			resolver := pids.NewResolver(a.CoreV1Client, a.Config, types.UID(pod.Labels[meta.TraceIDLabelKey]), pod.Namespace)
+			annotator = pids.NewAnnotator(out, resolver.Resolve)
+			out = annotator
+		}
+		var filter *bannerFilter
+		if a.quiet {
+			filter = newBannerFilter(out)
+			out = filter
+		}
+		var lines *bannerFilter
+		if a.observer != nil {
+			lines = newBannerFilter(&lineNotifier{observer: a.observer, event: podEvent(pod)})
+			out = io.MultiWriter(out, lines)
+		}
+		var redactor *redact.Writer
+		if len(a.redact) > 0 {
+			redactor = redact.NewWriter(out, a.redact)
+			out = redactor
+		}
+		t, err := setupTTY(out, s.In)
 		if err != nil {
 			return false, err
 		}
@@ -92,16 +255,96 @@ func (a *Attacher) Attach(selector, namespace string) {
 			containerName: containerName,
 			config:        a.Config,
 			tty:           t,
+			stdin:         s.In != nil,
 		}
+		klog.V(logging.LevelSteps).Infof("attaching to the trace job pod: pod=%s namespace=%s container=%s", pod.Name, pod.Namespace, containerName)
+		stop := make(chan struct{})
+		go a.warnDeadline(pod, s.ErrOut, t.Raw, stop)
 		err = t.Safe(ao.defaultAttachFunc())
+		close(stop)
+		if redactor != nil {
+			redactor.Flush()
+		}
+		if filter != nil {
+			filter.Flush()
+		}
+		if annotator != nil {
+			annotator.Flush()
+		}
+		if lines != nil {
+			lines.Flush()
+		}
 
 		if err != nil {
 			// on error, just send false so that the backoff mechanism can do a new tentative
+			klog.V(logging.LevelSteps).Infof("attach failed, retrying: pod=%s error=%q", pod.Name, err)
 			return false, nil
 		}
-		return true, nil
+		return true, a.waitForEnd(pod, tr, s.ErrOut)
 	})
-	<-a.ctx.Done()
+	if err == wait.ErrWaitTimeout && !podFound {
+		return fmt.Errorf(podNotFoundError)
+	}
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf(attachTimeoutError)
+	}
+	return err
+}
+
+// evictedReason is the reason of the pods evicted from their node.
+const evictedReason = "Evicted"
+
+// waitForEnd waits for the trace job pod to terminate once its output ended, to notify the observer of the outcome,
+// count a failure and print why the trace failed to errOut. The failure is returned classified by its cause,
+// as errdefs.ErrProgramInvalid when the program failed and as errdefs.ErrDeadlineExceeded when the trace was killed.
+func (a *Attacher) waitForEnd(pod *corev1.Pod, tr *tracker, errOut io.Writer) error {
+	timeout := endTimeout
+	if a.observer == nil && a.metrics == nil {
+		timeout = diagnoseTimeout
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, timeout)
+	defer cancel()
+	var last *corev1.Pod
+	wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		p, err := a.CoreV1Client.Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			// The pod is gone or cannot be read, there is no outcome to notify.
+			return true, nil
+		}
+		last = p
+		tr.update(p)
+		return tr.done, nil
+	}, ctx.Done())
+
+	if last == nil {
+		return nil
+	}
+	// A trace evicted by a drain is gone, or failed as evicted.
+	if !tr.done || last.Status.Reason == evictedReason {
+		if node, drained := diagnostics.Drained(a.CoreV1Client, last); drained {
+			err := errdefs.Errorf(errdefs.ErrNodeDrained, nodeDrainedError, node)
+			fmt.Fprintf(errOut, "%s %v\n", color.Sprint(errOut, color.Red, "trace failed:"), err)
+			tr.failed(last, err)
+			return err
+		}
+	}
+	reason, failed := diagnostics.Failure(last)
+	// A trace killed at its deadline is deleted by the job controller, it is gone before its failure is seen.
+	if (failed || !tr.done) && diagnostics.DeadlineExceeded(a.CoreV1Client, last) {
+		fmt.Fprintf(errOut, "%s %s\n", color.Sprint(errOut, color.Red, "trace failed:"), deadlineExceededError)
+		return errdefs.Errorf(errdefs.ErrDeadlineExceeded, deadlineExceededError)
+	}
+	if !failed {
+		return nil
+	}
+	fmt.Fprintf(errOut, "%s %s\n", color.Sprint(errOut, color.Red, "trace failed:"), reason)
+	if err := diagnostics.DescribeFailure(a.CoreV1Client, last, errOut); err != nil {
+		klog.V(logging.LevelSteps).Infof("could not describe the failed trace: pod=%s error=%q", last.Name, err)
+	}
+	if diagnostics.ProgramFailure(last) {
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, programFailedError)
+	}
+	return fmt.Errorf(traceFailedError)
 }
 
 type attach struct {
@@ -111,6 +354,7 @@ type attach struct {
 	namespace     string
 	config        *restclient.Config
 	tty           term.TTY
+	stdin         bool
 }
 
 func (a attach) defaultAttachFunc() func() error {
@@ -122,7 +366,7 @@ func (a attach) defaultAttachFunc() func() error {
 			SubResource("attach")
 		req.VersionedParams(&corev1.PodAttachOptions{
 			Container: a.containerName,
-			Stdin:     true,
+			Stdin:     a.stdin,
 			Stdout:    true,
 			Stderr:    false,
 			TTY:       a.tty.Raw,
@@ -134,14 +378,18 @@ func (a attach) defaultAttachFunc() func() error {
 		// of the screen so that it will be redrawn during attach and detach
 		tsize := a.tty.GetSize()
 		var terminalSizeQueue remotecommand.TerminalSizeQueue
-		if tsize != nil {
+		if tsize != nil && a.tty.Raw {
 			tsizeinc := *tsize
 			tsizeinc.Height++
 			tsizeinc.Width++
 			terminalSizeQueue = a.tty.MonitorSize(&tsizeinc, tsize)
 		}
 
-		return att.Attach("POST", req.URL(), a.config, a.tty.In, a.tty.Out, nil, a.tty.Raw, terminalSizeQueue)
+		var in io.Reader
+		if a.stdin {
+			in = a.tty.In
+		}
+		return att.Attach("POST", req.URL(), a.config, in, a.tty.Out, nil, a.tty.Raw, terminalSizeQueue)
 	}
 }
 
@@ -161,7 +409,11 @@ func (*defaultRemoteAttach) Attach(method string, url *url.URL, config *restclie
 	})
 }
 
+// setupTTY attaches with a TTY in raw mode when there is an input, which must then be a terminal.
 func setupTTY(out io.Writer, in io.Reader) (term.TTY, error) {
+	if in == nil {
+		return term.TTY{Out: out}, nil
+	}
 	t := term.TTY{
 		Out: out,
 		In:  in,
@@ -0,0 +1,79 @@
+package attacher
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/color"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultDeadlineWarning is how long before the deadline of an attached trace a warning is printed.
+const DefaultDeadlineWarning = time.Minute
+
+// WithDeadlineWarning prints a warning d before the deadline of the attached trace jobs, and another one when their
+// grace period begins, so that their termination does not come as a surprise. No warning is printed when d is 0.
+func (a *Attacher) WithDeadlineWarning(d time.Duration) {
+	a.deadlineWarning = d
+}
+
+// deadlines returns when the trace of the pod reaches its deadline and when its grace period ends, from the
+// annotations of the pod and the start of its container. ok is false when they are not known.
+func deadlines(pod *corev1.Pod) (deadline, killed time.Time, ok bool) {
+	seconds, err := strconv.ParseInt(pod.Annotations[meta.TraceDeadlineAnnotationKey], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	grace, err := strconv.ParseInt(pod.Annotations[meta.TraceDeadlineGracePeriodAnnotationKey], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	// The deadline of the trace runner is counted from the start of its container.
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.State.Running == nil {
+			continue
+		}
+		deadline = s.State.Running.StartedAt.Add(time.Duration(seconds) * time.Second)
+		return deadline, deadline.Add(time.Duration(grace) * time.Second), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// warnDeadline prints the deadline warnings of the pod to w until stop is closed.
+// raw tells whether the terminal is in raw mode, where lines must end with a carriage return.
+func (a *Attacher) warnDeadline(pod *corev1.Pod, w io.Writer, raw bool, stop <-chan struct{}) {
+	if a.deadlineWarning <= 0 {
+		return
+	}
+	deadline, killed, ok := deadlines(pod)
+	if !ok {
+		return
+	}
+	eol := "\n"
+	if raw {
+		eol = "\r\n"
+	}
+	warn := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, "%s%s %s%s", eol, color.Sprint(w, color.Yellow, "warning:"), fmt.Sprintf(format, args...), eol)
+	}
+
+	if time.Until(deadline) > 0 {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(deadline.Add(-a.deadlineWarning))):
+		}
+		warn("the trace reaches its deadline in %s, at %s", time.Until(deadline).Round(time.Second), deadline.Local().Format("15:04:05"))
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+	if time.Until(killed) > 0 {
+		warn("the trace reached its deadline, it has %s to print its maps before it is killed", time.Until(killed).Round(time.Second))
+	}
+}
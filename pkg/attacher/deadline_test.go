@@ -0,0 +1,63 @@
+package attacher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deadlinePod(started time.Time, deadline, grace string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			meta.TraceDeadlineAnnotationKey:            deadline,
+			meta.TraceDeadlineGracePeriodAnnotationKey: grace,
+		}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(started)},
+		}}}},
+	}
+}
+
+func TestDeadlines(t *testing.T) {
+	started := time.Date(2019, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	deadline, killed, ok := deadlines(deadlinePod(started, "3600", "30"))
+	if !ok || !deadline.Equal(started.Add(time.Hour)) || !killed.Equal(started.Add(time.Hour+30*time.Second)) {
+		t.Errorf("deadlines() = %v, %v, %v", deadline, killed, ok)
+	}
+
+	if _, _, ok := deadlines(deadlinePod(started, "", "30")); ok {
+		t.Errorf("deadlines() without deadline annotation should not be known")
+	}
+
+	pod := deadlinePod(started, "3600", "30")
+	pod.Status.ContainerStatuses = nil
+	if _, _, ok := deadlines(pod); ok {
+		t.Errorf("deadlines() of a pod not running should not be known")
+	}
+}
+
+func TestWarnDeadline(t *testing.T) {
+	// The deadline is in the past and the grace period is running.
+	pod := deadlinePod(time.Now().Add(-2*time.Second), "1", "60")
+	a := &Attacher{}
+	a.WithDeadlineWarning(time.Minute)
+
+	out := &bytes.Buffer{}
+	a.warnDeadline(pod, out, true, make(chan struct{}))
+	if !strings.Contains(out.String(), "the trace reached its deadline, it has") || !strings.HasSuffix(out.String(), "\r\n") {
+		t.Errorf("warnDeadline() = %q", out.String())
+	}
+
+	out.Reset()
+	a.WithDeadlineWarning(0)
+	a.warnDeadline(pod, out, false, make(chan struct{}))
+	if out.Len() > 0 {
+		t.Errorf("warnDeadline() without warning = %q, want nothing", out.String())
+	}
+}
@@ -0,0 +1,110 @@
+package attacher
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/diagnostics"
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/telemetry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// endTimeout bounds the wait for the trace job pod to terminate once its output stream ended.
+const endTimeout = time.Minute
+
+// diagnoseTimeout bounds the same wait when there is no observer to notify and no metrics to count,
+// only to tell whether to print why the trace failed.
+const diagnoseTimeout = 10 * time.Second
+
+// tracker notifies the observer of the lifecycle of the trace job pod, each change once,
+// and counts the failures in the metrics.
+type tracker struct {
+	observer  lifecycle.Observer
+	metrics   telemetry.Metrics
+	scheduled bool
+	running   bool
+	done      bool
+}
+
+func newTracker(observer lifecycle.Observer, metrics telemetry.Metrics) *tracker {
+	if observer == nil {
+		observer = lifecycle.Funcs{}
+	}
+	return &tracker{observer: observer, metrics: telemetry.OrNop(metrics)}
+}
+
+func podEvent(pod *corev1.Pod) lifecycle.Event {
+	return lifecycle.Event{
+		TraceID:   types.UID(pod.Labels[meta.TraceIDLabelKey]),
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Node:      pod.Spec.NodeName,
+		Time:      time.Now(),
+	}
+}
+
+// update notifies the changes seen in the status of the pod since the last update.
+func (t *tracker) update(pod *corev1.Pod) {
+	if t.done {
+		return
+	}
+	e := podEvent(pod)
+	if !t.scheduled && len(pod.Spec.NodeName) > 0 {
+		t.scheduled = true
+		t.observer.OnScheduled(e)
+	}
+	if !t.running {
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.State.Running != nil || s.State.Terminated != nil {
+				t.running = true
+				t.observer.OnRunning(e)
+				break
+			}
+		}
+	}
+	if reason, failed := diagnostics.Failure(pod); failed {
+		t.failed(pod, fmt.Errorf("the trace failed: %s", reason))
+		return
+	}
+	if pod.Status.Phase == corev1.PodSucceeded {
+		t.done = true
+		t.observer.OnCompleted(e)
+	}
+}
+
+// failed notifies that the trace cannot succeed anymore.
+func (t *tracker) failed(pod *corev1.Pod, err error) {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.metrics.TraceFailed(pod.Namespace)
+	t.observer.OnFailed(podEvent(pod), err)
+}
+
+// lineNotifier passes each line of the output of the program to the observer.
+type lineNotifier struct {
+	observer lifecycle.Observer
+	event    lifecycle.Event
+	line     []byte
+}
+
+func (w *lineNotifier) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.line = append(w.line, p...)
+			break
+		}
+		w.line = append(w.line, p[:i]...)
+		p = p[i+1:]
+		w.observer.OnOutputLine(w.event, string(bytes.TrimSuffix(w.line, []byte("\r"))))
+		w.line = w.line[:0]
+	}
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package attacher
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/telemetry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recorder records the notifications it gets.
+func recorder(calls *[]string) lifecycle.Observer {
+	return lifecycle.Funcs{
+		Scheduled:  func(e lifecycle.Event) { *calls = append(*calls, "scheduled "+e.Node) },
+		Running:    func(e lifecycle.Event) { *calls = append(*calls, "running") },
+		OutputLine: func(e lifecycle.Event, line string) { *calls = append(*calls, "line "+line) },
+		Completed:  func(e lifecycle.Event) { *calls = append(*calls, "completed") },
+		Failed:     func(e lifecycle.Event, err error) { *calls = append(*calls, "failed") },
+	}
+}
+
+func TestTracker(t *testing.T) {
+	pending := corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}}
+	scheduled := pending
+	scheduled.Spec.NodeName = "node-1"
+	running := scheduled
+	running.Status = corev1.PodStatus{
+		Phase:             corev1.PodRunning,
+		ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+	}
+	succeeded := running
+	succeeded.Status.Phase = corev1.PodSucceeded
+	failed := scheduled
+	failed.Status.Phase = corev1.PodFailed
+
+	tests := []struct {
+		name string
+		pods []corev1.Pod
+		want []string
+	}{
+		{
+			name: "whole lifecycle",
+			pods: []corev1.Pod{pending, scheduled, scheduled, running, running, succeeded},
+			want: []string{"scheduled node-1", "running", "completed"},
+		},
+		{
+			name: "changes seen at once",
+			pods: []corev1.Pod{succeeded},
+			want: []string{"scheduled node-1", "running", "completed"},
+		},
+		{
+			name: "failure",
+			pods: []corev1.Pod{scheduled, failed},
+			want: []string{"scheduled node-1", "failed"},
+		},
+		{
+			name: "nothing after the outcome",
+			pods: []corev1.Pod{failed, succeeded},
+			want: []string{"scheduled node-1", "failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			tr := newTracker(recorder(&calls), nil)
+			for i := range tt.pods {
+				tr.update(&tt.pods[i])
+			}
+			// every case ends with an outcome, nothing is notified after it
+			tr.failed(&pending, fmt.Errorf("too late"))
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("notifications = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineNotifier(t *testing.T) {
+	var calls []string
+	w := &lineNotifier{observer: recorder(&calls)}
+	for _, s := range []string{"@[sshd]: 1\r\n@[b", "ash]: 2\r\n", "partial"} {
+		w.Write([]byte(s))
+	}
+	want := []string{"line @[sshd]: 1", "line @[bash]: 2"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("notifications = %v, want %v", calls, want)
+	}
+}
+
+// failures counts the traces seen failing.
+type failures struct {
+	telemetry.Nop
+	count int
+}
+
+func (f *failures) TraceFailed(namespace string) { f.count++ }
+
+func TestTrackerMetrics(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed}}
+	m := &failures{}
+	tr := newTracker(nil, m)
+	tr.update(pod)
+	tr.update(pod)
+	tr.failed(pod, fmt.Errorf("could not start"))
+	if m.count != 1 {
+		t.Errorf("failures counted = %d, want 1", m.count)
+	}
+}
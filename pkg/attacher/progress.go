@@ -0,0 +1,65 @@
+package attacher
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iovisor/kubectl-trace/pkg/color"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// startupPhase describes what the trace job pod is waiting for before the program can run.
+func startupPhase(pod *corev1.Pod) string {
+	if pod == nil {
+		return "waiting for the trace job pod to be created"
+	}
+
+	scheduled := false
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionTrue {
+			scheduled = true
+		}
+	}
+	if !scheduled {
+		return "waiting for the trace job pod to be scheduled"
+	}
+
+	for _, s := range pod.Status.InitContainerStatuses {
+		if s.State.Terminated != nil {
+			continue
+		}
+		if s.State.Running != nil {
+			return "fetching the linux headers"
+		}
+		return fmt.Sprintf("pulling image %s and starting the linux headers fetcher", s.Image)
+	}
+
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.State.Running != nil {
+			return "compiling and attaching the program"
+		}
+		if s.State.Waiting != nil {
+			return fmt.Sprintf("pulling image %s and starting the tracerunner", s.Image)
+		}
+	}
+
+	return fmt.Sprintf("waiting for the trace job pod to start, pod is %s", pod.Status.Phase)
+}
+
+// progress prints the startup phases of the trace job pod as they change.
+type progress struct {
+	last string
+}
+
+func (p *progress) update(a *Attacher, errOut io.Writer, pod *corev1.Pod) {
+	if a.quiet {
+		return
+	}
+	phase := startupPhase(pod)
+	if phase == p.last {
+		return
+	}
+	p.last = phase
+	fmt.Fprintln(errOut, color.Sprint(errOut, color.Cyan, phase+"..."))
+}
@@ -0,0 +1,64 @@
+package attacher
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestStartupPhase(t *testing.T) {
+	scheduled := []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	terminated := corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want string
+	}{
+		{
+			name: "no pod yet",
+			want: "waiting for the trace job pod to be created",
+		},
+		{
+			name: "not scheduled",
+			pod:  &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			want: "waiting for the trace job pod to be scheduled",
+		},
+		{
+			name: "init container running",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Conditions:            scheduled,
+				InitContainerStatuses: []corev1.ContainerStatus{{Image: "init", State: running}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Image: "bpftrace", State: waiting}},
+			}},
+			want: "fetching the linux headers",
+		},
+		{
+			name: "tracerunner waiting",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Conditions:            scheduled,
+				InitContainerStatuses: []corev1.ContainerStatus{{Image: "init", State: terminated}},
+				ContainerStatuses:     []corev1.ContainerStatus{{Image: "bpftrace", State: waiting}},
+			}},
+			want: "pulling image bpftrace and starting the tracerunner",
+		},
+		{
+			name: "tracerunner running",
+			pod: &corev1.Pod{Status: corev1.PodStatus{
+				Conditions:        scheduled,
+				ContainerStatuses: []corev1.ContainerStatus{{Image: "bpftrace", State: running}},
+			}},
+			want: "compiling and attaching the program",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := startupPhase(tt.pod); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
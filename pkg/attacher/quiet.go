@@ -0,0 +1,106 @@
+package attacher
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+)
+
+// bannerLines match the lines written around the program output by the trace runner and by bpftrace.
+var bannerLines = []*regexp.Regexp{
+	regexp.MustCompile(regexp.QuoteMeta(meta.RunnerUsageMessage)),
+	regexp.MustCompile(regexp.QuoteMeta(meta.RunnerFirstSIGINTMessage)),
+	regexp.MustCompile(regexp.QuoteMeta(meta.RunnerSIGTERMMessage)),
+	regexp.MustCompile(`Attaching \d+ probes?\.\.\.`),
+}
+
+// maxBannerLength bounds the output held back while it can still be a banner line.
+const maxBannerLength = 256
+
+// bannerFilter drops the banner lines from the output of a trace.
+// The start of a line is only held back while it can still be a banner,
+// so that the output of the program is not delayed.
+type bannerFilter struct {
+	out     io.Writer
+	line    []byte
+	passing bool
+}
+
+func newBannerFilter(out io.Writer) *bannerFilter {
+	return &bannerFilter{out: out}
+}
+
+func (f *bannerFilter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if f.passing {
+			if i < 0 {
+				_, err := f.out.Write(p)
+				return n, err
+			}
+			if _, err := f.out.Write(p[:i+1]); err != nil {
+				return 0, err
+			}
+			f.passing = false
+			p = p[i+1:]
+			continue
+		}
+
+		if i < 0 {
+			f.line = append(f.line, p...)
+			if !mayBeBanner(f.line) {
+				f.passing = true
+				return n, f.Flush()
+			}
+			return n, nil
+		}
+		f.line = append(f.line, p[:i+1]...)
+		p = p[i+1:]
+		if isBanner(f.line) {
+			f.line = f.line[:0]
+			continue
+		}
+		if err := f.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the output held back.
+func (f *bannerFilter) Flush() error {
+	if len(f.line) == 0 {
+		return nil
+	}
+	_, err := f.out.Write(f.line)
+	f.line = f.line[:0]
+	return err
+}
+
+func isBanner(line []byte) bool {
+	l := strings.TrimRight(string(line), "\r\n")
+	for _, re := range bannerLines {
+		if re.FindString(l) == l && len(l) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func mayBeBanner(start []byte) bool {
+	if len(start) >= maxBannerLength {
+		return false
+	}
+	s := string(start)
+	for _, re := range bannerLines {
+		prefix, _ := re.LiteralPrefix()
+		if strings.HasPrefix(prefix, s) || strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package attacher
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+)
+
+func TestBannerFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "banners in one write",
+			writes: []string{meta.RunnerUsageMessage + "\r\nAttaching 1 probe...\r\n@: 42\r\n"},
+			want:   "@: 42\r\n",
+		},
+		{
+			name:   "banner split across writes",
+			writes: []string{"if your program", " has maps to print, send a SIGINT using Ctrl-C, if you want to interrupt the execution send SIGINT two times\n", "hello\n"},
+			want:   "hello\n",
+		},
+		{
+			name:   "first SIGINT message",
+			writes: []string{"^C\r\n", meta.RunnerFirstSIGINTMessage + "\r\n", "@reads: 3\r\n"},
+			want:   "^C\r\n@reads: 3\r\n",
+		},
+		{
+			name:   "output that is not a banner is not held back",
+			writes: []string{"Attaching to ", "the kernel"},
+			want:   "Attaching to the kernel",
+		},
+		{
+			name:   "line starting like a banner",
+			writes: []string{"Attaching 3 probes... done\n"},
+			want:   "Attaching 3 probes... done\n",
+		},
+		{
+			name:   "empty lines",
+			writes: []string{"\n\r\n"},
+			want:   "\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			f := newBannerFilter(&b)
+			for _, w := range tt.writes {
+				if n, err := f.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("write returned %d, %v", n, err)
+				}
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
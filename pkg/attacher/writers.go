@@ -0,0 +1,134 @@
+package attacher
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// PrefixWriter writes each line written to it to an underlying writer, prefixed,
+// so that the output of several trace jobs attached at once can be told apart.
+// Each line is written with a single Write, the underlying writer only has to be synchronized.
+type PrefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	line   []byte
+}
+
+// NewPrefixWriter provides a PrefixWriter writing to out.
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+// Write writes the complete lines of p, the last one is kept until it is complete.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.line = append(w.line, p...)
+			break
+		}
+		w.line = append(w.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := w.Flush(); err != nil {
+			return n - len(p), err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the incomplete line kept, if any.
+func (w *PrefixWriter) Flush() error {
+	if len(w.line) == 0 {
+		return nil
+	}
+	b := make([]byte, 0, len(w.prefix)+len(w.line))
+	b = append(append(b, w.prefix...), w.line...)
+	w.line = w.line[:0]
+	_, err := w.out.Write(b)
+	return err
+}
+
+// SyncWriter serializes the writes to an underlying writer shared by several attached trace jobs.
+type SyncWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewSyncWriter provides a SyncWriter writing to out.
+func NewSyncWriter(out io.Writer) *SyncWriter {
+	return &SyncWriter{out: out}
+}
+
+func (w *SyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// RotatingFile is a file receiving the output of attached trace jobs, rotated when it reaches a maximum size.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+// OpenRotatingFile opens the file at path to append to it. When maxSize is positive the file is rotated
+// before a write makes it larger than maxSize: it is renamed to path.1, the previous path.1 to path.2 and so on,
+// keeping at most backups previous files.
+func OpenRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, backups: backups}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.f, r.size = f, fi.Size()
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	return r.f.Close()
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	for i := r.backups; i > 0; i-- {
+		from := r.path
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", r.path, i-1)
+		}
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.f, r.size = f, 0
+	return nil
+}
@@ -0,0 +1,93 @@
+package attacher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		flush  bool
+		want   string
+	}{
+		{
+			name:   "complete lines",
+			writes: []string{"one\ntwo\n"},
+			want:   "[a] one\n[a] two\n",
+		},
+		{
+			name:   "line split across writes",
+			writes: []string{"o", "ne\r\nt", "wo\n"},
+			want:   "[a] one\r\n[a] two\n",
+		},
+		{
+			name:   "incomplete line kept",
+			writes: []string{"one\ntw"},
+			want:   "[a] one\n",
+		},
+		{
+			name:   "incomplete line flushed",
+			writes: []string{"one\ntw"},
+			flush:  true,
+			want:   "[a] one\n[a] tw",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			w := NewPrefixWriter(out, "[a] ")
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+			if tt.flush {
+				w.Flush()
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-trace-log-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trace.out")
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := r.Write([]byte(w)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	r.Close()
+
+	want := map[string]string{
+		path:        "six\n",
+		path + ".1": "four\nfive\n",
+		path + ".2": "three\n",
+	}
+	for p, content := range want {
+		b, err := ioutil.ReadFile(p)
+		if err != nil || string(b) != content {
+			t.Errorf("%s = %q, %v, want %q", p, b, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 backups kept")
+	}
+}
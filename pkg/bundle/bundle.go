@@ -0,0 +1,353 @@
+// Package bundle reads and writes the bundles exported from traces, holding what is needed to run a trace again
+// exactly as it was: its program, its spec with the digests of its images, its target and the node it ran on.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FormatVersion is the version of the bundle format written by Write, the bundles of later versions cannot be read.
+const FormatVersion = 1
+
+// The files of a bundle.
+const (
+	// ManifestFile is the JSON description of the trace, Bundle without its program and job.
+	ManifestFile = "bundle.json"
+	// ProgramFile is the bpftrace program of the trace.
+	ProgramFile = "program.bt"
+	// BinaryFile is the binary run by the trace instead of a bpftrace program.
+	BinaryFile = "program"
+	// JobFile is the job of the trace as it was in the cluster, for reference.
+	JobFile = "job.yaml"
+)
+
+// Bundle is an exported trace.
+type Bundle struct {
+	FormatVersion int `json:"formatVersion"`
+	// KubectlTrace is the git commit of the kubectl trace that exported the bundle.
+	KubectlTrace string    `json:"kubectlTrace,omitempty"`
+	ExportedAt   time.Time `json:"exportedAt"`
+	TraceID      types.UID `json:"traceID"`
+	TraceName    string    `json:"traceName"`
+	Namespace    string    `json:"namespace"`
+	Target       Target    `json:"target"`
+	Spec         Spec      `json:"spec"`
+	// Images are the images the containers of the trace ran, with their digests when the pod of the trace was found.
+	Images []Image `json:"images,omitempty"`
+	// Node is the node the trace ran on, nil when it could not be read.
+	Node *Node `json:"node,omitempty"`
+
+	Program string       `json:"-"`
+	Binary  []byte       `json:"-"`
+	Job     *batchv1.Job `json:"-"`
+}
+
+// Target is what the trace ran against.
+type Target struct {
+	// Node is the hostname of the node.
+	Node string `json:"node"`
+	// Pod is the name of the traced pod, empty when tracing the node or when the pod was gone.
+	Pod       string `json:"pod,omitempty"`
+	PodUID    string `json:"podUID,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+// Spec is how the trace ran.
+type Spec struct {
+	ServiceAccount string `json:"serviceAccount"`
+	RuntimeClass   string `json:"runtimeClass,omitempty"`
+	// HostPID is unset in the bundles exported before it could be turned off.
+	HostPID     *bool `json:"hostPID,omitempty"`
+	HostNetwork bool  `json:"hostNetwork,omitempty"`
+	// HostAliases and DNSConfig are the additions to the name resolution of the pod of the trace.
+	HostAliases []corev1.HostAlias   `json:"hostAliases,omitempty"`
+	DNSConfig   *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+	// Proxy is unset in the bundles exported before it was recorded.
+	Proxy *Proxy `json:"proxy,omitempty"`
+	// CABundle is unset in the bundles exported before it was recorded.
+	CABundle *CABundle `json:"caBundle,omitempty"`
+	// Image is the tracerunner image, pinned to its digest when it was resolved.
+	Image string `json:"image"`
+	// InitImage is the image fetching the linux headers, pinned to its digest when it was resolved.
+	InitImage           string                       `json:"initImage,omitempty"`
+	FetchHeaders        bool                         `json:"fetchHeaders,omitempty"`
+	Deadline            int64                        `json:"deadline"`
+	DeadlineGracePeriod int64                        `json:"deadlineGracePeriod"`
+	Unsafe              bool                         `json:"unsafe,omitempty"`
+	MapKeysMax          int64                        `json:"mapKeysMax,omitempty"`
+	Strlen              int64                        `json:"strlen,omitempty"`
+	PerfRBPages         int64                        `json:"perfRBPages,omitempty"`
+	CatBytesMax         int64                        `json:"catBytesMax,omitempty"`
+	Buffering           string                       `json:"buffering,omitempty"`
+	TracerFlags         string                       `json:"tracerFlags,omitempty"`
+	SnapshotInterval    string                       `json:"snapshotInterval,omitempty"`
+	OnlyTarget          bool                         `json:"onlyTarget,omitempty"`
+	MaxOutput           int64                        `json:"maxOutput,omitempty"`
+	Resources           *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// AvoidPods is the label selector of the pods the trace kept away from, empty when it did not.
+	AvoidPods string `json:"avoidPods,omitempty"`
+}
+
+// Proxy is the proxy the pod of the trace reached the network through, none when its URLs are empty.
+type Proxy struct {
+	HTTP    string `json:"http,omitempty"`
+	HTTPS   string `json:"https,omitempty"`
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+// CABundle is the configmap and its key holding the CA certificates trusted by the pod of the trace, the ones of
+// its images when the configmap is empty.
+type CABundle struct {
+	ConfigMap string `json:"configMap,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// Image is the image a container of the trace ran.
+type Image struct {
+	Container string `json:"container"`
+	// Image is the image as set in the job.
+	Image string `json:"image"`
+	// Digest is the digest of the image pulled on the node, empty when unknown.
+	Digest string `json:"digest,omitempty"`
+}
+
+// Pinned is the image pinned to its digest, the image as set in the job when the digest is unknown.
+func (i Image) Pinned() string {
+	if len(i.Digest) == 0 || strings.Contains(i.Image, "@") {
+		return i.Image
+	}
+	name := i.Image
+	if j := strings.LastIndex(name, ":"); j > strings.LastIndex(name, "/") {
+		name = name[:j]
+	}
+	return name + "@" + i.Digest
+}
+
+// NewImage describes the image of a container from its status, whose image ID holds the digest of the image as
+// pulled by the container runtime, like docker-pullable://quay.io/iovisor/kubectl-trace-bpftrace@sha256:...
+func NewImage(container, image, imageID string) Image {
+	i := Image{Container: container, Image: image}
+	if j := strings.LastIndex(imageID, "@"); j >= 0 {
+		i.Digest = imageID[j+1:]
+	}
+	return i
+}
+
+// Node is the node the trace ran on.
+type Node struct {
+	Name             string `json:"name"`
+	KernelVersion    string `json:"kernelVersion"`
+	OSImage          string `json:"osImage"`
+	Architecture     string `json:"architecture"`
+	ContainerRuntime string `json:"containerRuntime"`
+	Kubelet          string `json:"kubelet"`
+}
+
+// NewNode describes the node.
+func NewNode(n *corev1.Node) *Node {
+	info := n.Status.NodeInfo
+	return &Node{
+		Name:             n.Name,
+		KernelVersion:    info.KernelVersion,
+		OSImage:          info.OSImage,
+		Architecture:     info.Architecture,
+		ContainerRuntime: info.ContainerRuntimeVersion,
+		Kubelet:          info.KubeletVersion,
+	}
+}
+
+// New starts the bundle of the trace job, its images pinned to the digests of images once they are added.
+func New(tj tracejob.TraceJob, job *batchv1.Job) *Bundle {
+	b := &Bundle{
+		FormatVersion: FormatVersion,
+		TraceID:       tj.ID,
+		TraceName:     tj.Name,
+		Namespace:     tj.Namespace,
+		Target: Target{
+			Node:      tj.Hostname,
+			PodUID:    tj.PodUID,
+			Container: tj.ContainerName,
+		},
+		Spec: Spec{
+			ServiceAccount:      tj.ServiceAccount,
+			RuntimeClass:        tj.RuntimeClass,
+			HostPID:             &tj.HostPID,
+			HostNetwork:         tj.HostNetwork,
+			HostAliases:         tj.HostAliases,
+			DNSConfig:           tj.DNSConfig,
+			Proxy:               &Proxy{HTTP: tj.Proxy.HTTP, HTTPS: tj.Proxy.HTTPS, NoProxy: tj.Proxy.NoProxy},
+			CABundle:            &CABundle{ConfigMap: tj.CABundle.ConfigMap, Key: tj.CABundle.Key},
+			Image:               tj.ImageNameTag,
+			InitImage:           tj.InitImageNameTag,
+			FetchHeaders:        tj.FetchHeaders,
+			Deadline:            tj.Deadline,
+			DeadlineGracePeriod: tj.DeadlineGracePeriod,
+			Unsafe:              tj.Unsafe,
+			MapKeysMax:          tj.Tunables.MapKeysMax,
+			Strlen:              tj.Tunables.Strlen,
+			PerfRBPages:         tj.Tunables.PerfRBPages,
+			CatBytesMax:         tj.Tunables.CatBytesMax,
+			Buffering:           tj.Buffering,
+			TracerFlags:         tj.TracerFlags,
+			OnlyTarget:          tj.OnlyTarget,
+			MaxOutput:           tj.MaxOutput,
+			Resources:           tj.Resources,
+		},
+		Program: tj.Program,
+		Binary:  tj.Binary,
+		Job:     job,
+	}
+	if tj.SnapshotInterval > 0 {
+		b.Spec.SnapshotInterval = tj.SnapshotInterval.String()
+	}
+	if tj.AvoidPods != nil {
+		b.Spec.AvoidPods = metav1.FormatLabelSelector(tj.AvoidPods.LabelSelector)
+	}
+	return b
+}
+
+// AddImage records the image of a container of the trace, pinning the image of the spec it is to its digest.
+func (b *Bundle) AddImage(i Image) {
+	b.Images = append(b.Images, i)
+	switch i.Image {
+	case b.Spec.Image:
+		b.Spec.Image = i.Pinned()
+	case b.Spec.InitImage:
+		b.Spec.InitImage = i.Pinned()
+	}
+}
+
+// Tunables are the limits of bpftrace of the spec.
+func (s Spec) Tunables() tracejob.Tunables {
+	return tracejob.Tunables{
+		MapKeysMax:  s.MapKeysMax,
+		Strlen:      s.Strlen,
+		PerfRBPages: s.PerfRBPages,
+		CatBytesMax: s.CatBytesMax,
+	}
+}
+
+// TraceProxy is the proxy of the spec, nil when the bundle does not tell.
+func (s Spec) TraceProxy() *tracejob.Proxy {
+	if s.Proxy == nil {
+		return nil
+	}
+	return &tracejob.Proxy{HTTP: s.Proxy.HTTP, HTTPS: s.Proxy.HTTPS, NoProxy: s.Proxy.NoProxy}
+}
+
+// file is a file of a bundle.
+type file struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// Write writes the bundle as a gzipped tarball.
+func Write(w io.Writer, b *Bundle) error {
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []file{
+		{ManifestFile, 0644, append(manifest, '\n')},
+	}
+	if len(b.Binary) > 0 {
+		files = append(files, file{BinaryFile, 0755, b.Binary})
+	} else {
+		files = append(files, file{ProgramFile, 0644, []byte(b.Program)})
+	}
+	if b.Job != nil {
+		job, err := yaml.Marshal(b.Job)
+		if err != nil {
+			return err
+		}
+		files = append(files, file{JobFile, 0644, job})
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     f.name,
+			Mode:     f.mode,
+			Size:     int64(len(f.data)),
+			ModTime:  b.ExportedAt,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// Read reads a bundle written by Write.
+func Read(r io.Reader) (*Bundle, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a bundle: %v", err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a bundle: %v", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+
+	manifest, ok := files[ManifestFile]
+	if !ok {
+		return nil, fmt.Errorf("not a bundle: no %s", ManifestFile)
+	}
+	b := &Bundle{}
+	if err := json.Unmarshal(manifest, b); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ManifestFile, err)
+	}
+	if b.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("the bundle has the format version %d, this kubectl trace reads up to %d", b.FormatVersion, FormatVersion)
+	}
+	if binary, ok := files[BinaryFile]; ok {
+		b.Binary = binary
+	} else if program, ok := files[ProgramFile]; ok {
+		b.Program = string(program)
+	} else {
+		return nil, fmt.Errorf("not a bundle: no %s or %s", ProgramFile, BinaryFile)
+	}
+	if job, ok := files[JobFile]; ok {
+		b.Job = &batchv1.Job{}
+		if err := yaml.Unmarshal(bytes.TrimSpace(job), b.Job); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", JobFile, err)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,144 @@
+package bundle
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		imageID    string
+		wantPinned string
+	}{
+		{
+			image:      "quay.io/iovisor/kubectl-trace-bpftrace:latest",
+			imageID:    "docker-pullable://quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123",
+			wantPinned: "quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123",
+		},
+		{
+			image:      "localhost:5000/bpftrace",
+			imageID:    "localhost:5000/bpftrace@sha256:0123",
+			wantPinned: "localhost:5000/bpftrace@sha256:0123",
+		},
+		{
+			image:      "quay.io/iovisor/kubectl-trace-bpftrace:latest",
+			imageID:    "sha256:4567",
+			wantPinned: "quay.io/iovisor/kubectl-trace-bpftrace:latest",
+		},
+		{
+			image:      "quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123",
+			imageID:    "quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123",
+			wantPinned: "quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.imageID, func(t *testing.T) {
+			if got := NewImage("trace", tt.image, tt.imageID).Pinned(); got != tt.wantPinned {
+				t.Errorf("got %s, want %s", got, tt.wantPinned)
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	tj := tracejob.TraceJob{
+		Name:                "kubectl-trace-1",
+		ID:                  "1",
+		Namespace:           "default",
+		ServiceAccount:      "default",
+		Hostname:            "node-1",
+		Program:             "kprobe:do_sys_open { @ = count(); }",
+		PodUID:              "uid-1",
+		ContainerName:       "nginx",
+		IsPod:               true,
+		ImageNameTag:        "quay.io/iovisor/kubectl-trace-bpftrace:latest",
+		Deadline:            60,
+		DeadlineGracePeriod: 10,
+		Tunables:            tracejob.Tunables{Strlen: 200},
+		SnapshotInterval:    time.Minute,
+		HostAliases:         []corev1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"headers.internal"}}},
+		DNSConfig:           &corev1.PodDNSConfig{Searches: []string{"corp.internal"}},
+		Proxy:               tracejob.Proxy{HTTP: "http://proxy.internal:3128", NoProxy: "10.0.0.0/8"},
+		CABundle:            tracejob.CABundle{ConfigMap: "corp-ca", Key: "ca.crt"},
+		AvoidPods: &corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "latency-critical"}},
+			Namespaces:    []string{"default"},
+		},
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "kubectl-trace-1", Namespace: "default"}}
+	b := New(tj, job)
+	b.ExportedAt = time.Date(2019, 1, 2, 22, 0, 0, 0, time.UTC)
+	b.Target.Pod = "nginx-1"
+	b.AddImage(NewImage("kubectl-trace-1", tj.ImageNameTag, "docker-pullable://quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123"))
+	if b.Spec.Image != "quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123" {
+		t.Errorf("the image of the spec is not pinned: %s", b.Spec.Image)
+	}
+	if b.Spec.AvoidPods != "tier=latency-critical" {
+		t.Errorf("got avoided pods %q, want their selector", b.Spec.AvoidPods)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ExportedAt.Equal(b.ExportedAt) {
+		t.Errorf("got exported at %s, want %s", got.ExportedAt, b.ExportedAt)
+	}
+	got.ExportedAt = b.ExportedAt
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("got %+v, want %+v", got, b)
+	}
+	if *got.Spec.TraceProxy() != tj.Proxy {
+		t.Errorf("got proxy %+v, want %+v", *got.Spec.TraceProxy(), tj.Proxy)
+	}
+	if got.Spec.Tunables() != tj.Tunables {
+		t.Errorf("got tunables %+v, want %+v", got.Spec.Tunables(), tj.Tunables)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	newer := New(tracejob.TraceJob{Program: "BEGIN { exit(); }"}, nil)
+	newer.FormatVersion = FormatVersion + 1
+	var buf bytes.Buffer
+	if err := Write(&buf, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{
+			name:    "not gzipped",
+			data:    []byte("BEGIN { exit(); }"),
+			wantErr: "not a bundle",
+		},
+		{
+			name:    "newer format",
+			data:    buf.Bytes(),
+			wantErr: "format version 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,9 +3,13 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
 	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
 	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
@@ -18,7 +22,7 @@ import (
 )
 
 var (
-	attachShort = `Attach to an existing trace` // Wrap with i18n.T()
+	attachShort = `Attach to an existing trace`
 	attachLong  = attachShort
 
 	attachExamples = `
@@ -30,35 +34,61 @@ var (
 
 	# Attach to a trace in a namespace using its name
 	%[1]s trace attach kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1 -n mynamespace
+
+	# Attach to a trace printing only the output of the program
+	%[1]s trace attach 5594d7e1-0b78-11e9-b7f1-40a3cc632df1 --quiet
+
+	# Attach to a trace writing its output to a file as well
+	%[1]s trace attach 5594d7e1-0b78-11e9-b7f1-40a3cc632df1 --log-file trace.out
+
+	# Attach to a trace recording its output with its timing, to play it back later
+	%[1]s trace attach 5594d7e1-0b78-11e9-b7f1-40a3cc632df1 --record session.cast
+
+	# Attach to a node trace annotating the PIDs it prints with their pods
+	%[1]s trace attach 5594d7e1-0b78-11e9-b7f1-40a3cc632df1 --resolve-pids
 `
 )
 
 // AttachOptions ...
 type AttachOptions struct {
 	genericclioptions.IOStreams
-	traceID      *types.UID
-	traceName    *string
-	namespace    string
-	clientConfig *rest.Config
+	traceID         *types.UID
+	traceName       *string
+	namespace       string
+	quiet           bool
+	logFile         logFileOptions
+	record          recordOptions
+	redact          redactOptions
+	config          *config.Config
+	deadlineWarning time.Duration
+	resolvePIDs     bool
+	clientConfig    *rest.Config
+
+	// traceJobClient and attacher replace the clients talking to the cluster when set, for tests.
+	traceJobClient tracejob.Interface
+	attacher       attacher.Interface
 }
 
 // NewAttachOptions provides an instance of AttachOptions with default values.
 func NewAttachOptions(streams genericclioptions.IOStreams) *AttachOptions {
 	return &AttachOptions{
-		IOStreams: streams,
+		IOStreams:       streams,
+		deadlineWarning: attacher.DefaultDeadlineWarning,
 	}
 }
 
 // NewAttachCommand provides the attach command wrapping AttachOptions.
-func NewAttachCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+func NewAttachCommand(factory factory.Factory, cfg *config.Config, streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewAttachOptions(streams)
+	o.config = cfg
 
 	cmd := &cobra.Command{
 		Use:                   "attach (TRACE_ID | TRACE_NAME)",
 		DisableFlagsInUseLine: true,
-		Short:                 attachShort,
-		Long:                  attachLong,                             // Wrap with templates.LongDesc()
-		Example:               fmt.Sprintf(attachExamples, "kubectl"), // Wrap with templates.Examples()
+		Short:                 i18n.T(attachShort),
+		Long:                  i18n.T(attachLong),                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(i18n.T(attachExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage:          true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
 		},
@@ -66,14 +96,17 @@ func NewAttachCommand(factory factory.Factory, streams genericclioptions.IOStrea
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
-				fmt.Fprintln(o.ErrOut, err.Error())
-				return nil
-			}
-			return nil
+			return o.Run()
 		},
 	}
 
+	cmd.Flags().BoolVarP(&o.quiet, "quiet", "q", o.quiet, "Only print the output of the program, without the messages of the trace runner")
+	o.logFile.addFlags(cmd)
+	o.record.addFlags(cmd)
+	o.redact.addFlags(cmd)
+	cmd.Flags().DurationVar(&o.deadlineWarning, "deadline-warning", o.deadlineWarning, "Warn this long before the deadline of the trace, and when its grace period begins, never when 0")
+	cmd.Flags().BoolVar(&o.resolvePIDs, "resolve-pids", o.resolvePIDs, "Annotate the PIDs printed by the program, like \"pid 4242\", with the namespace, pod and container running them")
+
 	return cmd
 }
 
@@ -109,22 +142,30 @@ func (o *AttachOptions) Complete(factory factory.Factory, cmd *cobra.Command, ar
 		return err
 	}
 
-	return nil
+	return o.redact.complete(o.config)
 }
 
 func (o *AttachOptions) Run() error {
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	ctx := signals.WithStandardSignals(context.Background())
+	streams, logFile, err := o.logFile.tee(o.IOStreams)
 	if err != nil {
 		return err
 	}
-
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	defer logFile.Close()
+	title := "trace "
+	if o.traceID != nil {
+		title += string(*o.traceID)
+	} else {
+		title += *o.traceName
+	}
+	streams, session, err := o.record.record(streams, title)
 	if err != nil {
 		return err
 	}
-
-	tc := &tracejob.TraceJobClient{
-		JobClient: jobsClient.Jobs(o.namespace),
+	defer session.Close()
+	tc, a, err := o.clients(ctx, streams)
+	if err != nil {
+		return err
 	}
 
 	tf := tracejob.TraceJobFilter{
@@ -132,22 +173,45 @@ func (o *AttachOptions) Run() error {
 		ID:   o.traceID,
 	}
 
-	jobs, err := tc.GetJob(tf)
+	jobs, err := tc.GetJob(ctx, tf)
 
 	if err != nil {
 		return err
 	}
 
 	if len(jobs) == 0 {
-		return fmt.Errorf("no trace found with the provided criterias")
+		return errdefs.Errorf(errdefs.ErrTraceNotFound, "no trace found with the provided criterias")
 	}
 
 	job := jobs[0]
+	return a.AttachJob(job.ID, job.Namespace)
+}
+
+// clients returns the clients set for tests, or the ones talking to the cluster.
+func (o *AttachOptions) clients(ctx context.Context, streams genericclioptions.IOStreams) (tracejob.Interface, attacher.Interface, error) {
+	if o.traceJobClient != nil && o.attacher != nil {
+		return o.traceJobClient, o.attacher, nil
+	}
+
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
 
-	ctx := context.Background()
-	ctx = signals.WithStandardSignals(ctx)
-	a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
+	a := attacher.NewAttacher(coreClient, o.clientConfig, streams)
 	a.WithContext(ctx)
-	a.AttachJob(job.ID, job.Namespace)
-	return nil
+	a.WithQuiet(o.quiet)
+	a.WithDeadlineWarning(o.deadlineWarning)
+	a.WithResolvePIDs(o.resolvePIDs)
+	a.WithRedact(o.redact.res)
+	return tc, a, nil
 }
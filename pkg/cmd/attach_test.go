@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/tracetest"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestAttachRun(t *testing.T) {
+	name := "kubectl-trace-1"
+	missing := "kubectl-trace-2"
+	jobs := []tracejob.TraceJob{{Name: name, ID: "1", Namespace: "default"}}
+
+	tests := []struct {
+		name      string
+		traceName *string
+		attachErr error
+		wantErr   error
+		wantOut   string
+	}{
+		{
+			name:      "attached",
+			traceName: &name,
+			wantOut:   "@[sshd]: 1\n",
+		},
+		{
+			name:      "trace not found",
+			traceName: &missing,
+			wantErr:   errdefs.ErrTraceNotFound,
+		},
+		{
+			name:      "attach failure",
+			traceName: &name,
+			attachErr: errdefs.Errorf(errdefs.ErrAttachFailed, "timed out"),
+			wantErr:   errdefs.ErrAttachFailed,
+			wantOut:   "@[sshd]: 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams, _, out, _ := genericclioptions.NewTestIOStreams()
+			a := tracetest.NewAttacher(out, "@[sshd]: 1\n")
+			a.Err = tt.attachErr
+			o := NewAttachOptions(streams)
+			o.traceName = tt.traceName
+			o.traceJobClient = tracetest.NewTraceJobClient(jobs...)
+			o.attacher = a
+
+			err := o.Run()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if out.String() != tt.wantOut {
+				t.Errorf("Run() output = %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
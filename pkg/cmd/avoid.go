@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// completeAvoidPods looks up the pods selected by --avoid-pods in all the namespaces, whose namespaces the
+// anti-affinity of the trace job covers, and fails when one of them runs on the node of the trace.
+func (o *RunOptions) completeAvoidPods() error {
+	client, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	pl, err := client.Pods("").List(metav1.ListOptions{LabelSelector: o.avoidPodsArg})
+	if err != nil {
+		return fmt.Errorf("cannot list the pods avoided by --avoid-pods: %v", err)
+	}
+	o.avoidPodsNamespaces, err = avoidedPods(pl.Items, o.nodeName)
+	return err
+}
+
+// avoidedPods returns the namespaces of the pods still running, and fails when some of them run on the node.
+func avoidedPods(pods []v1.Pod, node string) ([]string, error) {
+	namespaces := map[string]bool{}
+	var onNode []string
+	for _, p := range pods {
+		if p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		namespaces[p.Namespace] = true
+		if len(node) > 0 && p.Spec.NodeName == node {
+			onNode = append(onNode, p.Namespace+"/"+p.Name)
+		}
+	}
+	if len(onNode) > 0 {
+		sort.Strings(onNode)
+		return nil, errdefs.Errorf(errdefs.ErrSchedulingFailed, "node %s runs pods avoided by --avoid-pods: %s", node, strings.Join(onNode, ", "))
+	}
+	list := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		list = append(list, ns)
+	}
+	sort.Strings(list)
+	return list, nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func avoidedPod(namespace, name, node string, phase v1.PodPhase) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.PodSpec{NodeName: node},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+func TestAvoidedPods(t *testing.T) {
+	tests := []struct {
+		name    string
+		pods    []v1.Pod
+		node    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "no pods",
+			node: "node-1",
+			want: []string{},
+		},
+		{
+			name: "other nodes",
+			pods: []v1.Pod{
+				avoidedPod("payments", "db-0", "node-2", v1.PodRunning),
+				avoidedPod("search", "index-0", "node-3", v1.PodRunning),
+				avoidedPod("payments", "db-1", "node-3", v1.PodRunning),
+			},
+			node: "node-1",
+			want: []string{"payments", "search"},
+		},
+		{
+			name: "completed pod on the node",
+			pods: []v1.Pod{avoidedPod("batch", "report-1", "node-1", v1.PodSucceeded)},
+			node: "node-1",
+			want: []string{},
+		},
+		{
+			name: "running on the node",
+			pods: []v1.Pod{
+				avoidedPod("search", "index-0", "node-1", v1.PodRunning),
+				avoidedPod("payments", "db-0", "node-1", v1.PodPending),
+			},
+			node:    "node-1",
+			wantErr: "node node-1 runs pods avoided by --avoid-pods: payments/db-0, search/index-0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := avoidedPods(tt.pods, tt.node)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("avoidedPods() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("avoidedPods() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("avoidedPods() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// cgroupRoots are where the cgroup v2 hierarchy is mounted, on the hosts mounting both versions and on the others.
+var cgroupRoots = []string{"/sys/fs/cgroup/unified", "/sys/fs/cgroup"}
+
+// containerCgroupPath returns the path of the cgroup v2 of the process, in the /sys of the host mounted in the trace
+// runner, that bpftrace turns into the ID compared with its cgroup builtin with cgroupid().
+func containerCgroupPath(pid string) (string, error) {
+	b, err := ioutil.ReadFile(path.Join("/proc", pid, "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	p, err := parseCgroupV2Path(string(b))
+	if err != nil {
+		return "", err
+	}
+	for _, root := range cgroupRoots {
+		if _, err := os.Stat(path.Join(root, "cgroup.controllers")); err == nil {
+			return path.Join(root, p), nil
+		}
+	}
+	return "", fmt.Errorf("the cgroup v2 hierarchy is not mounted in %s", strings.Join(cgroupRoots, " or "))
+}
+
+// parseCgroupV2Path returns the path of the cgroup v2 in the content of a /proc/<pid>/cgroup file,
+// the line of the hierarchy with ID 0 and no controllers.
+func parseCgroupV2Path(content string) (string, error) {
+	for _, l := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(l, "0::") {
+			continue
+		}
+		p := strings.TrimPrefix(l, "0::")
+		if p == "/" || len(p) == 0 {
+			return "", fmt.Errorf("the container has no cgroup of its own in the cgroup v2 hierarchy")
+		}
+		return p, nil
+	}
+	return "", fmt.Errorf("the container is not in the cgroup v2 hierarchy")
+}
+
+// restrictProbes adds the predicate to each probe of the bpftrace program, combined with the predicate of the probe
+// when it has one. The BEGIN, END and interval probes, which do not run in the context of the traced processes,
+// are left as they are, as well as the struct definitions.
+func restrictProbes(program, predicate string) (string, error) {
+	var b strings.Builder
+	depth := 0
+	header := -1
+	for i := 0; i < len(program); i++ {
+		c := program[i]
+		switch {
+		case strings.HasPrefix(program[i:], "//"):
+			end := strings.IndexByte(program[i:], '\n')
+			if end < 0 {
+				end = len(program) - i
+			}
+			if header < 0 {
+				b.WriteString(program[i : i+end])
+			}
+			i += end - 1
+			continue
+		case strings.HasPrefix(program[i:], "/*"):
+			end := strings.Index(program[i+2:], "*/")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			if header < 0 {
+				b.WriteString(program[i : i+end+4])
+			}
+			i += end + 3
+			continue
+		case c == '"':
+			end := i + 1
+			for ; end < len(program) && program[end] != '"'; end++ {
+				if program[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(program) {
+				return "", fmt.Errorf("unterminated string")
+			}
+			if header < 0 {
+				b.WriteString(program[i : end+1])
+			}
+			i = end
+			continue
+		}
+
+		if depth > 0 {
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		switch {
+		case c == '#' && header < 0:
+			// A preprocessor directive, up to the end of its line.
+			end := strings.IndexByte(program[i:], '\n')
+			if end < 0 {
+				end = len(program) - i
+			}
+			b.WriteString(program[i : i+end])
+			i += end - 1
+		case c == '{':
+			if header < 0 {
+				return "", fmt.Errorf("block without probe at offset %d", i)
+			}
+			b.WriteString(restrictHeader(program[header:i], predicate))
+			b.WriteByte(c)
+			header = -1
+			depth++
+		case c == '}':
+			return "", fmt.Errorf("unbalanced } at offset %d", i)
+		case header < 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';'):
+			b.WriteByte(c)
+		case header < 0:
+			header = i
+		}
+	}
+	if depth > 0 || header >= 0 {
+		return "", fmt.Errorf("unterminated probe")
+	}
+	return b.String(), nil
+}
+
+// restrictHeader adds the predicate to the header of a probe, its attach points and its own predicate if any.
+func restrictHeader(header, predicate string) string {
+	start := -1
+	for i := 1; i < len(header); i++ {
+		// The predicate is the first slash after a white space which does not follow a comma,
+		// the attach points like uprobe:/bin/bash:readline having none.
+		if header[i] == '/' && strings.ContainsAny(header[i-1:i], " \t\r\n") &&
+			!strings.HasSuffix(strings.TrimSpace(header[:i]), ",") {
+			start = i
+			break
+		}
+	}
+	points := header
+	if start >= 0 {
+		points = header[:start]
+	}
+	if strings.HasPrefix(points, "struct ") || !restrictable(points) {
+		return header
+	}
+	if start < 0 {
+		return strings.TrimRight(header, " \t\r\n") + " /" + predicate + "/ "
+	}
+	end := strings.LastIndexByte(header, '/')
+	if end <= start {
+		return header
+	}
+	return fmt.Sprintf("%s/(%s) && %s/%s", points, strings.TrimSpace(header[start+1:end]), predicate, header[end+1:])
+}
+
+// restrictable tells whether the attach points run in the context of processes, one of them at least.
+func restrictable(points string) bool {
+	for _, p := range strings.Split(points, ",") {
+		p = strings.TrimSpace(p)
+		if p != "BEGIN" && p != "END" && !strings.HasPrefix(p, "interval:") && !strings.HasPrefix(p, "i:") {
+			return true
+		}
+	}
+	return false
+}
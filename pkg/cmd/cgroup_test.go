@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseCgroupV2Path(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "hybrid",
+			content: "12:memory:/kubepods/pod6d2b4f0e/3f1b2a\n1:name=systemd:/kubepods/pod6d2b4f0e/3f1b2a\n0::/kubepods/pod6d2b4f0e/3f1b2a\n",
+			want:    "/kubepods/pod6d2b4f0e/3f1b2a",
+		},
+		{
+			name:    "unified",
+			content: "0::/kubepods.slice/kubepods-pod6d2b4f0e.slice/cri-containerd-3f1b2a.scope\n",
+			want:    "/kubepods.slice/kubepods-pod6d2b4f0e.slice/cri-containerd-3f1b2a.scope",
+		},
+		{
+			name:    "root",
+			content: "1:name=systemd:/kubepods/pod6d2b4f0e/3f1b2a\n0::/\n",
+			wantErr: true,
+		},
+		{
+			name:    "cgroup v1 only",
+			content: "12:memory:/kubepods/pod6d2b4f0e/3f1b2a\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCgroupV2Path(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCgroupV2Path() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCgroupV2Path() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestrictProbes(t *testing.T) {
+	const predicate = "cgroup == 42"
+	tests := []struct {
+		name    string
+		program string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "probe without predicate",
+			program: `kprobe:vfs_read { @[comm] = count(); }`,
+			want:    `kprobe:vfs_read /cgroup == 42/ { @[comm] = count(); }`,
+		},
+		{
+			name:    "probe with predicate",
+			program: "tracepoint:syscalls:sys_enter_openat /comm == \"nginx\"/\n{ printf(\"%s {\\n\", str(args->filename)); }\n",
+			want:    "tracepoint:syscalls:sys_enter_openat /(comm == \"nginx\") && cgroup == 42/\n{ printf(\"%s {\\n\", str(args->filename)); }\n",
+		},
+		{
+			name: "several attach points and probes",
+			program: `#include <linux/sched.h>
+// The reads of bash
+BEGIN { printf("tracing\n"); }
+uprobe:/bin/bash:readline,
+  uretprobe:/bin/bash:readline { if (pid > 1) { @[pid] = count(); } }
+interval:s:5 { print(@); clear(@); }
+`,
+			want: `#include <linux/sched.h>
+// The reads of bash
+BEGIN { printf("tracing\n"); }
+uprobe:/bin/bash:readline,
+  uretprobe:/bin/bash:readline /cgroup == 42/ { if (pid > 1) { @[pid] = count(); } }
+interval:s:5 { print(@); clear(@); }
+`,
+		},
+		{
+			name:    "struct definition",
+			program: "struct task { int pid; };\nkprobe:do_exit { @ = count(); }",
+			want:    "struct task { int pid; };\nkprobe:do_exit /cgroup == 42/ { @ = count(); }",
+		},
+		{
+			name:    "unbalanced braces",
+			program: `kprobe:vfs_read { @ = count();`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := restrictProbes(tt.program, predicate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restrictProbes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("restrictProbes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	cleanupShort = `Remove objects left behind by incomplete traces`
+	cleanupLong  = `Remove objects left behind by incomplete traces.
+
+Looks for kubectl-trace configmaps and pods whose job does not exist anymore,
+and for jobs whose program configmap does not exist anymore, and deletes them.
+
+With --interval, keeps looking for them at that interval until interrupted,
+to run as the garbage collector of the traces, like in a deployment.`
+
+	cleanupExamples = `
+  # Remove orphan trace objects in the current namespace
+  %[1]s trace cleanup
+
+  # Remove orphan trace objects in a specific namespace
+  %[1]s trace cleanup -n myns
+
+  # Remove orphan trace objects in all the namespaces
+  %[1]s trace cleanup --all-namespaces
+
+  # Remove orphan trace objects in all the namespaces every 10 minutes, until interrupted
+  %[1]s trace cleanup --all-namespaces --interval=10m`
+)
+
+// CleanupOptions ...
+type CleanupOptions struct {
+	genericclioptions.IOStreams
+	ResourceBuilderFlags *genericclioptions.ResourceBuilderFlags
+	namespace            string
+	clientConfig         *rest.Config
+	allNamespaces        bool
+	interval             time.Duration
+}
+
+// NewCleanupOptions provides an instance of CleanupOptions with default values.
+func NewCleanupOptions(streams genericclioptions.IOStreams) *CleanupOptions {
+	rbFlags := &genericclioptions.ResourceBuilderFlags{}
+	rbFlags.WithAllNamespaces(false)
+
+	return &CleanupOptions{
+		ResourceBuilderFlags: rbFlags,
+		IOStreams:            streams,
+	}
+}
+
+// NewCleanupCommand provides the cleanup command wrapping CleanupOptions.
+func NewCleanupCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewCleanupOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "cleanup",
+		Short:        i18n.T(cleanupShort),
+		Long:         i18n.T(cleanupLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(cleanupExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	o.ResourceBuilderFlags.AddFlags(cmd.Flags())
+	cmd.Flags().DurationVar(&o.interval, "interval", o.interval, "Keep removing the orphan objects at this interval until interrupted, instead of once")
+
+	return cmd
+}
+
+// Complete completes the setup of the command.
+func (o *CleanupOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flag("all-namespaces").Changed {
+		o.allNamespaces = *o.ResourceBuilderFlags.AllNamespaces
+		o.namespace = ""
+	}
+
+	if o.interval < 0 {
+		return fmt.Errorf("the interval must be positive, got %s", o.interval)
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *CleanupOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:    jobsClient.Jobs(o.namespace),
+		ConfigClient: coreClient.ConfigMaps(o.namespace),
+		PodClient:    coreClient.Pods(o.namespace),
+		// The orphans found in all the namespaces are deleted in their own.
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		ClusterPodClient:    coreClient,
+	}
+
+	tc.WithOutStream(o.Out)
+
+	ctx := signals.WithStandardSignals(context.Background())
+	if o.interval == 0 {
+		return tc.CleanupOrphans(ctx)
+	}
+	// As a garbage collector, a failed pass is reported and the next one tries again.
+	for {
+		if err := tc.CleanupOrphans(ctx); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(o.ErrOut, "error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(o.interval):
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	compareShort = `Run a program against two targets at the same time and compare their results`
+	compareLong  = `Run the same bpftrace program against two nodes or pods at the same time, for the same duration,
+then print the output of each trace followed by the differences of the values of their maps.
+
+The traces run until their deadline, when bpftrace prints the maps of the program.`
+
+	compareExamples = `
+  # Compare the syscalls of the pods of two revisions of a deployment for a minute
+  %[1]s trace compare pod/app-7d9f8c-x2x4z pod/app-5b6c4d-k8j2m -e 'tracepoint:raw_syscalls:sys_enter { @[comm] = count(); }'
+
+  # Compare the reads of two nodes for five minutes
+  %[1]s trace compare node/node-1 node/node-2 -f read.bt --deadline 300
+`
+)
+
+// defaultCompareDeadline is how long the compared traces run by default, in seconds.
+const defaultCompareDeadline = 60
+
+// CompareOptions ...
+type CompareOptions struct {
+	genericclioptions.IOStreams
+
+	eval                string
+	program             string
+	serviceAccount      string
+	imageName           string
+	initImageName       string
+	fetchHeaders        bool
+	deadline            int64
+	deadlineGracePeriod int64
+
+	resourceArgs []string
+	targets      []traceTarget
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewCompareOptions provides an instance of CompareOptions with default values.
+func NewCompareOptions(streams genericclioptions.IOStreams) *CompareOptions {
+	return &CompareOptions{
+		IOStreams: streams,
+
+		serviceAccount:      "default",
+		imageName:           ImageNameTag,
+		initImageName:       InitImageNameTag,
+		deadline:            defaultCompareDeadline,
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewCompareCommand provides the compare command wrapping CompareOptions.
+func NewCompareCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewCompareOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "compare TARGET_A TARGET_B (-e PROGRAM | -f FILENAME)",
+		Short:        i18n.T(compareShort),
+		Long:         i18n.T(compareLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(compareExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(2),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.eval, "eval", "e", o.eval, "Literal string to be evaluated as a bpftrace program")
+	cmd.Flags().StringVarP(&o.program, "filename", "f", o.program, "File containing a bpftrace program")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace jobs")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Time both traces run before printing their maps, in seconds")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time to print maps or histograms after deadline, in seconds")
+
+	cmd.MarkFlagFilename("filename", "bt")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating CompareOptions accordingly.
+func (o *CompareOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.resourceArgs = args
+	if !cmd.Flag("eval").Changed && !cmd.Flag("filename").Changed {
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceMissingErrString))
+	}
+	if cmd.Flag("eval").Changed == cmd.Flag("filename").Changed {
+		return i18n.Errorf(bpftraceDoubleErrString)
+	}
+	if (cmd.Flag("eval").Changed && len(o.eval) == 0) || (cmd.Flag("filename").Changed && len(o.program) == 0) {
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceEmptyErrString))
+	}
+	if o.deadline <= 0 {
+		return fmt.Errorf("the deadline must be positive, the traces are compared once they reach it")
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *CompareOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare program
+	if len(o.program) > 0 {
+		b, err := ioutil.ReadFile(o.program)
+		if err != nil {
+			return errdefs.Errorf(errdefs.ErrProgramInvalid, "error opening program file")
+		}
+		o.program = string(b)
+	} else {
+		o.program = o.eval
+	}
+
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Look for the targets
+	o.targets = nil
+	for _, r := range o.resourceArgs {
+		t, err := lookupTarget(factory, o.namespace, r, "")
+		if err != nil {
+			return err
+		}
+		o.targets = append(o.targets, t)
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the compare command.
+func (o *CompareOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs := []tracejob.TraceJob{}
+	for _, t := range o.targets {
+		tj, err := tracejob.New(t.tracejobTarget()).
+			WithNamespace(o.namespace).
+			WithServiceAccount(o.serviceAccount).
+			WithProgram(o.program).
+			WithImage(o.imageName).
+			WithInitImage(o.initImageName).
+			WithFetchHeaders(o.fetchHeaders).
+			WithDeadline(o.deadline).
+			WithDeadlineGracePeriod(o.deadlineGracePeriod).
+			Build()
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, tj)
+	}
+	// Both traces are created before attaching, so that they run over the same period.
+	for _, tj := range jobs {
+		if _, err := tc.CreateJob(ctx, tj); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.IOStreams.ErrOut, "trace %s created\n", tj.ID)
+	}
+
+	outputs := make([]attachOutput, len(jobs))
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i, tj := range jobs {
+		wg.Add(1)
+		go func(i int, tj tracejob.TraceJob) {
+			defer wg.Done()
+			a := attacher.NewAttacher(coreClient, o.clientConfig, genericclioptions.IOStreams{})
+			a.WithContext(ctx)
+			a.WithQuiet(true)
+			errs[i] = a.AttachJobTo(tj.ID, tj.Namespace, attacher.Streams{Out: &outputs[i], ErrOut: o.IOStreams.ErrOut})
+		}(i, tj)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		fmt.Fprintln(o.IOStreams.ErrOut, interruptedOutputsWarning)
+	}
+
+	writeComparison(o.IOStreams.Out, o.resourceArgs[0], o.resourceArgs[1], outputs[0].String(), outputs[1].String())
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interruptedOutputsWarning is printed when the traces attached in the background are interrupted before they ended.
+const interruptedOutputsWarning = "interrupted before the traces ended, their outputs are partial"
+
+// attachOutput collects the output of a trace attached in the background. Once read, it keeps what it got and drops
+// the rest: the attach of an interrupted trace goes on writing after AttachJobTo returned.
+type attachOutput struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	read bool
+}
+
+func (o *attachOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.read {
+		return len(p), nil
+	}
+	return o.buf.Write(p)
+}
+
+// String stops the collection and returns the output collected.
+func (o *attachOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.read = true
+	return o.buf.String()
+}
+
+// mapValueRE matches the lines of the maps holding a single integer, like "@calls[sys_read]: 1234".
+var mapValueRE = regexp.MustCompile(`^(@\w*(?:\[.*\])?): (-?\d+)$`)
+
+// parseMapValues returns the integer values of the maps printed in the output of bpftrace, with their keys in order.
+// The histograms and the other multi line values are left out.
+func parseMapValues(output string) ([]string, map[string]int64) {
+	keys := []string{}
+	values := map[string]int64{}
+	for _, l := range strings.Split(output, "\n") {
+		m := mapValueRE.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := values[m[1]]; !ok {
+			keys = append(keys, m[1])
+		}
+		// A map printed several times, like with snapshots, is compared by its last value.
+		values[m[1]] = v
+	}
+	return keys, values
+}
+
+// writeComparison writes the outputs of the traces of the targets a and b, then the differences of their map values.
+func writeComparison(w io.Writer, a, b, outA, outB string) {
+	fmt.Fprintf(w, "=== %s ===\n%s\n", a, strings.TrimRight(outA, "\n"))
+	fmt.Fprintf(w, "=== %s ===\n%s\n", b, strings.TrimRight(outB, "\n"))
+
+	keysA, valuesA := parseMapValues(outA)
+	keysB, valuesB := parseMapValues(outB)
+	keys := keysA
+	for _, k := range keysB {
+		if _, ok := valuesA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "=== differences ===\n")
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "MAP\t%s\t%s\tCHANGE\n", a, b)
+	for _, k := range keys {
+		va, okA := valuesA[k]
+		vb, okB := valuesB[k]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k, mapValue(va, okA), mapValue(vb, okB), change(va, vb, okA && okB))
+	}
+}
+
+func mapValue(v int64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// change returns the relative change from a to b, "-" when it cannot be computed.
+func change(a, b int64, ok bool) string {
+	if !ok || a == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(b-a)*100/float64(a))
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMapValues(t *testing.T) {
+	output := `@calls[sys_read]: 1234
+@calls[sys_write]: 56
+
+@lat:
+[1, 2)                 3 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|
+@total: 42
+@calls[sys_read]: 1300
+`
+	keys, values := parseMapValues(output)
+	if !reflect.DeepEqual(keys, []string{"@calls[sys_read]", "@calls[sys_write]", "@total"}) {
+		t.Errorf("keys = %q", keys)
+	}
+	want := map[string]int64{"@calls[sys_read]": 1300, "@calls[sys_write]": 56, "@total": 42}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+}
+
+func TestWriteComparison(t *testing.T) {
+	out := &bytes.Buffer{}
+	writeComparison(out, "pod/a", "pod/b", "@[bash]: 10\n@[sshd]: 4\n", "@[bash]: 15\n@[nginx]: 2\n")
+
+	got := out.String()
+	for _, want := range []string{
+		"=== pod/a ===\n@[bash]: 10\n@[sshd]: 4\n",
+		"=== pod/b ===\n@[bash]: 15\n@[nginx]: 2\n",
+		"MAP       pod/a  pod/b  CHANGE\n",
+		"@[bash]   10     15     +50.0%\n",
+		"@[sshd]   4      -      -\n",
+		"@[nginx]  -      2      -\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeComparison() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestChange(t *testing.T) {
+	tests := []struct {
+		a, b int64
+		ok   bool
+		want string
+	}{
+		{a: 10, b: 5, ok: true, want: "-50.0%"},
+		{a: 0, b: 5, ok: true, want: "-"},
+		{a: 10, b: 0, ok: false, want: "-"},
+	}
+	for _, tt := range tests {
+		if got := change(tt.a, tt.b, tt.ok); got != tt.want {
+			t.Errorf("change(%d, %d, %v) = %q, want %q", tt.a, tt.b, tt.ok, got, tt.want)
+		}
+	}
+}
+
+func TestAttachOutput(t *testing.T) {
+	o := &attachOutput{}
+	fmt.Fprintln(o, "@calls: 1")
+	if got := o.String(); got != "@calls: 1\n" {
+		t.Errorf("String() = %q", got)
+	}
+	if n, err := fmt.Fprintln(o, "@calls: 2"); err != nil || n != len("@calls: 2\n") {
+		t.Errorf("Write() after String() = %d, %v, want the write dropped without error", n, err)
+	}
+	if got := o.String(); got != "@calls: 1\n" {
+		t.Errorf("String() after a late write = %q, want the output read first", got)
+	}
+}
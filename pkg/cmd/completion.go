@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	completionShort = `Output shell completion code for the specified shell (bash or zsh)`
+	completionLong  = `Output shell completion code for the specified shell (bash or zsh).
+
+The bash completion also completes nodes, pods, containers and trace IDs by querying the cluster with kubectl.
+The shell code must be evaluated to provide interactive completion of kubectl-trace commands.`
+
+	completionExamples = `
+  # Load the kubectl-trace completion code for bash into the current shell
+  source <(kubectl-trace completion bash)
+
+  # Install the bash completion code
+  kubectl-trace completion bash > /etc/bash_completion.d/kubectl-trace
+
+  # Load the kubectl-trace completion code for zsh into the current shell
+  source <(kubectl-trace completion zsh)`
+
+	completionShells = map[string]func(io.Writer, *cobra.Command) error{
+		"bash": runCompletionBash,
+		"zsh":  runCompletionZsh,
+	}
+)
+
+// bashCompletionFunc contains the functions the generated bash completion uses to complete arguments from the cluster.
+// The flags selecting the cluster are passed along to kubectl, like the kubectl completion does.
+const bashCompletionFunc = `__kubectl_trace_override_flag_list=(--kubeconfig --cluster --user --context --namespace --server -n -s)
+__kubectl_trace_override_flags()
+{
+    local ${__kubectl_trace_override_flag_list[*]##*-} two_word_of of var
+    for w in "${words[@]}"; do
+        if [ -n "${two_word_of}" ]; then
+            eval "${two_word_of##*-}=\"${two_word_of}=\${w}\""
+            two_word_of=
+            continue
+        fi
+        for of in "${__kubectl_trace_override_flag_list[@]}"; do
+            case "${w}" in
+                ${of}=*)
+                    eval "${of##*-}=\"${w}\""
+                    ;;
+                ${of})
+                    two_word_of="${of}"
+                    ;;
+            esac
+        done
+    done
+    for var in "${__kubectl_trace_override_flag_list[@]##*-}"; do
+        if eval "test -n \"\$${var}\""; then
+            eval "echo -n \${${var}}' '"
+        fi
+    done
+}
+
+# __kubectl_trace_get completes with the names of the resources of the given kind, with an optional prefix
+__kubectl_trace_get()
+{
+    local kind="$1" prefix="$2" out
+    local template="{{ range .items }}{{ .metadata.name }} {{ end }}"
+    if out=$(kubectl get $(__kubectl_trace_override_flags) -o template --template="${template}" "${kind}" 2>/dev/null); then
+        COMPREPLY+=( $( compgen -P "${prefix}" -W "${out[*]}" -- "${cur#${prefix}}" ) )
+    fi
+}
+
+__kubectl_trace_get_namespaces()
+{
+    __kubectl_trace_get namespaces ""
+}
+
+# __kubectl_trace_get_targets completes pods and nodes, nodes being the default
+__kubectl_trace_get_targets()
+{
+    case "${cur}" in
+        pod/*)
+            __kubectl_trace_get pods "pod/"
+            ;;
+        node/*)
+            __kubectl_trace_get nodes "node/"
+            ;;
+        *)
+            COMPREPLY=( $( compgen -W "pod/ node/" -- "${cur}" ) )
+            __kubectl_trace_get nodes ""
+            if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]] && [[ $(type -t compopt) = "builtin" ]]; then
+                compopt -o nospace
+            fi
+            ;;
+    esac
+}
+
+# __kubectl_trace_get_containers completes the containers of the pod given as first argument
+__kubectl_trace_get_containers()
+{
+    local pod out w
+    for w in "${nouns[@]}"; do
+        if [[ ${w} == pod/* ]]; then
+            pod="${w#pod/}"
+        fi
+    done
+    if [[ -z ${pod} ]]; then
+        return
+    fi
+    local template="{{ range .spec.containers }}{{ .name }} {{ end }}"
+    if out=$(kubectl get $(__kubectl_trace_override_flags) -o template --template="${template}" pods "${pod}" 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out[*]}" -- "${cur}" ) )
+    fi
+}
+
+# __kubectl_trace_get_traces completes trace IDs and trace names
+__kubectl_trace_get_traces()
+{
+    local out
+    local template="{{ range .items }}{{ index .metadata.labels \"iovisor.org/kubectl-trace-id\" }} {{ .metadata.name }} {{ end }}"
+    if out=$(kubectl get $(__kubectl_trace_override_flags) -l iovisor.org/kubectl-trace-id -o template --template="${template}" jobs 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out[*]}" -- "${cur}" ) )
+    fi
+}
+
+__kubectl_trace_custom_func()
+{
+    case ${last_command} in
+        trace_run)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                __kubectl_trace_get_targets
+            elif [[ ${#nouns[@]} -eq 1 ]]; then
+                __kubectl_trace_get_containers
+            fi
+            return
+            ;;
+        trace_compare | trace_netlat)
+            if [[ ${#nouns[@]} -lt 2 ]]; then
+                __kubectl_trace_get_targets
+            fi
+            return
+            ;;
+        trace_trigger | trace_top | trace_shell)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                __kubectl_trace_get_targets
+            fi
+            return
+            ;;
+        trace_recipe)
+            # The name of the recipe comes first, unless it is defined by a file.
+            if [[ ${#nouns[@]} -lt 2 ]]; then
+                __kubectl_trace_get_targets
+            fi
+            return
+            ;;
+        trace_get | trace_attach | trace_delete | trace_logs | trace_export)
+            if [[ ${#nouns[@]} -eq 0 ]]; then
+                __kubectl_trace_get_traces
+            fi
+            return
+            ;;
+        *)
+            ;;
+    esac
+}
+`
+
+// NewCompletionCommand provides the completion command.
+func NewCompletionCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	shells := []string{}
+	for s := range completionShells {
+		shells = append(shells, s)
+	}
+	sort.Strings(shells)
+
+	cmd := &cobra.Command{
+		Use:                   "completion SHELL",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(completionShort),
+		Long:                  i18n.T(completionLong),
+		Example:               i18n.T(completionExamples),
+		ValidArgs:             shells,
+		RunE: func(c *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("exactly one shell is required, one of: %s", strings.Join(shells, ", "))
+			}
+			run, ok := completionShells[args[0]]
+			if !ok {
+				return fmt.Errorf("unsupported shell type %q", args[0])
+			}
+			return run(streams.Out, c.Root())
+		},
+	}
+
+	return cmd
+}
+
+func runCompletionBash(out io.Writer, root *cobra.Command) error {
+	var buf bytes.Buffer
+	if err := root.GenBashCompletion(&buf); err != nil {
+		return err
+	}
+	// The generic __custom_func name would clash with the one defined by the kubectl completion.
+	script := strings.Replace(buf.String(), "__custom_func", "__kubectl_trace_custom_func", -1)
+	if _, err := io.WriteString(out, script); err != nil {
+		return err
+	}
+	// The root command is named after the kubectl subcommand, complete the plugin binary as well.
+	_, err := fmt.Fprintf(out, "complete -o default -F __start_%s kubectl-%s\n", root.Name(), root.Name())
+	return err
+}
+
+func runCompletionZsh(out io.Writer, root *cobra.Command) error {
+	return root.GenZshCompletion(out)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/copier"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	cpShort = `Copy files out of or into a running trace`
+	cpLong  = `Copy files out of or into the pod of a running trace, like kubectl cp.
+The trace is referred to by its id or its name, followed by a colon and the path in the trace container.`
+
+	cpExamples = `
+  # Copy a file written by a trace to the local directory
+  %[1]s trace cp 5594d7e1-0b78-11e9-b7f1-40a3cc632df1:/tmp/out.txt out.txt
+
+  # Copy a directory of a trace using its name
+  %[1]s trace cp kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1:/tmp/results results
+
+  # Copy a large file of a trace, resuming the copy of the local file if it was interrupted
+  %[1]s trace cp 5594d7e1-0b78-11e9-b7f1-40a3cc632df1:/tmp/perf.data perf.data --resume
+
+  # Copy a local file into a trace
+  %[1]s trace cp symbols.txt 5594d7e1-0b78-11e9-b7f1-40a3cc632df1:/tmp/symbols.txt
+`
+)
+
+// CpOptions ...
+type CpOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	fromTrace    bool
+	tracePath    string
+	localPath    string
+	resume       bool
+	verify       bool
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewCpOptions provides an instance of CpOptions with default values.
+func NewCpOptions(streams genericclioptions.IOStreams) *CpOptions {
+	return &CpOptions{
+		IOStreams: streams,
+		verify:    true,
+	}
+}
+
+// NewCpCommand provides the cp command wrapping CpOptions.
+func NewCpCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewCpOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "cp (TRACE_ID | TRACE_NAME):SRC DST | SRC (TRACE_ID | TRACE_NAME):DST",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(cpShort),
+		Long:                  i18n.T(cpLong),                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(i18n.T(cpExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage:          true,
+		Args:                  cobra.ExactArgs(2),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().BoolVar(&o.verify, "verify", o.verify, "Verify the SHA-256 checksums of the files copied out of the trace, to disable for files still written by the trace")
+	cmd.Flags().BoolVar(&o.resume, "resume", o.resume, "Copy a single file out of the trace in chunks, resuming from the size of the local file and after interrupted transfers")
+
+	return cmd
+}
+
+// Validate validates the arguments populating CpOptions accordingly.
+func (o *CpOptions) Validate(cmd *cobra.Command, args []string) error {
+	srcTrace, srcPath, srcRemote := splitTracePath(args[0])
+	dstTrace, dstPath, dstRemote := splitTracePath(args[1])
+	if srcRemote == dstRemote {
+		return fmt.Errorf("one of the source and the destination must be a path in a trace, as (TRACE_ID | TRACE_NAME):PATH")
+	}
+
+	trace := dstTrace
+	o.tracePath, o.localPath = dstPath, args[0]
+	if srcRemote {
+		o.fromTrace = true
+		trace = srcTrace
+		o.tracePath, o.localPath = srcPath, args[1]
+	}
+	if o.resume && !o.fromTrace {
+		return fmt.Errorf("--resume only applies to copies out of a trace")
+	}
+	if len(o.tracePath) == 0 || len(o.localPath) == 0 {
+		return fmt.Errorf("the source and the destination paths cannot be empty")
+	}
+
+	if meta.IsObjectName(trace) {
+		o.traceName = &trace
+	} else {
+		tid := types.UID(trace)
+		o.traceID = &tid
+	}
+	return nil
+}
+
+// splitTracePath splits a TRACE:PATH argument, remote is false for local paths.
+func splitTracePath(arg string) (trace, path string, remote bool) {
+	i := strings.Index(arg, ":")
+	// A path starting with a colon or containing a slash before the colon is local.
+	if i <= 0 || strings.Contains(arg[:i], "/") {
+		return "", arg, false
+	}
+	return arg[:i], arg[i+1:], true
+}
+
+// Complete completes the setup of the command.
+func (o *CpOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the cp command.
+func (o *CpOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	// --request-timeout is meant for single requests, it must not cut a copy
+	streamConfig := rest.CopyConfig(o.clientConfig)
+	streamConfig.Timeout = 0
+	client, err := corev1client.NewForConfig(streamConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
+
+	tf := tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	}
+
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		return errdefs.Errorf(errdefs.ErrTraceNotFound, "no trace found with the provided criterias")
+	}
+
+	job := jobs[0]
+	c := copier.NewCopier(client, streamConfig)
+	if !o.fromTrace {
+		return c.ToTrace(job.ID, job.Namespace, o.localPath, o.tracePath)
+	}
+	if o.resume {
+		err = c.FromTraceResumable(job.ID, job.Namespace, o.tracePath, o.localPath)
+	} else {
+		err = c.FromTrace(job.ID, job.Namespace, o.tracePath, o.localPath)
+	}
+	if err != nil || !o.verify {
+		return err
+	}
+	return c.Verify(job.ID, job.Namespace, o.tracePath, o.localPath)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import "testing"
+
+func TestSplitTracePath(t *testing.T) {
+	tests := []struct {
+		arg        string
+		wantTrace  string
+		wantPath   string
+		wantRemote bool
+	}{
+		{arg: "5594d7e1-0b78-11e9-b7f1-40a3cc632df1:/tmp/out.txt", wantTrace: "5594d7e1-0b78-11e9-b7f1-40a3cc632df1", wantPath: "/tmp/out.txt", wantRemote: true},
+		{arg: "kubectl-trace-d5842929:results", wantTrace: "kubectl-trace-d5842929", wantPath: "results", wantRemote: true},
+		{arg: "out.txt", wantPath: "out.txt"},
+		{arg: "./dir:with:colons", wantPath: "./dir:with:colons"},
+		{arg: ":out.txt", wantPath: ":out.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			trace, path, remote := splitTracePath(tt.arg)
+			if trace != tt.wantTrace || path != tt.wantPath || remote != tt.wantRemote {
+				t.Errorf("got %q, %q, %v, want %q, %q, %v", trace, path, remote, tt.wantTrace, tt.wantPath, tt.wantRemote)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/types"
@@ -15,7 +18,7 @@ import (
 )
 
 var (
-	deleteShort = `Delete a bpftrace program execution` // Wrap with i18n.T()
+	deleteShort = `Delete a bpftrace program execution`
 	deleteLong  = deleteShort
 
 	deleteExamples = `
@@ -62,10 +65,11 @@ func NewDeleteCommand(factory factory.Factory, streams genericclioptions.IOStrea
 	o := NewDeleteOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:     "delete (TRACE_ID | TRACE_NAME)",
-		Short:   deleteShort,
-		Long:    deleteLong,                             // Wrap with templates.LongDesc()
-		Example: fmt.Sprintf(deleteExamples, "kubectl"), // Wrap with templates.Examples()
+		Use:          "delete (TRACE_ID | TRACE_NAME)",
+		Short:        i18n.T(deleteShort),
+		Long:         i18n.T(deleteLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(deleteExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
 		},
@@ -73,11 +77,7 @@ func NewDeleteCommand(factory factory.Factory, streams genericclioptions.IOStrea
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
-				fmt.Fprintln(o.ErrOut, err.Error())
-				return nil
-			}
-			return nil
+			return o.Run()
 		},
 	}
 
@@ -154,7 +154,8 @@ func (o *DeleteOptions) Run() error {
 		ID:   o.traceID,
 	}
 
-	err = tc.DeleteJobs(tf)
+	ctx := signals.WithStandardSignals(context.Background())
+	err = tc.DeleteJobs(ctx, tf)
 	if err != nil {
 		return err
 	}
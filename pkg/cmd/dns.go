@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+// dnsOptions are the host aliases and the DNS configuration of the trace job pod, for the endpoints only resolvable
+// through internal DNS servers or fixed addresses.
+type dnsOptions struct {
+	hosts       []string
+	nameservers []string
+	searches    []string
+	options     []string
+
+	hostAliases []v1.HostAlias
+	dnsConfig   *v1.PodDNSConfig
+}
+
+func (o *dnsOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&o.hosts, "add-host", o.hosts, "Host name and IP, as HOST:IP, added to /etc/hosts of the pod of the kubectl-trace job, can be repeated")
+	cmd.Flags().StringArrayVar(&o.nameservers, "dns-nameserver", o.nameservers, "IP of a DNS server of the pod of the kubectl-trace job, on top of the ones of the cluster, can be repeated")
+	cmd.Flags().StringArrayVar(&o.searches, "dns-search", o.searches, "DNS search domain of the pod of the kubectl-trace job, on top of the ones of the cluster, can be repeated")
+	cmd.Flags().StringArrayVar(&o.options, "dns-option", o.options, "DNS resolver option, as NAME or NAME=VALUE like ndots=2, of the pod of the kubectl-trace job, can be repeated")
+}
+
+// validate parses the host aliases and the DNS configuration of the flags.
+func (o *dnsOptions) validate() error {
+	o.hostAliases = nil
+	for _, h := range o.hosts {
+		// Host names have no colon, IPv6 addresses do.
+		i := strings.Index(h, ":")
+		if i <= 0 || net.ParseIP(h[i+1:]) == nil {
+			return fmt.Errorf("invalid --add-host %q, expected HOST:IP", h)
+		}
+		o.addHostAlias(h[:i], h[i+1:])
+	}
+
+	if len(o.nameservers) == 0 && len(o.searches) == 0 && len(o.options) == 0 {
+		o.dnsConfig = nil
+		return nil
+	}
+	o.dnsConfig = &v1.PodDNSConfig{Searches: o.searches}
+	for _, ns := range o.nameservers {
+		if net.ParseIP(ns) == nil {
+			return fmt.Errorf("invalid --dns-nameserver %q, expected an IP", ns)
+		}
+		o.dnsConfig.Nameservers = append(o.dnsConfig.Nameservers, ns)
+	}
+	for _, opt := range o.options {
+		name, value := opt, ""
+		hasValue := false
+		if i := strings.Index(opt, "="); i >= 0 {
+			name, value, hasValue = opt[:i], opt[i+1:], true
+		}
+		if len(name) == 0 {
+			return fmt.Errorf("invalid --dns-option %q, expected NAME or NAME=VALUE", opt)
+		}
+		o.dnsConfig.Options = append(o.dnsConfig.Options, v1.PodDNSConfigOption{Name: name})
+		if hasValue {
+			o.dnsConfig.Options[len(o.dnsConfig.Options)-1].Value = &value
+		}
+	}
+	return nil
+}
+
+// addHostAlias adds the host name to the alias of the IP, aliases being by IP in the pod spec.
+func (o *dnsOptions) addHostAlias(host, ip string) {
+	for i := range o.hostAliases {
+		if o.hostAliases[i].IP == ip {
+			o.hostAliases[i].Hostnames = append(o.hostAliases[i].Hostnames, host)
+			return
+		}
+	}
+	o.hostAliases = append(o.hostAliases, v1.HostAlias{IP: ip, Hostnames: []string{host}})
+}
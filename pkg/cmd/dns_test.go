@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestDNSOptions(t *testing.T) {
+	ndots := "2"
+	tests := []struct {
+		name            string
+		o               dnsOptions
+		wantHostAliases []v1.HostAlias
+		wantDNSConfig   *v1.PodDNSConfig
+		wantErr         bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "host aliases",
+			o:    dnsOptions{hosts: []string{"sink.internal:10.0.0.7", "upload.internal:10.0.0.8", "sink:10.0.0.7", "v6.internal:fd00::1"}},
+			wantHostAliases: []v1.HostAlias{
+				{IP: "10.0.0.7", Hostnames: []string{"sink.internal", "sink"}},
+				{IP: "10.0.0.8", Hostnames: []string{"upload.internal"}},
+				{IP: "fd00::1", Hostnames: []string{"v6.internal"}},
+			},
+		},
+		{
+			name: "dns config",
+			o:    dnsOptions{nameservers: []string{"10.0.0.53"}, searches: []string{"corp.internal"}, options: []string{"ndots=2", "edns0"}},
+			wantDNSConfig: &v1.PodDNSConfig{
+				Nameservers: []string{"10.0.0.53"},
+				Searches:    []string{"corp.internal"},
+				Options:     []v1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}, {Name: "edns0"}},
+			},
+		},
+		{
+			name:    "host without an IP",
+			o:       dnsOptions{hosts: []string{"sink.internal"}},
+			wantErr: true,
+		},
+		{
+			name:    "nameserver not an IP",
+			o:       dnsOptions{nameservers: []string{"dns.internal"}},
+			wantErr: true,
+		},
+		{
+			name:    "option without a name",
+			o:       dnsOptions{options: []string{"=2"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.o.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(tt.o.hostAliases, tt.wantHostAliases) {
+				t.Errorf("host aliases = %v, want %v", tt.o.hostAliases, tt.wantHostAliases)
+			}
+			if !reflect.DeepEqual(tt.o.dnsConfig, tt.wantDNSConfig) {
+				t.Errorf("dns config = %v, want %v", tt.o.dnsConfig, tt.wantDNSConfig)
+			}
+		})
+	}
+}
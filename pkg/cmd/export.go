@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/bundle"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/version"
+	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	exportShort = `Export a trace as a bundle to run it again later`
+	exportLong  = `Export a trace as a bundle, a gzipped tarball to attach to a ticket and to run again later exactly as it was.
+
+The bundle holds the program of the trace, its spec with its images pinned to the digests the node pulled,
+its target, the kernel and the runtime of its node, and its job for reference.
+The images are pinned as long as the pod of the trace is still around.`
+
+	exportExamples = `
+  # Export a trace using its id
+  %[1]s trace export 5594d7e1-0b78-11e9-b7f1-40a3cc632df1 bundle.tar.gz
+
+  # Export a trace using its name
+  %[1]s trace export kubectl-trace-d5842929-0b78-11e9-a9fa-40a3cc632df1 bundle.tar.gz`
+)
+
+// ExportOptions ...
+type ExportOptions struct {
+	genericclioptions.IOStreams
+	traceID      *types.UID
+	traceName    *string
+	path         string
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewExportOptions provides an instance of ExportOptions with default values.
+func NewExportOptions(streams genericclioptions.IOStreams) *ExportOptions {
+	return &ExportOptions{
+		IOStreams: streams,
+	}
+}
+
+// NewExportCommand provides the export command wrapping ExportOptions.
+func NewExportCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewExportOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "export (TRACE_ID | TRACE_NAME) FILE",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(exportShort),
+		Long:                  i18n.T(exportLong),                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(i18n.T(exportExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage:          true,
+		Args:                  cobra.ExactArgs(2),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	return cmd
+}
+
+// Validate validates the arguments populating ExportOptions accordingly.
+func (o *ExportOptions) Validate(cmd *cobra.Command, args []string) error {
+	if meta.IsObjectName(args[0]) {
+		o.traceName = &args[0]
+	} else {
+		tid := types.UID(args[0])
+		o.traceID = &tid
+	}
+	o.path = args[1]
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *ExportOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the export command.
+func (o *ExportOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient: jobsClient.Jobs(o.namespace),
+	}
+
+	tf := tracejob.TraceJobFilter{
+		Name: o.traceName,
+		ID:   o.traceID,
+	}
+
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs, err := tc.GetJob(ctx, tf)
+	if err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		return errdefs.Errorf(errdefs.ErrTraceNotFound, "no trace found with the provided criterias")
+	}
+
+	b, err := o.newBundle(jobsClient, coreClient, jobs[0])
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Write(f, b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.IOStreams.Out, "trace %s exported to %s\n", b.TraceID, o.path)
+	return nil
+}
+
+// newBundle reads back the trace from its job and its configmap, and completes it with what the cluster tells about
+// its images, its target and its node. The missing details are warned about, only the spec and the program are required.
+func (o *ExportOptions) newBundle(jobsClient batchv1client.BatchV1Interface, coreClient corev1client.CoreV1Interface, tj tracejob.TraceJob) (*bundle.Bundle, error) {
+	job, err := jobsClient.Jobs(tj.Namespace).Get(tj.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cm, err := coreClient.ConfigMaps(tj.Namespace).Get(tj.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("the program of trace %s cannot be read: %v", tj.ID, err)
+	}
+	spec, err := tracejob.FromObjects(job, cm)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bundle.New(spec, job)
+	b.ExportedAt = time.Now().UTC()
+	b.KubectlTrace = version.GitCommit()
+
+	pods, err := coreClient.Pods(tj.Namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pod *v1.Pod
+	for i := range pods.Items {
+		if p := &pods.Items[i]; pod == nil || pod.CreationTimestamp.Before(&p.CreationTimestamp) {
+			pod = p
+		}
+	}
+	// The image IDs of the statuses hold the digests, their images can be normalized by the runtime.
+	imageIDs := map[string]string{}
+	if pod != nil {
+		for _, s := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			imageIDs[s.Name] = s.ImageID
+		}
+	}
+	if len(imageIDs) == 0 {
+		fmt.Fprintf(o.IOStreams.ErrOut, "the pod of trace %s is gone or did not start, its images are not pinned to their digests\n", tj.ID)
+	}
+	for _, c := range append(job.Spec.Template.Spec.InitContainers, job.Spec.Template.Spec.Containers...) {
+		b.AddImage(bundle.NewImage(c.Name, c.Image, imageIDs[c.Name]))
+	}
+
+	if spec.IsPod {
+		targets, err := coreClient.Pods(tj.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range targets.Items {
+			if string(p.UID) == spec.PodUID {
+				b.Target.Pod = p.Name
+			}
+		}
+		if len(b.Target.Pod) == 0 {
+			fmt.Fprintf(o.IOStreams.ErrOut, "the pod traced by trace %s is gone, only its UID is exported\n", tj.ID)
+		}
+	}
+
+	// The users tracing pods may not be allowed to read the nodes.
+	nodes, err := coreClient.Nodes().List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", v1.LabelHostname, spec.Hostname),
+	})
+	if err == nil && len(nodes.Items) > 0 {
+		b.Node = bundle.NewNode(&nodes.Items[0])
+	} else {
+		fmt.Fprintf(o.IOStreams.ErrOut, "the node %s of trace %s cannot be read, its kernel is not exported\n", spec.Hostname, tj.ID)
+	}
+	return b, nil
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/bundle"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validateFromBundle reads the bundle of --from-bundle, whose program is run instead of one given by the flags.
+// Without a target argument, the trace runs again against the target of the bundle.
+func (o *RunOptions) validateFromBundle(cmd *cobra.Command) error {
+	for _, f := range []string{"eval", "filename", "binary", "profile", "on-rollout"} {
+		if cmd.Flag(f).Changed {
+			return fmt.Errorf("--from-bundle runs the program of the bundle, it cannot be used with --%s", f)
+		}
+	}
+	f, err := os.Open(o.bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if o.bundle, err = bundle.Read(f); err != nil {
+		return fmt.Errorf("invalid bundle %s: %v", o.bundlePath, err)
+	}
+	if len(o.bundle.Spec.SnapshotInterval) > 0 {
+		if _, err := time.ParseDuration(o.bundle.Spec.SnapshotInterval); err != nil {
+			return fmt.Errorf("invalid snapshot interval of the bundle %s: %v", o.bundlePath, err)
+		}
+	}
+	if len(o.bundle.Spec.AvoidPods) > 0 {
+		if _, err := metav1.ParseToLabelSelector(o.bundle.Spec.AvoidPods); err != nil {
+			return fmt.Errorf("invalid avoided pods selector of the bundle %s: %v", o.bundlePath, err)
+		}
+	}
+
+	if len(o.resourceArg) > 0 {
+		return nil
+	}
+	if cmd.Flag("container").Changed {
+		return fmt.Errorf("the container is given along with a new target, the bundle tells the one it traced")
+	}
+	o.resourceArg, o.container, err = bundleTarget(o.bundle)
+	if err != nil {
+		return err
+	}
+	o.bundleTarget = true
+	return nil
+}
+
+// bundleTarget returns the target argument and the container the trace of the bundle ran against.
+func bundleTarget(b *bundle.Bundle) (string, string, error) {
+	if len(b.Target.Pod) > 0 {
+		return "pod/" + b.Target.Pod, b.Target.Container, nil
+	}
+	if len(b.Target.PodUID) > 0 {
+		return "", "", fmt.Errorf("the pod traced by trace %s was gone when it was exported, give the target to run its bundle against", b.TraceID)
+	}
+	node := b.Target.Node
+	if b.Node != nil {
+		// The hostname and the name of a node can differ.
+		node = b.Node.Name
+	}
+	return "node/" + node, "", nil
+}
+
+// applyBundle uses the spec of the bundle for the flags that have not been set, over the configuration file.
+func (o *RunOptions) applyBundle(cmd *cobra.Command) {
+	s := o.bundle.Spec
+	o.binary = o.bundle.Binary
+	if !cmd.Flag("serviceaccount").Changed {
+		o.serviceAccount = s.ServiceAccount
+	}
+	if !cmd.Flag("runtime-class").Changed {
+		o.runtimeClass = s.RuntimeClass
+	}
+	if !cmd.Flag("host-pid").Changed && s.HostPID != nil {
+		o.hostPID = *s.HostPID
+	}
+	if !cmd.Flag("host-network").Changed {
+		o.hostNetwork = s.HostNetwork
+	}
+	if !cmd.Flag("add-host").Changed {
+		o.dns.hostAliases = s.HostAliases
+	}
+	if !cmd.Flag("dns-nameserver").Changed && !cmd.Flag("dns-search").Changed && !cmd.Flag("dns-option").Changed {
+		o.dns.dnsConfig = s.DNSConfig
+	}
+	o.proxy.bundle = s.TraceProxy()
+	if !cmd.Flag("ca-configmap").Changed && s.CABundle != nil {
+		o.caConfigMap = s.CABundle.ConfigMap
+		if len(s.CABundle.ConfigMap) > 0 && len(s.CABundle.Key) > 0 {
+			o.caConfigMap += ":" + s.CABundle.Key
+		}
+	}
+	if !cmd.Flag("imagename").Changed && !cmd.Flag("bpftrace-version").Changed {
+		o.imageName = s.Image
+	}
+	if !cmd.Flag("init-imagename").Changed && len(s.InitImage) > 0 {
+		o.initImageName = s.InitImage
+	}
+	if !cmd.Flag("fetch-headers").Changed {
+		o.fetchHeaders = s.FetchHeaders
+	}
+	if !cmd.Flag("deadline").Changed {
+		o.deadline = s.Deadline
+	}
+	if !cmd.Flag("deadline-grace-period").Changed {
+		o.deadlineGracePeriod = s.DeadlineGracePeriod
+	}
+	if !cmd.Flag("unsafe").Changed {
+		o.unsafe = s.Unsafe
+	}
+	for _, t := range []struct {
+		flag  string
+		value *int64
+		spec  int64
+	}{
+		{"map-keys-max", &o.tunables.MapKeysMax, s.MapKeysMax},
+		{"strlen", &o.tunables.Strlen, s.Strlen},
+		{"perf-rb-pages", &o.tunables.PerfRBPages, s.PerfRBPages},
+		{"cat-bytes-max", &o.tunables.CatBytesMax, s.CatBytesMax},
+	} {
+		if !cmd.Flag(t.flag).Changed {
+			*t.value = t.spec
+		}
+	}
+	if !cmd.Flag("buffering").Changed {
+		o.buffering = s.Buffering
+	}
+	if !cmd.Flag("tracer-flags").Changed {
+		o.tracerFlags = s.TracerFlags
+	}
+	if !cmd.Flag("snapshot-interval").Changed && len(s.SnapshotInterval) > 0 {
+		// Validated with the bundle.
+		o.snapshotInterval, _ = time.ParseDuration(s.SnapshotInterval)
+	}
+	if !cmd.Flag("max-output").Changed && s.MaxOutput > 0 {
+		o.maxOutput = s.MaxOutput
+	}
+	if s.Resources != nil {
+		o.resources = s.Resources
+	}
+	if !cmd.Flag("avoid-pods").Changed && len(s.AvoidPods) > 0 {
+		// Validated with the bundle, the pods to keep away from are listed again when completing.
+		o.avoidPodsArg = s.AvoidPods
+		o.avoidPods, _ = metav1.ParseToLabelSelector(s.AvoidPods)
+	}
+}
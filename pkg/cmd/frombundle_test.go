@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/bundle"
+)
+
+func TestBundleTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		bundle        bundle.Bundle
+		wantArg       string
+		wantContainer string
+		wantErr       bool
+	}{
+		{
+			name:          "pod",
+			bundle:        bundle.Bundle{Target: bundle.Target{Node: "node-1", Pod: "nginx-1", PodUID: "uid-1", Container: "nginx"}},
+			wantArg:       "pod/nginx-1",
+			wantContainer: "nginx",
+		},
+		{
+			name:    "pod gone when exported",
+			bundle:  bundle.Bundle{Target: bundle.Target{Node: "node-1", PodUID: "uid-1", Container: "nginx"}},
+			wantErr: true,
+		},
+		{
+			name:    "node",
+			bundle:  bundle.Bundle{Target: bundle.Target{Node: "node-1"}},
+			wantArg: "node/node-1",
+		},
+		{
+			name:    "node name differing from its hostname",
+			bundle:  bundle.Bundle{Target: bundle.Target{Node: "node-1"}, Node: &bundle.Node{Name: "node-1.example.com"}},
+			wantArg: "node/node-1.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg, container, err := bundleTarget(&tt.bundle)
+			if (err != nil) != tt.wantErr || arg != tt.wantArg || container != tt.wantContainer {
+				t.Errorf("bundleTarget() = %q, %q, %v, want %q, %q, error %v", arg, container, err, tt.wantArg, tt.wantContainer, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,13 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"text/tabwriter"
 	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/color"
 	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -22,7 +26,7 @@ import (
 
 var (
 	getCommand = "get"
-	getShort   = `Get the running traces` // Wrap with i18n.T()
+	getShort   = `Get the running traces`
 	getLong    = getShort
 
 	getExamples = `
@@ -55,6 +59,9 @@ type GetOptions struct {
 	clientConfig  *rest.Config
 	traceID       *types.UID
 	traceName     *string
+
+	// traceJobClient replaces the client talking to the cluster when set, for tests.
+	traceJobClient tracejob.Interface
 }
 
 // NewGetOptions provides an instance of GetOptions with default values.
@@ -74,9 +81,9 @@ func NewGetCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 
 	cmd := &cobra.Command{
 		Use:          fmt.Sprintf("%s (TRACE_ID | TRACE_NAME)", getCommand),
-		Short:        getShort,
-		Long:         getLong,                             // wrap with templates.LongDesc()
-		Example:      fmt.Sprintf(getExamples, "kubectl"), // wrap with templates.Examples()
+		Short:        i18n.T(getShort),
+		Long:         i18n.T(getLong),                             // wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(getExamples), "kubectl"), // wrap with templates.Examples()
 		SilenceUsage: true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
@@ -85,11 +92,7 @@ func NewGetCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
-				fmt.Fprintln(o.ErrOut, err.Error())
-				return nil
-			}
-			return nil
+			return o.Run()
 		},
 	}
 
@@ -138,29 +141,18 @@ func (o *GetOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 }
 
 func (o *GetOptions) Run() error {
-	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
-	if err != nil {
-		return err
-	}
-
-	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	tc, err := o.client()
 	if err != nil {
 		return err
 	}
 
-	tc := &tracejob.TraceJobClient{
-		JobClient:    jobsClient.Jobs(o.namespace),
-		ConfigClient: coreClient.ConfigMaps(o.namespace),
-	}
-
-	tc.WithOutStream(o.Out)
-
 	tf := tracejob.TraceJobFilter{
 		Name: o.traceName,
 		ID:   o.traceID,
 	}
 
-	jobs, err := tc.GetJob(tf)
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs, err := tc.GetJob(ctx, tf)
 
 	if err != nil {
 		return err
@@ -171,12 +163,38 @@ func (o *GetOptions) Run() error {
 	return nil
 }
 
+// client returns the client set for tests, or the one talking to the cluster.
+func (o *GetOptions) client() (tracejob.Interface, error) {
+	if o.traceJobClient != nil {
+		return o.traceJobClient, nil
+	}
+
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:    jobsClient.Jobs(o.namespace),
+		ConfigClient: coreClient.ConfigMaps(o.namespace),
+		PodClient:    coreClient.Pods(o.namespace),
+	}
+
+	tc.WithOutStream(o.Out)
+	return tc, nil
+}
+
 // TODO(fntlnz): This needs better printing, perhaps we could use the humanreadable table from k8s itself
 // to be consistent with the main project.
 func jobsTablePrint(o io.Writer, jobs []tracejob.TraceJob) {
-	format := "%s\t%s\t%s\t%s\t%s\t"
+	format := "%s\t%s\t%s\t%s\t%s\t%s\t%s\t"
 	if len(jobs) == 0 {
-		fmt.Println("No resources found.")
+		fmt.Fprintln(o, "No resources found.")
 		return
 	}
 	// initialize tabwriter
@@ -187,17 +205,38 @@ func jobsTablePrint(o io.Writer, jobs []tracejob.TraceJob) {
 
 	// TODO(fntlnz): Do the status and age fields, we don't have a way to get them now, so reporting
 	// them as missing.
-	fmt.Fprintf(w, format, "NAMESPACE", "NODE", "NAME", "STATUS", "AGE")
+	fmt.Fprintf(w, format, "NAMESPACE", "NODE", "NAME", color.Sprint(o, color.Default, "STATUS"), "PHASE", "REASON", "AGE")
 	for _, j := range jobs {
 		status := j.Status
 		if status == "" {
 			status = tracejob.TraceJobUnknown
 		}
-		fmt.Fprintf(w, "\n"+format, j.Namespace, j.Hostname, j.Name, status, translateTimestampSince(j.StartTime))
+		fmt.Fprintf(w, "\n"+format, j.Namespace, j.Hostname, j.Name, color.Sprint(o, statusColor(status), string(status)), orNone(j.Phase), orNone(j.Reason), translateTimestampSince(j.StartTime))
 	}
 	fmt.Fprintf(w, "\n")
 }
 
+// orNone returns s, or <none> when it is empty.
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "<none>"
+	}
+	return s
+}
+
+// statusColor returns the color the status is printed with.
+func statusColor(s tracejob.TraceJobStatus) color.Color {
+	switch s {
+	case tracejob.TraceJobRunning:
+		return color.Green
+	case tracejob.TraceJobCompleted:
+		return color.Cyan
+	case tracejob.TraceJobFailed, tracejob.TraceJobDeadlineExceeded:
+		return color.Red
+	}
+	return color.Yellow
+}
+
 // translateTimestampSince returns the elapsed time since timestamp in
 // human-readable approximation.
 func translateTimestampSince(timestamp *metav1.Time) string {
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/tracetest"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestGetRun(t *testing.T) {
+	jobs := []tracejob.TraceJob{
+		{Name: "kubectl-trace-1", ID: "1", Namespace: "default", Hostname: "node-1", Status: tracejob.TraceJobRunning},
+		{Name: "kubectl-trace-2", ID: "2", Namespace: "default", Hostname: "node-2", Status: tracejob.TraceJobFailed, Phase: "Failed", Reason: "Failed: program compile error"},
+		{Name: "kubectl-trace-3", ID: "3", Namespace: "default", Hostname: "node-3", Status: tracejob.TraceJobDeadlineExceeded, Phase: "Draining"},
+	}
+	id := types.UID("2")
+
+	tests := []struct {
+		name    string
+		jobs    []tracejob.TraceJob
+		traceID *types.UID
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "all traces",
+			jobs: jobs,
+			want: []string{"kubectl-trace-1", "node-1", "Running", "<none>", "kubectl-trace-2", "node-2", "Failed", "Failed: program compile error", "kubectl-trace-3", "DeadlineExceeded", "Draining"},
+		},
+		{
+			name:    "by ID",
+			jobs:    jobs,
+			traceID: &id,
+			want:    []string{"kubectl-trace-2"},
+			notWant: []string{"kubectl-trace-1"},
+		},
+		{
+			name: "no traces",
+			want: []string{"No resources found."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams, _, out, _ := genericclioptions.NewTestIOStreams()
+			o := NewGetOptions(streams)
+			o.traceID = tt.traceID
+			o.traceJobClient = tracetest.NewTraceJobClient(tt.jobs...)
+
+			if err := o.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("Run() output %q does not contain %q", out.String(), w)
+				}
+			}
+			for _, w := range tt.notWant {
+				if strings.Contains(out.String(), w) {
+					t.Errorf("Run() output %q contains %q", out.String(), w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// currentIdentity tells who the user of the kubeconfig is, for the mappings of the configuration file:
+// the name of the user of the kubeconfig, along with the common name and organizations of its client certificate,
+// or the user and groups it impersonates. The identity is empty when the kubeconfig cannot be read.
+func currentIdentity(flags *genericclioptions.ConfigFlags) config.Identity {
+	id := config.Identity{}
+	raw, err := flags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return id
+	}
+	contextName := raw.CurrentContext
+	if flags.Context != nil && len(*flags.Context) > 0 {
+		contextName = *flags.Context
+	}
+	authName := ""
+	if c, ok := raw.Contexts[contextName]; ok {
+		authName = c.AuthInfo
+	}
+	if flags.AuthInfoName != nil && len(*flags.AuthInfoName) > 0 {
+		authName = *flags.AuthInfoName
+	}
+
+	if flags.Impersonate != nil && len(*flags.Impersonate) > 0 {
+		id.Names = []string{*flags.Impersonate}
+		if flags.ImpersonateGroup != nil {
+			id.Groups = *flags.ImpersonateGroup
+		}
+		return id
+	}
+	auth, ok := raw.AuthInfos[authName]
+	if !ok {
+		return id
+	}
+	if len(auth.Impersonate) > 0 {
+		id.Names = []string{auth.Impersonate}
+		id.Groups = auth.ImpersonateGroups
+		return id
+	}
+
+	id.Names = []string{authName}
+	data := auth.ClientCertificateData
+	if len(data) == 0 && len(auth.ClientCertificate) > 0 {
+		if data, err = ioutil.ReadFile(auth.ClientCertificate); err != nil {
+			return id
+		}
+	}
+	if len(data) > 0 {
+		if name, groups, err := certIdentity(data); err == nil {
+			id.Names = append(id.Names, name)
+			id.Groups = groups
+		}
+	}
+	return id
+}
+
+// certIdentity returns the user and groups of a PEM client certificate, its common name and organizations as
+// kubernetes reads them.
+func certIdentity(data []byte) (string, []string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", nil, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", nil, err
+	}
+	return cert.Subject.CommonName, cert.Subject.Organization, nil
+}
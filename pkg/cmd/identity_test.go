@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCertIdentity(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alice", Organization: []string{"team-payments", "system:masters"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, groups, err := certIdentity(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if err != nil {
+		t.Fatalf("certIdentity() error = %v", err)
+	}
+	if name != "alice" || !reflect.DeepEqual(groups, []string{"team-payments", "system:masters"}) {
+		t.Errorf("certIdentity() = %s, %v", name, groups)
+	}
+
+	if _, _, err := certIdentity([]byte("not a certificate")); err == nil {
+		t.Errorf("certIdentity() of garbage should fail")
+	}
+}
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
 	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
 	"github.com/iovisor/kubectl-trace/pkg/logs"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/redact"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/types"
@@ -16,7 +22,7 @@ import (
 )
 
 var (
-	logShort    = `Print the logs for a specific trace execution` // Wrap with i18n.T()
+	logShort    = `Print the logs for a specific trace execution`
 	logLong     = logShort
 	logExamples = `
   # Logs from a trace using its name
@@ -42,6 +48,8 @@ type LogOptions struct {
 	clientConfig *rest.Config
 	follow       bool
 	timestamps   bool
+	redact       redactOptions
+	config       *config.Config
 }
 
 // NewLogOptions provides an instance of LogOptions with default values.
@@ -54,16 +62,18 @@ func NewLogOptions(streams genericclioptions.IOStreams) *LogOptions {
 }
 
 // NewLogCommand provides the log command wrapping LogOptions.
-func NewLogCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+func NewLogCommand(factory factory.Factory, cfg *config.Config, streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewLogOptions(streams)
+	o.config = cfg
 
 	cmd := &cobra.Command{
 		Use:                   "logs (TRACE_ID | TRACE_NAME) [-f]",
 		DisableFlagsInUseLine: true,
 		Aliases:               []string{"log"},
-		Short:                 logShort,
-		Long:                  logLong,                             // Wrap with templates.LongDesc()
-		Example:               fmt.Sprintf(logExamples, "kubectl"), // Wrap with templates.Examples()
+		Short:                 i18n.T(logShort),
+		Long:                  i18n.T(logLong),                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(i18n.T(logExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage:          true,
 		Args:                  cobra.ExactArgs(1),
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
@@ -72,16 +82,13 @@ func NewLogCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
-				fmt.Fprintln(o.ErrOut, err.Error())
-				return nil
-			}
-			return nil
+			return o.Run()
 		},
 	}
 
 	cmd.Flags().BoolVarP(&o.follow, "follow", "f", o.follow, "Specify if the logs should be streamed")
 	cmd.Flags().BoolVar(&o.timestamps, "timestamps", o.timestamps, "Include timestamps on each line in the log output")
+	o.redact.addFlags(cmd)
 	return cmd
 }
 
@@ -112,7 +119,7 @@ func (o *LogOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 		return err
 	}
 
-	return nil
+	return o.redact.complete(o.config)
 }
 
 func (o *LogOptions) Run() error {
@@ -121,7 +128,14 @@ func (o *LogOptions) Run() error {
 		return err
 	}
 
-	client, err := corev1client.NewForConfig(o.clientConfig)
+	streamConfig := o.clientConfig
+	if o.follow {
+		// --request-timeout is meant for single requests, it must not cut a followed stream
+		streamConfig = rest.CopyConfig(o.clientConfig)
+		streamConfig.Timeout = 0
+	}
+
+	client, err := corev1client.NewForConfig(streamConfig)
 	if err != nil {
 		return err
 	}
@@ -135,19 +149,26 @@ func (o *LogOptions) Run() error {
 		ID:   o.traceID,
 	}
 
-	jobs, err := tc.GetJob(tf)
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs, err := tc.GetJob(ctx, tf)
 
 	if err != nil {
 		return err
 	}
 
 	if len(jobs) == 0 {
-		return fmt.Errorf("no trace found with the provided criterias")
+		return errdefs.Errorf(errdefs.ErrTraceNotFound, "no trace found with the provided criterias")
 	}
 
 	job := jobs[0]
 
-	nl := logs.NewLogs(client, o.IOStreams)
+	streams := o.IOStreams
+	if len(o.redact.res) > 0 {
+		redactor := redact.NewWriter(streams.Out, o.redact.res)
+		defer redactor.Flush()
+		streams.Out = redactor
+	}
+	nl := logs.NewLogs(client, streams)
 	nl.Run(job.ID, job.Namespace, o.follow, o.timestamps)
 	return nil
 }
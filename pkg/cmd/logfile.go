@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// logFileOptions are the options of the file the attached output is copied to.
+type logFileOptions struct {
+	path    string
+	maxSize int64
+	backups int
+}
+
+func (o *logFileOptions) addFlags(cmd *cobra.Command) {
+	o.backups = 3
+	cmd.Flags().StringVar(&o.path, "log-file", o.path, "File the attached output is also written to, appended to when it exists")
+	cmd.Flags().Int64Var(&o.maxSize, "log-file-max-size", o.maxSize, "Size in MiB at which the log file is rotated, never when 0")
+	cmd.Flags().IntVar(&o.backups, "log-file-backups", o.backups, "Number of rotated log files kept")
+}
+
+// tee returns the streams writing the output to the log file as well, and the log file to close once attached.
+func (o *logFileOptions) tee(streams genericclioptions.IOStreams) (genericclioptions.IOStreams, io.Closer, error) {
+	if len(o.path) == 0 {
+		return streams, nopCloser{}, nil
+	}
+	f, err := attacher.OpenRotatingFile(o.path, o.maxSize*1024*1024, o.backups)
+	if err != nil {
+		return streams, nil, err
+	}
+	streams.Out = io.MultiWriter(streams.Out, f)
+	return streams, f, nil
+}
+
+// files returns the log file and its rotated backups.
+func (o *logFileOptions) files() []string {
+	if len(o.path) == 0 {
+		return nil
+	}
+	files := []string{o.path}
+	for i := 1; i <= o.backups; i++ {
+		p := fmt.Sprintf("%s.%d", o.path, i)
+		if _, err := os.Stat(p); err == nil {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sizeUnits are the units of the sizes of parseSize, decimal and binary.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseSize parses a number of bytes with an optional unit like 100MB or 512KiB.
+func parseSize(s string) (int64, error) {
+	number, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(strings.ToUpper(number), strings.ToUpper(u.suffix)) {
+			number, unit = strings.TrimSpace(number[:len(number)-len(u.suffix)]), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number of bytes like 100MB or 512KiB", s)
+	}
+	if n > 0 && unit > (1<<63-1)/n {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * unit, nil
+}
+
+// outputLimiter writes up to max bytes to out, and drops the rest after a truncation marker, counting what it drops.
+type outputLimiter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	max     int64
+	written int64
+	// droppedBytes and droppedLines count the output past max, a partial last line included.
+	droppedBytes int64
+	droppedLines int64
+	lastNewline  bool
+}
+
+func newOutputLimiter(out io.Writer, max int64) *outputLimiter {
+	return &outputLimiter{out: out, max: max, lastNewline: true}
+}
+
+// Write always reports the whole of p written, so that the program is not failed by its truncated output.
+func (l *outputLimiter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(p)
+	if l.droppedBytes == 0 {
+		kept := p
+		if left := l.max - l.written; int64(len(kept)) > left {
+			kept = p[:left]
+		}
+		if len(kept) > 0 {
+			if _, err := l.out.Write(kept); err != nil {
+				return 0, err
+			}
+			l.written += int64(len(kept))
+			l.lastNewline = kept[len(kept)-1] == '\n'
+		}
+		p = p[len(kept):]
+		if len(p) == 0 {
+			return n, nil
+		}
+		marker := fmt.Sprintf("[output truncated after %d bytes by --max-output, the rest of the output is dropped]\n", l.max)
+		if !l.lastNewline {
+			marker = "\n" + marker
+		}
+		if _, err := io.WriteString(l.out, marker); err != nil {
+			return 0, err
+		}
+	}
+	l.droppedBytes += int64(len(p))
+	l.droppedLines += int64(bytes.Count(p, []byte{'\n'}))
+	l.lastNewline = p[len(p)-1] == '\n'
+	return n, nil
+}
+
+// Close tells how much of the output was dropped, when it was truncated.
+func (l *outputLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.droppedBytes == 0 {
+		return nil
+	}
+	lines := l.droppedLines
+	if !l.lastNewline {
+		lines++
+	}
+	_, err := fmt.Fprintf(l.out, "[output truncated: %d bytes in %d lines dropped after the first %d bytes]\n", l.droppedBytes, lines, l.max)
+	return err
+}
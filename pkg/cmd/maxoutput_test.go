@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "0", want: 0},
+		{size: "4096", want: 4096},
+		{size: "100MB", want: 100 * 1000 * 1000},
+		{size: "100mb", want: 100 * 1000 * 1000},
+		{size: "512KiB", want: 512 * 1024},
+		{size: "2 GiB", want: 2 << 30},
+		{size: "10B", want: 10},
+		{size: "MB", wantErr: true},
+		{size: "-1MB", wantErr: true},
+		{size: "1.5MB", wantErr: true},
+		{size: "10PB", wantErr: true},
+		{size: "9223372036854775807GB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := parseSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		max    int64
+		writes []string
+		want   string
+	}{
+		{
+			name:   "within the limit",
+			max:    16,
+			writes: []string{"one\n", "two\n"},
+			want:   "one\ntwo\n",
+		},
+		{
+			name:   "cut at a line",
+			max:    8,
+			writes: []string{"one\n", "two\n", "three\nfour\n"},
+			want: "one\ntwo\n" +
+				"[output truncated after 8 bytes by --max-output, the rest of the output is dropped]\n" +
+				"[output truncated: 11 bytes in 2 lines dropped after the first 8 bytes]\n",
+		},
+		{
+			name:   "cut within a line",
+			max:    6,
+			writes: []string{"one\ntwo\nthr", "ee"},
+			want: "one\ntw\n" +
+				"[output truncated after 6 bytes by --max-output, the rest of the output is dropped]\n" +
+				"[output truncated: 7 bytes in 2 lines dropped after the first 6 bytes]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := newOutputLimiter(&out, tt.max)
+			for _, w := range tt.writes {
+				if n, err := l.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
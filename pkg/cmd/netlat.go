@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	netlatShort = `Capture the TCP connections between two pods on both sides and break down their latency`
+	netlatLong  = `Trace the state changes of the TCP connections on the nodes of a client pod and of a server pod at the same time,
+then merge the events of both sides by connection and print, for each connection from the client to the server,
+the time to connect seen by the client, the time the connection was established on each side,
+and the difference between them, spent outside of the server: in the network and in the client.
+
+Connections are matched by the address and port of the client, so that those made through a service are matched too,
+as long as the address of the client is not translated on the way.`
+
+	netlatExamples = `
+  # Break down the latency of the connections from a frontend pod to a backend pod for a minute
+  %[1]s trace netlat pod/frontend-7d9f8c-x2x4z pod/backend-5b6c4d-k8j2m
+
+  # Same, for five minutes
+  %[1]s trace netlat pod/frontend-7d9f8c-x2x4z pod/backend-5b6c4d-k8j2m --deadline 300
+`
+)
+
+// netlatProgram prints the state changes of the IPv4 TCP sockets of the node, with the time they happened at.
+const netlatProgram = `tracepoint:sock:inet_sock_set_state /args->protocol == 6 && args->family == 2/ {
+  printf("` + netlatEventPrefix + `%d %s %d %s %d %d %d\n", nsecs, ntop(args->saddr), args->sport, ntop(args->daddr), args->dport, args->oldstate, args->newstate);
+}
+`
+
+const (
+	// netlatEventPrefix starts the lines of the events printed by netlatProgram.
+	netlatEventPrefix = "kubectl-trace tcp "
+
+	// The TCP states of the events used to break down the latency.
+	tcpEstablished = 1
+	tcpSynSent     = 2
+	tcpClose       = 7
+)
+
+// NetlatOptions ...
+type NetlatOptions struct {
+	genericclioptions.IOStreams
+
+	serviceAccount      string
+	imageName           string
+	initImageName       string
+	deadline            int64
+	deadlineGracePeriod int64
+
+	resourceArgs []string
+	client       traceTarget
+	server       traceTarget
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewNetlatOptions provides an instance of NetlatOptions with default values.
+func NewNetlatOptions(streams genericclioptions.IOStreams) *NetlatOptions {
+	return &NetlatOptions{
+		IOStreams: streams,
+
+		serviceAccount:      "default",
+		imageName:           ImageNameTag,
+		initImageName:       InitImageNameTag,
+		deadline:            defaultCompareDeadline,
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewNetlatCommand provides the netlat command wrapping NetlatOptions.
+func NewNetlatCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewNetlatOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "netlat CLIENT_POD SERVER_POD",
+		Short:        i18n.T(netlatShort),
+		Long:         i18n.T(netlatLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(netlatExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(2),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace jobs")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Time the connections are captured for, in seconds")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time for the traces to stop after deadline, in seconds")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating NetlatOptions accordingly.
+func (o *NetlatOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.resourceArgs = args
+	if o.deadline <= 0 {
+		return fmt.Errorf("the deadline must be positive, the connections are merged once the traces reach it")
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *NetlatOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Look for the pods
+	for i, t := range []*traceTarget{&o.client, &o.server} {
+		*t, err = lookupTarget(factory, o.namespace, o.resourceArgs[i], "")
+		if err != nil {
+			return err
+		}
+		if !t.isPod {
+			return fmt.Errorf("%s is not a pod, the connections are captured between two pods", o.resourceArgs[i])
+		}
+		if len(t.podIP) == 0 {
+			return fmt.Errorf("pod %s has no IP yet", o.resourceArgs[i])
+		}
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the netlat command.
+func (o *NetlatOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	// The state changes are seen on the nodes, a single trace captures both sides of pods on the same node.
+	nodes := []string{o.client.nodeName}
+	if o.server.nodeName != o.client.nodeName {
+		nodes = append(nodes, o.server.nodeName)
+	}
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs := []tracejob.TraceJob{}
+	for _, node := range nodes {
+		tj, err := tracejob.New(tracejob.NodeTarget(node)).
+			WithNamespace(o.namespace).
+			WithServiceAccount(o.serviceAccount).
+			WithProgram(netlatProgram).
+			WithImage(o.imageName).
+			WithInitImage(o.initImageName).
+			WithDeadline(o.deadline).
+			WithDeadlineGracePeriod(o.deadlineGracePeriod).
+			Build()
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, tj)
+	}
+	for i, tj := range jobs {
+		if _, err := tc.CreateJob(ctx, tj); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.IOStreams.ErrOut, "trace %s created on node %s\n", tj.ID, nodes[i])
+	}
+
+	outputs := make([]attachOutput, len(jobs))
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i, tj := range jobs {
+		wg.Add(1)
+		go func(i int, tj tracejob.TraceJob) {
+			defer wg.Done()
+			a := attacher.NewAttacher(coreClient, o.clientConfig, genericclioptions.IOStreams{})
+			a.WithContext(ctx)
+			a.WithQuiet(true)
+			errs[i] = a.AttachJobTo(tj.ID, tj.Namespace, attacher.Streams{Out: &outputs[i], ErrOut: o.IOStreams.ErrOut})
+		}(i, tj)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		fmt.Fprintln(o.IOStreams.ErrOut, interruptedOutputsWarning)
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	clientEvents := parseTCPEvents(outputs[0].String())
+	serverEvents := clientEvents
+	if len(outputs) > 1 {
+		serverEvents = parseTCPEvents(outputs[1].String())
+	}
+	writeConnections(o.IOStreams.Out, mergeConnections(o.client.podIP, o.server.podIP, clientEvents, serverEvents))
+	return nil
+}
+
+// tcpEvent is a state change of a TCP socket, local and remote being address:port.
+type tcpEvent struct {
+	time     int64
+	local    string
+	remote   string
+	oldState int
+	newState int
+}
+
+// parseTCPEvents parses the events printed by netlatProgram, in order.
+func parseTCPEvents(output string) []tcpEvent {
+	events := []tcpEvent{}
+	for _, l := range strings.Split(output, "\n") {
+		l = strings.TrimSpace(l)
+		if !strings.HasPrefix(l, netlatEventPrefix) {
+			continue
+		}
+		f := strings.Fields(strings.TrimPrefix(l, netlatEventPrefix))
+		if len(f) != 7 {
+			continue
+		}
+		var n [4]int64
+		var err error
+		for i, s := range []string{f[0], f[4], f[5], f[6]} {
+			if n[i], err = strconv.ParseInt(s, 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		events = append(events, tcpEvent{
+			time:     n[0],
+			local:    f[1] + ":" + f[2],
+			remote:   f[3] + ":" + f[4],
+			oldState: int(n[2]),
+			newState: int(n[3]),
+		})
+	}
+	return events
+}
+
+// connectionSide is what one side of a connection saw of it, the times being those of the clock of its node.
+type connectionSide struct {
+	local       string
+	synSent     int64
+	established int64
+	closed      int64
+}
+
+// connection is a connection from the client to the server, as seen by both sides.
+type connection struct {
+	client connectionSide
+	server connectionSide
+}
+
+// sides returns the connections of the events whose local address is ip, keyed by the client endpoint:
+// the local one when clientSide, the remote one otherwise.
+func sides(ip string, clientSide bool, events []tcpEvent) (map[string]*connectionSide, []string) {
+	byClient := map[string]*connectionSide{}
+	keys := []string{}
+	for _, e := range events {
+		if !strings.HasPrefix(e.local, ip+":") {
+			continue
+		}
+		key := e.remote
+		if clientSide {
+			key = e.local
+		}
+		s, ok := byClient[key]
+		if !ok {
+			s = &connectionSide{local: e.local}
+			byClient[key] = s
+			keys = append(keys, key)
+		}
+		switch e.newState {
+		case tcpSynSent:
+			s.synSent = e.time
+		case tcpEstablished:
+			s.established = e.time
+		case tcpClose:
+			s.closed = e.time
+		}
+	}
+	return byClient, keys
+}
+
+// mergeConnections matches the connections seen by the client with the ones seen by the server,
+// in the order the client made them.
+func mergeConnections(clientIP, serverIP string, clientEvents, serverEvents []tcpEvent) []connection {
+	clients, keys := sides(clientIP, true, clientEvents)
+	servers, _ := sides(serverIP, false, serverEvents)
+	conns := []connection{}
+	for _, k := range keys {
+		s, ok := servers[k]
+		if !ok {
+			continue
+		}
+		conns = append(conns, connection{client: *clients[k], server: *s})
+	}
+	sort.SliceStable(conns, func(i, j int) bool {
+		return conns[i].client.established < conns[j].client.established
+	})
+	return conns
+}
+
+// span returns the duration between two times of the same clock, not ok when either is unknown.
+func span(from, to int64) (time.Duration, bool) {
+	if from == 0 || to == 0 || to < from {
+		return 0, false
+	}
+	return time.Duration(to - from), true
+}
+
+func formatSpan(d time.Duration, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return d.Round(time.Microsecond).String()
+}
+
+// writeConnections writes the latency breakdown of each connection.
+func writeConnections(w io.Writer, conns []connection) {
+	if len(conns) == 0 {
+		fmt.Fprintln(w, "no connection between the pods was seen on both sides")
+		return
+	}
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "CLIENT\tSERVER\tCONNECT\tCLIENT TIME\tSERVER TIME\tOUTSIDE SERVER\n")
+	for _, c := range conns {
+		connect, connectOK := span(c.client.synSent, c.client.established)
+		clientTime, clientOK := span(c.client.established, c.client.closed)
+		serverTime, serverOK := span(c.server.established, c.server.closed)
+		outside, outsideOK := clientTime-serverTime, clientOK && serverOK && clientTime >= serverTime
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.client.local, c.server.local,
+			formatSpan(connect, connectOK), formatSpan(clientTime, clientOK), formatSpan(serverTime, serverOK), formatSpan(outside, outsideOK))
+	}
+}
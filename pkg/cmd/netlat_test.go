@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMergeConnections(t *testing.T) {
+	// The client connects to the server through the address of a service, 10.96.0.10:80.
+	clientOutput := `Attaching 1 probe...
+kubectl-trace tcp 1000000 10.0.1.5 43512 10.96.0.10 80 7 2
+kubectl-trace tcp 1400000 10.0.1.5 43512 10.96.0.10 80 2 1
+kubectl-trace tcp 1500000 10.0.1.9 40000 10.0.2.7 8080 7 2
+kubectl-trace tcp 13400000 10.0.1.5 43512 10.96.0.10 80 4 7
+kubectl-trace tcp 2000000 10.0.1.5 43600 10.96.0.10 80 7 2
+garbage
+`
+	serverOutput := `kubectl-trace tcp 50000000 10.0.2.7 8080 10.0.1.5 43512 3 1
+kubectl-trace tcp 61100000 10.0.2.7 8080 10.0.1.5 43512 8 7
+`
+
+	conns := mergeConnections("10.0.1.5", "10.0.2.7", parseTCPEvents(clientOutput), parseTCPEvents(serverOutput))
+	if len(conns) != 1 {
+		t.Fatalf("mergeConnections() = %+v, want the only connection seen on both sides", conns)
+	}
+
+	var b bytes.Buffer
+	writeConnections(&b, conns)
+	want := `CLIENT          SERVER         CONNECT  CLIENT TIME  SERVER TIME  OUTSIDE SERVER
+10.0.1.5:43512  10.0.2.7:8080  400µs    12ms         11.1ms       900µs
+`
+	if got := b.String(); got != want {
+		t.Errorf("writeConnections() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteConnectionsNone(t *testing.T) {
+	var b bytes.Buffer
+	writeConnections(&b, nil)
+	if got := b.String(); got != "no connection between the pods was seen on both sides\n" {
+		t.Errorf("writeConnections() = %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// outputFormats are the formats of --output, printing the objects of a trace.
+var outputFormats = []string{"yaml", "json"}
+
+func validateOutput(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("--output must be one of %s, got %q", strings.Join(outputFormats, ", "), format)
+}
+
+// printObjects prints the configmap and the job of a trace as a list in the format, YAML when empty, like kubectl get
+// prints several objects. The decoded objects have lost their kind, it is set back on copies.
+func printObjects(out io.Writer, format string, cm *v1.ConfigMap, job *batchv1.Job) error {
+	cm = cm.DeepCopy()
+	cm.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	job = job.DeepCopy()
+	job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+	list := &v1.List{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"},
+		Items:    []runtime.RawExtension{{Object: cm}, {Object: job}},
+	}
+
+	var b []byte
+	var err error
+	if format == "json" {
+		b, err = json.MarshalIndent(list, "", "    ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(list)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(b)
+	return err
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrintObjects(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubectl-trace-1", ResourceVersion: "42"},
+		Data:       map[string]string{"program.bt": "BEGIN { exit(); }"},
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "kubectl-trace-1", UID: "uid-1"}}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: "",
+			want:   []string{"kind: List", "kind: ConfigMap", "resourceVersion: \"42\"", "kind: Job", "uid: uid-1", "program.bt: BEGIN { exit(); }"},
+		},
+		{
+			format: "yaml",
+			want:   []string{"kind: List", "apiVersion: batch/v1"},
+		},
+		{
+			format: "json",
+			want:   []string{`"kind": "List"`, `"kind": "ConfigMap"`, `"kind": "Job"`, `"uid": "uid-1"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := printObjects(&out, tt.format, cm, job); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("output misses %q:\n%s", w, out.String())
+				}
+			}
+		})
+	}
+	if len(cm.Kind) > 0 || len(job.Kind) > 0 {
+		t.Errorf("the printed objects were modified")
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, f := range []string{"yaml", "json"} {
+		if err := validateOutput(f); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+	if err := validateOutput("wide"); err == nil {
+		t.Errorf("wide: want an error")
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// probesPollInterval is how often the trace runner checks whether the program attached its probes.
+const probesPollInterval = 500 * time.Millisecond
+
+// phaseOrder orders the phases of the trace runner, a phase is only reported after the ones before it.
+var phaseOrder = map[string]int{
+	meta.PhaseWaiting:   1,
+	meta.PhaseCompiling: 2,
+	meta.PhaseRunning:   3,
+	meta.PhaseDraining:  4,
+	meta.PhaseCompleted: 5,
+	meta.PhaseFailed:    5,
+}
+
+// phaseReporter reports the phase of the trace runner as an annotation of its pod, for the CLI to display it.
+// Reporting is best effort: the service account of the trace job needs to patch pods, the trace runs without it.
+type phaseReporter struct {
+	mu sync.Mutex
+	// patch applies a merge patch to the pod.
+	patch    func(data []byte) error
+	last     string
+	disabled bool
+}
+
+// newPhaseReporter returns nil when the trace runner does not know its pod or cannot talk to the API server.
+func newPhaseReporter() *phaseReporter {
+	name, namespace := os.Getenv(meta.EnvPodName), os.Getenv(meta.EnvPodNamespace)
+	if len(name) == 0 || len(namespace) == 0 {
+		return nil
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil
+	}
+	client, err := corev1typed.NewForConfig(config)
+	if err != nil {
+		return nil
+	}
+	pods := client.Pods(namespace)
+	return &phaseReporter{patch: func(data []byte) error {
+		_, err := pods.Patch(name, types.MergePatchType, data)
+		return err
+	}}
+}
+
+// report annotates the pod with the phase, unless a later phase was already reported.
+func (r *phaseReporter) report(phase string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.disabled || phaseOrder[phase] <= phaseOrder[r.last] {
+		return
+	}
+	r.last = phase
+
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, meta.TracePhaseAnnotationKey, phase)
+	err := r.patch([]byte(patch))
+	if errors.IsForbidden(err) {
+		// The service account is not allowed to patch pods, the phases are not reported.
+		r.disabled = true
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not report the %s phase: %v\n", phase, err)
+	}
+}
+
+// waitForProbes waits until the process with the given pid holds a BPF program, which is once it attached its probes.
+// It returns false when done is closed before.
+func waitForProbes(pid int, done <-chan struct{}) bool {
+	t := time.NewTicker(probesPollInterval)
+	defer t.Stop()
+	for {
+		if holdsBPFProgram(pid) {
+			return true
+		}
+		select {
+		case <-done:
+			return false
+		case <-t.C:
+		}
+	}
+}
+
+// holdsBPFProgram tells whether one of the file descriptors of the process is a BPF program.
+func holdsBPFProgram(pid int) bool {
+	dir := path.Join("/proc", fmt.Sprint(pid), "fd")
+	fds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, fd := range fds {
+		if link, err := os.Readlink(path.Join(dir, fd.Name())); err == nil && link == "anon_inode:bpf-prog" {
+			return true
+		}
+	}
+	return false
+}
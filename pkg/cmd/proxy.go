@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+)
+
+// proxyFromEnv is the value of --proxy passing the proxy of the environment of kubectl-trace on to the trace.
+const proxyFromEnv = "env"
+
+// proxyOptions are the proxy the trace job pod reaches the network through.
+type proxyOptions struct {
+	proxy   string
+	noProxy string
+
+	// bundle is the proxy of the bundle run by --from-bundle, over the configuration, nil when there is none.
+	bundle *tracejob.Proxy
+
+	value tracejob.Proxy
+}
+
+func (o *proxyOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.proxy, "proxy", o.proxy, "URL of the proxy the pod of the kubectl-trace job reaches the network through, to fetch the linux headers, or env for the HTTP_PROXY, HTTPS_PROXY and NO_PROXY of the environment")
+	cmd.Flags().StringVar(&o.noProxy, "no-proxy", o.noProxy, "Hosts, domains and networks, separated by commas, that the pod of the kubectl-trace job reaches without the proxy")
+}
+
+// complete sets the proxy of the flags, or of the bundle or the configuration for the flags that have not been set.
+func (o *proxyOptions) complete(cmd *cobra.Command, cfg *config.Config) error {
+	if o.bundle != nil && !cmd.Flag("proxy").Changed {
+		o.value = *o.bundle
+		if cmd.Flag("no-proxy").Changed {
+			o.value.NoProxy = o.noProxy
+		}
+		return nil
+	}
+	if cfg != nil {
+		if !cmd.Flag("proxy").Changed {
+			o.proxy = cfg.Proxy
+		}
+		if !cmd.Flag("no-proxy").Changed {
+			o.noProxy = cfg.NoProxy
+		}
+	}
+	switch o.proxy {
+	case "":
+		o.value = tracejob.Proxy{}
+		return nil
+	case proxyFromEnv:
+		o.value = tracejob.Proxy{
+			HTTP:    getenv("HTTP_PROXY", "http_proxy"),
+			HTTPS:   getenv("HTTPS_PROXY", "https_proxy"),
+			NoProxy: getenv("NO_PROXY", "no_proxy"),
+		}
+	default:
+		u, err := url.Parse(o.proxy)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("invalid --proxy %q, expected a URL like http://proxy.internal:3128 or %s", o.proxy, proxyFromEnv)
+		}
+		o.value = tracejob.Proxy{HTTP: o.proxy, HTTPS: o.proxy}
+	}
+	if cmd.Flag("no-proxy").Changed || len(o.noProxy) > 0 {
+		o.value.NoProxy = o.noProxy
+	}
+	return nil
+}
+
+// getenv returns the first of the environment variables that is set.
+func getenv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
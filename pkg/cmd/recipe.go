@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	recipeShort = `Run the programs of a recipe together against a target and report their outputs`
+	recipeLong  = `Run the programs of a recipe against the same node or pod at the same time, each by its own trace,
+then print a single report with the output of each program.
+
+Recipes are defined by name in the recipes of the configuration file, or in a file of their own to share them.
+The traces run until their deadline, when bpftrace prints the maps of the programs.`
+
+	recipeExamples = `
+  # Check the health of the IOs of a node for a minute with the io-health recipe of the configuration file
+  %[1]s trace recipe io-health node/node-1
+
+  # Run the recipe of a file against a pod container for five minutes
+  %[1]s trace recipe -f io-health.yaml pod/mysql-0 -c mysql --deadline 300
+`
+)
+
+// RecipeOptions ...
+type RecipeOptions struct {
+	genericclioptions.IOStreams
+
+	config *config.Config
+
+	recipeName          string
+	recipeFile          string
+	container           string
+	serviceAccount      string
+	imageName           string
+	initImageName       string
+	fetchHeaders        bool
+	deadline            int64
+	deadlineGracePeriod int64
+
+	resourceArg  string
+	recipe       *config.Recipe
+	target       traceTarget
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewRecipeOptions provides an instance of RecipeOptions with default values.
+func NewRecipeOptions(streams genericclioptions.IOStreams) *RecipeOptions {
+	return &RecipeOptions{
+		IOStreams: streams,
+
+		serviceAccount:      "default",
+		imageName:           ImageNameTag,
+		initImageName:       InitImageNameTag,
+		deadline:            defaultCompareDeadline,
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewRecipeCommand provides the recipe command wrapping RecipeOptions.
+func NewRecipeCommand(factory factory.Factory, cfg *config.Config, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewRecipeOptions(streams)
+	o.config = cfg
+
+	cmd := &cobra.Command{
+		Use:          "recipe (NAME | -f FILENAME) TARGET [-c CONTAINER]",
+		Short:        i18n.T(recipeShort),
+		Long:         i18n.T(recipeLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(recipeExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.recipeFile, "filename", "f", o.recipeFile, "File defining the recipe, instead of naming one of the configuration file")
+	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace jobs")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Time the programs run before printing their maps, in seconds")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time to print maps or histograms after deadline, in seconds")
+
+	cmd.MarkFlagFilename("filename", "yaml", "yml")
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating RecipeOptions accordingly.
+func (o *RecipeOptions) Validate(cmd *cobra.Command, args []string) error {
+	if cmd.Flag("filename").Changed {
+		if len(args) != 1 {
+			return fmt.Errorf("the target is the only argument when the recipe is defined by a file")
+		}
+		o.resourceArg = args[0]
+	} else {
+		if len(args) != 2 {
+			return fmt.Errorf("the name of the recipe and the target are required arguments for the recipe command")
+		}
+		o.recipeName, o.resourceArg = args[0], args[1]
+	}
+	if o.deadline <= 0 {
+		return fmt.Errorf("the deadline must be positive, the outputs are reported once the programs reach it")
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *RecipeOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare recipe
+	var err error
+	if len(o.recipeFile) > 0 {
+		o.recipe, err = config.LoadRecipe(o.recipeFile)
+		o.recipeName = o.recipeFile
+	} else {
+		cfg := o.config
+		if cfg == nil {
+			cfg = &config.Config{}
+		}
+		o.recipe, err = cfg.Recipe(o.recipeName)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Prepare namespace
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.target, err = lookupTarget(factory, o.namespace, o.resourceArg, o.container)
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the recipe command.
+func (o *RecipeOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	ctx := signals.WithStandardSignals(context.Background())
+	jobs := []tracejob.TraceJob{}
+	for _, p := range o.recipe.Programs {
+		tj, err := tracejob.New(o.target.tracejobTarget()).
+			WithNamespace(o.namespace).
+			WithServiceAccount(o.serviceAccount).
+			WithProgram(p.Program).
+			WithImage(o.imageName).
+			WithInitImage(o.initImageName).
+			WithFetchHeaders(o.fetchHeaders).
+			WithDeadline(o.deadline).
+			WithDeadlineGracePeriod(o.deadlineGracePeriod).
+			Build()
+		if err != nil {
+			return fmt.Errorf("program %s: %v", p.Name, err)
+		}
+		jobs = append(jobs, tj)
+	}
+	// All the traces are created before attaching, so that they run over the same period.
+	for i, tj := range jobs {
+		if _, err := tc.CreateJob(ctx, tj); err != nil {
+			return fmt.Errorf("program %s: %v", o.recipe.Programs[i].Name, err)
+		}
+		fmt.Fprintf(o.IOStreams.ErrOut, "trace %s created for %s\n", tj.ID, o.recipe.Programs[i].Name)
+	}
+
+	outputs := make([]attachOutput, len(jobs))
+	errs := make([]error, len(jobs))
+	var wg sync.WaitGroup
+	for i, tj := range jobs {
+		wg.Add(1)
+		go func(i int, tj tracejob.TraceJob) {
+			defer wg.Done()
+			a := attacher.NewAttacher(coreClient, o.clientConfig, genericclioptions.IOStreams{})
+			a.WithContext(ctx)
+			a.WithQuiet(true)
+			errs[i] = a.AttachJobTo(tj.ID, tj.Namespace, attacher.Streams{Out: &outputs[i], ErrOut: o.IOStreams.ErrOut})
+		}(i, tj)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		fmt.Fprintln(o.IOStreams.ErrOut, interruptedOutputsWarning)
+	}
+
+	results := make([]recipeResult, len(jobs))
+	for i, p := range o.recipe.Programs {
+		results[i] = recipeResult{name: p.Name, output: outputs[i].String(), err: errs[i]}
+	}
+	writeRecipeReport(o.IOStreams.Out, o.recipeName, o.resourceArg, o.recipe.Description, results)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recipeResult is the outcome of the trace of a program of a recipe.
+type recipeResult struct {
+	name   string
+	output string
+	err    error
+}
+
+// writeRecipeReport writes the report of the recipe run against the target: its description,
+// then the output of each program in the order of the recipe, with the error of those that failed.
+func writeRecipeReport(w io.Writer, recipe, target, description string, results []recipeResult) {
+	fmt.Fprintf(w, "Recipe %s on %s\n", recipe, target)
+	if len(description) > 0 {
+		fmt.Fprintf(w, "%s\n", strings.TrimSpace(description))
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "=== %s ===\n", r.name)
+		if out := strings.TrimRight(r.output, "\n"); len(out) > 0 {
+			fmt.Fprintf(w, "%s\n", out)
+		}
+		if r.err != nil {
+			fmt.Fprintf(w, "error: %v\n", r.err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestWriteRecipeReport(t *testing.T) {
+	var b bytes.Buffer
+	writeRecipeReport(&b, "io-health", "node/node-1", "Latency of the disks\n", []recipeResult{
+		{name: "biolatency", output: "@usecs:\n[1]  3 |@@@@|\n\n"},
+		{name: "fsslower", err: fmt.Errorf("the program failed")},
+	})
+
+	want := `Recipe io-health on node/node-1
+Latency of the disks
+=== biolatency ===
+@usecs:
+[1]  3 |@@@@|
+=== fsslower ===
+error: the program failed
+`
+	if got := b.String(); got != want {
+		t.Errorf("writeRecipeReport() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/iovisor/kubectl-trace/pkg/recording"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+// The terminal size of the sessions recorded when the output is not a terminal.
+const (
+	recordWidth  = 80
+	recordHeight = 24
+)
+
+// recordOptions are the options of the session the attached output is recorded to.
+type recordOptions struct {
+	path string
+}
+
+func (o *recordOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.path, "record", o.path, "File the attached output is recorded to with its timing, as an asciicast v2 session to play back with kubectl trace replay or asciinema")
+}
+
+// record returns the streams recording the output to the session as well, and the session to close once attached.
+func (o *recordOptions) record(streams genericclioptions.IOStreams, title string) (genericclioptions.IOStreams, io.Closer, error) {
+	if len(o.path) == 0 {
+		return streams, nopCloser{}, nil
+	}
+	width, height := recordWidth, recordHeight
+	if size := (term.TTY{Out: streams.Out}).GetSize(); size != nil {
+		width, height = int(size.Width), int(size.Height)
+	}
+	f, err := os.Create(o.path)
+	if err != nil {
+		return streams, nil, err
+	}
+	r, err := recording.NewRecorder(f, width, height, title)
+	if err != nil {
+		f.Close()
+		return streams, nil, err
+	}
+	streams.Out = io.MultiWriter(streams.Out, r)
+	return streams, &session{r: r, f: f}, nil
+}
+
+// files returns the recorded session.
+func (o *recordOptions) files() []string {
+	if len(o.path) == 0 {
+		return nil
+	}
+	return []string{o.path}
+}
+
+// session is a recorded session to close once attached.
+type session struct {
+	r *recording.Recorder
+	f *os.File
+}
+
+func (s *session) Close() error {
+	if err := s.r.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
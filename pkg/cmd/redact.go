@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"regexp"
+
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/redact"
+	"github.com/spf13/cobra"
+)
+
+// redactOptions are the regular expressions of the text redacted from the output of the traces.
+type redactOptions struct {
+	exprs []string
+	res   []*regexp.Regexp
+}
+
+func (o *redactOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&o.exprs, "redact", o.exprs, "Regular expression of the text replaced by [REDACTED] in the output, only its groups when it has some, can be repeated")
+}
+
+// complete compiles the regular expressions of the flags and of the configuration, which always apply.
+func (o *redactOptions) complete(cfg *config.Config) error {
+	exprs := o.exprs
+	if cfg != nil {
+		exprs = append(append([]string(nil), cfg.Redact...), exprs...)
+	}
+	var err error
+	o.res, err = redact.Compile(exprs)
+	return err
+}
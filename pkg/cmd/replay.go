@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/recording"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+var (
+	replayShort = `Play back a recorded session`
+	replayLong  = `Play back a session recorded with --record, with the timing of its output, for incident reviews
+or to show how a problem manifested.
+
+The session is played locally, it does not need a cluster.`
+
+	replayExamples = `
+  # Play back a session as it was recorded
+  %[1]s trace replay session.cast
+
+  # Play back a session twice as fast
+  %[1]s trace replay session.cast --speed 2x`
+)
+
+// ReplayOptions ...
+type ReplayOptions struct {
+	genericclioptions.IOStreams
+
+	path     string
+	speedArg string
+	speed    float64
+}
+
+// NewReplayOptions provides an instance of ReplayOptions with default values.
+func NewReplayOptions(streams genericclioptions.IOStreams) *ReplayOptions {
+	return &ReplayOptions{
+		IOStreams: streams,
+		speedArg:  "1x",
+	}
+}
+
+// NewReplayCommand provides the replay command wrapping ReplayOptions.
+func NewReplayCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewReplayOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:                   "replay FILE [--speed SPEED]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T(replayShort),
+		Long:                  i18n.T(replayLong),                             // Wrap with templates.LongDesc()
+		Example:               fmt.Sprintf(i18n.T(replayExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage:          true,
+		Args:                  cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.speedArg, "speed", o.speedArg, "How many times faster than recorded the session is played back, like 2x or 0.5x")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating ReplayOptions accordingly.
+func (o *ReplayOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.path = args[0]
+	var err error
+	o.speed, err = parseSpeed(o.speedArg)
+	return err
+}
+
+// parseSpeed parses a speed like 2x, the x being optional.
+func parseSpeed(arg string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(arg, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("the speed must be a positive number like 2x, got %q", arg)
+	}
+	return speed, nil
+}
+
+// Run executes the replay command.
+func (o *ReplayOptions) Run() error {
+	f, err := os.Open(o.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := signals.WithStandardSignals(context.Background())
+	if _, err := recording.Play(ctx, o.IOStreams.Out, f, o.speed); err != nil && err != context.Canceled {
+		return fmt.Errorf("cannot replay %s: %v", o.path, err)
+	}
+	return nil
+}
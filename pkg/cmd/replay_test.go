@@ -0,0 +1,26 @@
+package cmd
+
+import "testing"
+
+func TestParseSpeed(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    float64
+		wantErr bool
+	}{
+		{arg: "2x", want: 2},
+		{arg: "2", want: 2},
+		{arg: "0.5x", want: 0.5},
+		{arg: "0x", wantErr: true},
+		{arg: "-1x", wantErr: true},
+		{arg: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseSpeed(tt.arg)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseSpeed() = %v, %v, want %v, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/copier"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The statuses of a run in its report, besides the ones of tracejob.TraceJobStatus.
+const (
+	// reportNotCreated is the status of a run that failed before its trace was created.
+	reportNotCreated = "NotCreated"
+	// reportCreated is the status of a run that created its trace without waiting for it.
+	reportCreated = "Created"
+)
+
+// runReport is the machine readable report of a run written by --report, to be archived with incident timelines.
+type runReport struct {
+	TraceID   types.UID        `json:"traceID,omitempty"`
+	TraceName string           `json:"traceName,omitempty"`
+	Namespace string           `json:"namespace,omitempty"`
+	Target    reportTarget     `json:"target"`
+	Spec      reportSpec       `json:"spec"`
+	Status    string           `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	ExitCode  int              `json:"exitCode"`
+	StartedAt time.Time        `json:"startedAt"`
+	CreatedAt *time.Time       `json:"createdAt,omitempty"`
+	EndedAt   time.Time        `json:"endedAt"`
+	Duration  string           `json:"duration"`
+	Artifacts []reportArtifact `json:"artifacts,omitempty"`
+}
+
+type reportTarget struct {
+	Node      string `json:"node"`
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+type reportSpec struct {
+	// Program is the bpftrace program, left out for binaries which are only known by their checksum.
+	Program             string `json:"program,omitempty"`
+	ProgramSHA256       string `json:"programSHA256"`
+	Binary              bool   `json:"binary,omitempty"`
+	Image               string `json:"image"`
+	Deadline            int64  `json:"deadline"`
+	DeadlineGracePeriod int64  `json:"deadlineGracePeriod"`
+	Unsafe              bool   `json:"unsafe,omitempty"`
+	Buffering           string `json:"buffering,omitempty"`
+	TracerFlags         string `json:"tracerFlags,omitempty"`
+	SnapshotInterval    string `json:"snapshotInterval,omitempty"`
+	MaxOutput           int64  `json:"maxOutput,omitempty"`
+	Attach              bool   `json:"attach"`
+}
+
+// reportArtifact is a local file written by the run, with its checksum.
+type reportArtifact struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// newRunReport starts the report of the run with its spec and target.
+func (o *RunOptions) newRunReport() *runReport {
+	program := []byte(o.program)
+	if len(o.binary) > 0 {
+		program = o.binary
+	}
+	sum := sha256.Sum256(program)
+	r := &runReport{
+		Namespace: o.namespace,
+		Target: reportTarget{
+			Node: o.nodeName,
+		},
+		Spec: reportSpec{
+			ProgramSHA256:       hex.EncodeToString(sum[:]),
+			Binary:              len(o.binary) > 0,
+			Image:               o.imageName,
+			Deadline:            o.deadline,
+			DeadlineGracePeriod: o.deadlineGracePeriod,
+			Unsafe:              o.unsafe,
+			Buffering:           o.buffering,
+			TracerFlags:         o.tracerFlags,
+			MaxOutput:           o.maxOutput,
+			Attach:              o.attach,
+		},
+		Status:    reportNotCreated,
+		StartedAt: time.Now(),
+	}
+	if len(o.binary) == 0 {
+		r.Spec.Program = o.program
+	}
+	if o.snapshotInterval > 0 {
+		r.Spec.SnapshotInterval = o.snapshotInterval.String()
+	}
+	if o.isPod {
+		r.Target.Pod = o.target.Name
+		r.Target.Namespace = o.target.Namespace
+		r.Target.Container = o.container
+	}
+	return r
+}
+
+// created records the creation of the trace.
+func (r *runReport) created(tj tracejob.TraceJob) {
+	now := time.Now()
+	r.TraceID = tj.ID
+	r.TraceName = tj.Name
+	r.CreatedAt = &now
+	r.Status = reportCreated
+}
+
+// finish records the outcome of the run and the checksums of the local files it wrote.
+func (r *runReport) finish(err error, files []string) {
+	r.EndedAt = time.Now()
+	r.Duration = r.EndedAt.Sub(r.StartedAt).Round(time.Millisecond).String()
+	r.ExitCode = errdefs.ExitCode(err)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, f := range files {
+		sum, err := copier.Checksum(f)
+		if err != nil {
+			// The rotated files that were never written are not artifacts.
+			continue
+		}
+		r.Artifacts = append(r.Artifacts, reportArtifact{Path: f, SHA256: sum})
+	}
+}
+
+func (r *runReport) write(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write the report: %v", err)
+	}
+	return nil
+}
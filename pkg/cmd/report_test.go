@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestRunReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-trace-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	streams, _, _, _ := genericclioptions.NewTestIOStreams()
+	o := NewRunOptions(streams)
+	o.program = `kprobe:do_sys_open { @ = count(); }`
+	o.nodeName = "node-1"
+	o.isPod = true
+	o.target = corev1.ObjectReference{Kind: "Pod", Name: "nginx", Namespace: "web"}
+	o.container = "nginx"
+	o.logFile.path = filepath.Join(dir, "trace.out")
+	if err := ioutil.WriteFile(o.logFile.path, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := o.newRunReport()
+	r.created(tracejob.TraceJob{ID: "5594d7e1", Name: "kubectl-trace-5594d7e1"})
+	r.finish(errdefs.Errorf(errdefs.ErrProgramInvalid, "the trace program failed"), o.logFile.files())
+
+	path := filepath.Join(dir, "report.json")
+	if err := r.write(path); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runReport{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("the report is not JSON: %v", err)
+	}
+
+	if got.TraceID != "5594d7e1" || got.Status != reportCreated || got.CreatedAt == nil {
+		t.Errorf("trace = %s, %s, %v", got.TraceID, got.Status, got.CreatedAt)
+	}
+	if got.Target != (reportTarget{Node: "node-1", Pod: "nginx", Namespace: "web", Container: "nginx"}) {
+		t.Errorf("target = %+v", got.Target)
+	}
+	if got.Spec.Program != o.program || len(got.Spec.ProgramSHA256) != 64 {
+		t.Errorf("spec = %+v", got.Spec)
+	}
+	if got.ExitCode != errdefs.ExitProgramInvalid || got.Error != "the trace program failed" {
+		t.Errorf("outcome = %d, %q", got.ExitCode, got.Error)
+	}
+	want := reportArtifact{Path: o.logFile.path, SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+	if len(got.Artifacts) != 1 || got.Artifacts[0] != want {
+		t.Errorf("artifacts = %+v, want %+v", got.Artifacts, want)
+	}
+}
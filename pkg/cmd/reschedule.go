@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/events"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// reschedulePollInterval is how often the traced pod is looked for on another node once its node is drained.
+const reschedulePollInterval = 2 * time.Second
+
+// rescheduleTrace recreates the trace of a pod whose node was drained against the pod once it runs on another node,
+// the pod itself or the one replacing it under the same controller. The new trace runs for what is left of the
+// deadline, until, and waiting for the pod gives up then.
+func (o *RunOptions) rescheduleTrace(ctx context.Context, tc *tracejob.TraceJobClient, core corev1client.CoreV1Interface, until time.Time) (tracejob.TraceJob, error) {
+	if !o.quiet {
+		fmt.Fprintf(o.IOStreams.ErrOut, "waiting for pod %s to run on another node\n", o.target.Name)
+	}
+	waitCtx, cancel := context.WithDeadline(ctx, until)
+	defer cancel()
+	var t traceTarget
+	err := wait.PollImmediateUntil(reschedulePollInterval, func() (bool, error) {
+		pl, err := core.Pods(o.target.Namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		for i := range pl.Items {
+			p := &pl.Items[i]
+			if !rescheduled(p, o.target.Name, o.controllerUID) {
+				continue
+			}
+			if t, err = podTarget(core, p, o.container); err != nil {
+				return false, err
+			}
+			if t.nodeName != o.nodeName {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, waitCtx.Done())
+	if err != nil {
+		return tracejob.TraceJob{}, fmt.Errorf("pod %s did not run on another node before the deadline of the trace: %v", o.target.Name, err)
+	}
+
+	o.podUID, o.nodeName, o.target = t.podUID, t.nodeName, t.ref
+	o.deadline = int64(time.Until(until) / time.Second)
+	tj, err := o.buildTraceJob(t.tracejobTarget())
+	if err != nil {
+		return tj, err
+	}
+	if _, err := tc.CreateJob(ctx, tj); err != nil {
+		return tj, err
+	}
+	if o.quiet {
+		fmt.Fprintln(o.IOStreams.Out, tj.ID)
+	} else {
+		fmt.Fprintf(o.IOStreams.Out, "trace %s created on node %s\n", tj.ID, tj.Hostname)
+	}
+	return tj, nil
+}
+
+// rescheduled tells whether the pod is the traced pod, named name, or its replacement under the controller with the
+// given UID, running.
+func rescheduled(p *v1.Pod, name string, controllerUID types.UID) bool {
+	if p.Status.Phase != v1.PodRunning || p.DeletionTimestamp != nil {
+		return false
+	}
+	if p.Name == name {
+		return true
+	}
+	c := metav1.GetControllerOf(p)
+	return len(controllerUID) > 0 && c != nil && c.UID == controllerUID
+}
+
+// podTarget returns the target of a trace of the container of the pod, like lookupTarget does for the pods it finds.
+func podTarget(core corev1client.CoreV1Interface, p *v1.Pod, container string) (traceTarget, error) {
+	target, err := tracejob.ResolvePodTarget(core, p, container)
+	if err != nil {
+		return traceTarget{}, err
+	}
+	t := traceTarget{isPod: true, podUID: target.PodUID, container: target.ContainerName, nodeName: target.Hostname, podIP: p.Status.PodIP, ref: events.PodTarget(p)}
+	return t, nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRescheduled(t *testing.T) {
+	controlled := func(uid types.UID) []metav1.OwnerReference {
+		controller := true
+		return []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx-7d8b49557c", UID: uid, Controller: &controller}}
+	}
+	now := metav1.Now()
+	tests := []struct {
+		name string
+		pod  v1.Pod
+		want bool
+	}{
+		{
+			name: "same pod",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0"}, Status: v1.PodStatus{Phase: v1.PodRunning}},
+			want: true,
+		},
+		{
+			name: "same pod pending",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-0"}, Status: v1.PodStatus{Phase: v1.PodPending}},
+		},
+		{
+			name: "replacement",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-7d8b49557c-x2kqn", OwnerReferences: controlled("rs-1")}, Status: v1.PodStatus{Phase: v1.PodRunning}},
+			want: true,
+		},
+		{
+			name: "replacement being deleted",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx-7d8b49557c-x2kqn", OwnerReferences: controlled("rs-1"), DeletionTimestamp: &now}, Status: v1.PodStatus{Phase: v1.PodRunning}},
+		},
+		{
+			name: "other controller",
+			pod:  v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "redis-5c9f8b4d7-abcde", OwnerReferences: controlled("rs-2")}, Status: v1.PodStatus{Phase: v1.PodRunning}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rescheduled(&tt.pod, "web-0", "rs-1"); got != tt.want {
+				t.Errorf("rescheduled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
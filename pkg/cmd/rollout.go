@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/events"
+	"github.com/iovisor/kubectl-trace/pkg/logging"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
+)
+
+// rolloutPollInterval is how often the pods of a rollout are looked for.
+const rolloutPollInterval = 2 * time.Second
+
+// deploymentKinds are the ways to name a deployment in --on-rollout, like kubectl does.
+var deploymentKinds = map[string]bool{
+	"deploy":          true,
+	"deployment":      true,
+	"deployments":     true,
+	"deployment.apps": true,
+}
+
+// parseDeployment returns the name of the deployment of a deploy/NAME argument.
+func parseDeployment(arg string) (string, error) {
+	parts := strings.SplitN(arg, "/", 2)
+	if len(parts) != 2 || !deploymentKinds[parts[0]] || len(parts[1]) == 0 {
+		return "", fmt.Errorf("--on-rollout takes a deployment as deploy/NAME, got %q", arg)
+	}
+	return parts[1], nil
+}
+
+// validateOnRollout checks the flags that --on-rollout cannot be used with, since it runs several traces.
+func (o *RunOptions) validateOnRollout(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("no target can be given with --on-rollout, the pods of the rollout are traced")
+	}
+	if o.attach {
+		return fmt.Errorf("--attach cannot be used with --on-rollout, which runs a trace for each new pod")
+	}
+	if cmd.Flag("pre-hook").Changed || cmd.Flag("post-hook").Changed || cmd.Flag("report").Changed {
+		return fmt.Errorf("hooks and reports cannot be used with --on-rollout, which runs a trace for each new pod")
+	}
+	_, err := parseDeployment(o.onRollout)
+	return err
+}
+
+// rollout finds the pods of a deployment created by its rollout: the ones of the replica sets that did not exist
+// when it started, which tells the pods of the new revision from the pods of the revisions being replaced.
+type rollout struct {
+	deployments appsv1client.DeploymentInterface
+	replicaSets appsv1client.ReplicaSetInterface
+	pods        corev1client.PodInterface
+	name        string
+	selector    labels.Selector
+	old         map[types.UID]bool
+	seen        map[types.UID]bool
+}
+
+func newRollout(apps appsv1client.AppsV1Interface, core corev1client.CoreV1Interface, namespace, name string) (*rollout, error) {
+	r := &rollout{
+		deployments: apps.Deployments(namespace),
+		replicaSets: apps.ReplicaSets(namespace),
+		pods:        core.Pods(namespace),
+		name:        name,
+		old:         map[types.UID]bool{},
+		seen:        map[types.UID]bool{},
+	}
+	d, err := r.deployments.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	r.selector, err = metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	rsl, err := r.replicaSets.List(metav1.ListOptions{LabelSelector: r.selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	for _, rs := range rsl.Items {
+		r.old[rs.UID] = true
+	}
+	return r, nil
+}
+
+// newPods returns the pods of the new replica sets that are running and were not returned before.
+func (r *rollout) newPods() ([]v1.Pod, error) {
+	pl, err := r.pods.List(metav1.ListOptions{LabelSelector: r.selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	pods := []v1.Pod{}
+	for _, p := range pl.Items {
+		if r.seen[p.UID] || !r.isNew(p) || p.Status.Phase != v1.PodRunning || len(p.Spec.NodeName) == 0 {
+			continue
+		}
+		r.seen[p.UID] = true
+		pods = append(pods, p)
+	}
+	return pods, nil
+}
+
+func (r *rollout) isNew(p v1.Pod) bool {
+	for _, o := range p.OwnerReferences {
+		if o.Kind == "ReplicaSet" && !r.old[o.UID] {
+			return true
+		}
+	}
+	return false
+}
+
+// done tells whether the rollout completed: all the replicas of the deployment are updated and available.
+func (r *rollout) done() (bool, error) {
+	d, err := r.deployments.Get(r.name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return rolloutComplete(d) && len(r.seen) > 0, nil
+}
+
+// rolloutComplete tells whether the deployment controller completed the rollout of the current revision.
+func rolloutComplete(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	s := d.Status
+	return s.ObservedGeneration >= d.Generation && s.UpdatedReplicas == replicas && s.Replicas == replicas && s.AvailableReplicas == replicas
+}
+
+// runOnRollout waits for the pods of the rollout of the deployment and runs a trace against each of them
+// once it runs, until the rollout completes or until interrupted.
+func (o *RunOptions) runOnRollout() error {
+	name, err := parseDeployment(o.onRollout)
+	if err != nil {
+		return err
+	}
+	appsClient, err := appsv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+
+	r, err := newRollout(appsClient, coreClient, o.namespace, name)
+	if err != nil {
+		return err
+	}
+	if !o.quiet {
+		fmt.Fprintf(o.IOStreams.ErrOut, "waiting for the rollout of deployment %s, interrupt to stop\n", name)
+	}
+
+	ctx := signals.WithStandardSignals(context.Background())
+	err = wait.PollImmediateUntil(rolloutPollInterval, func() (bool, error) {
+		pods, err := r.newPods()
+		if err != nil {
+			klog.V(logging.LevelSteps).Infof("could not list the pods of the rollout: deployment=%s error=%q", name, err)
+			return false, nil
+		}
+		for i := range pods {
+			if err := o.tracePod(ctx, tc, coreClient, &pods[i]); err != nil {
+				// A pod going away during the rollout does not stop tracing the next ones.
+				fmt.Fprintf(o.IOStreams.ErrOut, "could not trace pod %s: %v\n", pods[i].Name, err)
+			}
+		}
+		done, err := r.done()
+		if err != nil {
+			return false, err
+		}
+		return done, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		// Interrupted, the traces created so far keep running.
+		return nil
+	}
+	return err
+}
+
+// tracePod runs a trace against the container of the pod.
+func (o *RunOptions) tracePod(ctx context.Context, tc *tracejob.TraceJobClient, core corev1client.CoreV1Interface, pod *v1.Pod) error {
+	target, err := tracejob.ResolvePodTarget(core, pod, o.container)
+	if err != nil {
+		return err
+	}
+
+	tj, err := o.buildTraceJob(target)
+	if err != nil {
+		return err
+	}
+	if _, err := tc.CreateJob(ctx, tj); err != nil {
+		return err
+	}
+	if o.quiet {
+		fmt.Fprintln(o.IOStreams.Out, tj.ID)
+	} else {
+		fmt.Fprintf(o.IOStreams.Out, "trace %s created for pod %s\n", tj.ID, pod.Name)
+	}
+	if o.events {
+		events.NewRecorder(core, events.PodTarget(pod), tj.ID, o.user).Started()
+	}
+	return nil
+}
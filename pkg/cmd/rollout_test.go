@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseDeployment(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr bool
+	}{
+		{arg: "deploy/app", want: "app"},
+		{arg: "deployment.apps/app", want: "app"},
+		{arg: "app", wantErr: true},
+		{arg: "statefulset/app", wantErr: true},
+		{arg: "deploy/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got, err := parseDeployment(tt.arg)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseDeployment() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	replicas := int32(3)
+	deployment := func(status appsv1.DeploymentStatus) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Generation: 2},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status:     status,
+		}
+	}
+	tests := []struct {
+		name   string
+		status appsv1.DeploymentStatus
+		want   bool
+	}{
+		{name: "complete", status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}, want: true},
+		{name: "not observed", status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3}},
+		{name: "old replicas left", status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3}},
+		{name: "not available", status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolloutComplete(deployment(tt.status)); got != tt.want {
+				t.Errorf("rolloutComplete() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutIsNew(t *testing.T) {
+	r := &rollout{old: map[types.UID]bool{"rs-1": true}}
+	pod := func(owner types.UID) v1.Pod {
+		return v1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", UID: owner}}}}
+	}
+	if r.isNew(pod("rs-1")) {
+		t.Errorf("isNew() of a pod of an old replica set = true")
+	}
+	if !r.isNew(pod("rs-2")) {
+		t.Errorf("isNew() of a pod of a new replica set = false")
+	}
+}
@@ -2,24 +2,41 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/bundle"
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/events"
 	"github.com/iovisor/kubectl-trace/pkg/factory"
-	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/hooks"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/pids"
+	"github.com/iovisor/kubectl-trace/pkg/profile"
 	"github.com/iovisor/kubectl-trace/pkg/signals"
 	"github.com/iovisor/kubectl-trace/pkg/tracejob"
 	"github.com/spf13/cobra"
 	"k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
-	"k8s.io/client-go/kubernetes/scheme"
 	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
+// tracePollInterval is how often the status of the trace is checked while waiting for it to run the post hooks.
+const tracePollInterval = 2 * time.Second
+
 var (
 	// ImageNameTag represents the default tracerunner image
 	ImageNameTag = "quay.io/iovisor/kubectl-trace-bpftrace:latest"
@@ -33,7 +50,7 @@ var (
 )
 
 var (
-	runShort = `Execute a bpftrace program on resources` // Wrap with i18n.T()
+	runShort = `Execute a bpftrace program on resources`
 
 	runLong = runShort
 
@@ -52,7 +69,38 @@ var (
   %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); } --init-imagename=quay.io/custom-init-image-name --fetch-headers"
 
   # Run a bpftrace inline program on a pod container with a custom image for the bpftrace container that will run your program in the cluster
-  %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); } --imagename=quay.io/custom-bpftrace-image-name"`
+  %[1]s trace run pod/nginx nginx -e "tracepoint:syscalls:sys_enter_* { @[probe] = count(); } --imagename=quay.io/custom-bpftrace-image-name"
+
+  # Run a bpftrace program on a node only if no other exclusive trace is running there
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --exclusive
+
+  # Scale a canary up before the trace starts and back down once it completed
+  %[1]s trace run pod/nginx -f read.bt --pre-hook 'kubectl scale deployment canary --replicas=1' --post-hook 'kubectl scale deployment canary --replicas=0'
+
+  # Count the files opened by the processes of a pod container only, without filtering them in the program
+  %[1]s trace run pod/nginx -c nginx -e "tracepoint:syscalls:sys_enter_openat { @[str(args->filename)] = count(); }" --only-target
+
+  # Trace each new pod of the rollout of a deployment, from its start
+  %[1]s trace run --on-rollout deploy/app -f read.bt
+
+  # Profile the stacks of a pod container for an hour, writing their folded stacks to a file per minute
+  %[1]s trace run pod/nginx -c nginx --profile ./profiles --profile-interval 1m --deadline 3600
+
+  # Profile a node, labelling each stack with the pod and container of its process
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal --profile ./profiles --profile-format dataset
+
+  # Run a bpftrace program on a node only during its maintenance window
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --not-before 2019-01-02T22:00:00Z --not-after 2019-01-02T23:00:00Z
+
+  # Run an exported trace again, against the same target or against another pod
+  %[1]s trace run --from-bundle bundle.tar.gz
+  %[1]s trace run --from-bundle bundle.tar.gz pod/nginx-2 -c nginx
+
+  # Print the configmap and the job of a trace instead of creating them
+  %[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --dry-run=client
+
+  # Run a bpftrace program and keep its ID for later use
+  id=$(%[1]s trace run node/kubernetes-node-emt8.c.myproject.internal -f read.bt --quiet)`
 
 	runCommand                    = "run"
 	usageString                   = "(POD | TYPE/NAME)"
@@ -61,12 +109,16 @@ var (
 	bpftraceMissingErrString      = "the bpftrace program is mandatory"
 	bpftraceDoubleErrString       = "specify the bpftrace program either via an external file or via a literal string, not both"
 	bpftraceEmptyErrString        = "the bpftrace programm cannot be empty"
+	binaryDoubleErrString         = "specify either a bpftrace program or a binary, not both"
+	profileProgramErrString       = "the profile mode runs its own program, a bpftrace program or a binary cannot be given"
 )
 
 // RunOptions ...
 type RunOptions struct {
 	genericclioptions.IOStreams
 
+	config *config.Config
+
 	namespace         string
 	explicitNamespace bool
 
@@ -74,18 +126,73 @@ type RunOptions struct {
 	container           string
 	eval                string
 	program             string
+	binaryPath          string
+	binary              []byte
 	serviceAccount      string
 	imageName           string
+	bpftraceVersion     string
 	initImageName       string
 	fetchHeaders        bool
 	deadline            int64
 	deadlineGracePeriod int64
+	exclusive           bool
+	lockNamespace       string
+	unsafe              bool
+	tunables            tracejob.Tunables
+	buffering           string
+	tracerFlags         string
+	snapshotInterval    time.Duration
+	onlyTarget          bool
+	logFile             logFileOptions
+	record              recordOptions
+	redact              redactOptions
+	deadlineWarning     time.Duration
+	reportPath          string
+	onRollout           string
+	notBeforeArg        string
+	notAfterArg         string
+	notBefore           time.Time
+	notAfter            time.Time
+	maxOutputArg        string
+	maxOutput           int64
+	runtimeClass        string
+	hostPID             bool
+	hostNetwork         bool
+	dns                 dnsOptions
+	proxy               proxyOptions
+	caConfigMap         string
+	avoidPodsArg        string
+	avoidPods           *metav1.LabelSelector
+	avoidPodsNamespaces []string
+	profileDir          string
+	profileHz           int
+	profileInterval     time.Duration
+	profileFormat       string
+	quiet               bool
+	resources           *v1.ResourceRequirements
+	preHooks            []string
+	postHooks           []string
+	hooks               hooks.Hooks
+	events              bool
+	dryRun              string
+	createNamespace     bool
+	output              string
+	bundlePath          string
+	bundle              *bundle.Bundle
+	// bundleTarget tells that the trace runs against the target of the bundle, in its namespace.
+	bundleTarget bool
 
 	resourceArg string
 	attach      bool
+	resolvePIDs bool
+	reschedule  bool
 	isPod       bool
 	podUID      string
 	nodeName    string
+	target      v1.ObjectReference
+	// controllerUID is the UID of the controller of the traced pod, whose new pod is traced when rescheduling.
+	controllerUID types.UID
+	user          string
 
 	clientConfig *rest.Config
 }
@@ -96,22 +203,32 @@ func NewRunOptions(streams genericclioptions.IOStreams) *RunOptions {
 		IOStreams: streams,
 
 		serviceAccount:      "default",
+		lockNamespace:       tracejob.DefaultLockNamespace,
 		imageName:           ImageNameTag,
 		initImageName:       InitImageNameTag,
 		deadline:            int64(DefaultDeadline),
 		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+		events:              true,
+		deadlineWarning:     attacher.DefaultDeadlineWarning,
+		profileHz:           profile.DefaultHz,
+		profileInterval:     profile.DefaultInterval,
+		profileFormat:       profile.FormatFolded,
+		dryRun:              "none",
+		maxOutputArg:        "0",
+		hostPID:             true,
 	}
 }
 
 // NewRunCommand provides the run command wrapping RunOptions.
-func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+func NewRunCommand(factory factory.Factory, cfg *config.Config, streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewRunOptions(streams)
+	o.config = cfg
 
 	cmd := &cobra.Command{
 		Use:          fmt.Sprintf("%s %s [-c CONTAINER] [--attach]", runCommand, usageString),
-		Short:        runShort,
-		Long:         runLong,                             // Wrap with templates.LongDesc()
-		Example:      fmt.Sprintf(runExamples, "kubectl"), // Wrap with templates.Examples()
+		Short:        i18n.T(runShort),
+		Long:         i18n.T(runLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(runExamples), "kubectl"), // Wrap with templates.Examples()
 		SilenceUsage: true,
 		PreRunE: func(c *cobra.Command, args []string) error {
 			return o.Validate(c, args)
@@ -120,11 +237,7 @@ func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 			if err := o.Complete(factory, c, args); err != nil {
 				return err
 			}
-			if err := o.Run(); err != nil {
-				fmt.Fprintln(o.ErrOut, err.Error())
-				return nil
-			}
-			return nil
+			return o.Run()
 		},
 	}
 
@@ -132,12 +245,61 @@ func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 	cmd.Flags().BoolVarP(&o.attach, "attach", "a", o.attach, "Whether or not to attach to the trace program once it is created")
 	cmd.Flags().StringVarP(&o.eval, "eval", "e", o.eval, "Literal string to be evaluated as a bpftrace program")
 	cmd.Flags().StringVarP(&o.program, "filename", "f", o.program, "File containing a bpftrace program")
+	cmd.Flags().StringVar(&o.binaryPath, "binary", o.binaryPath, "Statically linked binary, like a libbpf based tool, run instead of a bpftrace program")
 	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace job")
+	cmd.Flags().BoolVar(&o.hostPID, "host-pid", o.hostPID, "Run the pod of the kubectl-trace job in the PID namespace of the host, required to trace a pod and to resolve the processes of the host")
+	cmd.Flags().BoolVar(&o.hostNetwork, "host-network", o.hostNetwork, "Run the pod of the kubectl-trace job in the network namespace of the host")
+	o.dns.addFlags(cmd)
+	o.proxy.addFlags(cmd)
+	cmd.Flags().StringVar(&o.caConfigMap, "ca-configmap", o.caConfigMap, "Configmap of the namespace of the trace, as NAME or NAME:KEY with ca.crt as default key, holding the bundle of CA certificates trusted by the pod of the kubectl-trace job instead of the ones of its images")
+	cmd.Flags().StringVar(&o.runtimeClass, "runtime-class", o.runtimeClass, "Runtime class of the pod of the kubectl-trace job, for the clusters whose default runtime is a sandbox where host level tracing does not work")
 	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.bpftraceVersion, "bpftrace-version", o.bpftraceVersion, "Version of bpftrace to run, mapped to a tracerunner image by the bpftraceImages of the configuration file")
 	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
 	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
 	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Maximum time to allow trace to run in seconds")
 	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time to print maps or histograms after deadline, in seconds")
+	cmd.Flags().DurationVar(&o.deadlineWarning, "deadline-warning", o.deadlineWarning, "When attaching, warn this long before the deadline of the trace, and when its grace period begins, never when 0")
+	cmd.Flags().BoolVar(&o.exclusive, "exclusive", o.exclusive, "Whether to refuse to run when another exclusive trace is running on the same node, from any namespace. The nodes are locked with leases of the namespace given by --lock-namespace")
+	cmd.Flags().StringVar(&o.lockNamespace, "lock-namespace", o.lockNamespace, "Namespace of the leases locking the nodes of the exclusive traces, shared by everyone running them")
+	cmd.Flags().BoolVar(&o.unsafe, "unsafe", o.unsafe, "Run bpftrace in unsafe mode, allowing actions like system() and signal(), unless disabled by the configuration or the tracerunner image")
+	cmd.Flags().Int64Var(&o.tunables.MapKeysMax, "map-keys-max", o.tunables.MapKeysMax, "Maximum number of keys of a bpftrace map, the bpftrace default when 0")
+	cmd.Flags().Int64Var(&o.tunables.Strlen, "strlen", o.tunables.Strlen, "Number of bytes kept by str(), the bpftrace default when 0")
+	cmd.Flags().Int64Var(&o.tunables.PerfRBPages, "perf-rb-pages", o.tunables.PerfRBPages, "Number of pages of the perf ring buffer of each CPU, a power of 2, the bpftrace default when 0")
+	cmd.Flags().Int64Var(&o.tunables.CatBytesMax, "cat-bytes-max", o.tunables.CatBytesMax, "Maximum number of bytes printed by cat(), the bpftrace default when 0")
+	cmd.Flags().StringVarP(&o.buffering, "buffering", "B", o.buffering, "Output buffering mode of bpftrace, one of: none, line, full (default line when attaching or with --max-output, otherwise the default of bpftrace, line on the terminal of the trace)")
+	o.logFile.addFlags(cmd)
+	o.record.addFlags(cmd)
+	o.redact.addFlags(cmd)
+	cmd.Flags().DurationVar(&o.snapshotInterval, "snapshot-interval", o.snapshotInterval, "Interval at which bpftrace prints its maps while the trace runs, for intermediate results of long traces")
+	cmd.Flags().StringVar(&o.tracerFlags, "tracer-flags", o.tracerFlags, "Flags appended verbatim to the bpftrace command line, for the options without a flag of their own")
+	cmd.Flags().StringVar(&o.notBeforeArg, "not-before", o.notBeforeArg, "Time, in RFC3339 like 2019-01-02T22:00:00Z, before which the created trace waits to start its program")
+	cmd.Flags().StringVar(&o.notAfterArg, "not-after", o.notAfterArg, "Time, in RFC3339, at which the program of the trace is stopped, and after which it is not started")
+	cmd.Flags().BoolVar(&o.createNamespace, "create-namespace", o.createNamespace, "Create the namespace of the trace when missing, labelled to allow privileged pods, with its service account and the role of the trace runners")
+	cmd.Flags().StringVar(&o.avoidPodsArg, "avoid-pods", o.avoidPodsArg, "Label selector of the pods, like tier=latency-critical, next to which the trace job must not run: the trace is refused on a node running them, and keeps them off its node")
+	cmd.Flags().StringVar(&o.maxOutputArg, "max-output", o.maxOutputArg, "Size of the output of the program, like 100MB or 512KiB, after which the rest is dropped behind a truncation marker, unlimited when 0. The output then goes through the trace runner, a --binary program does not get the terminal of the trace")
+	cmd.Flags().StringVar(&o.onRollout, "on-rollout", o.onRollout, "Deployment, as deploy/NAME, whose rollout is waited for to trace each of its new pods once running, instead of a target")
+	cmd.Flags().StringVar(&o.profileDir, "profile", o.profileDir, "Directory the stacks sampled by a continuous profile of the target are written to, as a file of folded stacks per interval, instead of running a program")
+	cmd.Flags().IntVar(&o.profileHz, "profile-hz", o.profileHz, "Frequency at which the stacks are sampled on each CPU in profile mode")
+	cmd.Flags().DurationVar(&o.profileInterval, "profile-interval", o.profileInterval, "Length of the time buckets of the profile, each written to its own file")
+	cmd.Flags().StringVar(&o.profileFormat, "profile-format", o.profileFormat, fmt.Sprintf("Format of the profile files, one of %s, the dataset labelling each stack with the node, pod and container of its process", strings.Join(profile.Formats, ", ")))
+	cmd.Flags().StringVar(&o.reportPath, "report", o.reportPath, "File the JSON report of the run is written to: spec, target, status, timing and checksums of the local files")
+	cmd.Flags().BoolVarP(&o.quiet, "quiet", "q", o.quiet, "Only print the trace ID, and only the output of the program when attaching")
+	cmd.Flags().BoolVar(&o.onlyTarget, "only-target", o.onlyTarget, "Restrict the probes of the program to the processes of the traced container, even those attached to the whole node")
+	cmd.Flags().BoolVar(&o.reschedule, "reschedule", o.reschedule, "When attaching to the trace of a pod whose node is drained, trace the pod again once it runs on another node, until the deadline")
+	cmd.Flags().BoolVar(&o.resolvePIDs, "resolve-pids", o.resolvePIDs, "When attaching, annotate the PIDs printed by the program, like \"pid 4242\", with the namespace, pod and container running them")
+
+	cmd.Flags().BoolVar(&o.events, "events", o.events, "Record the start and the outcome of the trace as events of the traced pod or node, the outcome only when attaching or waiting for post hooks")
+
+	cmd.Flags().StringVar(&o.dryRun, "dry-run", o.dryRun, fmt.Sprintf("One of %s: client prints the configmap and the job of the trace without creating them, server submits them to be validated and admitted without creating them", strings.Join(tracejob.DryRunModes, ", ")))
+	cmd.Flags().StringVar(&o.bundlePath, "from-bundle", o.bundlePath, "Bundle written by kubectl trace export, whose trace is run again with its program and spec, against its target unless a new one is given")
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, fmt.Sprintf("Print the created configmap and job of the trace, as the server returned them, instead of its ID, one of %s", strings.Join(outputFormats, ", ")))
+	cmd.Flags().StringArrayVar(&o.preHooks, "pre-hook", o.preHooks, "Local command to run with sh -c before the trace starts, can be repeated")
+	cmd.Flags().StringArrayVar(&o.postHooks, "post-hook", o.postHooks, "Local command to run with sh -c after the trace completed, can be repeated")
+
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+	cmd.MarkFlagFilename("filename", "bt")
+	cmd.MarkFlagFilename("binary")
 
 	return cmd
 }
@@ -145,7 +307,16 @@ func NewRunCommand(factory factory.Factory, streams genericclioptions.IOStreams)
 // Validate validates the arguments and flags populating RunOptions accordingly.
 func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 	containerFlagDefined := cmd.Flag("container").Changed
+	if len(o.onRollout) > 0 {
+		if err := o.validateOnRollout(cmd, args); err != nil {
+			return err
+		}
+	}
 	switch len(args) {
+	case 0:
+		if len(o.onRollout) == 0 && len(o.bundlePath) == 0 {
+			return i18n.Errorf(requiredArgErrString)
+		}
 	case 1:
 		o.resourceArg = args[0]
 		break
@@ -154,21 +325,79 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 		o.resourceArg = args[0]
 		o.container = args[1]
 		if containerFlagDefined {
-			return fmt.Errorf(containerAsArgOrFlagErrString)
+			return i18n.Errorf(containerAsArgOrFlagErrString)
 		}
 		break
 	default:
-		return fmt.Errorf(requiredArgErrString)
+		return i18n.Errorf(requiredArgErrString)
+	}
+
+	if cmd.Flag("imagename").Changed && cmd.Flag("bpftrace-version").Changed {
+		return fmt.Errorf("--imagename and --bpftrace-version cannot be used together")
+	}
+
+	if err := o.validateTimeWindow(); err != nil {
+		return err
+	}
+	var err error
+	if o.maxOutput, err = parseSize(o.maxOutputArg); err != nil {
+		return fmt.Errorf("--max-output: %v", err)
+	}
+	if err := o.dns.validate(); err != nil {
+		return err
+	}
+	if name, key := splitCAConfigMap(o.caConfigMap); len(o.caConfigMap) > 0 && (len(name) == 0 || strings.Contains(key, ":")) {
+		return fmt.Errorf("invalid --ca-configmap %q, expected NAME or NAME:KEY", o.caConfigMap)
+	}
+	if len(o.avoidPodsArg) > 0 {
+		if o.avoidPods, err = metav1.ParseToLabelSelector(o.avoidPodsArg); err != nil {
+			return fmt.Errorf("invalid --avoid-pods selector: %v", err)
+		}
+	}
+
+	if o.reschedule && !o.attach && len(o.profileDir) == 0 {
+		return fmt.Errorf("--reschedule requires --attach, the drain of the node is noticed while attached")
+	}
+
+	if err := o.validateDryRun(); err != nil {
+		return err
+	}
+
+	if len(o.output) > 0 {
+		if err := validateOutput(o.output); err != nil {
+			return err
+		}
+		if o.attach || len(o.profileDir) > 0 || len(o.onRollout) > 0 || o.quiet {
+			return fmt.Errorf("--output cannot be used with --attach, --profile, --on-rollout or --quiet, the objects are printed alone")
+		}
+	}
+
+	if len(o.bundlePath) > 0 {
+		return o.validateFromBundle(cmd)
+	}
+
+	if len(o.profileDir) > 0 {
+		return o.validateProfile(cmd)
+	}
+
+	if cmd.Flag("binary").Changed {
+		if cmd.Flag("eval").Changed || cmd.Flag("filename").Changed {
+			return i18n.Errorf(binaryDoubleErrString)
+		}
+		if len(o.binaryPath) == 0 {
+			return errdefs.Errorf(errdefs.ErrProgramInvalid, "the binary cannot be empty")
+		}
+		return nil
 	}
 
 	if !cmd.Flag("eval").Changed && !cmd.Flag("filename").Changed {
-		return fmt.Errorf(bpftraceMissingErrString)
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceMissingErrString))
 	}
 	if cmd.Flag("eval").Changed == cmd.Flag("filename").Changed {
-		return fmt.Errorf(bpftraceDoubleErrString)
+		return i18n.Errorf(bpftraceDoubleErrString)
 	}
 	if (cmd.Flag("eval").Changed && len(o.eval) == 0) || (cmd.Flag("filename").Changed && len(o.program) == 0) {
-		return fmt.Errorf(bpftraceEmptyErrString)
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceEmptyErrString))
 	}
 
 	return nil
@@ -176,13 +405,52 @@ func (o *RunOptions) Validate(cmd *cobra.Command, args []string) error {
 
 // Complete completes the setup of the command.
 func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	o.applyConfig(cmd)
+	if o.bundle != nil {
+		o.applyBundle(cmd)
+	}
+	o.applyHooks(cmd)
+	if !cmd.Flag("buffering").Changed && (o.attach || o.maxOutput > 0) && len(o.binaryPath) == 0 && len(o.binary) == 0 {
+		// Stream the output through the attach as it comes. With --max-output, the output of bpftrace goes through
+		// the trace runner instead of the terminal of the trace, and bpftrace would buffer it fully.
+		o.buffering = "line"
+	}
+	if len(o.bpftraceVersion) > 0 {
+		cfg := o.config
+		if cfg == nil {
+			cfg = &config.Config{}
+		}
+		image, err := cfg.BpftraceImage(o.bpftraceVersion)
+		if err != nil {
+			return err
+		}
+		o.imageName = image
+	}
+	if (o.unsafe || tracerFlagsUnsafe(o.tracerFlags)) && o.config != nil && o.config.DisableUnsafe != nil && *o.config.DisableUnsafe {
+		return fmt.Errorf("the unsafe mode is disabled by the configuration")
+	}
+	if err := o.redact.complete(o.config); err != nil {
+		return err
+	}
+	if err := o.proxy.complete(cmd, o.config); err != nil {
+		return err
+	}
+
 	// Prepare program
-	if len(o.program) > 0 {
+	if len(o.binaryPath) > 0 {
+		b, err := ioutil.ReadFile(o.binaryPath)
+		if err != nil {
+			return errdefs.Errorf(errdefs.ErrProgramInvalid, "error opening binary file")
+		}
+		o.binary = b
+	} else if len(o.program) > 0 {
 		b, err := ioutil.ReadFile(o.program)
 		if err != nil {
-			return fmt.Errorf("error opening program file")
+			return errdefs.Errorf(errdefs.ErrProgramInvalid, "error opening program file")
 		}
 		o.program = string(b)
+	} else if o.bundle != nil {
+		o.program = o.bundle.Program
 	} else {
 		o.program = o.eval
 	}
@@ -193,84 +461,29 @@ func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 	if err != nil {
 		return err
 	}
-
-	// Look for the target object
-	x := factory.
-		NewBuilder().
-		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
-		NamespaceParam(o.namespace).
-		SingleResourceType().
-		ResourceNames("nodes", o.resourceArg). // Search nodes by default
-		Do()
-
-	obj, err := x.Object()
-	if err != nil {
-		return err
+	if o.bundleTarget && !o.explicitNamespace {
+		o.namespace = o.bundle.Namespace
 	}
 
-	// Check we got a pod or a node
-	o.isPod = false
-
-	var node *v1.Node
-
-	switch v := obj.(type) {
-	case *v1.Pod:
-		if len(v.Spec.NodeName) == 0 {
-			return fmt.Errorf("cannot attach a trace program to a pod that is not currently scheduled on a node")
-		}
-		o.isPod = true
-		found := false
-		o.podUID = string(v.UID)
-		for _, c := range v.Spec.Containers {
-			// default if no container provided
-			if len(o.container) == 0 {
-				o.container = c.Name
-				found = true
-				break
-			}
-			// check if the provided one exists
-			if c.Name == o.container {
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			return fmt.Errorf("no containers found for the provided pod/container combination")
-		}
-
-		obj, err = factory.
-			NewBuilder().
-			WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
-			ResourceNames("nodes", v.Spec.NodeName).
-			Do().Object()
-
+	if len(o.onRollout) == 0 {
+		t, err := lookupTarget(factory, o.namespace, o.resourceArg, o.container)
 		if err != nil {
 			return err
 		}
-
-		if n, ok := obj.(*v1.Node); ok {
-			node = n
+		o.isPod, o.podUID, o.container, o.nodeName, o.target = t.isPod, t.podUID, t.container, t.nodeName, t.ref
+		o.controllerUID = t.controllerUID
+		if o.reschedule && !o.isPod {
+			return fmt.Errorf("--reschedule follows a pod to its new node, a node trace cannot be rescheduled")
 		}
-
-		break
-	case *v1.Node:
-		node = v
-		break
-	default:
-		return fmt.Errorf("first argument must be %s", usageString)
 	}
-
-	if node == nil {
-		return fmt.Errorf("could not determine on which node to run the trace program")
+	if o.bundle != nil && !cmd.Flag("only-target").Changed {
+		// A bundle retargeted to a node runs on the whole node.
+		o.onlyTarget = o.bundle.Spec.OnlyTarget && o.isPod
 	}
-
-	labels := node.GetLabels()
-	val, ok := labels["kubernetes.io/hostname"]
-	if !ok {
-		return fmt.Errorf("label kubernetes.io/hostname not found in node")
+	if len(o.profileDir) > 0 {
+		o.program = profile.Program(o.profileHz, o.profileInterval, o.isPod, o.profileFormat)
 	}
-	o.nodeName = val
+	o.user = currentUser(factory.ToRawKubeConfigLoader())
 
 	// Prepare client
 	o.clientConfig, err = factory.ToRESTConfig()
@@ -278,12 +491,131 @@ func (o *RunOptions) Complete(factory factory.Factory, cmd *cobra.Command, args
 		return err
 	}
 
+	if o.avoidPods != nil {
+		return o.completeAvoidPods()
+	}
+	return nil
+}
+
+// applyConfig uses the values from the configuration file for the flags that have not been set.
+func (o *RunOptions) applyConfig(cmd *cobra.Command) {
+	if o.config == nil {
+		return
+	}
+	if !cmd.Flag("imagename").Changed && len(o.config.ImageName) > 0 {
+		o.imageName = o.config.ImageName
+	}
+	if !cmd.Flag("init-imagename").Changed && len(o.config.InitImageName) > 0 {
+		o.initImageName = o.config.InitImageName
+	}
+	if !cmd.Flag("serviceaccount").Changed && len(o.config.ServiceAccount) > 0 {
+		o.serviceAccount = o.config.ServiceAccount
+	}
+	if !cmd.Flag("runtime-class").Changed && len(o.config.RuntimeClass) > 0 {
+		o.runtimeClass = o.config.RuntimeClass
+	}
+	if !cmd.Flag("ca-configmap").Changed && len(o.config.CAConfigMap) > 0 {
+		o.caConfigMap = o.config.CAConfigMap
+	}
+	if !cmd.Flag("lock-namespace").Changed && len(o.config.LockNamespace) > 0 {
+		o.lockNamespace = o.config.LockNamespace
+	}
+	if !cmd.Flag("host-pid").Changed && o.config.HostPID != nil {
+		o.hostPID = *o.config.HostPID
+	}
+	if !cmd.Flag("host-network").Changed && o.config.HostNetwork != nil {
+		o.hostNetwork = *o.config.HostNetwork
+	}
+	if !cmd.Flag("deadline").Changed && o.config.Deadline != nil {
+		o.deadline = *o.config.Deadline
+	}
+	if !cmd.Flag("deadline-grace-period").Changed && o.config.DeadlineGracePeriod != nil {
+		o.deadlineGracePeriod = *o.config.DeadlineGracePeriod
+	}
+	if !cmd.Flag("fetch-headers").Changed && o.config.FetchHeaders != nil {
+		o.fetchHeaders = *o.config.FetchHeaders
+	}
+	o.resources = o.config.Resources
+	if o.config.Hooks != nil {
+		o.hooks = *o.config.Hooks
+	}
+}
+
+// applyHooks uses the hooks given as flags instead of the ones from the configuration file.
+func (o *RunOptions) applyHooks(cmd *cobra.Command) {
+	if cmd.Flag("pre-hook").Changed {
+		o.hooks.Pre = commandHooks(o.preHooks)
+	}
+	if cmd.Flag("post-hook").Changed {
+		o.hooks.Post = commandHooks(o.postHooks)
+	}
+}
+
+func commandHooks(commands []string) []hooks.Hook {
+	hs := make([]hooks.Hook, 0, len(commands))
+	for _, c := range commands {
+		hs = append(hs, hooks.Hook{Command: c})
+	}
+	return hs
+}
+
+// validateDryRun checks the dry run mode, the dry runs create nothing to attach to or to report on.
+func (o *RunOptions) validateDryRun() error {
+	valid := false
+	for _, m := range tracejob.DryRunModes {
+		valid = valid || o.dryRun == m
+	}
+	if !valid {
+		return fmt.Errorf("--dry-run must be one of %s, got %q", strings.Join(tracejob.DryRunModes, ", "), o.dryRun)
+	}
+	if o.dryRun == "none" {
+		return nil
+	}
+	if o.attach || len(o.profileDir) > 0 || len(o.onRollout) > 0 || len(o.reportPath) > 0 || o.createNamespace {
+		return fmt.Errorf("--dry-run cannot be used with --attach, --profile, --on-rollout, --report or --create-namespace, it creates nothing")
+	}
 	return nil
 }
 
 // Run executes the run command.
 func (o *RunOptions) Run() error {
-	juid := uuid.NewUUID()
+	if len(o.onRollout) > 0 {
+		return o.runOnRollout()
+	}
+	if len(o.reportPath) == 0 {
+		return o.run(nil)
+	}
+	r := o.newRunReport()
+	err := o.run(r)
+	r.finish(err, append(o.logFile.files(), o.record.files()...))
+	if werr := r.write(o.reportPath); werr != nil {
+		if err != nil {
+			fmt.Fprintln(o.IOStreams.ErrOut, werr.Error())
+			return err
+		}
+		return werr
+	}
+	return err
+}
+
+// run creates the trace, recording its creation and its status in r when it is not nil.
+func (o *RunOptions) run(r *runReport) error {
+	target := tracejob.NodeTarget(o.nodeName)
+	if o.isPod {
+		target = tracejob.PodTarget(o.nodeName, o.podUID, o.container)
+	}
+	tj, err := o.buildTraceJob(target)
+	if err != nil {
+		return err
+	}
+	if o.dryRun == "client" {
+		cm, job, err := tracejob.Manifests(tj)
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrJobCreateFailed, err)
+		}
+		return printObjects(o.IOStreams.Out, o.output, cm, job)
+	}
+
 	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
 	if err != nil {
 		return err
@@ -294,42 +626,312 @@ func (o *RunOptions) Run() error {
 		return err
 	}
 
+	if o.dryRun == "server" {
+		cm, job, err := tracejob.DryRun(jobsClient.RESTClient(), coreClient.RESTClient(), tj)
+		if err != nil {
+			return errdefs.Wrap(errdefs.ErrJobCreateFailed, err)
+		}
+		if len(o.output) > 0 {
+			return printObjects(o.IOStreams.Out, o.output, cm, job)
+		}
+		if o.quiet {
+			fmt.Fprintln(o.IOStreams.Out, tj.ID)
+		} else {
+			fmt.Fprintf(o.IOStreams.Out, "trace %s created (server dry run)\n", tj.ID)
+		}
+		return nil
+	}
+
+	if o.createNamespace {
+		rbacClient, err := rbacv1client.NewForConfig(o.clientConfig)
+		if err != nil {
+			return err
+		}
+		created, err := tracejob.CreateNamespace(coreClient, rbacClient, o.namespace, o.serviceAccount)
+		if err != nil {
+			return errdefs.Errorf(errdefs.ErrJobCreateFailed, "creating the namespace %s: %v", o.namespace, err)
+		}
+		if created && !o.quiet {
+			fmt.Fprintf(o.IOStreams.ErrOut, "namespace %s created for the traces, with the service account %s\n", o.namespace, o.serviceAccount)
+		}
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
 	tc := &tracejob.TraceJobClient{
-		JobClient:    jobsClient.Jobs(o.namespace),
-		ConfigClient: coreClient.ConfigMaps(o.namespace),
-	}
-
-	tj := tracejob.TraceJob{
-		Name:                fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(juid)),
-		Namespace:           o.namespace,
-		ServiceAccount:      o.serviceAccount,
-		ID:                  juid,
-		Hostname:            o.nodeName,
-		Program:             o.program,
-		PodUID:              o.podUID,
-		ContainerName:       o.container,
-		IsPod:               o.isPod,
-		ImageNameTag:        o.imageName,
-		InitImageNameTag:    o.initImageName,
-		FetchHeaders:        o.fetchHeaders,
-		Deadline:            o.deadline,
-		DeadlineGracePeriod: o.deadlineGracePeriod,
-	}
-
-	job, err := tc.CreateJob(tj)
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		LockNamespace:       o.lockNamespace,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	// Tells when the trace is queued.
+	tc.WithOutStream(o.IOStreams.ErrOut)
+
+	hr := &hooks.Runner{
+		JobClient: jobsClient.Jobs(o.namespace),
+		Out:       o.IOStreams.ErrOut,
+		ErrOut:    o.IOStreams.ErrOut,
+	}
+	env := hooks.Env{
+		hooks.EnvTraceID:        string(tj.ID),
+		hooks.EnvTraceName:      tj.Name,
+		hooks.EnvTraceNamespace: tj.Namespace,
+		hooks.EnvTraceNode:      tj.Hostname,
+	}
+	// Interrupting the pre hooks or the creation of the trace does not leave a half created trace behind.
+	ctx := signals.WithStandardSignals(context.Background())
+	if err := hr.Run(ctx, o.hooks.Pre, env); err != nil {
+		return fmt.Errorf("not starting the trace: pre %v", err)
+	}
+
+	// The rescheduled traces run until the deadline of the first one.
+	until := time.Now()
+	if o.notBefore.After(until) {
+		until = o.notBefore
+	}
+	until = until.Add(time.Duration(o.deadline) * time.Second)
+	job, err := tc.CreateJob(ctx, tj)
 	if err != nil {
 		return err
 	}
+	if r != nil {
+		r.created(tj)
+	}
 
-	fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+	if len(o.output) > 0 {
+		cm, err := tc.ConfigClient.Get(tj.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err := printObjects(o.IOStreams.Out, o.output, cm, job); err != nil {
+			return err
+		}
+	} else if o.quiet {
+		fmt.Fprintln(o.IOStreams.Out, tj.ID)
+	} else {
+		fmt.Fprintf(o.IOStreams.Out, "trace %s created\n", tj.ID)
+	}
+	var recorder *events.Recorder
+	if o.events {
+		recorder = events.NewRecorder(coreClient, o.target, tj.ID, o.user)
+		recorder.Started()
+	}
 
+	var attachErr error
 	if o.attach {
-		ctx := context.Background()
-		ctx = signals.WithStandardSignals(ctx)
-		a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
+		streams := o.IOStreams
+		var profileWriter *profile.Writer
+		if len(o.profileDir) > 0 {
+			if o.profileFormat == profile.FormatDataset {
+				resolver := pids.NewResolver(coreClient, o.clientConfig, tj.ID, job.Namespace)
+				profileWriter, err = profile.NewDatasetWriter(o.profileDir, o.nodeName, resolver.Resolve, o.IOStreams.ErrOut)
+			} else {
+				profileWriter, err = profile.NewWriter(o.profileDir, o.IOStreams.ErrOut)
+			}
+			if err != nil {
+				return err
+			}
+			streams.Out = profileWriter
+		}
+		streams, logFile, err := o.logFile.tee(streams)
+		if err != nil {
+			return err
+		}
+		streams, session, err := o.record.record(streams, "trace "+string(tj.ID))
+		if err != nil {
+			logFile.Close()
+			return err
+		}
+		a := attacher.NewAttacher(coreClient, o.clientConfig, streams)
 		a.WithContext(ctx)
-		a.AttachJob(tj.ID, job.Namespace)
+		a.WithQuiet(o.quiet)
+		a.WithDeadlineWarning(o.deadlineWarning)
+		a.WithResolvePIDs(o.resolvePIDs)
+		a.WithRedact(o.redact.res)
+		if recorder != nil {
+			a.WithObserver(recorder.Observer())
+		}
+		attachErr = a.AttachJob(tj.ID, job.Namespace)
+		for errors.Is(attachErr, errdefs.ErrNodeDrained) {
+			// The job would be left pending on the drained node.
+			if err := tc.DeleteJobs(context.Background(), tracejob.TraceJobFilter{ID: &tj.ID}); err != nil {
+				fmt.Fprintf(o.IOStreams.ErrOut, "could not delete trace %s: %v\n", tj.ID, err)
+			}
+			if !o.reschedule {
+				break
+			}
+			if tj, err = o.rescheduleTrace(ctx, tc, coreClient, until); err != nil {
+				attachErr = err
+				break
+			}
+			if r != nil {
+				r.created(tj)
+			}
+			env[hooks.EnvTraceID], env[hooks.EnvTraceName], env[hooks.EnvTraceNode] = string(tj.ID), tj.Name, tj.Hostname
+			attachErr = a.AttachJob(tj.ID, tj.Namespace)
+		}
+		logFile.Close()
+		session.Close()
+		if profileWriter != nil {
+			if err := profileWriter.Close(); err != nil && attachErr == nil {
+				attachErr = err
+			}
+		}
+		if r != nil {
+			r.Status = string(tracejob.TraceJobCompleted)
+			if errors.Is(attachErr, errdefs.ErrDeadlineExceeded) {
+				r.Status = string(tracejob.TraceJobDeadlineExceeded)
+			} else if attachErr != nil {
+				r.Status = string(tracejob.TraceJobFailed)
+			}
+		}
+	}
+
+	if len(o.hooks.Post) == 0 {
+		return attachErr
+	}
+	if attachErr != nil {
+		// The post hooks still run, the trace may be running even if its output cannot be streamed.
+		fmt.Fprintln(o.IOStreams.ErrOut, attachErr.Error())
+	}
+	if !o.quiet {
+		fmt.Fprintf(o.IOStreams.ErrOut, "waiting for trace %s to complete to run the post hooks\n", tj.ID)
+	}
+	status := waitForTrace(signals.WithStandardSignals(context.Background()), tc, tj.ID)
+	if recorder != nil && !o.attach {
+		// When attached, the outcome was recorded by the observer.
+		switch status {
+		case tracejob.TraceJobCompleted:
+			recorder.Completed()
+		case tracejob.TraceJobFailed:
+			recorder.Failed(fmt.Errorf("the trace job failed"))
+		case tracejob.TraceJobDeadlineExceeded:
+			recorder.Failed(fmt.Errorf("the trace job exceeded its deadline"))
+		}
+	}
+	env[hooks.EnvTraceStatus] = string(status)
+	if r != nil {
+		r.Status = string(status)
+	}
+	if err := hr.Run(signals.WithStandardSignals(context.Background()), o.hooks.Post, env); err != nil {
+		return fmt.Errorf("post %v", err)
+	}
+	if attachErr == nil && status == tracejob.TraceJobDeadlineExceeded {
+		// The trace was waited for, the exit code tells it was killed as when attached.
+		return errdefs.Errorf(errdefs.ErrDeadlineExceeded, "trace %s did not stop within its deadline and grace period", tj.ID)
+	}
+	return attachErr
+}
+
+// buildTraceJob builds the trace job running the program of the options against the target.
+func (o *RunOptions) buildTraceJob(target tracejob.Target) (tracejob.TraceJob, error) {
+	b := tracejob.New(target).
+		WithNamespace(o.namespace).
+		WithServiceAccount(o.serviceAccount)
+	if len(o.binary) > 0 {
+		b.WithBinary(o.binary)
+	} else {
+		b.WithProgram(o.program)
+	}
+	return b.
+		WithImage(o.imageName).
+		WithInitImage(o.initImageName).
+		WithFetchHeaders(o.fetchHeaders).
+		WithDeadline(o.deadline).
+		WithDeadlineGracePeriod(o.deadlineGracePeriod).
+		WithExclusive(o.exclusive).
+		WithUnsafe(o.unsafe).
+		WithTunables(o.tunables).
+		WithBuffering(o.buffering).
+		WithTracerFlags(o.tracerFlags).
+		WithSnapshotInterval(o.snapshotInterval).
+		WithTimeWindow(o.notBefore, o.notAfter).
+		WithMaxOutput(o.maxOutput).
+		WithAvoidPods(o.avoidPods, o.avoidPodsNamespaces).
+		WithRuntimeClass(o.runtimeClass).
+		WithHostNamespaces(o.hostPID, o.hostNetwork).
+		WithNameResolution(o.dns.hostAliases, o.dns.dnsConfig).
+		WithProxy(o.proxy.value).
+		WithCABundle(splitCAConfigMap(o.caConfigMap)).
+		WithOnlyTarget(o.onlyTarget).
+		WithResources(o.resources).
+		Build()
+}
+
+// validateProfile validates the flags of the profile mode, which always attaches to write the profile.
+func (o *RunOptions) validateProfile(cmd *cobra.Command) error {
+	if cmd.Flag("eval").Changed || cmd.Flag("filename").Changed || cmd.Flag("binary").Changed {
+		return i18n.Errorf(profileProgramErrString)
+	}
+	if len(o.onRollout) > 0 {
+		return fmt.Errorf("--profile and --on-rollout cannot be used together")
+	}
+	if o.profileHz <= 0 {
+		return fmt.Errorf("the profile frequency must be positive, got %d", o.profileHz)
+	}
+	if o.profileInterval < time.Second || o.profileInterval%time.Second != 0 {
+		return fmt.Errorf("the profile interval must be a whole number of seconds, got %s", o.profileInterval)
+	}
+	if o.profileFormat != profile.FormatFolded && o.profileFormat != profile.FormatDataset {
+		return fmt.Errorf("the profile format must be one of %s, got %q", strings.Join(profile.Formats, ", "), o.profileFormat)
+	}
+	o.attach = true
+	return nil
+}
+
+// splitCAConfigMap splits the NAME:KEY of --ca-configmap, the key is empty when not given.
+func splitCAConfigMap(arg string) (string, string) {
+	if i := strings.Index(arg, ":"); i >= 0 {
+		return arg[:i], arg[i+1:]
 	}
+	return arg, ""
+}
 
+// validateTimeWindow parses the times of the window the trace is allowed to run in.
+func (o *RunOptions) validateTimeWindow() error {
+	var err error
+	if len(o.notBeforeArg) > 0 {
+		if o.notBefore, err = time.Parse(time.RFC3339, o.notBeforeArg); err != nil {
+			return fmt.Errorf("invalid --not-before time, expected RFC3339 like 2019-01-02T22:00:00Z: %v", err)
+		}
+	}
+	if len(o.notAfterArg) > 0 {
+		if o.notAfter, err = time.Parse(time.RFC3339, o.notAfterArg); err != nil {
+			return fmt.Errorf("invalid --not-after time, expected RFC3339 like 2019-01-02T23:00:00Z: %v", err)
+		}
+	}
 	return nil
 }
+
+// currentUser returns the user of the current context of the kubeconfig, empty when it cannot be read.
+func currentUser(config clientcmd.ClientConfig) string {
+	raw, err := config.RawConfig()
+	if err != nil {
+		return ""
+	}
+	if c, ok := raw.Contexts[raw.CurrentContext]; ok {
+		return c.AuthInfo
+	}
+	return ""
+}
+
+// waitForTrace waits until the trace completed or failed, or until ctx is done, and returns its last known status.
+func waitForTrace(ctx context.Context, tc *tracejob.TraceJobClient, id types.UID) tracejob.TraceJobStatus {
+	status := tracejob.TraceJobUnknown
+	wait.PollImmediateUntil(tracePollInterval, func() (bool, error) {
+		tjs, err := tc.GetJob(ctx, tracejob.TraceJobFilter{ID: &id})
+		if err != nil || len(tjs) == 0 {
+			// The trace is gone, deleted by hand or cleaned up.
+			return err == nil, nil
+		}
+		status = tjs[0].Status
+		return status.Terminal(), nil
+	}, ctx.Done())
+	return status
+}
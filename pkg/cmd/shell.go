@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/diagnostics"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/scheme"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var (
+	shellShort = `Start a tracer on a target and run bpftrace programs in it interactively`
+	shellLong  = `Start a long-lived tracer against a node or pod, then read bpftrace programs from the input and run each of them
+in the tracer, without paying for the start of a trace job pod and for its headers every time.
+
+A program runs once its braces are balanced. Ctrl-C stops the running program, which prints its maps,
+exit or Ctrl-D deletes the tracer and quits. The tracer is deleted at its deadline as well.`
+
+	shellExamples = `
+  # Start a tracer on a node and run programs in it
+  %[1]s trace shell node/node-1
+
+  # Start a tracer on a pod container, with the linux headers
+  %[1]s trace shell pod/nginx -c nginx --fetch-headers
+`
+)
+
+// shellPrompt is printed when the shell waits for a program.
+const shellPrompt = "bpftrace> "
+
+// ShellOptions ...
+type ShellOptions struct {
+	genericclioptions.IOStreams
+
+	container           string
+	serviceAccount      string
+	imageName           string
+	initImageName       string
+	fetchHeaders        bool
+	deadline            int64
+	deadlineGracePeriod int64
+
+	resourceArg  string
+	target       traceTarget
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewShellOptions provides an instance of ShellOptions with default values.
+func NewShellOptions(streams genericclioptions.IOStreams) *ShellOptions {
+	return &ShellOptions{
+		IOStreams: streams,
+
+		serviceAccount:      "default",
+		imageName:           ImageNameTag,
+		initImageName:       InitImageNameTag,
+		deadline:            int64(DefaultDeadline),
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewShellCommand provides the shell command wrapping ShellOptions.
+func NewShellCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewShellOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "shell TARGET [-c CONTAINER]",
+		Short:        i18n.T(shellShort),
+		Long:         i18n.T(shellLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(shellExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace job")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Maximum time the tracer is kept, in seconds")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time for the running program to print its maps after deadline, in seconds")
+
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating ShellOptions accordingly.
+func (o *ShellOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.resourceArg = args[0]
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *ShellOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.target, err = lookupTarget(factory, o.namespace, o.resourceArg, o.container)
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the shell command.
+func (o *ShellOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	tj, err := tracejob.New(o.target.tracejobTarget()).
+		WithNamespace(o.namespace).
+		WithServiceAccount(o.serviceAccount).
+		WithShell(true).
+		WithImage(o.imageName).
+		WithInitImage(o.initImageName).
+		WithFetchHeaders(o.fetchHeaders).
+		WithDeadline(o.deadline).
+		WithDeadlineGracePeriod(o.deadlineGracePeriod).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	ctx := signals.WithStandardSignals(context.Background())
+	if _, err := tc.CreateJob(ctx, tj); err != nil {
+		return err
+	}
+	defer tc.DeleteJobs(context.Background(), tracejob.TraceJobFilter{ID: &tj.ID})
+	fmt.Fprintf(o.IOStreams.ErrOut, "trace %s created, waiting for the tracer to be ready\n", tj.ID)
+
+	pod, err := waitForShellPod(ctx, coreClient, tj)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.IOStreams.ErrOut, "tracer ready on node %s: a program runs once its braces are balanced, Ctrl-C stops it, exit or Ctrl-D quits\n", pod.Spec.NodeName)
+
+	// From now on the interrupts stop the running program instead of the shell.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	defer signal.Stop(sigCh)
+
+	scanner := bufio.NewScanner(o.IOStreams.In)
+	for n := 1; ; n++ {
+		program, ok := readSnippet(scanner, o.IOStreams.ErrOut)
+		if !ok {
+			fmt.Fprintln(o.IOStreams.ErrOut)
+			return nil
+		}
+		done := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case <-sigCh:
+					// Stopping bpftrace makes it print its maps, like when attached.
+					shellExec(coreClient, o.clientConfig, pod, []string{"/bin/sh", "-c", "kill -INT $(pidof bpftrace)"}, ioutil.Discard, ioutil.Discard)
+				}
+			}
+		}()
+		err := shellExec(coreClient, o.clientConfig, pod, shellCommand(n, program, o.target), o.IOStreams.Out, o.IOStreams.ErrOut)
+		close(done)
+		if err != nil {
+			fmt.Fprintf(o.IOStreams.ErrOut, "error: %v\n", err)
+		}
+	}
+}
+
+// waitForShellPod waits for the pod of the shell trace to be running, or to fail to start.
+func waitForShellPod(ctx context.Context, client corev1client.CoreV1Interface, tj tracejob.TraceJob) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	var startupErr error
+	err := wait.PollImmediateUntil(tracePollInterval, func() (bool, error) {
+		pl, err := client.Pods(tj.Namespace).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, tj.ID),
+		})
+		if err != nil || len(pl.Items) == 0 {
+			return false, nil
+		}
+		p := &pl.Items[0]
+		if reason, failed := diagnostics.StartupFailure(p); failed {
+			startupErr = fmt.Errorf("the tracer failed to start: %s", reason)
+			return true, nil
+		}
+		if p.Status.Phase != corev1.PodRunning {
+			return false, nil
+		}
+		pod = p
+		return true, nil
+	}, ctx.Done())
+	if startupErr != nil {
+		return nil, startupErr
+	}
+	return pod, err
+}
+
+// readSnippet reads the lines of the next program, until its braces are balanced.
+// It returns false at the end of the input or when asked to exit.
+func readSnippet(scanner *bufio.Scanner, prompt io.Writer) (string, bool) {
+	var lines []string
+	fmt.Fprint(prompt, shellPrompt)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(lines) == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				fmt.Fprint(prompt, shellPrompt)
+				continue
+			case "exit", "quit":
+				return "", false
+			}
+		}
+		lines = append(lines, line)
+		program := strings.Join(lines, "\n")
+		if snippetComplete(program) {
+			return program, true
+		}
+		fmt.Fprint(prompt, strings.Repeat(" ", len(shellPrompt)-2)+"> ")
+	}
+	return "", false
+}
+
+// snippetComplete tells whether the program is complete, which is once it has a block and its braces are balanced.
+func snippetComplete(program string) bool {
+	open := strings.Count(program, "{")
+	return open > 0 && open == strings.Count(program, "}")
+}
+
+// shellCommand returns the command running the program in the tracer with a trace runner of its own,
+// the program being the nth one of the shell.
+func shellCommand(n int, program string, target traceTarget) []string {
+	path := fmt.Sprintf("/tmp/shell-%d.bt", n)
+	// The trace runner of the program does not report phases, those of the pod are the ones of the tracer.
+	runner := []string{meta.EnvPodName + "=", "exec", "/bin/trace-runner", "--program=" + path, "--buffering=line"}
+	if target.isPod {
+		runner = append(runner, "--inpod", "--container="+target.container, "--poduid="+target.podUID)
+	}
+	script := fmt.Sprintf("echo %s | base64 -d > %s && %s",
+		base64.StdEncoding.EncodeToString([]byte(program)), path, strings.Join(runner, " "))
+	return []string{"/bin/sh", "-c", script}
+}
+
+// shellExec runs the command in the tracer of the pod.
+func shellExec(client corev1client.CoreV1Interface, config *rest.Config, pod *corev1.Pod, command []string, out, errOut io.Writer) error {
+	req := client.RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec")
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: pod.Spec.Containers[0].Name,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	return exec.Stream(remotecommand.StreamOptions{
+		Stdout: out,
+		Stderr: errOut,
+	})
+}
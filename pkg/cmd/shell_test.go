@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadSnippet(t *testing.T) {
+	input := `
+kprobe:do_sys_open { @[comm] = count(); }
+BEGIN {
+  printf("hello\n");
+}
+exit
+BEGIN { exit(); }
+`
+	scanner := bufio.NewScanner(strings.NewReader(input))
+
+	want := []string{
+		"kprobe:do_sys_open { @[comm] = count(); }",
+		"BEGIN {\n  printf(\"hello\\n\");\n}",
+	}
+	for _, w := range want {
+		got, ok := readSnippet(scanner, ioutil.Discard)
+		if !ok || got != w {
+			t.Fatalf("readSnippet() = %q, %v, want %q", got, ok, w)
+		}
+	}
+	if got, ok := readSnippet(scanner, ioutil.Discard); ok {
+		t.Errorf("readSnippet() = %q, want exit", got)
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	got := shellCommand(3, "BEGIN { exit(); }", traceTarget{isPod: true, container: "nginx", podUID: "uid"})
+	want := "echo QkVHSU4geyBleGl0KCk7IH0= | base64 -d > /tmp/shell-3.bt && " +
+		"KUBECTL_TRACE_POD_NAME= exec /bin/trace-runner --program=/tmp/shell-3.bt --buffering=line --inpod --container=nginx --poduid=uid"
+	if len(got) != 3 || got[2] != want {
+		t.Errorf("shellCommand() = %q, want %q", got, want)
+	}
+}
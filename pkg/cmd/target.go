@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/events"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// traceTarget is the node, or the container of a pod, a trace runs against.
+type traceTarget struct {
+	isPod     bool
+	podUID    string
+	container string
+	nodeName  string
+	// podIP is the IP of the traced pod, empty for a node.
+	podIP string
+	// controllerUID is the UID of the controller of the traced pod, empty for a node or a pod without one.
+	controllerUID types.UID
+	// ref references the traced pod or node, for the events of the trace.
+	ref v1.ObjectReference
+}
+
+// tracejobTarget returns the target of the trace job.
+func (t traceTarget) tracejobTarget() tracejob.Target {
+	if t.isPod {
+		return tracejob.PodTarget(t.nodeName, t.podUID, t.container)
+	}
+	return tracejob.NodeTarget(t.nodeName)
+}
+
+// lookupTarget looks for the node or the pod named by resource, and for the node of the pod.
+// The container defaults to the first one of the pod when empty.
+func lookupTarget(factory factory.Factory, namespace, resource, container string) (traceTarget, error) {
+	t := traceTarget{container: container}
+	x := factory.
+		NewBuilder().
+		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
+		NamespaceParam(namespace).
+		SingleResourceType().
+		ResourceNames("nodes", resource). // Search nodes by default
+		Do()
+
+	obj, err := x.Object()
+	if apierrors.IsNotFound(err) {
+		return t, errdefs.Wrap(errdefs.ErrTargetNotFound, err)
+	}
+	if err != nil {
+		return t, err
+	}
+
+	core, err := factory.KubernetesClientSet()
+	if err != nil {
+		return t, err
+	}
+
+	// Check we got a pod or a node
+	var target tracejob.Target
+	switch v := obj.(type) {
+	case *v1.Pod:
+		if target, err = tracejob.ResolvePodTarget(core.CoreV1(), v, t.container); err != nil {
+			return t, err
+		}
+		t.isPod = true
+		t.podUID = target.PodUID
+		t.container = target.ContainerName
+		t.podIP = v.Status.PodIP
+		if c := metav1.GetControllerOf(v); c != nil {
+			t.controllerUID = c.UID
+		}
+		t.ref = events.PodTarget(v)
+	case *v1.Node:
+		hostname, err := tracejob.NodeHostname(v)
+		if err != nil {
+			return t, err
+		}
+		target = tracejob.NodeTarget(hostname)
+		t.ref = events.NodeTarget(v)
+	default:
+		return t, fmt.Errorf("the target must be %s", usageString)
+	}
+	t.nodeName = target.Hostname
+	return t, nil
+}
@@ -0,0 +1,459 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+var (
+	topShort = `Display a live table of the busiest processes or connections of a target`
+	topLong  = `Run a rolling aggregation program against a node or pod and display its results as a table refreshed in place
+at every interval, with the values of the last interval and the totals since the start.
+
+The programs are:
+  syscalls      system calls by process name
+  offcpu        time spent off CPU by process name, in microseconds
+  retransmits   TCP retransmits by destination address and port, on nodes only
+
+On a pod, only the root process of the container is measured.
+While displayed, the table is sorted by the values of the last interval with v, by the totals with t and by key with k,
+q quits and deletes the trace.`
+
+	topExamples = `
+  # Display the processes of a node making the most system calls
+  %[1]s trace top node/node-1
+
+  # Display the TCP retransmits of a node every 5 seconds
+  %[1]s trace top node/node-1 --program retransmits --interval 5s
+`
+)
+
+// topProgram is a rolling aggregation program of the top command, aggregating its values in the @top map.
+type topProgram struct {
+	// program is the bpftrace program, formatted with the filter of the pod when tracing one.
+	program string
+	// podFilter restricts the program to the root process of the container of a pod.
+	podFilter string
+	// unit is the unit of the values.
+	unit string
+}
+
+var topPrograms = map[string]topProgram{
+	"syscalls": {
+		program:   `tracepoint:raw_syscalls:sys_enter%s { @top[comm] = count(); }`,
+		podFilter: " /pid == $container_pid/",
+		unit:      "calls",
+	},
+	"offcpu": {
+		program: `tracepoint:sched:sched_switch { @start[args->prev_pid] = nsecs; }
+tracepoint:sched:sched_switch /@start[args->next_pid]%s/ {
+  @top[args->next_comm] = sum((nsecs - @start[args->next_pid]) / 1000);
+  delete(@start[args->next_pid]);
+}`,
+		podFilter: " && args->next_pid == $container_pid",
+		unit:      "µs",
+	},
+	"retransmits": {
+		program: `tracepoint:tcp:tcp_retransmit_skb%s { @top[ntop(args->daddr), args->dport] = count(); }`,
+		unit:    "retransmits",
+	},
+}
+
+// topIntervalEnd is printed by the top programs after the values of each interval.
+const topIntervalEnd = "--- end of top interval ---"
+
+// TopOptions ...
+type TopOptions struct {
+	genericclioptions.IOStreams
+
+	programName    string
+	interval       time.Duration
+	rows           int
+	container      string
+	serviceAccount string
+	imageName      string
+	initImageName  string
+	deadline       int64
+
+	resourceArg  string
+	target       traceTarget
+	program      topProgram
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewTopOptions provides an instance of TopOptions with default values.
+func NewTopOptions(streams genericclioptions.IOStreams) *TopOptions {
+	return &TopOptions{
+		IOStreams: streams,
+
+		programName:    "syscalls",
+		interval:       2 * time.Second,
+		rows:           20,
+		serviceAccount: "default",
+		imageName:      ImageNameTag,
+		initImageName:  InitImageNameTag,
+		deadline:       int64(DefaultDeadline),
+	}
+}
+
+// NewTopCommand provides the top command wrapping TopOptions.
+func NewTopCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewTopOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "top TARGET [--program syscalls|offcpu|retransmits]",
+		Short:        i18n.T(topShort),
+		Long:         i18n.T(topLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(topExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.programName, "program", o.programName, "Aggregation program to display, one of: syscalls, offcpu, retransmits")
+	cmd.Flags().DurationVar(&o.interval, "interval", o.interval, "Interval at which the table is refreshed, a whole number of seconds")
+	cmd.Flags().IntVar(&o.rows, "rows", o.rows, "Number of rows of the table")
+	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace job")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Maximum time the table is displayed for, in seconds")
+
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating TopOptions accordingly.
+func (o *TopOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.resourceArg = args[0]
+	p, ok := topPrograms[o.programName]
+	if !ok {
+		return fmt.Errorf("unknown program %s, the programs are syscalls, offcpu and retransmits", o.programName)
+	}
+	o.program = p
+	if o.interval < time.Second || o.interval%time.Second != 0 {
+		return fmt.Errorf("the interval must be a whole number of seconds, got %s", o.interval)
+	}
+	if o.rows <= 0 {
+		return fmt.Errorf("the number of rows must be positive, got %d", o.rows)
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *TopOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.target, err = lookupTarget(factory, o.namespace, o.resourceArg, o.container)
+	if err != nil {
+		return err
+	}
+	if o.target.isPod && len(o.program.podFilter) == 0 {
+		return fmt.Errorf("the %s program can only run on nodes", o.programName)
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the top command.
+func (o *TopOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	tj, err := tracejob.New(o.target.tracejobTarget()).
+		WithNamespace(o.namespace).
+		WithServiceAccount(o.serviceAccount).
+		WithProgram(topProgramSource(o.program, o.target.isPod, o.interval)).
+		WithImage(o.imageName).
+		WithInitImage(o.initImageName).
+		WithDeadline(o.deadline).
+		WithDeadlineGracePeriod(int64(DefaultDeadlineGracePeriod)).
+		WithBuffering("line").
+		Build()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(signals.WithStandardSignals(context.Background()))
+	defer cancel()
+	if _, err := tc.CreateJob(ctx, tj); err != nil {
+		return err
+	}
+	// The trace only serves the table, it is not left running once done with.
+	defer tc.DeleteJobs(context.Background(), tracejob.TraceJobFilter{ID: &tj.ID})
+	fmt.Fprintf(o.IOStreams.ErrOut, "trace %s created, waiting for its first interval\n", tj.ID)
+
+	tty := term.TTY{In: o.IOStreams.In, Out: o.IOStreams.Out, Raw: true}
+	interactive := o.IOStreams.In != nil && tty.IsTerminalIn() && tty.IsTerminalOut()
+	if !interactive {
+		tty = term.TTY{Out: o.IOStreams.Out}
+	}
+	screen := &topScreen{
+		out:         o.IOStreams.Out,
+		title:       fmt.Sprintf("%s on %s, %s every %s", o.programName, o.resourceArg, o.program.unit, o.interval),
+		rows:        o.rows,
+		interactive: interactive,
+		table:       newTopTable(),
+	}
+	return tty.Safe(func() error {
+		if interactive {
+			go screen.readKeys(o.IOStreams.In, cancel)
+		}
+		a := attacher.NewAttacher(coreClient, o.clientConfig, genericclioptions.IOStreams{})
+		a.WithContext(ctx)
+		a.WithQuiet(true)
+		return a.AttachJobTo(tj.ID, tj.Namespace, attacher.Streams{Out: &topWriter{screen: screen}, ErrOut: o.IOStreams.ErrOut})
+	})
+}
+
+// topProgramSource returns the bpftrace program printing and clearing the values of the top program at every interval.
+func topProgramSource(p topProgram, pod bool, interval time.Duration) string {
+	filter := ""
+	if pod {
+		filter = p.podFilter
+	}
+	return fmt.Sprintf(p.program, filter) + fmt.Sprintf(`
+interval:s:%d { print(@top); clear(@top); printf("%s\n"); }
+END { clear(@top); }
+`, int64(interval/time.Second), topIntervalEnd)
+}
+
+// topValueRE matches the lines of the values of the @top map, like "@top[nginx]: 1234".
+var topValueRE = regexp.MustCompile(`^@top\[(.*)\]: (-?\d+)$`)
+
+// parseTopValues returns the values of the @top map printed in the output of bpftrace, by key.
+func parseTopValues(output string) map[string]int64 {
+	values := map[string]int64{}
+	for _, l := range strings.Split(output, "\n") {
+		m := topValueRE.FindStringSubmatch(strings.TrimSpace(l))
+		if m == nil {
+			continue
+		}
+		if v, err := strconv.ParseInt(m[2], 10, 64); err == nil {
+			values[m[1]] = v
+		}
+	}
+	return values
+}
+
+// Sort orders of the top table.
+const (
+	topSortLast  = 'v'
+	topSortTotal = 't'
+	topSortKey   = 'k'
+)
+
+// topTable holds the values of the last interval and their totals since the start.
+type topTable struct {
+	last   map[string]int64
+	total  map[string]int64
+	sortBy byte
+}
+
+func newTopTable() *topTable {
+	return &topTable{last: map[string]int64{}, total: map[string]int64{}, sortBy: topSortLast}
+}
+
+// update replaces the values of the last interval, adding them to the totals.
+func (t *topTable) update(values map[string]int64) {
+	t.last = values
+	for k, v := range values {
+		t.total[k] += v
+	}
+}
+
+// keys returns the keys of the table in the sort order, the largest values first.
+func (t *topTable) keys() []string {
+	keys := make([]string, 0, len(t.total))
+	for k := range t.total {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch t.sortBy {
+		case topSortLast:
+			if t.last[a] != t.last[b] {
+				return t.last[a] > t.last[b]
+			}
+		case topSortTotal:
+			if t.total[a] != t.total[b] {
+				return t.total[a] > t.total[b]
+			}
+		}
+		return a < b
+	})
+	return keys
+}
+
+// write writes the first rows of the table, each line ending with newline.
+func (t *topTable) write(w io.Writer, rows int, newline string) {
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "LAST\tTOTAL\t  KEY%s", newline)
+	for i, k := range t.keys() {
+		if i == rows {
+			break
+		}
+		fmt.Fprintf(tw, "%d\t%d\t  %s%s", t.last[k], t.total[k], k, newline)
+	}
+	tw.Flush()
+}
+
+// topScreen renders the table, in place when interactive.
+type topScreen struct {
+	out         io.Writer
+	title       string
+	rows        int
+	interactive bool
+
+	mu    sync.Mutex
+	table *topTable
+}
+
+// update updates the table with the output of an interval and renders it.
+func (s *topScreen) update(output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table.update(parseTopValues(output))
+	s.render()
+}
+
+// sort changes the sort order of the table and renders it.
+func (s *topScreen) sort(by byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table.sortBy = by
+	s.render()
+}
+
+func (s *topScreen) render() {
+	var b bytes.Buffer
+	newline := "\n"
+	if s.interactive {
+		// The terminal is in raw mode, and the table is drawn over the previous one.
+		newline = "\r\n"
+		b.WriteString("\x1b[H\x1b[2J")
+		fmt.Fprintf(&b, "%s - sorted by %s (v: last, t: total, k: key, q: quit)%s%s", s.title, topSortNames[s.table.sortBy], newline, newline)
+	} else {
+		fmt.Fprintf(&b, "%s - %s%s", s.title, time.Now().Format("15:04:05"), newline)
+	}
+	s.table.write(&b, s.rows, newline)
+	if !s.interactive {
+		b.WriteString(newline)
+	}
+	s.out.Write(b.Bytes())
+}
+
+var topSortNames = map[byte]string{
+	topSortLast:  "last interval",
+	topSortTotal: "total",
+	topSortKey:   "key",
+}
+
+// readKeys changes the sort order on the keys typed, and calls quit on q or Ctrl-C.
+func (s *topScreen) readKeys(in io.Reader, quit func()) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			return
+		}
+		switch buf[0] {
+		case 'q', 3:
+			quit()
+			return
+		case topSortLast, topSortTotal, topSortKey:
+			s.sort(buf[0])
+		}
+	}
+}
+
+// topWriter passes the output of each interval of the top program to the screen.
+type topWriter struct {
+	screen   *topScreen
+	partial  []byte
+	interval bytes.Buffer
+}
+
+func (w *topWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+		if strings.TrimSpace(line) == topIntervalEnd {
+			w.screen.update(w.interval.String())
+			w.interval.Reset()
+			continue
+		}
+		w.interval.WriteString(line)
+	}
+}
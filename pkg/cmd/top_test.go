@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopProgramSource(t *testing.T) {
+	got := topProgramSource(topPrograms["syscalls"], true, 5*time.Second)
+	for _, want := range []string{"sys_enter /pid == $container_pid/ {", "interval:s:5 { print(@top); clear(@top);", topIntervalEnd} {
+		if !strings.Contains(got, want) {
+			t.Errorf("topProgramSource() = %q, want it to contain %q", got, want)
+		}
+	}
+	if got := topProgramSource(topPrograms["offcpu"], false, time.Second); strings.Contains(got, "%") {
+		t.Errorf("topProgramSource() = %q, want the filter formatted", got)
+	}
+}
+
+func TestTopScreen(t *testing.T) {
+	var out bytes.Buffer
+	s := &topScreen{out: &out, title: "syscalls", rows: 2, table: newTopTable()}
+	w := &topWriter{screen: s}
+
+	output := "Attaching 2 probes...\n@top[nginx]: 10\n@top[sh]: 30\n@start[12]: 4\n" + topIntervalEnd + "\n@top[nginx]: 25\n@top[bash]: 1\n" + topIntervalEnd + "\n"
+	for _, chunk := range []string{output[:20], output[20:70], output[70:]} {
+		w.Write([]byte(chunk))
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n\n")
+	if len(lines) != 2 {
+		t.Fatalf("rendered %d tables, want 2: %q", len(lines), out.String())
+	}
+	want := `  LAST  TOTAL  KEY
+    25     35  nginx
+     1      1  bash`
+	if got := lines[1][strings.Index(lines[1], "\n")+1:]; got != want {
+		t.Errorf("second table =\n%s\nwant\n%s", got, want)
+	}
+
+	out.Reset()
+	s.sort(topSortTotal)
+	if !strings.Contains(out.String(), "     0     30  sh") {
+		t.Errorf("table sorted by total = %q, want sh second", out.String())
+	}
+}
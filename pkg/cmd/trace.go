@@ -3,10 +3,15 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/iovisor/kubectl-trace/pkg/color"
+	"github.com/iovisor/kubectl-trace/pkg/config"
 	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/logging"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/klog"
 )
 
 var (
@@ -29,6 +34,12 @@ These commands help you trace existing application resources.
 // TraceOptions ...
 type TraceOptions struct {
 	configFlags *genericclioptions.ConfigFlags
+	configPath  string
+	preset      string
+	config      *config.Config
+	verbosity   int
+	logFormat   string
+	noColor     bool
 
 	genericclioptions.IOStreams
 }
@@ -37,6 +48,8 @@ type TraceOptions struct {
 func NewTraceOptions(streams genericclioptions.IOStreams) *TraceOptions {
 	return &TraceOptions{
 		configFlags: genericclioptions.NewConfigFlags(false),
+		config:      &config.Config{},
+		logFormat:   logging.FormatText,
 
 		IOStreams: streams,
 	}
@@ -47,13 +60,19 @@ func NewTraceCommand(streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewTraceOptions(streams)
 
 	cmd := &cobra.Command{
-		Use:                   "trace",
-		DisableFlagsInUseLine: true,
-		Short:                 `Execute and manage bpftrace programs`, // Wrap with i18n.T()
-		Long:                  traceLong,                              // Wrap with templates.LongDesc()
-		Example:               fmt.Sprintf(traceExamples, "kubectl"),  // Wrap with templates.Examples()
-		PersistentPreRun: func(c *cobra.Command, args []string) {
+		Use:                    "trace",
+		DisableFlagsInUseLine:  true,
+		Short:                  i18n.T(`Execute and manage bpftrace programs`),
+		Long:                   i18n.T(traceLong),                             // Wrap with templates.LongDesc()
+		Example:                fmt.Sprintf(i18n.T(traceExamples), "kubectl"), // Wrap with templates.Examples()
+		BashCompletionFunction: bashCompletionFunc,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
 			c.SetOutput(streams.ErrOut)
+			color.Setup(o.noColor)
+			if err := o.setupLogging(); err != nil {
+				return err
+			}
+			return o.loadConfig(c)
 		},
 		Run: func(c *cobra.Command, args []string) {
 			cobra.NoArgs(c, args)
@@ -63,20 +82,41 @@ func NewTraceCommand(streams genericclioptions.IOStreams) *cobra.Command {
 
 	flags := cmd.PersistentFlags()
 	o.configFlags.AddFlags(flags)
-
-	matchVersionFlags := factory.NewMatchVersionFlags(o.configFlags)
+	flags.StringVar(&o.configPath, "config", o.configPath, fmt.Sprintf("Path to the kubectl-trace configuration file (default %s)", config.DefaultPath()))
+	flags.StringVar(&o.preset, "preset", o.preset, "Name of the preset from the configuration file to use for the defaults")
+	flags.IntVarP(&o.verbosity, "verbose", "v", o.verbosity, "Log level for the messages about what kubectl-trace is doing, written to stderr (1: steps, 2: trace pod status, 4: API requests, 5: generated manifests with the trace program, proxy passwords redacted, 6 and above: client library debug)")
+	flags.StringVar(&o.logFormat, "log-format", o.logFormat, "Format of the log messages, one of: text, json")
+	flags.BoolVar(&o.noColor, "no-color", o.noColor, "Disable colors, which are also disabled when NO_COLOR is set or the output is not a terminal")
+	cobra.MarkFlagFilename(flags, "config", "yaml", "yml")
+	cobra.MarkFlagCustom(flags, "namespace", "__kubectl_trace_get_namespaces")
+
+	clientFlags := factory.NewClientFlags(o.configFlags)
+	clientFlags.AddFlags(flags)
+
+	matchVersionFlags := factory.NewMatchVersionFlags(clientFlags)
 	matchVersionFlags.AddFlags(flags)
 
 	// flags.AddGoFlagSet(flag.CommandLine) // todo(leodido) > evaluate whether we need this or not
 
 	f := factory.NewFactory(matchVersionFlags)
 
-	cmd.AddCommand(NewRunCommand(f, streams))
+	cmd.AddCommand(NewRunCommand(f, o.config, streams))
 	cmd.AddCommand(NewGetCommand(f, streams))
-	cmd.AddCommand(NewAttachCommand(f, streams))
+	cmd.AddCommand(NewAttachCommand(f, o.config, streams))
 	cmd.AddCommand(NewDeleteCommand(f, streams))
-	cmd.AddCommand(NewVersionCommand(streams))
-	cmd.AddCommand(NewLogCommand(f, streams))
+	cmd.AddCommand(NewVersionCommand(o.config, streams))
+	cmd.AddCommand(NewLogCommand(f, o.config, streams))
+	cmd.AddCommand(NewCpCommand(f, streams))
+	cmd.AddCommand(NewExportCommand(f, streams))
+	cmd.AddCommand(NewReplayCommand(streams))
+	cmd.AddCommand(NewCompareCommand(f, streams))
+	cmd.AddCommand(NewRecipeCommand(f, o.config, streams))
+	cmd.AddCommand(NewTriggerCommand(f, streams))
+	cmd.AddCommand(NewNetlatCommand(f, streams))
+	cmd.AddCommand(NewTopCommand(f, streams))
+	cmd.AddCommand(NewShellCommand(f, streams))
+	cmd.AddCommand(NewCleanupCommand(f, streams))
+	cmd.AddCommand(NewCompletionCommand(streams))
 
 	// Override help on all the commands tree
 	walk(cmd, func(c *cobra.Command) {
@@ -86,6 +126,41 @@ func NewTraceCommand(streams genericclioptions.IOStreams) *cobra.Command {
 	return cmd
 }
 
+// setupLogging configures the logs of kubectl-trace and of the kubernetes client libraries, both written with klog.
+func (o *TraceOptions) setupLogging() error {
+	return logging.Configure(o.ErrOut, o.verbosity, o.logFormat)
+}
+
+// loadConfig reads the configuration file and the environment and applies the defaults shared by all the commands.
+// The default configuration file is optional, one given explicitly is not.
+func (o *TraceOptions) loadConfig(c *cobra.Command) error {
+	path := o.configPath
+	explicit := len(path) > 0
+	if !explicit {
+		path = config.DefaultPath()
+	}
+
+	cfg, err := config.Load(path, !explicit)
+	if err != nil {
+		return err
+	}
+	if i := cfg.UseMapping(currentIdentity(o.configFlags)); i >= 0 {
+		klog.V(logging.LevelSteps).Infof("using the service account and namespace of a mapping of the configuration file: mapping=%d", i)
+	}
+	cfg.FromEnv()
+	if len(o.preset) > 0 {
+		if err := cfg.UsePreset(o.preset); err != nil {
+			return err
+		}
+	}
+	*o.config = *cfg
+
+	if f := c.Flag("namespace"); f != nil && !f.Changed && len(cfg.Namespace) > 0 {
+		*o.configFlags.Namespace = cfg.Namespace
+	}
+	return nil
+}
+
 // walk calls f for c and all of its children.
 func walk(c *cobra.Command, f func(*cobra.Command)) {
 	f(c)
@@ -11,17 +11,44 @@ import (
 	"path"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fntlnz/mountinfo"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
 	"github.com/spf13/cobra"
 )
 
+// envContainerPID gives the binaries run instead of bpftrace the pid of the traced container,
+// that bpftrace programs get as $container_pid.
+const envContainerPID = "CONTAINER_PID"
+
+// targetCgroupVar is replaced in the bpftrace programs run in a pod by the ID of the cgroup of the container,
+// to compare with the cgroup builtin.
+const targetCgroupVar = "$target_cgroup"
+
+// envDisableUnsafe refuses the unsafe mode when set in the environment of the tracerunner,
+// for the images of the clusters where it must not be used.
+const envDisableUnsafe = "KUBECTL_TRACE_DISABLE_UNSAFE"
+
 type TraceRunnerOptions struct {
 	podUID             string
 	containerName      string
 	inPod              bool
 	programPath        string
+	binaryPath         string
 	bpftraceBinaryPath string
+	unsafe             bool
+	buffering          string
+	tracerFlags        string
+	snapshotInterval   time.Duration
+	notBefore          string
+	notAfter           string
+	shell              bool
+	onlyTarget         bool
+	maxOutput          int64
+
+	start time.Time
+	end   time.Time
 }
 
 func NewTraceRunnerOptions() *TraceRunnerOptions {
@@ -40,6 +67,7 @@ func NewTraceRunnerCommand() *cobra.Command {
 			}
 			if err := o.Run(); err != nil {
 				fmt.Fprintln(os.Stdout, err.Error())
+				writeTerminationMessage(err)
 				return nil
 			}
 			return nil
@@ -50,7 +78,17 @@ func NewTraceRunnerCommand() *cobra.Command {
 	cmd.Flags().StringVarP(&o.podUID, "poduid", "p", o.podUID, "Specify the pod UID")
 	cmd.Flags().StringVarP(&o.programPath, "program", "f", "program.bt", "Specify the bpftrace program path")
 	cmd.Flags().StringVarP(&o.bpftraceBinaryPath, "bpftracebinary", "b", "/bin/bpftrace", "Specify the bpftrace binary path")
+	cmd.Flags().StringVar(&o.binaryPath, "binary", "", "Specify the path of a binary to run instead of the bpftrace program")
 	cmd.Flags().BoolVar(&o.inPod, "inpod", false, "Whether or not run this bpftrace in a pod's container process namespace")
+	cmd.Flags().BoolVar(&o.unsafe, "unsafe", false, "Whether to run bpftrace in unsafe mode")
+	cmd.Flags().StringVar(&o.buffering, "buffering", "", "Output buffering mode of bpftrace: none, line or full")
+	cmd.Flags().DurationVar(&o.snapshotInterval, "snapshot-interval", 0, "Interval at which bpftrace prints its maps, never when 0")
+	cmd.Flags().StringVar(&o.tracerFlags, "tracer-flags", "", "Flags appended verbatim to the bpftrace command line")
+	cmd.Flags().BoolVar(&o.shell, "shell", false, "Wait for the programs run by kubectl trace shell instead of running one")
+	cmd.Flags().BoolVar(&o.onlyTarget, "only-target", false, "Restrict the probes of the program to the cgroup of the container")
+	cmd.Flags().StringVar(&o.notBefore, "not-before", "", "Time, in RFC3339, to wait for before starting the program")
+	cmd.Flags().StringVar(&o.notAfter, "not-after", "", "Time, in RFC3339, at which the program is stopped, and after which it is not started")
+	cmd.Flags().Int64Var(&o.maxOutput, "max-output", 0, "Number of bytes of output of the program after which the rest is dropped, unlimited when 0")
 	return cmd
 }
 
@@ -59,16 +97,77 @@ func (o *TraceRunnerOptions) Validate(cmd *cobra.Command, args []string) error {
 	if o.inPod == true && (len(o.containerName) == 0 || len(o.podUID) == 0) {
 		return fmt.Errorf("poduid and container must be specified when inpod=true")
 	}
+	if len(o.binaryPath) > 0 && (o.unsafe || len(o.buffering) > 0 || o.snapshotInterval > 0) {
+		return fmt.Errorf("unsafe, buffering and snapshot interval only apply to bpftrace programs, not to binaries")
+	}
+	if o.onlyTarget && (!o.inPod || len(o.binaryPath) > 0) {
+		return fmt.Errorf("only-target restricts the bpftrace programs run in a pod")
+	}
+	if (o.unsafe || tracerFlagsUnsafe(o.tracerFlags)) && len(os.Getenv(envDisableUnsafe)) > 0 {
+		return fmt.Errorf("the unsafe mode is disabled in this tracerunner image")
+	}
+	if o.maxOutput < 0 {
+		return fmt.Errorf("max-output cannot be negative, got %d", o.maxOutput)
+	}
+	var err error
+	if len(o.notBefore) > 0 {
+		if o.start, err = time.Parse(time.RFC3339, o.notBefore); err != nil {
+			return fmt.Errorf("invalid not-before time: %v", err)
+		}
+	}
+	if len(o.notAfter) > 0 {
+		if o.end, err = time.Parse(time.RFC3339, o.notAfter); err != nil {
+			return fmt.Errorf("invalid not-after time: %v", err)
+		}
+	}
 	return nil
 }
 
+// terminationMessagePath is where kubernetes reads the termination message of the trace runner container from.
+const terminationMessagePath = "/dev/termination-log"
+
+// writeTerminationMessage sets the error as the termination message of the container, when running in one.
+// The trace runner exits successfully even when the program fails, so that the job does not run it again,
+// the termination message tells the failure.
+func writeTerminationMessage(err error) {
+	if _, statErr := os.Stat(terminationMessagePath); statErr != nil {
+		return
+	}
+	ioutil.WriteFile(terminationMessagePath, []byte(err.Error()), 0644)
+}
+
+// tracerFlagsUnsafe tells whether the tracer flags enable the unsafe mode of bpftrace.
+func tracerFlagsUnsafe(flags string) bool {
+	for _, f := range strings.Fields(flags) {
+		if f == "--unsafe" {
+			return true
+		}
+	}
+	return false
+}
+
 // Complete completes the setup of the command.
 func (o *TraceRunnerOptions) Complete(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
 func (o *TraceRunnerOptions) Run() error {
+	r := newPhaseReporter()
+	err := o.run(r)
+	if err != nil {
+		r.report(meta.PhaseFailed)
+	} else {
+		r.report(meta.PhaseCompleted)
+	}
+	return err
+}
+
+func (o *TraceRunnerOptions) run(r *phaseReporter) error {
+	if o.shell {
+		return runShell(r)
+	}
 	programPath := o.programPath
+	containerPID := ""
 	if o.inPod == true {
 		pid, err := findPidByPodContainer(o.podUID, o.containerName)
 		if err != nil {
@@ -80,22 +179,43 @@ func (o *TraceRunnerOptions) Run() error {
 		if len(*pid) == 0 {
 			return fmt.Errorf("invalid pid found")
 		}
+		containerPID = *pid
+	}
+	if len(containerPID) > 0 && len(o.binaryPath) == 0 {
 		f, err := ioutil.ReadFile(programPath)
 		if err != nil {
 			return err
 		}
 		programPath = path.Join(os.TempDir(), "program-container.bt")
-		r := strings.Replace(string(f), "$container_pid", *pid, -1)
+		r := strings.Replace(string(f), "$container_pid", containerPID, -1)
+		if o.onlyTarget || strings.Contains(r, targetCgroupVar) {
+			cgroupPath, err := containerCgroupPath(containerPID)
+			if err != nil {
+				return err
+			}
+			// bpftrace resolves the ID of the cgroup when compiling the program.
+			targetCgroup := fmt.Sprintf("cgroupid(%q)", cgroupPath)
+			r = strings.Replace(r, targetCgroupVar, targetCgroup, -1)
+			if o.onlyTarget {
+				if r, err = restrictProbes(r, "cgroup == "+targetCgroup); err != nil {
+					return fmt.Errorf("cannot restrict the program to the container: %v", err)
+				}
+			}
+		}
 		if err := ioutil.WriteFile(programPath, []byte(r), 0755); err != nil {
 			return err
 		}
 	}
 
-	fmt.Println("if your program has maps to print, send a SIGINT using Ctrl-C, if you want to interrupt the execution send SIGINT two times")
-	ctx, cancel := context.WithCancel(context.Background())
 	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Signal(syscall.SIGINT), os.Signal(syscall.SIGTERM))
+
+	if err := o.waitForWindow(r, sigCh); err != nil {
+		return err
+	}
 
-	signal.Notify(sigCh, os.Signal(syscall.SIGINT))
+	fmt.Println(meta.RunnerUsageMessage)
+	ctx, cancel := context.WithCancel(context.Background())
 
 	go func() {
 		killable := false
@@ -105,10 +225,19 @@ func (o *TraceRunnerOptions) Run() error {
 			select {
 			case <-ctx.Done():
 				return
-			case <-sigCh:
+			case s := <-sigCh:
+				if s == syscall.SIGTERM {
+					// The pod is being killed, past the deadline and grace period of the trace or deleted, and its
+					// tracer was interrupted by the pre-stop hook: the output of the tracer is still forwarded
+					// until it printed its maps and exited, or until the kubelet kills them all.
+					r.report(meta.PhaseDraining)
+					fmt.Println("\n" + meta.RunnerSIGTERMMessage)
+					continue
+				}
 				if !killable {
 					killable = true
-					fmt.Println("\nfirst SIGINT received, now if your program had maps and did not free them it should print them out")
+					r.report(meta.PhaseDraining)
+					fmt.Println("\n" + meta.RunnerFirstSIGINTMessage)
 					continue
 				}
 				return
@@ -116,11 +245,114 @@ func (o *TraceRunnerOptions) Run() error {
 		}
 	}()
 
-	c := exec.CommandContext(ctx, o.bpftraceBinaryPath, programPath)
+	var c *exec.Cmd
+	if len(o.binaryPath) > 0 {
+		c = exec.CommandContext(ctx, o.binaryPath, strings.Fields(o.tracerFlags)...)
+		c.Env = os.Environ()
+		if len(containerPID) > 0 {
+			c.Env = append(c.Env, envContainerPID+"="+containerPID)
+		}
+	} else {
+		args := []string{}
+		if o.unsafe {
+			args = append(args, "--unsafe")
+		}
+		if len(o.buffering) > 0 {
+			args = append(args, "-B", o.buffering)
+		}
+		args = append(args, strings.Fields(o.tracerFlags)...)
+		args = append(args, programPath)
+		c = exec.CommandContext(ctx, o.bpftraceBinaryPath, args...)
+	}
 	c.Stdout = os.Stdout
+	if o.maxOutput > 0 {
+		limiter := newOutputLimiter(os.Stdout, o.maxOutput)
+		defer limiter.Close()
+		c.Stdout = limiter
+	}
 	c.Stdin = os.Stdin
 	c.Stderr = os.Stderr
-	return c.Run()
+	if err := c.Start(); err != nil {
+		return err
+	}
+	r.report(meta.PhaseCompiling)
+	go func() {
+		if waitForProbes(c.Process.Pid, ctx.Done()) {
+			r.report(meta.PhaseRunning)
+		}
+	}()
+	if o.snapshotInterval > 0 {
+		go snapshotMaps(ctx, c.Process, o.snapshotInterval)
+	}
+	if !o.end.IsZero() {
+		go stopAt(ctx, c.Process, o.end)
+	}
+	if err := c.Wait(); err != nil {
+		return fmt.Errorf("the program failed: %v", err)
+	}
+	return nil
+}
+
+// runShell keeps the tracer ready for the programs run by kubectl trace shell, each run by a trace runner of its own,
+// until interrupted.
+func runShell(r *phaseReporter) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Signal(syscall.SIGINT), os.Signal(syscall.SIGTERM))
+	r.report(meta.PhaseRunning)
+	fmt.Println("tracer ready for the programs of kubectl trace shell")
+	<-sigCh
+	// The programs run by the shell leave their failures as termination message, the shell did not fail.
+	if _, err := os.Stat(terminationMessagePath); err == nil {
+		ioutil.WriteFile(terminationMessagePath, nil, 0644)
+	}
+	return nil
+}
+
+// waitForWindow waits for the beginning of the time window of the trace, unless interrupted by a signal of sigCh,
+// and fails when the window already ended.
+func (o *TraceRunnerOptions) waitForWindow(r *phaseReporter, sigCh <-chan os.Signal) error {
+	if wait := time.Until(o.start); wait > 0 {
+		r.report(meta.PhaseWaiting)
+		fmt.Printf("waiting until %s, the beginning of the time window of the trace\n", o.start.UTC().Format(time.RFC3339))
+		select {
+		case <-time.After(wait):
+		case <-sigCh:
+			return fmt.Errorf("interrupted before the beginning of the time window of the trace")
+		}
+	}
+	if !o.end.IsZero() && !time.Now().Before(o.end) {
+		return fmt.Errorf("the time window of the trace ended at %s", o.end.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// stopAt makes bpftrace print its maps and exit at the end of the time window, sending it SIGINT.
+func stopAt(ctx context.Context, p *os.Process, end time.Time) {
+	t := time.NewTimer(time.Until(end))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+		fmt.Printf("\nthe time window of the trace ended at %s\n", end.UTC().Format(time.RFC3339))
+		p.Signal(syscall.SIGINT)
+	}
+}
+
+// snapshotMaps makes bpftrace print its maps at every interval, sending it SIGUSR1, after a timestamp.
+func snapshotMaps(ctx context.Context, p *os.Process, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			fmt.Printf("\n--- maps at %s ---\n", now.UTC().Format(time.RFC3339))
+			if err := p.Signal(syscall.SIGUSR1); err != nil {
+				return
+			}
+		}
+	}
 }
 
 func findPidByPodContainer(podUID, containerName string) (*string, error) {
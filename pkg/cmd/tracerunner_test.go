@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTracerFlagsUnsafe(t *testing.T) {
+	tests := []struct {
+		flags string
+		want  bool
+	}{
+		{flags: "", want: false},
+		{flags: "-d --include linux/sched.h", want: false},
+		{flags: "-d  --unsafe", want: true},
+		{flags: "--unsafe-not", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.flags, func(t *testing.T) {
+			if got := tracerFlagsUnsafe(tt.flags); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhaseReporter(t *testing.T) {
+	var r *phaseReporter
+	// A nil reporter, outside of a pod, reports nothing.
+	r.report(meta.PhaseRunning)
+
+	var patches []string
+	r = &phaseReporter{patch: func(data []byte) error {
+		patches = append(patches, string(data))
+		return nil
+	}}
+	for _, phase := range []string{meta.PhaseCompiling, meta.PhaseDraining, meta.PhaseRunning, meta.PhaseCompleted, meta.PhaseFailed} {
+		r.report(phase)
+	}
+	want := []string{
+		`{"metadata":{"annotations":{"iovisor.org/kubectl-trace-phase":"Compiling"}}}`,
+		`{"metadata":{"annotations":{"iovisor.org/kubectl-trace-phase":"Draining"}}}`,
+		`{"metadata":{"annotations":{"iovisor.org/kubectl-trace-phase":"Completed"}}}`,
+	}
+	if strings.Join(patches, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got patches %v, want %v", patches, want)
+	}
+
+	patches = nil
+	r = &phaseReporter{patch: func(data []byte) error {
+		patches = append(patches, string(data))
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "trace", nil)
+	}}
+	r.report(meta.PhaseCompiling)
+	r.report(meta.PhaseRunning)
+	if len(patches) != 1 {
+		t.Errorf("got %d patches, want the reporting disabled after a forbidden patch", len(patches))
+	}
+}
@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/factory"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/signals"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	triggerShort = `Watch a cheap probe and run a deeper trace when its rate crosses a threshold`
+	triggerLong  = `Run a watcher trace counting the events of a cheap probe every second against a node or pod,
+and when their rate goes above the threshold, run the bpftrace program against the same target for a bounded duration,
+attaching to it.
+
+The watcher runs until its deadline, until the program ran as many times as allowed, or until interrupted,
+it is deleted then.`
+
+	triggerExamples = `
+  # Trace the fsyncs of a pod in depth for a minute once there are more than 100 per second
+  %[1]s trace trigger pod/mysql-0 -c mysql --probe tracepoint:syscalls:sys_enter_fsync --threshold 100 -f fsync.bt
+
+  # Watch the rate of the TCP retransmits of a node for a day, running the deep trace up to three times
+  %[1]s trace trigger node/node-1 --probe 'kprobe:tcp_retransmit_skb' --threshold 50 -f retransmits.bt --deadline 86400 --max-triggers 3
+`
+)
+
+const (
+	// triggerRatePrefix starts the lines of the rates printed every second by the watcher program.
+	triggerRatePrefix = "kubectl-trace rate "
+	// defaultTriggerDuration is how long the triggered trace runs by default, in seconds.
+	defaultTriggerDuration = 60
+)
+
+// TriggerOptions ...
+type TriggerOptions struct {
+	genericclioptions.IOStreams
+
+	probe               string
+	threshold           int64
+	duration            int64
+	maxTriggers         int
+	eval                string
+	program             string
+	container           string
+	serviceAccount      string
+	imageName           string
+	initImageName       string
+	fetchHeaders        bool
+	deadline            int64
+	deadlineGracePeriod int64
+
+	resourceArg  string
+	target       traceTarget
+	namespace    string
+	clientConfig *rest.Config
+}
+
+// NewTriggerOptions provides an instance of TriggerOptions with default values.
+func NewTriggerOptions(streams genericclioptions.IOStreams) *TriggerOptions {
+	return &TriggerOptions{
+		IOStreams: streams,
+
+		duration:            defaultTriggerDuration,
+		maxTriggers:         1,
+		serviceAccount:      "default",
+		imageName:           ImageNameTag,
+		initImageName:       InitImageNameTag,
+		deadline:            int64(DefaultDeadline),
+		deadlineGracePeriod: int64(DefaultDeadlineGracePeriod),
+	}
+}
+
+// NewTriggerCommand provides the trigger command wrapping TriggerOptions.
+func NewTriggerCommand(factory factory.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewTriggerOptions(streams)
+
+	cmd := &cobra.Command{
+		Use:          "trigger TARGET --probe PROBE --threshold RATE (-e PROGRAM | -f FILENAME)",
+		Short:        i18n.T(triggerShort),
+		Long:         i18n.T(triggerLong),                             // Wrap with templates.LongDesc()
+		Example:      fmt.Sprintf(i18n.T(triggerExamples), "kubectl"), // Wrap with templates.Examples()
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+		PreRunE: func(c *cobra.Command, args []string) error {
+			return o.Validate(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := o.Complete(factory, c, args); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	cmd.Flags().StringVar(&o.probe, "probe", o.probe, "Probe of the watcher, with an optional filter, whose events are counted every second")
+	cmd.Flags().Int64Var(&o.threshold, "threshold", o.threshold, "Number of events per second of the probe above which the program is run")
+	cmd.Flags().Int64Var(&o.duration, "duration", o.duration, "Time the triggered program runs before printing its maps, in seconds")
+	cmd.Flags().IntVar(&o.maxTriggers, "max-triggers", o.maxTriggers, "Number of times the program is run before the watcher stops")
+	cmd.Flags().StringVarP(&o.eval, "eval", "e", o.eval, "Literal string to be evaluated as the triggered bpftrace program")
+	cmd.Flags().StringVarP(&o.program, "filename", "f", o.program, "File containing the triggered bpftrace program")
+	cmd.Flags().StringVarP(&o.container, "container", "c", o.container, "Specify the container")
+	cmd.Flags().StringVar(&o.serviceAccount, "serviceaccount", o.serviceAccount, "Service account to use to set in the pod spec of the kubectl-trace jobs")
+	cmd.Flags().StringVar(&o.imageName, "imagename", o.imageName, "Custom image for the tracerunner")
+	cmd.Flags().StringVar(&o.initImageName, "init-imagename", o.initImageName, "Custom image for the init container responsible to fetch and prepare linux headers")
+	cmd.Flags().BoolVar(&o.fetchHeaders, "fetch-headers", o.fetchHeaders, "Whether to fetch linux headers or not")
+	cmd.Flags().Int64Var(&o.deadline, "deadline", o.deadline, "Maximum time the watcher runs, in seconds")
+	cmd.Flags().Int64Var(&o.deadlineGracePeriod, "deadline-grace-period", o.deadlineGracePeriod, "Maximum wait time to print maps or histograms after deadline, in seconds")
+
+	cmd.MarkFlagRequired("probe")
+	cmd.MarkFlagRequired("threshold")
+	cmd.MarkFlagFilename("filename", "bt")
+	cmd.MarkFlagCustom("container", "__kubectl_trace_get_containers")
+
+	return cmd
+}
+
+// Validate validates the arguments and flags populating TriggerOptions accordingly.
+func (o *TriggerOptions) Validate(cmd *cobra.Command, args []string) error {
+	o.resourceArg = args[0]
+	if len(strings.TrimSpace(o.probe)) == 0 {
+		return fmt.Errorf("the probe of the watcher cannot be empty")
+	}
+	if o.threshold < 0 {
+		return fmt.Errorf("the threshold cannot be negative, got %d", o.threshold)
+	}
+	if o.duration <= 0 {
+		return fmt.Errorf("the duration of the triggered program must be positive, got %d", o.duration)
+	}
+	if o.maxTriggers <= 0 {
+		return fmt.Errorf("the program must be allowed to run at least once, got %d", o.maxTriggers)
+	}
+	if !cmd.Flag("eval").Changed && !cmd.Flag("filename").Changed {
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceMissingErrString))
+	}
+	if cmd.Flag("eval").Changed == cmd.Flag("filename").Changed {
+		return i18n.Errorf(bpftraceDoubleErrString)
+	}
+	if (cmd.Flag("eval").Changed && len(o.eval) == 0) || (cmd.Flag("filename").Changed && len(o.program) == 0) {
+		return errdefs.Errorf(errdefs.ErrProgramInvalid, i18n.T(bpftraceEmptyErrString))
+	}
+	return nil
+}
+
+// Complete completes the setup of the command.
+func (o *TriggerOptions) Complete(factory factory.Factory, cmd *cobra.Command, args []string) error {
+	// Prepare program
+	if len(o.program) > 0 {
+		b, err := ioutil.ReadFile(o.program)
+		if err != nil {
+			return errdefs.Errorf(errdefs.ErrProgramInvalid, "error opening program file")
+		}
+		o.program = string(b)
+	} else {
+		o.program = o.eval
+	}
+
+	// Prepare namespace
+	var err error
+	o.namespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.target, err = lookupTarget(factory, o.namespace, o.resourceArg, o.container)
+	if err != nil {
+		return err
+	}
+
+	// Prepare client
+	o.clientConfig, err = factory.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Run executes the trigger command.
+func (o *TriggerOptions) Run() error {
+	jobsClient, err := batchv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coreClient, err := corev1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	coordinationClient, err := coordinationv1client.NewForConfig(o.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	tc := &tracejob.TraceJobClient{
+		JobClient:           jobsClient.Jobs(o.namespace),
+		ConfigClient:        coreClient.ConfigMaps(o.namespace),
+		LeaseClient:         coordinationClient,
+		ClusterJobClient:    jobsClient,
+		ClusterConfigClient: coreClient,
+		QuotaClient:         coreClient.ResourceQuotas(o.namespace),
+	}
+	tc.WithOutStream(ioutil.Discard)
+
+	watcher, err := o.buildTraceJob(watcherProgram(o.probe), o.deadline)
+	if err != nil {
+		return fmt.Errorf("watcher: %v", err)
+	}
+	deep, err := o.buildTraceJob(o.program, o.duration)
+	if err != nil {
+		return err
+	}
+
+	ctx := signals.WithStandardSignals(context.Background())
+	if _, err := tc.CreateJob(ctx, watcher); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.IOStreams.ErrOut, "watcher trace %s created\n", watcher.ID)
+	// The watcher is not left running once done with, even when interrupted.
+	defer tc.DeleteJobs(context.Background(), tracejob.TraceJobFilter{ID: &watcher.ID})
+
+	// The rates seen while the program runs are dropped.
+	rates := make(chan int64, 1)
+	watcherCtx, stopWatcher := context.WithCancel(ctx)
+	defer stopWatcher()
+	watcherDone := make(chan error, 1)
+	go func() {
+		a := attacher.NewAttacher(coreClient, o.clientConfig, genericclioptions.IOStreams{Out: ioutil.Discard, ErrOut: o.IOStreams.ErrOut})
+		a.WithContext(watcherCtx)
+		a.WithQuiet(true)
+		a.WithObserver(lifecycle.Funcs{
+			OutputLine: func(e lifecycle.Event, line string) {
+				if rate, ok := parseRate(line); ok {
+					select {
+					case rates <- rate:
+					default:
+					}
+				}
+			},
+		})
+		watcherDone <- a.AttachJob(watcher.ID, watcher.Namespace)
+	}()
+
+	for triggers := 0; triggers < o.maxTriggers; {
+		select {
+		case err := <-watcherDone:
+			if err != nil {
+				return fmt.Errorf("watcher: %v", err)
+			}
+			return nil
+		case rate := <-rates:
+			if rate <= o.threshold {
+				continue
+			}
+			triggers++
+			if triggers > 1 {
+				// Every run of the program is a trace of its own.
+				if deep, err = o.buildTraceJob(o.program, o.duration); err != nil {
+					return err
+				}
+			}
+			if _, err := tc.CreateJob(ctx, deep); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.IOStreams.ErrOut, "rate of %d/s above %d/s, trace %s created (%d/%d)\n", rate, o.threshold, deep.ID, triggers, o.maxTriggers)
+			a := attacher.NewAttacher(coreClient, o.clientConfig, o.IOStreams)
+			a.WithContext(ctx)
+			if err := a.AttachJob(deep.ID, deep.Namespace); err != nil {
+				return err
+			}
+			// Drop the rate seen while attached.
+			select {
+			case <-rates:
+			default:
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// buildTraceJob builds the trace job running the program against the target for the deadline, in seconds.
+func (o *TriggerOptions) buildTraceJob(program string, deadline int64) (tracejob.TraceJob, error) {
+	return tracejob.New(o.target.tracejobTarget()).
+		WithNamespace(o.namespace).
+		WithServiceAccount(o.serviceAccount).
+		WithProgram(program).
+		WithImage(o.imageName).
+		WithInitImage(o.initImageName).
+		WithFetchHeaders(o.fetchHeaders).
+		WithDeadline(deadline).
+		WithDeadlineGracePeriod(o.deadlineGracePeriod).
+		WithBuffering("line").
+		Build()
+}
+
+// watcherProgram returns the program counting the events of the probe and printing their number every second.
+func watcherProgram(probe string) string {
+	return fmt.Sprintf(`%s { @events = count(); }
+interval:s:1 { printf("%s%%d\n", @events); clear(@events); }
+END { clear(@events); }
+`, probe, triggerRatePrefix)
+}
+
+// parseRate parses a line of rate printed by the watcher program.
+func parseRate(line string) (int64, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, triggerRatePrefix) {
+		return 0, false
+	}
+	rate, err := strconv.ParseInt(strings.TrimPrefix(line, triggerRatePrefix), 10, 64)
+	return rate, err == nil
+}
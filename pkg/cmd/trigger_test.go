@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   int64
+		wantOK bool
+	}{
+		{line: "kubectl-trace rate 120", want: 120, wantOK: true},
+		{line: "kubectl-trace rate 0\r", want: 0, wantOK: true},
+		{line: "Attaching 3 probes..."},
+		{line: "kubectl-trace rate many"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, ok := parseRate(tt.line)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRate() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestWatcherProgram(t *testing.T) {
+	got := watcherProgram(`tracepoint:syscalls:sys_enter_fsync /comm == "mysqld"/`)
+	want := `tracepoint:syscalls:sys_enter_fsync /comm == "mysqld"/ { @events = count(); }`
+	if !strings.HasPrefix(got, want) || !strings.Contains(got, `printf("kubectl-trace rate %d\n", @events)`) {
+		t.Errorf("watcherProgram() = %q", got)
+	}
+}
@@ -2,21 +2,128 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/color"
+	"github.com/iovisor/kubectl-trace/pkg/config"
+	"github.com/iovisor/kubectl-trace/pkg/i18n"
+	"github.com/iovisor/kubectl-trace/pkg/registry"
 	"github.com/iovisor/kubectl-trace/pkg/version"
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
+var (
+	versionShort = `Print the version information for kubectl trace`
+	versionLong  = `Print the version information for kubectl trace and its default images.
+
+With --remote, also print the versions of the tools the images contain, read from the labels of the images
+in their registry, and warn when the tracerunner image is not compatible with this kubectl trace.`
+
+	versionExamples = `
+  # Print the version of kubectl trace and its default images
+  %[1]s trace version
+
+  # Also print the versions of bpftrace and bcc of the default images, looked up in their registry
+  %[1]s trace version --remote`
+)
+
+// registryTimeout is how long to wait for the registry when reading the image labels.
+const registryTimeout = 10 * time.Second
+
+// VersionOptions ...
+type VersionOptions struct {
+	genericclioptions.IOStreams
+
+	config *config.Config
+
+	remote        bool
+	imageName     string
+	initImageName string
+}
+
+// NewVersionOptions provides an instance of VersionOptions with default values.
+func NewVersionOptions(streams genericclioptions.IOStreams) *VersionOptions {
+	return &VersionOptions{
+		IOStreams: streams,
+
+		imageName:     ImageNameTag,
+		initImageName: InitImageNameTag,
+	}
+}
+
 // NewVersionCommand provides the version command.
-func NewVersionCommand(streams genericclioptions.IOStreams) *cobra.Command {
+func NewVersionCommand(cfg *config.Config, streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewVersionOptions(streams)
+	o.config = cfg
+
 	cmd := &cobra.Command{
-		Use:   "version",
-		Short: "Print the version information for kubectl trace",
+		Use:     "version",
+		Short:   i18n.T(versionShort),
+		Long:    i18n.T(versionLong),                             // Wrap with templates.LongDesc()
+		Example: fmt.Sprintf(i18n.T(versionExamples), "kubectl"), // Wrap with templates.Examples()
+		Args:    cobra.NoArgs,
 		RunE: func(c *cobra.Command, args []string) error {
-			fmt.Fprintln(streams.Out, version.String())
-			return nil
+			o.Complete()
+			return o.Run()
 		},
 	}
+
+	cmd.Flags().BoolVar(&o.remote, "remote", o.remote, "Look up the versions of the tools of the images in their registry")
+
 	return cmd
 }
+
+// Complete completes the setup of the command.
+func (o *VersionOptions) Complete() {
+	if o.config == nil {
+		return
+	}
+	if len(o.config.ImageName) > 0 {
+		o.imageName = o.config.ImageName
+	}
+	if len(o.config.InitImageName) > 0 {
+		o.initImageName = o.config.InitImageName
+	}
+}
+
+// Run executes the version command.
+func (o *VersionOptions) Run() error {
+	fmt.Fprintln(o.Out, version.String())
+	if !o.remote {
+		fmt.Fprintf(o.Out, "tracerunner image: %s\n", o.imageName)
+		fmt.Fprintf(o.Out, "init image: %s\n", o.initImageName)
+		return nil
+	}
+
+	rc := registry.NewClient(registryTimeout)
+
+	fmt.Fprintf(o.Out, "tracerunner image: %s\n", o.imageName)
+	labels, err := rc.Labels(o.imageName)
+	if err != nil {
+		fmt.Fprintf(o.Out, "  could not read the image labels: %v\n", err)
+	} else {
+		fmt.Fprintf(o.Out, "  git commit: %s\n", labelOr(labels, version.ImageLabelGitCommit, "unknown"))
+		fmt.Fprintf(o.Out, "  bpftrace version: %s\n", labelOr(labels, version.ImageLabelBpftraceVersion, "unknown"))
+		fmt.Fprintf(o.Out, "  bcc version: %s\n", labelOr(labels, version.ImageLabelBCCVersion, "not included"))
+		if p, ok := labels[version.ImageLabelRunnerProtocol]; ok && p != version.RunnerProtocol {
+			fmt.Fprintf(o.ErrOut, "%s the tracerunner image implements the runner protocol %s while this kubectl trace needs %s, traces are likely to fail\n", color.Sprint(o.ErrOut, color.Yellow, "warning:"), p, version.RunnerProtocol)
+		}
+	}
+
+	fmt.Fprintf(o.Out, "init image: %s\n", o.initImageName)
+	labels, err = rc.Labels(o.initImageName)
+	if err != nil {
+		fmt.Fprintf(o.Out, "  could not read the image labels: %v\n", err)
+	} else {
+		fmt.Fprintf(o.Out, "  git commit: %s\n", labelOr(labels, version.ImageLabelGitCommit, "unknown"))
+	}
+	return nil
+}
+
+func labelOr(labels map[string]string, key, def string) string {
+	if v, ok := labels[key]; ok && len(v) > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,67 @@
+package color
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/kubectl/util/term"
+)
+
+// EnvNoColor disables colors when set to any value, see https://no-color.org.
+const EnvNoColor = "NO_COLOR"
+
+// Color is an ANSI foreground color.
+type Color int
+
+// The colors used by kubectl-trace.
+const (
+	// Default is the default color of the terminal, for aligning colored columns.
+	Default Color = 39
+	// Red is for failures.
+	Red Color = 31
+	// Green is for success.
+	Green Color = 32
+	// Yellow is for warnings and for things in progress.
+	Yellow Color = 33
+	// Cyan is for information.
+	Cyan Color = 36
+)
+
+var (
+	mu       sync.Mutex
+	disabled bool
+)
+
+// Disable turns colors off for all the writers.
+func Disable() {
+	mu.Lock()
+	defer mu.Unlock()
+	disabled = true
+}
+
+// Setup turns colors off when asked to, either with noColor or by the environment.
+func Setup(noColor bool) {
+	_, set := os.LookupEnv(EnvNoColor)
+	if noColor || set || os.Getenv("TERM") == "dumb" {
+		Disable()
+	}
+}
+
+// Enabled tells whether text written to w can be colored, which requires w to be a terminal.
+func Enabled(w io.Writer) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return !disabled && term.IsTerminal(w)
+}
+
+// Sprint returns s in color c when text written to w can be colored, s as is otherwise.
+// All the strings colored with the same writer take the same additional width,
+// so that colored columns stay aligned.
+func Sprint(w io.Writer, c Color, s string) string {
+	if !Enabled(w) {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", c, s)
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/iovisor/kubectl-trace/pkg/hooks"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/homedir"
+)
+
+// Environment variables overriding the values of the configuration file.
+const (
+	// EnvConfig is the path of the configuration file.
+	EnvConfig = "KUBECTL_TRACE_CONFIG"
+	// EnvImageName is the image for the tracerunner.
+	EnvImageName = "KUBECTL_TRACE_IMAGE"
+	// EnvInitImageName is the image for the init container.
+	EnvInitImageName = "KUBECTL_TRACE_INIT_IMAGE"
+	// EnvServiceAccount is the service account of the trace job pods.
+	EnvServiceAccount = "KUBECTL_TRACE_SERVICEACCOUNT"
+	// EnvNamespace is the namespace trace jobs are created and looked up in.
+	EnvNamespace = "KUBECTL_TRACE_NAMESPACE"
+)
+
+// Defaults are the values used by the kubectl-trace commands when the corresponding flags are not set.
+type Defaults struct {
+	// ImageName is the image for the tracerunner.
+	ImageName string `json:"imageName,omitempty"`
+	// InitImageName is the image for the init container fetching the linux headers.
+	InitImageName string `json:"initImageName,omitempty"`
+	// ServiceAccount is the service account of the trace job pods.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// Namespace is the namespace trace jobs are created and looked up in.
+	Namespace string `json:"namespace,omitempty"`
+	// RuntimeClass is the runtime class of the trace job pods, for the clusters whose default one is a sandbox.
+	RuntimeClass string `json:"runtimeClass,omitempty"`
+	// HostPID and HostNetwork tell whether the trace job pods run in the PID and network namespaces of the host.
+	HostPID     *bool `json:"hostPID,omitempty"`
+	HostNetwork *bool `json:"hostNetwork,omitempty"`
+	// Proxy is the URL of the proxy the trace job pods reach the network through, or env for the one of the
+	// environment. NoProxy lists what they reach without it.
+	Proxy   string `json:"proxy,omitempty"`
+	NoProxy string `json:"noProxy,omitempty"`
+	// CAConfigMap is the configmap, as NAME or NAME:KEY, holding the bundle of CA certificates trusted by the trace job
+	// pods instead of the ones of their images.
+	CAConfigMap string `json:"caConfigMap,omitempty"`
+	// LockNamespace is the namespace of the leases locking the nodes of the exclusive traces.
+	LockNamespace string `json:"lockNamespace,omitempty"`
+	// Resources are the compute resources of the tracerunner container.
+	Resources *apiv1.ResourceRequirements `json:"resources,omitempty"`
+	// Deadline is the maximum time a trace is allowed to run, in seconds.
+	Deadline *int64 `json:"deadline,omitempty"`
+	// DeadlineGracePeriod is the maximum time to wait to print maps after the deadline, in seconds.
+	DeadlineGracePeriod *int64 `json:"deadlineGracePeriod,omitempty"`
+	// FetchHeaders tells whether to fetch the linux headers.
+	FetchHeaders *bool `json:"fetchHeaders,omitempty"`
+	// DisableUnsafe refuses to run traces in bpftrace unsafe mode.
+	DisableUnsafe *bool `json:"disableUnsafe,omitempty"`
+	// Hooks are run before the trace starts and after it completes.
+	Hooks *hooks.Hooks `json:"hooks,omitempty"`
+	// BpftraceImages maps the bpftrace versions to the tracerunner images shipping them.
+	BpftraceImages map[string]string `json:"bpftraceImages,omitempty"`
+	// Redact are the regular expressions of the text redacted from the output of the traces, on top of the ones
+	// given as flags.
+	Redact []string `json:"redact,omitempty"`
+}
+
+// Config is the content of the configuration file.
+type Config struct {
+	Defaults
+
+	// Presets are named sets of defaults, applied on top of the others when selected.
+	Presets map[string]Defaults `json:"presets,omitempty"`
+
+	// Recipes are named sets of programs run together against the same target by the recipe command.
+	Recipes map[string]Recipe `json:"recipes,omitempty"`
+
+	// Mappings give the service account and namespace of the traces of users and groups, the first one matching the
+	// current user applied on top of the defaults.
+	Mappings []Mapping `json:"mappings,omitempty"`
+}
+
+// Mapping is the service account and namespace the traces of some users and groups use.
+type Mapping struct {
+	// Users are the names of the users of the kubeconfig, or of the common names of their client certificates.
+	Users []string `json:"users,omitempty"`
+	// Groups are the organizations of the client certificates of the users.
+	Groups []string `json:"groups,omitempty"`
+
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+}
+
+// Identity is who runs kubectl-trace, as far as the kubeconfig tells.
+type Identity struct {
+	// Names are the names the user is known by, like the name of the user of the kubeconfig and the common name of
+	// its client certificate.
+	Names  []string
+	Groups []string
+}
+
+// matches tells whether the mapping applies to the identity.
+func (m Mapping) matches(id Identity) bool {
+	return intersects(m.Users, id.Names) || intersects(m.Groups, id.Groups)
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UseMapping overrides the service account and namespace defaults with the ones of the first mapping matching the
+// identity, and returns its index, -1 when none matches.
+func (c *Config) UseMapping(id Identity) int {
+	for i, m := range c.Mappings {
+		if !m.matches(id) {
+			continue
+		}
+		if len(m.ServiceAccount) > 0 {
+			c.ServiceAccount = m.ServiceAccount
+		}
+		if len(m.Namespace) > 0 {
+			c.Namespace = m.Namespace
+		}
+		return i
+	}
+	return -1
+}
+
+// DefaultPath returns the path of the configuration file used when none is given explicitly.
+func DefaultPath() string {
+	if path := os.Getenv(EnvConfig); len(path) > 0 {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if len(dir) == 0 {
+		dir = filepath.Join(homedir.HomeDir(), ".config")
+	}
+	return filepath.Join(dir, "kubectl-trace", "config.yaml")
+}
+
+// Load reads the configuration file at path.
+// When optional is true a missing file results in an empty configuration rather than an error.
+func Load(path string, optional bool) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && optional {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file %s: %v", path, err)
+	}
+
+	c := &Config{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("error parsing configuration file %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// FromEnv overrides the configuration with the values set in the environment.
+func (c *Config) FromEnv() {
+	fromEnv(EnvImageName, &c.ImageName)
+	fromEnv(EnvInitImageName, &c.InitImageName)
+	fromEnv(EnvServiceAccount, &c.ServiceAccount)
+	fromEnv(EnvNamespace, &c.Namespace)
+}
+
+func fromEnv(key string, value *string) {
+	if v := os.Getenv(key); len(v) > 0 {
+		*value = v
+	}
+}
+
+// UsePreset overrides the defaults with the ones set in the named preset.
+func (c *Config) UsePreset(name string) error {
+	p, ok := c.Presets[name]
+	if !ok {
+		return fmt.Errorf("preset %s not found in the configuration file", name)
+	}
+
+	if len(p.ImageName) > 0 {
+		c.ImageName = p.ImageName
+	}
+	if len(p.InitImageName) > 0 {
+		c.InitImageName = p.InitImageName
+	}
+	if len(p.ServiceAccount) > 0 {
+		c.ServiceAccount = p.ServiceAccount
+	}
+	if len(p.Namespace) > 0 {
+		c.Namespace = p.Namespace
+	}
+	if len(p.RuntimeClass) > 0 {
+		c.RuntimeClass = p.RuntimeClass
+	}
+	if p.HostPID != nil {
+		c.HostPID = p.HostPID
+	}
+	if p.HostNetwork != nil {
+		c.HostNetwork = p.HostNetwork
+	}
+	if len(p.Proxy) > 0 {
+		c.Proxy = p.Proxy
+	}
+	if len(p.NoProxy) > 0 {
+		c.NoProxy = p.NoProxy
+	}
+	if len(p.CAConfigMap) > 0 {
+		c.CAConfigMap = p.CAConfigMap
+	}
+	if len(p.LockNamespace) > 0 {
+		c.LockNamespace = p.LockNamespace
+	}
+	if p.Resources != nil {
+		c.Resources = p.Resources
+	}
+	if p.Deadline != nil {
+		c.Deadline = p.Deadline
+	}
+	if p.DeadlineGracePeriod != nil {
+		c.DeadlineGracePeriod = p.DeadlineGracePeriod
+	}
+	if p.FetchHeaders != nil {
+		c.FetchHeaders = p.FetchHeaders
+	}
+	if p.DisableUnsafe != nil {
+		c.DisableUnsafe = p.DisableUnsafe
+	}
+	if p.Hooks != nil {
+		c.Hooks = p.Hooks
+	}
+	// The redactions of a preset add to the others, a preset cannot weaken the policy.
+	c.Redact = append(c.Redact, p.Redact...)
+	for version, image := range p.BpftraceImages {
+		if c.BpftraceImages == nil {
+			c.BpftraceImages = map[string]string{}
+		}
+		c.BpftraceImages[version] = image
+	}
+	return nil
+}
+
+// BpftraceImage returns the tracerunner image shipping the given version of bpftrace.
+func (c *Config) BpftraceImage(version string) (string, error) {
+	if image, ok := c.BpftraceImages[version]; ok {
+		return image, nil
+	}
+	if len(c.BpftraceImages) == 0 {
+		return "", fmt.Errorf("bpftrace version %s requested but no bpftraceImages are set in the configuration file", version)
+	}
+	versions := make([]string, 0, len(c.BpftraceImages))
+	for v := range c.BpftraceImages {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return "", fmt.Errorf("no image for bpftrace version %s in the configuration file, the known versions are %s", version, strings.Join(versions, ", "))
+}
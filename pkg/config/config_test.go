@@ -0,0 +1,232 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-trace-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	content := `
+imageName: quay.io/myorg/kubectl-trace-bpftrace:v1
+serviceAccount: kubectltrace
+namespace: tracing
+runtimeClass: runc
+resources:
+  limits:
+    cpu: 500m
+    memory: 256Mi
+hooks:
+  pre:
+  - command: kubectl scale deployment canary --replicas=1
+  post:
+  - image: curlimages/curl
+    args: ["curl", "-d", "done", "https://hooks.example.com"]
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path, false)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if c.ImageName != "quay.io/myorg/kubectl-trace-bpftrace:v1" {
+		t.Errorf("Load() imageName = %q", c.ImageName)
+	}
+	if c.ServiceAccount != "kubectltrace" || c.Namespace != "tracing" {
+		t.Errorf("Load() serviceAccount = %q, namespace = %q", c.ServiceAccount, c.Namespace)
+	}
+	if c.RuntimeClass != "runc" {
+		t.Errorf("Load() runtimeClass = %q", c.RuntimeClass)
+	}
+	if c.Resources == nil {
+		t.Fatalf("Load() resources not loaded")
+	}
+	if cpu := c.Resources.Limits[apiv1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("Load() cpu limit = %s, want 500m", cpu.String())
+	}
+	if c.Hooks == nil || len(c.Hooks.Pre) != 1 || len(c.Hooks.Post) != 1 {
+		t.Fatalf("Load() hooks = %+v", c.Hooks)
+	}
+	if c.Hooks.Pre[0].Command != "kubectl scale deployment canary --replicas=1" {
+		t.Errorf("Load() pre hook command = %q", c.Hooks.Pre[0].Command)
+	}
+	if c.Hooks.Post[0].Image != "curlimages/curl" || len(c.Hooks.Post[0].Args) != 4 {
+		t.Errorf("Load() post hook = %+v", c.Hooks.Post[0])
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml"), false); err == nil {
+		t.Errorf("Load() of a missing explicit file should fail")
+	}
+	c, err = Load(filepath.Join(dir, "missing.yaml"), true)
+	if err != nil || c == nil {
+		t.Errorf("Load() of a missing optional file = %v, %v", c, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	os.Setenv(EnvImageName, "quay.io/myorg/bpftrace:env")
+	os.Setenv(EnvServiceAccount, "")
+	defer os.Unsetenv(EnvImageName)
+	defer os.Unsetenv(EnvServiceAccount)
+
+	c := &Config{
+		Defaults: Defaults{
+			ImageName:      "quay.io/myorg/bpftrace:file",
+			ServiceAccount: "kubectltrace",
+		},
+	}
+	c.FromEnv()
+
+	if c.ImageName != "quay.io/myorg/bpftrace:env" {
+		t.Errorf("FromEnv() imageName = %q, want the environment value", c.ImageName)
+	}
+	if c.ServiceAccount != "kubectltrace" {
+		t.Errorf("FromEnv() serviceAccount = %q, an empty variable should not override the file", c.ServiceAccount)
+	}
+}
+
+func TestUsePreset(t *testing.T) {
+	deadline := int64(300)
+	fetchHeaders := true
+	c := &Config{
+		Defaults: Defaults{
+			ImageName:      "quay.io/myorg/bpftrace:latest",
+			ServiceAccount: "kubectltrace",
+			Redact:         []string{`password=(\S+)`},
+		},
+		Presets: map[string]Defaults{
+			"prod-safe": Defaults{
+				ImageName: "quay.io/myorg/bpftrace:restricted",
+				Deadline:  &deadline,
+				Redact:    []string{`AKIA[0-9A-Z]{16}`},
+			},
+			"deep-debug": Defaults{
+				FetchHeaders: &fetchHeaders,
+			},
+		},
+	}
+
+	if err := c.UsePreset("prod-safe"); err != nil {
+		t.Fatalf("UsePreset() error = %v", err)
+	}
+	if c.ImageName != "quay.io/myorg/bpftrace:restricted" {
+		t.Errorf("UsePreset() imageName = %q, want the preset value", c.ImageName)
+	}
+	if c.ServiceAccount != "kubectltrace" {
+		t.Errorf("UsePreset() serviceAccount = %q, want the value outside the preset", c.ServiceAccount)
+	}
+	if c.Deadline == nil || *c.Deadline != 300 {
+		t.Errorf("UsePreset() deadline = %v, want 300", c.Deadline)
+	}
+	if c.FetchHeaders != nil {
+		t.Errorf("UsePreset() fetchHeaders set by another preset")
+	}
+	if len(c.Redact) != 2 {
+		t.Errorf("UsePreset() redact = %v, want the preset ones added to the others", c.Redact)
+	}
+
+	if err := c.UsePreset("missing"); err == nil {
+		t.Errorf("UsePreset() of a missing preset should fail")
+	}
+}
+
+func TestUseMapping(t *testing.T) {
+	mappings := []Mapping{
+		{Users: []string{"alice"}, ServiceAccount: "tracer-alice"},
+		{Groups: []string{"payments"}, ServiceAccount: "tracer-payments", Namespace: "payments"},
+		{Users: []string{"bob"}, Groups: []string{"payments"}, ServiceAccount: "tracer-bob"},
+	}
+	tests := []struct {
+		name               string
+		id                 Identity
+		want               int
+		wantServiceAccount string
+		wantNamespace      string
+	}{
+		{
+			name:               "user",
+			id:                 Identity{Names: []string{"alice@prod", "alice"}},
+			want:               0,
+			wantServiceAccount: "tracer-alice",
+			wantNamespace:      "tracing",
+		},
+		{
+			name:               "first match",
+			id:                 Identity{Names: []string{"bob"}, Groups: []string{"system:authenticated", "payments"}},
+			want:               1,
+			wantServiceAccount: "tracer-payments",
+			wantNamespace:      "payments",
+		},
+		{
+			name:               "no match",
+			id:                 Identity{Names: []string{"carol"}},
+			want:               -1,
+			wantServiceAccount: "kubectltrace",
+			wantNamespace:      "tracing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				Defaults: Defaults{ServiceAccount: "kubectltrace", Namespace: "tracing"},
+				Mappings: mappings,
+			}
+			if got := c.UseMapping(tt.id); got != tt.want {
+				t.Errorf("UseMapping() = %d, want %d", got, tt.want)
+			}
+			if c.ServiceAccount != tt.wantServiceAccount || c.Namespace != tt.wantNamespace {
+				t.Errorf("UseMapping() serviceAccount, namespace = %s, %s, want %s, %s", c.ServiceAccount, c.Namespace, tt.wantServiceAccount, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestBpftraceImage(t *testing.T) {
+	c := &Config{
+		Defaults: Defaults{
+			BpftraceImages: map[string]string{
+				"0.18": "quay.io/myorg/bpftrace:v0.18",
+				"0.19": "quay.io/myorg/bpftrace:v0.19",
+			},
+		},
+		Presets: map[string]Defaults{
+			"nightly": Defaults{
+				BpftraceImages: map[string]string{"0.19": "quay.io/myorg/bpftrace:v0.19-nightly"},
+			},
+		},
+	}
+
+	if image, err := c.BpftraceImage("0.18"); err != nil || image != "quay.io/myorg/bpftrace:v0.18" {
+		t.Errorf("BpftraceImage() = %q, %v", image, err)
+	}
+	if _, err := c.BpftraceImage("0.20"); err == nil || !strings.Contains(err.Error(), "0.18, 0.19") {
+		t.Errorf("BpftraceImage() of an unknown version error = %v, want the known versions", err)
+	}
+
+	if err := c.UsePreset("nightly"); err != nil {
+		t.Fatalf("UsePreset() error = %v", err)
+	}
+	if image, _ := c.BpftraceImage("0.19"); image != "quay.io/myorg/bpftrace:v0.19-nightly" {
+		t.Errorf("BpftraceImage() = %q, want the preset value", image)
+	}
+	if image, _ := c.BpftraceImage("0.18"); image != "quay.io/myorg/bpftrace:v0.18" {
+		t.Errorf("BpftraceImage() = %q, want the value outside the preset", image)
+	}
+
+	if _, err := (&Config{}).BpftraceImage("0.19"); err == nil {
+		t.Errorf("BpftraceImage() without images should fail")
+	}
+}
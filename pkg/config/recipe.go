@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Recipe is a named set of programs run together against the same target, like biolatency, biosnoop and fsslower
+// for the health of the IOs of a node.
+type Recipe struct {
+	// Description tells what the recipe is for.
+	Description string `json:"description,omitempty"`
+	// Programs are the programs of the recipe, each run by its own trace.
+	Programs []RecipeProgram `json:"programs"`
+}
+
+// RecipeProgram is a program of a recipe.
+type RecipeProgram struct {
+	// Name names the output of the program in the report of the recipe.
+	Name string `json:"name"`
+	// Program is the bpftrace program.
+	Program string `json:"program"`
+}
+
+// Validate tells whether the recipe has programs, all named differently.
+func (r *Recipe) Validate() error {
+	if len(r.Programs) == 0 {
+		return fmt.Errorf("the recipe has no programs")
+	}
+	names := map[string]bool{}
+	for i, p := range r.Programs {
+		if len(p.Name) == 0 {
+			return fmt.Errorf("program %d of the recipe has no name", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("the recipe has several programs named %s", p.Name)
+		}
+		names[p.Name] = true
+		if len(strings.TrimSpace(p.Program)) == 0 {
+			return fmt.Errorf("program %s of the recipe is empty", p.Name)
+		}
+	}
+	return nil
+}
+
+// LoadRecipe reads the recipe defined by the file at path, to share recipes outside of the configuration file.
+func LoadRecipe(path string) (*Recipe, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading recipe file %s: %v", path, err)
+	}
+	r := &Recipe{}
+	if err := yaml.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("error parsing recipe file %s: %v", path, err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid recipe file %s: %v", path, err)
+	}
+	return r, nil
+}
+
+// Recipe returns the named recipe of the configuration file.
+func (c *Config) Recipe(name string) (*Recipe, error) {
+	r, ok := c.Recipes[name]
+	if !ok {
+		if len(c.Recipes) == 0 {
+			return nil, fmt.Errorf("recipe %s requested but no recipes are set in the configuration file", name)
+		}
+		names := make([]string, 0, len(c.Recipes))
+		for n := range c.Recipes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("recipe %s not found in the configuration file, the known recipes are %s", name, strings.Join(names, ", "))
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid recipe %s: %v", name, err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRecipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-trace-recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "io-health.yaml")
+	content := `
+description: Latency and slow operations of the disks and filesystems
+programs:
+- name: biolatency
+  program: |
+    kprobe:blk_account_io_start { @start[arg0] = nsecs; }
+- name: fsslower
+  program: kprobe:vfs_read { @reads = count(); }
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := LoadRecipe(path)
+	if err != nil {
+		t.Fatalf("LoadRecipe() error = %v", err)
+	}
+	if len(r.Programs) != 2 || r.Programs[0].Name != "biolatency" || r.Programs[1].Program != "kprobe:vfs_read { @reads = count(); }" {
+		t.Errorf("LoadRecipe() = %+v", r)
+	}
+}
+
+func TestRecipe(t *testing.T) {
+	c := &Config{
+		Recipes: map[string]Recipe{
+			"io-health": {Programs: []RecipeProgram{{Name: "biolatency", Program: "kprobe:blk_account_io_start {}"}}},
+			"cpu":       {Programs: []RecipeProgram{{Name: "a", Program: "BEGIN {}"}, {Name: "a", Program: "END {}"}}},
+		},
+	}
+
+	if r, err := c.Recipe("io-health"); err != nil || len(r.Programs) != 1 {
+		t.Errorf("Recipe() = %+v, %v", r, err)
+	}
+	if _, err := c.Recipe("net"); err == nil || !strings.Contains(err.Error(), "cpu, io-health") {
+		t.Errorf("Recipe() of an unknown recipe error = %v, want the known recipes", err)
+	}
+	if _, err := c.Recipe("cpu"); err == nil || !strings.Contains(err.Error(), "several programs named a") {
+		t.Errorf("Recipe() of an invalid recipe error = %v", err)
+	}
+	if _, err := (&Config{}).Recipe("cpu"); err == nil {
+		t.Errorf("Recipe() without recipes should fail")
+	}
+}
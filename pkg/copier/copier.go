@@ -0,0 +1,371 @@
+package copier
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/logging"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
+)
+
+const (
+	podNotFoundError              = "no trace found to copy files with the given selector"
+	podPhaseNotAcceptedError      = "cannot copy files of a trace that is not running; current phase is %s"
+	invalidPodContainersSizeError = "unexpected number of containers in trace job pod"
+)
+
+// chunkSize is the maximum size copied by each exec of a resumable copy.
+const chunkSize = 64 * 1024 * 1024
+
+// resumeAttempts is how many times in a row a resumable copy is resumed after a failed transfer.
+const resumeAttempts = 5
+
+// Copier copies files out of and into the running trace job pods, streaming tar archives through exec like kubectl cp.
+// The tracerunner image must have tar.
+type Copier struct {
+	coreV1Client tcorev1.CoreV1Interface
+	config       *restclient.Config
+}
+
+func NewCopier(client tcorev1.CoreV1Interface, config *restclient.Config) *Copier {
+	return &Copier{
+		coreV1Client: client,
+		config:       config,
+	}
+}
+
+// FromTrace copies the file or the directory at src in the trace job pod to the local path dst.
+func (c *Copier) FromTrace(jobID types.UID, namespace, src, dst string) error {
+	pod, err := c.findPod(jobID, namespace)
+	if err != nil {
+		return err
+	}
+
+	src = path.Clean(src)
+	pr, pw := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		err := c.exec(pod, []string{"tar", "cf", "-", "-C", path.Dir(src), path.Base(src)}, nil, pw)
+		pw.CloseWithError(err)
+		errCh <- err
+	}()
+
+	if err := untar(pr, path.Base(src), dst); err != nil {
+		pr.CloseWithError(err)
+		<-errCh
+		return err
+	}
+	io.Copy(ioutil.Discard, pr)
+	return <-errCh
+}
+
+// FromTraceResumable copies the regular file at src in the trace job pod to the local file dst in chunks,
+// appending to dst from its current size so that an interrupted copy can be resumed.
+// A chunk failing to transfer is retried from where it stopped, up to resumeAttempts times in a row.
+func (c *Copier) FromTraceResumable(jobID types.UID, namespace, src, dst string) error {
+	pod, err := c.findPod(jobID, namespace)
+	if err != nil {
+		return err
+	}
+
+	size, err := c.size(pod, src)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	failures := 0
+	for {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		offset := fi.Size()
+		if offset == size {
+			return nil
+		}
+		if offset > size {
+			return fmt.Errorf("%s is larger than %s in the trace, it is not a partial copy of it", dst, src)
+		}
+
+		count := size - offset
+		if count > chunkSize {
+			count = chunkSize
+		}
+		err = c.exec(pod, []string{
+			"dd",
+			"if=" + src,
+			"iflag=skip_bytes,count_bytes",
+			fmt.Sprintf("skip=%d", offset),
+			fmt.Sprintf("count=%d", count),
+			"bs=64K",
+			"status=none",
+		}, nil, f)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		if failures > resumeAttempts {
+			return err
+		}
+		klog.V(logging.LevelSteps).Infof("copy interrupted, resuming: file=%s offset=%d error=%q", src, offset, err)
+	}
+}
+
+// Verify checks that the local copy dst of the file or directory at src in the trace job pod has the same content,
+// comparing the SHA-256 checksums of the regular files computed in the trace container with the ones of the local files.
+func (c *Copier) Verify(jobID types.UID, namespace, src, dst string) error {
+	pod, err := c.findPod(jobID, namespace)
+	if err != nil {
+		return err
+	}
+
+	src = path.Clean(src)
+	out := &bytes.Buffer{}
+	if err := c.exec(pod, []string{"find", src, "-type", "f", "-exec", "sha256sum", "{}", "+"}, nil, out); err != nil {
+		return err
+	}
+	sums, err := parseChecksums(out.String(), src)
+	if err != nil {
+		return err
+	}
+
+	for rel, want := range sums {
+		local := filepath.Join(dst, filepath.FromSlash(rel))
+		got, err := Checksum(local)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s: the copy has sha256 %s, the trace has %s", local, got, want)
+		}
+	}
+	return nil
+}
+
+// parseChecksums parses the output of sha256sum for the files under src, keyed by their path relative to src.
+func parseChecksums(out, src string) (map[string]string, error) {
+	sums := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, "  ", 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, fmt.Errorf("unexpected checksum line %q", line)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(fields[1], src), "/")
+		sums[rel] = fields[0]
+	}
+	return sums, nil
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of the local file at p.
+func Checksum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// size returns the size in bytes of the regular file at p in the trace job pod.
+func (c *Copier) size(pod *corev1.Pod, p string) (int64, error) {
+	out := &bytes.Buffer{}
+	if err := c.exec(pod, []string{"stat", "-L", "-c", "%s %F", p}, nil, out); err != nil {
+		return 0, err
+	}
+	// The file type is "regular file", or "regular empty file".
+	fields := strings.SplitN(strings.TrimSpace(out.String()), " ", 2)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "regular") {
+		return 0, fmt.Errorf("%s is not a regular file, only files can be copied with resume", p)
+	}
+	return strconv.ParseInt(fields[0], 10, 64)
+}
+
+// ToTrace copies the local file or directory at src to the path dst in the trace job pod.
+func (c *Copier) ToTrace(jobID types.UID, namespace, src, dst string) error {
+	pod, err := c.findPod(jobID, namespace)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	dst = path.Clean(dst)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, src, path.Base(dst)))
+	}()
+	err = c.exec(pod, []string{"tar", "xmf", "-", "-C", path.Dir(dst)}, pr, ioutil.Discard)
+	pr.Close()
+	return err
+}
+
+func (c *Copier) findPod(jobID types.UID, namespace string) (*corev1.Pod, error) {
+	pl, err := c.coreV1Client.Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, jobID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pl.Items) == 0 {
+		return nil, fmt.Errorf(podNotFoundError)
+	}
+
+	pod := &pl.Items[0]
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil, fmt.Errorf(podPhaseNotAcceptedError, pod.Status.Phase)
+	}
+	if len(pod.Spec.Containers) != 1 {
+		return nil, fmt.Errorf(invalidPodContainersSizeError)
+	}
+	return pod, nil
+}
+
+// exec runs the command in the trace container of the pod, returning its error output as error when it fails.
+func (c *Copier) exec(pod *corev1.Pod, command []string, in io.Reader, out io.Writer) error {
+	req := c.coreV1Client.RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec")
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: pod.Spec.Containers[0].Name,
+		Command:   command,
+		Stdin:     in != nil,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(c.config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	errOut := &bytes.Buffer{}
+	err = exec.Stream(remotecommand.StreamOptions{
+		Stdin:  in,
+		Stdout: out,
+		Stderr: errOut,
+	})
+	if err != nil && errOut.Len() > 0 {
+		return fmt.Errorf("%s: %s", strings.Join(command, " "), strings.TrimSpace(errOut.String()))
+	}
+	return err
+}
+
+// writeTar archives the local file or directory at src, naming it name in the archive.
+func writeTar(w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		h, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		h.Name = path.Join(name, filepath.ToSlash(rel))
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// untar extracts the archive entries under name to the local path dst, refusing the ones that would land outside of it.
+func untar(r io.Reader, name, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel := path.Clean(h.Name)
+		if rel != name && !strings.HasPrefix(rel, name+"/") {
+			return fmt.Errorf("unexpected file %s in the archive", h.Name)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(strings.TrimPrefix(rel, name)))
+		if target != filepath.Clean(dst) && !strings.HasPrefix(target, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("file %s of the archive is outside of %s", h.Name, dst)
+		}
+
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(h.Mode)|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(h.Mode))
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			// Links and special files are skipped, so that nothing is written through them.
+		}
+	}
+}
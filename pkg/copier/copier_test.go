@@ -0,0 +1,110 @@
+package copier
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl-trace-copier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "out.txt"), []byte("@: 42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeTar(buf, src, "results"); err != nil {
+		t.Fatalf("writeTar() error = %v", err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err := untar(buf, "results", dst); err != nil {
+		t.Fatalf("untar() error = %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dst, "sub", "out.txt"))
+	if err != nil || string(b) != "@: 42\n" {
+		t.Errorf("copied file = %q, %v", b, err)
+	}
+}
+
+func TestUntarRefusesEscapingFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr string
+	}{
+		{name: "other file", entry: "passwd", wantErr: "unexpected file"},
+		{name: "parent directory", entry: "results/../../passwd", wantErr: "unexpected file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			tw := tar.NewWriter(buf)
+			tw.WriteHeader(&tar.Header{Name: tt.entry, Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+			tw.Write([]byte("x"))
+			tw.Close()
+
+			dir, err := ioutil.TempDir("", "kubectl-trace-copier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			err = untar(buf, "results", filepath.Join(dir, "dst"))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("untar() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	out := `9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  /tmp/results/out.txt
+60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752  /tmp/results/sub/hist.txt
+`
+	sums, err := parseChecksums(out, "/tmp/results")
+	if err != nil {
+		t.Fatalf("parseChecksums() error = %v", err)
+	}
+	if len(sums) != 2 || sums["out.txt"] != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" || len(sums["sub/hist.txt"]) == 0 {
+		t.Errorf("parseChecksums() = %v", sums)
+	}
+
+	sums, err = parseChecksums("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08  /tmp/out.txt\n", "/tmp/out.txt")
+	if err != nil || len(sums) != 1 || len(sums[""]) == 0 {
+		t.Errorf("parseChecksums() of a single file = %v, %v", sums, err)
+	}
+
+	if _, err := parseChecksums("find: /tmp/missing: No such file or directory", "/tmp/missing"); err == nil {
+		t.Errorf("parseChecksums() of an unexpected output should fail")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	f, err := ioutil.TempFile("", "kubectl-trace-copier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("test")
+	f.Close()
+
+	got, err := Checksum(f.Name())
+	if err != nil || got != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+		t.Errorf("Checksum() = %s, %v", got, err)
+	}
+}
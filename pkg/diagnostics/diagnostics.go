@@ -0,0 +1,293 @@
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/duration"
+	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fatalWaitingReasons are the container waiting reasons a trace pod does not recover from by itself.
+var fatalWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerError":       true,
+	"CreateContainerConfigError": true,
+	"RunContainerError":          true,
+}
+
+// Unschedulable tells whether the pod cannot be scheduled, and why.
+func Unschedulable(pod *corev1.Pod) (string, bool) {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Reason == corev1.PodReasonUnschedulable {
+			return fmt.Sprintf("%s: %s", c.Reason, c.Message), true
+		}
+	}
+	return "", false
+}
+
+// hostnameLabel is the label of the nodes the trace pods are bound to by their affinity.
+const hostnameLabel = "kubernetes.io/hostname"
+
+// Drained tells whether the node of the trace pod is cordoned, which draining it starts with, and the name of the node.
+// A trace pod evicted by a drain is replaced by one that cannot be scheduled, bound to the node by its affinity only.
+func Drained(client tcorev1.CoreV1Interface, pod *corev1.Pod) (string, bool) {
+	if len(pod.Spec.NodeName) > 0 {
+		n, err := client.Nodes().Get(pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", false
+		}
+		return n.Name, n.Spec.Unschedulable
+	}
+	hostname := affinityHostname(pod)
+	if len(hostname) == 0 {
+		return "", false
+	}
+	nl, err := client.Nodes().List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", hostnameLabel, hostname)})
+	if err != nil || len(nl.Items) == 0 {
+		return "", false
+	}
+	return nl.Items[0].Name, nl.Items[0].Spec.Unschedulable
+}
+
+// affinityHostname returns the hostname of the node the pod is required to run on by its affinity, empty when none.
+func affinityHostname(pod *corev1.Pod) string {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, t := range pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, e := range t.MatchExpressions {
+			if e.Key == hostnameLabel && len(e.Values) > 0 {
+				return e.Values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// StartupFailure tells whether the pod is stuck before its containers could start, and why.
+func StartupFailure(pod *corev1.Pod) (string, bool) {
+	if reason, unschedulable := Unschedulable(pod); unschedulable {
+		return reason, true
+	}
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if s.State.Waiting != nil && fatalWaitingReasons[s.State.Waiting.Reason] {
+			return fmt.Sprintf("container %s %s: %s", s.Name, s.State.Waiting.Reason, s.State.Waiting.Message), true
+		}
+	}
+
+	return "", false
+}
+
+// failureLogLines is how many of the last log lines of a failed trace are shown.
+const failureLogLines = 20
+
+// Failure tells whether the trace of the pod failed, and why. Besides the pod failing, the trace runner reports its
+// failures in its phase annotation and in its termination message, the pod of a failed program still succeeds.
+func Failure(pod *corev1.Pod) (string, bool) {
+	reason := Reason(pod)
+	if strings.HasPrefix(reason, "Failed: ") {
+		return strings.TrimPrefix(reason, "Failed: "), true
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		return fmt.Sprintf("the trace job pod failed: %s %s", pod.Status.Reason, pod.Status.Message), true
+	}
+	if pod.Annotations[meta.TracePhaseAnnotationKey] == meta.PhaseFailed {
+		return "the trace runner reported a failure", true
+	}
+	return "", false
+}
+
+// ProgramFailure tells whether the trace of the pod failed because of its program rather than because of the cluster,
+// which is when the trace runner reported the failure itself.
+func ProgramFailure(pod *corev1.Pod) bool {
+	for _, s := range pod.Status.ContainerStatuses {
+		// The trace runner exits successfully with a termination message when the program fails,
+		// a non-zero exit code means that the container was killed.
+		if t := s.State.Terminated; t != nil && t.ExitCode == 0 && len(t.Message) > 0 {
+			return true
+		}
+	}
+	return pod.Annotations[meta.TracePhaseAnnotationKey] == meta.PhaseFailed
+}
+
+// deadlineExceededReason is the reason of the pods and of the jobs killed for running past their active deadline.
+const deadlineExceededReason = "DeadlineExceeded"
+
+// DeadlineExceeded tells whether the trace of the pod was killed for running past its deadline and grace period.
+// The job controller then deletes the pod, so it is told by the event of the job of the pod.
+func DeadlineExceeded(client tcorev1.CoreV1Interface, pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodFailed && pod.Status.Reason == deadlineExceededReason {
+		return true
+	}
+	for _, o := range pod.OwnerReferences {
+		if o.Kind != "Job" {
+			continue
+		}
+		el, err := client.Events(pod.Namespace).List(metav1.ListOptions{
+			FieldSelector: fields.Set{
+				"involvedObject.kind": "Job",
+				"involvedObject.name": o.Name,
+				"involvedObject.uid":  string(o.UID),
+				"reason":              deadlineExceededReason,
+			}.AsSelector().String(),
+		})
+		if err == nil && len(el.Items) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DescribeFailure writes everything needed to understand why a trace failed to w: the container statuses with their
+// termination messages, the last lines of the output of the trace runner with hints for the failures recognized in them,
+// and the events of the pod.
+func DescribeFailure(client tcorev1.CoreV1Interface, pod *corev1.Pod, w io.Writer) error {
+	if len(pod.Spec.Containers) > 0 {
+		tail := int64(failureLogLines)
+		b, err := client.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container: pod.Spec.Containers[0].Name,
+			TailLines: &tail,
+		}).DoRaw()
+		if err == nil && len(bytes.TrimSpace(b)) > 0 {
+			fmt.Fprintf(w, "Last %d log lines:\n", failureLogLines)
+			for _, l := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+				fmt.Fprintf(w, "  %s\n", strings.TrimRight(l, "\r"))
+			}
+		}
+		output := string(b)
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.State.Terminated != nil {
+				output += "\n" + s.State.Terminated.Message
+			}
+		}
+		if advices := Hints(output); len(advices) > 0 {
+			fmt.Fprintln(w, "Hints:")
+			for _, a := range advices {
+				fmt.Fprintf(w, "  %s\n", a)
+			}
+		}
+	}
+	return Describe(client, pod, w)
+}
+
+// Reason returns a short human readable reason for the state of the pod, like "Pending: ImagePullBackOff"
+// or the first line of the termination message of a failed container, empty when there is nothing to explain.
+func Reason(pod *corev1.Pod) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && len(c.Reason) > 0 {
+			return "Pending: " + c.Reason
+		}
+	}
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, s := range statuses {
+		if t := s.State.Terminated; t != nil && (t.ExitCode != 0 || len(t.Message) > 0) {
+			// The trace runner only writes a termination message when it fails.
+			if len(t.Message) > 0 {
+				return "Failed: " + strings.SplitN(strings.TrimSpace(t.Message), "\n", 2)[0]
+			}
+			return fmt.Sprintf("Failed: %s, exit code %d", t.Reason, t.ExitCode)
+		}
+	}
+	for _, s := range statuses {
+		if w := s.State.Waiting; w != nil && len(w.Reason) > 0 && w.Reason != "PodInitializing" {
+			return "Pending: " + w.Reason
+		}
+	}
+	return ""
+}
+
+// ContainerStates returns a short description of the state of each container of the pod, init containers included.
+func ContainerStates(pod *corev1.Pod) map[string]string {
+	states := map[string]string{}
+	for _, s := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		states[s.Name] = containerState(s.State)
+	}
+	return states
+}
+
+// Describe writes the container statuses and the events of the pod to w,
+// which is usually all it takes to understand why a trace did not start.
+func Describe(client tcorev1.CoreV1Interface, pod *corev1.Pod, w io.Writer) error {
+	fmt.Fprintf(w, "Pod %s/%s is %s\n", pod.Namespace, pod.Name, pod.Status.Phase)
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	if len(statuses) > 0 {
+		fmt.Fprintln(w, "Containers:")
+		for _, s := range statuses {
+			fmt.Fprintf(w, "  %s: %s\n", s.Name, containerState(s.State))
+		}
+	}
+
+	el, err := client.Events(pod.Namespace).List(metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(el.Items) == 0 {
+		fmt.Fprintln(w, "Events: <none>")
+		return nil
+	}
+
+	events := el.Items
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+
+	fmt.Fprintln(w, "Events:")
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "  TYPE\tREASON\tAGE\tFROM\tMESSAGE\n")
+	for _, e := range events {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", e.Type, e.Reason, eventAge(e), e.Source.Component, e.Message)
+	}
+	return nil
+}
+
+func containerState(s corev1.ContainerState) string {
+	switch {
+	case s.Waiting != nil:
+		if len(s.Waiting.Message) == 0 {
+			return fmt.Sprintf("waiting (%s)", s.Waiting.Reason)
+		}
+		return fmt.Sprintf("waiting (%s): %s", s.Waiting.Reason, s.Waiting.Message)
+	case s.Terminated != nil:
+		if len(s.Terminated.Message) == 0 {
+			return fmt.Sprintf("terminated (%s), exit code %d", s.Terminated.Reason, s.Terminated.ExitCode)
+		}
+		return fmt.Sprintf("terminated (%s), exit code %d: %s", s.Terminated.Reason, s.Terminated.ExitCode, s.Terminated.Message)
+	case s.Running != nil:
+		return "running"
+	}
+	return "unknown"
+}
+
+func eventAge(e corev1.Event) string {
+	if e.LastTimestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(e.LastTimestamp.Time))
+}
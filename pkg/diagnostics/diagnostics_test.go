@@ -0,0 +1,176 @@
+package diagnostics
+
+import (
+	"testing"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReason(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  corev1.PodStatus
+		want string
+	}{
+		{
+			name: "running",
+			pod: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+			},
+		},
+		{
+			name: "unschedulable",
+			pod: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable}},
+			},
+			want: "Pending: Unschedulable",
+		},
+		{
+			name: "image pull",
+			pod: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}}},
+			},
+			want: "Pending: ImagePullBackOff",
+		},
+		{
+			name: "termination message",
+			pod: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 1,
+					Reason:   "Error",
+					Message:  "program compile error\nstdin:1:1-5: ERROR: syntax error",
+				}}}},
+			},
+			want: "Failed: program compile error",
+		},
+		{
+			name: "exit code",
+			pod: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2, Reason: "Error"}}}},
+			},
+			want: "Failed: Error, exit code 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Reason(&corev1.Pod{Status: tt.pod}); got != tt.want {
+				t.Errorf("Reason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		pod        corev1.Pod
+		wantReason string
+		wantFailed bool
+	}{
+		{
+			name: "succeeded",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+		},
+		{
+			name: "termination message of a succeeded pod",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase: corev1.PodSucceeded,
+				ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Message: "the program failed: exit status 1",
+				}}}},
+			}},
+			wantReason: "the program failed: exit status 1",
+			wantFailed: true,
+		},
+		{
+			name: "reported phase",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{meta.TracePhaseAnnotationKey: meta.PhaseFailed}},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			},
+			wantReason: "the trace runner reported a failure",
+			wantFailed: true,
+		},
+		{
+			name:       "failed pod",
+			pod:        corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "DeadlineExceeded", Message: "Pod was active on the node longer than the specified deadline"}},
+			wantReason: "the trace job pod failed: DeadlineExceeded Pod was active on the node longer than the specified deadline",
+			wantFailed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, failed := Failure(&tt.pod)
+			if reason != tt.wantReason || failed != tt.wantFailed {
+				t.Errorf("Failure() = %q, %v, want %q, %v", reason, failed, tt.wantReason, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestProgramFailure(t *testing.T) {
+	terminated := func(exitCode int32, message string) corev1.PodStatus {
+		return corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			ExitCode: exitCode,
+			Message:  message,
+		}}}}}
+	}
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want bool
+	}{
+		{name: "termination message", pod: corev1.Pod{Status: terminated(0, "the program failed: exit status 1")}, want: true},
+		{name: "killed container", pod: corev1.Pod{Status: terminated(137, "Attaching 1 probe...")}},
+		{name: "succeeded", pod: corev1.Pod{Status: terminated(0, "")}},
+		{
+			name: "reported phase",
+			pod:  corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{meta.TracePhaseAnnotationKey: meta.PhaseFailed}}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProgramFailure(&tt.pod); got != tt.want {
+				t.Errorf("ProgramFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffinityHostname(t *testing.T) {
+	affinity := func(key string, values ...string) *corev1.Affinity {
+		return &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values}},
+					}},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		affinity *corev1.Affinity
+		want     string
+	}{
+		{name: "no affinity"},
+		{name: "hostname", affinity: affinity("kubernetes.io/hostname", "node-1"), want: "node-1"},
+		{name: "other label", affinity: affinity("zone", "a")},
+		{name: "no value", affinity: affinity("kubernetes.io/hostname")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: tt.affinity}}
+			if got := affinityHostname(pod); got != tt.want {
+				t.Errorf("affinityHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package diagnostics
+
+import "strings"
+
+// hint is an advice for the failures whose output contains one of its signatures.
+type hint struct {
+	signatures []string
+	advice     string
+}
+
+// hints are the advices for the common failures of bpftrace, the signatures are lower case.
+var hints = []hint{
+	{
+		signatures: []string{"kernel headers", "' file not found", "unknown type name"},
+		advice:     "the program needs the linux headers of the node, run it with --fetch-headers",
+	},
+	{
+		signatures: []string{"tracepoint not found", "could not resolve symbol", "no probes to attach", "attaching 0 probes", "could not attach probe"},
+		advice:     "a probe of the program does not exist on the node, it may be named differently in this kernel version: list the probes with bpftrace -l in a trace",
+	},
+	{
+		signatures: []string{"verifier", "error loading program", "invalid mem access", "back-edge from insn", "program is too large"},
+		advice:     "the kernel verifier rejected the program: reduce its loops, its unrolls and the size of its strings and maps, and check that the pointers it reads are valid",
+	},
+	{
+		signatures: []string{"kernel does not support", "not supported by your kernel", "unknown func bpf_", "kernel too old"},
+		advice:     "the kernel of the node is too old for a feature of the program, like a helper or a probe type: check the kernel version required by each feature in the bpftrace reference guide",
+	},
+	{
+		signatures: []string{"operation not permitted", "permission denied"},
+		advice:     "bpftrace is not allowed to load programs on the node, check the security policies applying to the trace job pods",
+	},
+}
+
+// Hints returns the advices for the failures recognized in the output of a trace, each once and in a stable order.
+func Hints(output string) []string {
+	output = strings.ToLower(output)
+	advices := []string{}
+	for _, h := range hints {
+		for _, s := range h.signatures {
+			if strings.Contains(output, s) {
+				advices = append(advices, h.advice)
+				break
+			}
+		}
+	}
+	return advices
+}
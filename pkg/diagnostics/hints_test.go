@@ -0,0 +1,44 @@
+package diagnostics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHints(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{name: "no failure", output: "Attaching 1 probe...\n@: 42\n", want: []string{}},
+		{
+			name:   "missing headers",
+			output: "/bpftrace/include/clang_workarounds.h:14:10: fatal error: 'linux/types.h' file not found",
+			want:   []string{hints[0].advice},
+		},
+		{
+			name:   "unknown tracepoint",
+			output: "ERROR: tracepoint not found: syscalls:sys_enter_openat2",
+			want:   []string{hints[1].advice},
+		},
+		{
+			name:   "verifier",
+			output: "Error loading program: kprobe:do_sys_open\nR1 invalid mem access 'inv'",
+			want:   []string{hints[2].advice},
+		},
+		{
+			name:   "old kernel and permissions",
+			output: "ERROR: Kernel does not support bpf_get_current_task\nOperation not permitted",
+			want:   []string{hints[3].advice, hints[4].advice},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hints(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Hints() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package errdefs defines the classes of the failures of kubectl-trace.
+// The errors returned by the other packages are classified by wrapping them,
+// callers branch on the class with errors.Is and still reach the underlying error with errors.Unwrap.
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The classes of failures.
+var (
+	// ErrTargetNotFound means the node or the pod to trace does not exist.
+	ErrTargetNotFound = errors.New("target not found")
+	// ErrContainerNotFound means the pod to trace has no such container.
+	ErrContainerNotFound = errors.New("container not found")
+	// ErrTraceNotFound means no trace matches the given ID or name.
+	ErrTraceNotFound = errors.New("trace not found")
+	// ErrProgramInvalid means the bpftrace program is missing, empty or cannot be read,
+	// or that it failed once in the trace, like when bpftrace cannot compile it.
+	ErrProgramInvalid = errors.New("invalid program")
+	// ErrJobCreateFailed means the objects of the trace could not be created.
+	ErrJobCreateFailed = errors.New("trace job creation failed")
+	// ErrAttachFailed means the output of the trace could not be streamed.
+	ErrAttachFailed = errors.New("attach failed")
+	// ErrSchedulingFailed means the pod of the trace cannot be scheduled on its node.
+	ErrSchedulingFailed = errors.New("scheduling failed")
+	// ErrNodeDrained means the node of the trace is drained, its pod was evicted or cannot be scheduled again.
+	// It is a scheduling failure as far as the exit code goes.
+	ErrNodeDrained = errors.New("node drained")
+	// ErrDeadlineExceeded means the trace did not stop within its deadline and grace period and was killed.
+	ErrDeadlineExceeded = errors.New("deadline exceeded")
+)
+
+// The exit codes of the kubectl-trace commands.
+const (
+	ExitOK = 0
+	// ExitFailure is used for the failures without a class, like invalid flags.
+	ExitFailure          = 1
+	ExitProgramInvalid   = 2
+	ExitNotFound         = 3
+	ExitSchedulingFailed = 4
+	ExitDeadlineExceeded = 5
+	ExitJobCreateFailed  = 6
+	ExitAttachFailed     = 7
+)
+
+// classified is an error belonging to a class, with the message of the error.
+type classified struct {
+	class error
+	err   error
+}
+
+func (e *classified) Error() string { return e.err.Error() }
+
+func (e *classified) Unwrap() error { return e.err }
+
+func (e *classified) Is(target error) bool { return target == e.class }
+
+// Wrap classifies err, nil stays nil.
+func Wrap(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classified{class: class, err: err}
+}
+
+// Errorf formats an error of the class, %w can be used to wrap another error.
+func Errorf(class error, format string, a ...interface{}) error {
+	return Wrap(class, fmt.Errorf(format, a...))
+}
+
+// ExitCode returns the exit code for the class of err.
+// The classes of the outcome of a trace are checked before ErrAttachFailed, that the attacher wraps them in.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrProgramInvalid):
+		return ExitProgramInvalid
+	case errors.Is(err, ErrTargetNotFound), errors.Is(err, ErrContainerNotFound), errors.Is(err, ErrTraceNotFound):
+		return ExitNotFound
+	case errors.Is(err, ErrSchedulingFailed), errors.Is(err, ErrNodeDrained):
+		return ExitSchedulingFailed
+	case errors.Is(err, ErrDeadlineExceeded):
+		return ExitDeadlineExceeded
+	case errors.Is(err, ErrJobCreateFailed):
+		return ExitJobCreateFailed
+	case errors.Is(err, ErrAttachFailed):
+		return ExitAttachFailed
+	}
+	return ExitFailure
+}
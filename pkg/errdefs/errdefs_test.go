@@ -0,0 +1,59 @@
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	cause := errors.New("pods \"nginx\" not found")
+	err := Wrap(ErrTargetNotFound, cause)
+
+	if err.Error() != cause.Error() {
+		t.Errorf("Error() = %q, want the message of the wrapped error", err.Error())
+	}
+	if !errors.Is(err, ErrTargetNotFound) {
+		t.Errorf("errors.Is() does not match the class")
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("errors.Is() does not match the wrapped error")
+	}
+	if errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("errors.Is() matches another class")
+	}
+	if Wrap(ErrTargetNotFound, nil) != nil {
+		t.Errorf("Wrap() of nil is not nil")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "success", err: nil, want: ExitOK},
+		{name: "unclassified", err: errors.New("boom"), want: ExitFailure},
+		{name: "program", err: Errorf(ErrProgramInvalid, "empty program"), want: ExitProgramInvalid},
+		{name: "target", err: Errorf(ErrTargetNotFound, "no node"), want: ExitNotFound},
+		{name: "container", err: Errorf(ErrContainerNotFound, "no container"), want: ExitNotFound},
+		{name: "trace", err: Errorf(ErrTraceNotFound, "no trace"), want: ExitNotFound},
+		{name: "job", err: Errorf(ErrJobCreateFailed, "forbidden"), want: ExitJobCreateFailed},
+		{name: "attach", err: Errorf(ErrAttachFailed, "timed out"), want: ExitAttachFailed},
+		{name: "scheduling", err: Errorf(ErrSchedulingFailed, "unschedulable"), want: ExitSchedulingFailed},
+		{name: "drained", err: Wrap(ErrAttachFailed, Errorf(ErrNodeDrained, "cordoned")), want: ExitSchedulingFailed},
+		{name: "deadline", err: Errorf(ErrDeadlineExceeded, "killed"), want: ExitDeadlineExceeded},
+		{name: "outcome in attach", err: Wrap(ErrAttachFailed, Errorf(ErrDeadlineExceeded, "killed")), want: ExitDeadlineExceeded},
+		{name: "program failure in attach", err: Wrap(ErrAttachFailed, Errorf(ErrProgramInvalid, "failed")), want: ExitProgramInvalid},
+		{name: "wrapped again", err: fmt.Errorf("run: %w", Errorf(ErrAttachFailed, "timed out")), want: ExitAttachFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package events records the lifecycle of the traces as Kubernetes events of the pods and of the nodes they trace,
+// so that tracing shows up in kubectl describe of the traced workload and in the event pipelines of the cluster.
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/lifecycle"
+	"github.com/iovisor/kubectl-trace/pkg/logging"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
+)
+
+// The reasons of the events of the traces.
+const (
+	ReasonTraceStarted   = "TraceStarted"
+	ReasonTraceCompleted = "TraceCompleted"
+	ReasonTraceFailed    = "TraceFailed"
+)
+
+// component is the source of the events.
+const component = "kubectl-trace"
+
+// nodeEventsNamespace is where the events of the nodes are recorded, like the kubelet does.
+const nodeEventsNamespace = metav1.NamespaceDefault
+
+// PodTarget references the traced pod.
+func PodTarget(pod *corev1.Pod) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// NodeTarget references the traced node. Its UID is its name, like in the events of the kubelet,
+// which is what kubectl describe node looks for.
+func NodeTarget(node *corev1.Node) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       node.Name,
+		UID:        types.UID(node.Name),
+	}
+}
+
+// Recorder records the events of a trace on its target.
+// Recording is best effort: a user not allowed to create events still runs the trace, the failures are only logged.
+type Recorder struct {
+	client  tcorev1.EventsGetter
+	target  corev1.ObjectReference
+	traceID types.UID
+	user    string
+}
+
+// NewRecorder records the events of the trace with the given ID on target, naming user as the one who ran it when known.
+func NewRecorder(client tcorev1.EventsGetter, target corev1.ObjectReference, traceID types.UID, user string) *Recorder {
+	return &Recorder{
+		client:  client,
+		target:  target,
+		traceID: traceID,
+		user:    user,
+	}
+}
+
+// Started records that the trace was started.
+func (r *Recorder) Started() {
+	r.record(corev1.EventTypeNormal, ReasonTraceStarted, "started")
+}
+
+// Completed records that the trace completed.
+func (r *Recorder) Completed() {
+	r.record(corev1.EventTypeNormal, ReasonTraceCompleted, "completed")
+}
+
+// Failed records that the trace failed and why.
+func (r *Recorder) Failed(err error) {
+	r.record(corev1.EventTypeWarning, ReasonTraceFailed, fmt.Sprintf("failed: %v", err))
+}
+
+// Observer records the completion and the failure of the trace when notified of them, to attach with.
+func (r *Recorder) Observer() lifecycle.Observer {
+	return lifecycle.Funcs{
+		Completed: func(lifecycle.Event) { r.Completed() },
+		Failed:    func(_ lifecycle.Event, err error) { r.Failed(err) },
+	}
+}
+
+func (r *Recorder) record(eventType, reason, what string) {
+	e := r.event(eventType, reason, what, time.Now())
+	if _, err := r.client.Events(e.Namespace).Create(e); err != nil {
+		klog.V(logging.LevelSteps).Infof("could not record the event of the trace: reason=%s target=%s error=%q", reason, r.target.Name, err)
+	}
+}
+
+// event builds the event, its message tells the trace and who ran it.
+func (r *Recorder) event(eventType, reason, what string, now time.Time) *corev1.Event {
+	namespace := r.target.Namespace
+	if len(namespace) == 0 {
+		namespace = nodeEventsNamespace
+	}
+	message := fmt.Sprintf("trace %s %s", r.traceID, what)
+	if len(r.user) > 0 {
+		message = fmt.Sprintf("trace %s of %s %s", r.traceID, r.user, what)
+	}
+	t := metav1.NewTime(now)
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// Named like the events of client-go, after the object and a unique timestamp.
+			Name:      fmt.Sprintf("%v.%x", r.target.Name, now.UnixNano()),
+			Namespace: namespace,
+			Labels: map[string]string{
+				meta.TraceIDLabelKey: string(r.traceID),
+			},
+		},
+		InvolvedObject: r.target,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: component},
+		FirstTimestamp: t,
+		LastTimestamp:  t,
+		Count:          1,
+	}
+}
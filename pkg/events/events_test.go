@@ -0,0 +1,71 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvent(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "web", UID: "f1c3"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "a7b9"}}
+	now := time.Unix(1545000000, 0)
+
+	tests := []struct {
+		name          string
+		recorder      *Recorder
+		eventType     string
+		reason        string
+		what          string
+		wantNamespace string
+		wantMessage   string
+	}{
+		{
+			name:          "pod",
+			recorder:      NewRecorder(nil, PodTarget(pod), "5594d7e1", "alice"),
+			eventType:     corev1.EventTypeNormal,
+			reason:        ReasonTraceStarted,
+			what:          "started",
+			wantNamespace: "web",
+			wantMessage:   "trace 5594d7e1 of alice started",
+		},
+		{
+			name:          "node without user",
+			recorder:      NewRecorder(nil, NodeTarget(node), "5594d7e1", ""),
+			eventType:     corev1.EventTypeWarning,
+			reason:        ReasonTraceFailed,
+			what:          "failed: " + errors.New("the program failed").Error(),
+			wantNamespace: metav1.NamespaceDefault,
+			wantMessage:   "trace 5594d7e1 failed: the program failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.recorder.event(tt.eventType, tt.reason, tt.what, now)
+			if e.Namespace != tt.wantNamespace {
+				t.Errorf("namespace = %q, want %q", e.Namespace, tt.wantNamespace)
+			}
+			if e.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", e.Message, tt.wantMessage)
+			}
+			if e.InvolvedObject != tt.recorder.target || e.Reason != tt.reason || e.Type != tt.eventType {
+				t.Errorf("event = %+v", e)
+			}
+			if e.Labels[meta.TraceIDLabelKey] != "5594d7e1" {
+				t.Errorf("labels = %v, want the trace ID", e.Labels)
+			}
+		})
+	}
+}
+
+func TestNodeTarget(t *testing.T) {
+	ref := NodeTarget(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "a7b9"}})
+	if ref.UID != "node-1" || ref.Kind != "Node" || len(ref.Namespace) > 0 {
+		t.Errorf("NodeTarget() = %+v, want the name as UID", ref)
+	}
+}
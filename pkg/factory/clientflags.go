@@ -0,0 +1,73 @@
+package factory
+
+import (
+	"github.com/iovisor/kubectl-trace/pkg/logging"
+	"github.com/spf13/pflag"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const (
+	flagQPS   = "qps"
+	flagBurst = "burst"
+)
+
+// ClientFlags is for tuning the rate limits of the REST clients, and logs their requests.
+// The request timeout is already covered by the --request-timeout flag of the config flags.
+type ClientFlags struct {
+	Delegate genericclioptions.RESTClientGetter
+
+	// QPS is the maximum sustained queries per second to the API server, zero means the client-go default.
+	QPS float32
+	// Burst is the maximum burst of queries to the API server, zero means the client-go default.
+	Burst int
+}
+
+var _ genericclioptions.RESTClientGetter = &ClientFlags{}
+
+// ToRESTConfig implements RESTClientGetter.
+// Returns the delegate REST client configuration with the rate limits and the request logging applied.
+// Without any kubeconfig, the delegate already returns the configuration of the pod kubectl-trace runs in, if any.
+func (f *ClientFlags) ToRESTConfig() (*rest.Config, error) {
+	clientConfig, err := f.Delegate.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	if f.QPS > 0 {
+		clientConfig.QPS = f.QPS
+	}
+	if f.Burst > 0 {
+		clientConfig.Burst = f.Burst
+	}
+	clientConfig.Wrap(logging.WrapTransport)
+	return clientConfig, nil
+}
+
+func (f *ClientFlags) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return f.Delegate.ToRawKubeConfigLoader()
+}
+
+func (f *ClientFlags) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return f.Delegate.ToDiscoveryClient()
+}
+
+// RESTMapper returns a mapper.
+func (f *ClientFlags) ToRESTMapper() (meta.RESTMapper, error) {
+	return f.Delegate.ToRESTMapper()
+}
+
+func (f *ClientFlags) AddFlags(flags *pflag.FlagSet) {
+	flags.Float32Var(&f.QPS, flagQPS, f.QPS, "Maximum queries per second to the API server, zero uses the client default")
+	flags.IntVar(&f.Burst, flagBurst, f.Burst, "Maximum burst of queries to the API server, zero uses the client default")
+}
+
+func NewClientFlags(delegate genericclioptions.RESTClientGetter) *ClientFlags {
+	return &ClientFlags{
+		Delegate: delegate,
+	}
+}
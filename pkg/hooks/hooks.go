@@ -0,0 +1,188 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/logging"
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	batchv1typed "k8s.io/client-go/kubernetes/typed/batch/v1"
+	"k8s.io/klog"
+)
+
+// HookLabelKey labels the jobs running hooks with the ID of their trace.
+// It differs from the trace labels so that hook jobs are not mistaken for traces.
+const HookLabelKey = "iovisor.org/kubectl-trace-hook"
+
+// jobPollInterval is how often the status of a hook job is checked.
+const jobPollInterval = 2 * time.Second
+
+// Hook is a command run before a trace starts or after it completes.
+// Either Command or Image is set.
+type Hook struct {
+	// Command is run locally with sh -c.
+	Command string `json:"command,omitempty"`
+	// Image runs the hook as a job in the cluster, in the namespace of the trace.
+	Image string `json:"image,omitempty"`
+	// Args is the command of the hook job, the entrypoint of the image when empty.
+	Args []string `json:"args,omitempty"`
+}
+
+// Hooks are the hooks run around a trace.
+type Hooks struct {
+	// Pre hooks run in order before the trace job is created, the trace is not created if one fails.
+	Pre []Hook `json:"pre,omitempty"`
+	// Post hooks run in order after the trace completed.
+	Post []Hook `json:"post,omitempty"`
+}
+
+// Env describes the trace to the hooks, as environment variables.
+type Env map[string]string
+
+// Environment variables set for the hooks.
+const (
+	EnvTraceID        = "TRACE_ID"
+	EnvTraceName      = "TRACE_NAME"
+	EnvTraceNamespace = "TRACE_NAMESPACE"
+	EnvTraceNode      = "TRACE_NODE"
+	// EnvTraceStatus is only set for the post hooks.
+	EnvTraceStatus = "TRACE_STATUS"
+)
+
+// Runner runs hooks.
+type Runner struct {
+	// JobClient creates the jobs of the hooks running in the cluster.
+	JobClient batchv1typed.JobInterface
+	// Out and ErrOut receive the output of the local hooks.
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// Run runs the hooks in order, stopping at the first failure.
+func (r *Runner) Run(ctx context.Context, hooks []Hook, env Env) error {
+	for i, h := range hooks {
+		var err error
+		switch {
+		case len(h.Command) > 0 && len(h.Image) > 0:
+			err = fmt.Errorf("a hook runs either a command or an image, not both")
+		case len(h.Command) > 0:
+			klog.V(logging.LevelSteps).Infof("running local hook: command=%q", h.Command)
+			err = r.runLocal(ctx, h, env)
+		case len(h.Image) > 0:
+			klog.V(logging.LevelSteps).Infof("running hook job: image=%s args=%q", h.Image, h.Args)
+			err = r.runJob(ctx, h, env)
+		default:
+			err = fmt.Errorf("a hook runs either a command or an image")
+		}
+		if err != nil {
+			return fmt.Errorf("hook %d failed: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runLocal(ctx context.Context, h Hook, env Env) error {
+	c := exec.CommandContext(ctx, "/bin/sh", "-c", h.Command)
+	c.Env = os.Environ()
+	for _, k := range env.keys() {
+		c.Env = append(c.Env, k+"="+env[k])
+	}
+	c.Stdout = r.Out
+	c.Stderr = r.ErrOut
+	return c.Run()
+}
+
+func (r *Runner) runJob(ctx context.Context, h Hook, env Env) error {
+	if r.JobClient == nil {
+		return fmt.Errorf("a job client is required to run hooks in the cluster")
+	}
+
+	vars := []apiv1.EnvVar{}
+	for _, k := range env.keys() {
+		vars = append(vars, apiv1.EnvVar{Name: k, Value: env[k]})
+	}
+
+	name := fmt.Sprintf("%shook-%s", meta.ObjectNamePrefix, uuid.NewUUID())
+	om := metav1.ObjectMeta{
+		Name:   name,
+		Labels: map[string]string{HookLabelKey: env[EnvTraceID]},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: om,
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            int32Ptr(0),
+			TTLSecondsAfterFinished: int32Ptr(60),
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: om,
+				Spec: apiv1.PodSpec{
+					RestartPolicy: apiv1.RestartPolicyNever,
+					Containers: []apiv1.Container{
+						apiv1.Container{
+							Name:    "hook",
+							Image:   h.Image,
+							Command: h.Args,
+							Env:     vars,
+						},
+					},
+				},
+			},
+		},
+	}
+	job.Spec.Template.ObjectMeta.Name = ""
+
+	if _, err := r.JobClient.Create(job); err != nil {
+		return err
+	}
+
+	var status batchv1.JobStatus
+	err := wait.PollImmediateUntil(jobPollInterval, func() (bool, error) {
+		j, err := r.JobClient.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		status = j.Status
+		return status.Succeeded > 0 || status.Failed > 0, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		err = ctx.Err()
+	}
+	if err != nil {
+		r.deleteJob(name)
+		return err
+	}
+	if status.Failed > 0 {
+		return fmt.Errorf("hook job %s failed", name)
+	}
+	return nil
+}
+
+// deleteJob removes a hook job that is not waited for anymore.
+func (r *Runner) deleteJob(name string) {
+	dp := metav1.DeletePropagationForeground
+	err := r.JobClient.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &dp})
+	if err != nil && !errors.IsNotFound(err) {
+		klog.V(logging.LevelSteps).Infof("could not delete hook job: job=%s error=%q", name, err)
+	}
+}
+
+func (e Env) keys() []string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func int32Ptr(i int32) *int32 { return &i }
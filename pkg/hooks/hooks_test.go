@@ -0,0 +1,61 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestRunLocal(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   []Hook
+		wantOut string
+		wantErr bool
+	}{
+		{
+			name:    "environment",
+			hooks:   []Hook{{Command: `echo "$TRACE_ID $TRACE_STATUS"`}},
+			wantOut: "1234 Completed\n",
+		},
+		{
+			name:    "in order",
+			hooks:   []Hook{{Command: "echo first"}, {Command: "echo second"}},
+			wantOut: "first\nsecond\n",
+		},
+		{
+			name:    "stops at the first failure",
+			hooks:   []Hook{{Command: "exit 3"}, {Command: "echo second"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty hook",
+			hooks:   []Hook{{}},
+			wantErr: true,
+		},
+		{
+			name:    "command and image",
+			hooks:   []Hook{{Command: "true", Image: "busybox"}},
+			wantErr: true,
+		},
+		{
+			name:    "job without client",
+			hooks:   []Hook{{Image: "busybox"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			r := &Runner{Out: out, ErrOut: out}
+			err := r.Run(context.Background(), tt.hooks, Env{EnvTraceID: "1234", EnvTraceStatus: "Completed"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && out.String() != tt.wantOut {
+				t.Errorf("Run() output = %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
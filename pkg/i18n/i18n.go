@@ -0,0 +1,122 @@
+// Package i18n translates the messages of kubectl-trace the way kubectl does: the messages are written in English
+// in the code, and looked up by their English text in the gettext PO file of the language of the user.
+//
+// The translations of a language are read from <root>/<lang>/LC_MESSAGES/kubectl-trace.po, where root is the
+// directory given to LoadTranslations, and lang the language of the user, like fr_FR or fr.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// EnvTranslations is the environment variable with the directory of the translations, shipped by the distributions.
+	EnvTranslations = "KUBECTL_TRACE_TRANSLATIONS"
+
+	// domain is the name of the PO files of kubectl-trace.
+	domain = "kubectl-trace"
+)
+
+var (
+	mu sync.RWMutex
+	// translations are the forms of the translation of each message, the singular one first.
+	translations map[string][]string
+)
+
+// LoadTranslations loads the translations of the language returned by getLanguageFn from the root directory,
+// or of the language of the LC_ALL, LC_MESSAGES and LANG environment variables when getLanguageFn is nil.
+// The messages stay in English when root is empty, or when it has no translations for the language.
+func LoadTranslations(root string, getLanguageFn func() string) error {
+	if getLanguageFn == nil {
+		getLanguageFn = loadSystemLanguage
+	}
+	lang := getLanguageFn()
+	if len(root) == 0 || len(lang) == 0 {
+		setTranslations(nil)
+		return nil
+	}
+
+	// A fr_FR user gets the fr translations when there are no fr_FR ones.
+	candidates := []string{lang}
+	if i := strings.Index(lang, "_"); i > 0 {
+		candidates = append(candidates, lang[:i])
+	}
+	for _, l := range candidates {
+		path := filepath.Join(root, l, "LC_MESSAGES", domain+".po")
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		t, err := parsePO(f)
+		if err != nil {
+			return fmt.Errorf("error loading the translations of %s: %v", path, err)
+		}
+		setTranslations(t)
+		return nil
+	}
+	setTranslations(nil)
+	return nil
+}
+
+func setTranslations(t map[string][]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	translations = t
+}
+
+// loadSystemLanguage returns the language of the locale of the user, like fr_FR for fr_FR.UTF-8,
+// following the priority of gettext: LC_ALL, LC_MESSAGES, then LANG. It is empty for the C and POSIX locales.
+func loadSystemLanguage() string {
+	lang := os.Getenv("LC_ALL")
+	if len(lang) == 0 {
+		lang = os.Getenv("LC_MESSAGES")
+	}
+	if len(lang) == 0 {
+		lang = os.Getenv("LANG")
+	}
+	if i := strings.IndexAny(lang, ".@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "C" || lang == "POSIX" {
+		return ""
+	}
+	return lang
+}
+
+// T returns the translation of defaultValue, or defaultValue itself when it has none.
+// Given a count, T picks the singular or the plural form of the translation for it, and formats it with the count,
+// defaultValue being the message id of the singular form.
+func T(defaultValue string, args ...int) string {
+	mu.RLock()
+	forms, ok := translations[defaultValue]
+	mu.RUnlock()
+
+	if len(args) == 0 {
+		if !ok {
+			return defaultValue
+		}
+		return forms[0]
+	}
+	msg := defaultValue
+	if ok {
+		msg = forms[0]
+		// The languages with more than two plural forms are not handled, they get the second one past one.
+		if args[0] != 1 && len(forms) > 1 {
+			msg = forms[1]
+		}
+	}
+	return fmt.Sprintf(msg, args[0])
+}
+
+// Errorf returns an error with the translation of defaultValue, formatted with args.
+func Errorf(defaultValue string, args ...interface{}) error {
+	return fmt.Errorf(T(defaultValue), args...)
+}
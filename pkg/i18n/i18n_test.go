@@ -0,0 +1,140 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPO = `# French translations of kubectl-trace.
+msgid ""
+msgstr ""
+"Language: fr\n"
+"Plural-Forms: nplurals=2; plural=(n > 1);\n"
+
+#: pkg/cmd/get.go
+msgid "Get the running traces"
+msgstr "Afficher les traces en cours"
+
+msgid ""
+"Print the logs "
+"for a specific trace execution"
+msgstr ""
+"Afficher les journaux "
+"d'une exécution de trace"
+
+#, fuzzy
+msgid "Delete a bpftrace program execution"
+msgstr "Supprimer un programme"
+
+msgid "Attach to an existing trace"
+msgstr ""
+
+msgctxt "menu"
+msgid "Export"
+msgstr "Exporter"
+
+msgid "%d trace deleted"
+msgid_plural "%d traces deleted"
+msgstr[0] "%d trace supprimée"
+msgstr[1] "%d traces supprimées"
+
+msgid "the bpftrace program is mandatory: %s"
+msgstr "le programme bpftrace est obligatoire : %s"
+`
+
+func TestParsePO(t *testing.T) {
+	got, err := parsePO(strings.NewReader(testPO))
+	if err != nil {
+		t.Fatalf("parsePO() error = %v", err)
+	}
+	want := map[string][]string{
+		"Get the running traces":                        {"Afficher les traces en cours"},
+		"Print the logs for a specific trace execution": {"Afficher les journaux d'une exécution de trace"},
+		"%d trace deleted":                              {"%d trace supprimée", "%d traces supprimées"},
+		"the bpftrace program is mandatory: %s":         {"le programme bpftrace est obligatoire : %s"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("parsePO() = %q, want %q", got, want)
+	}
+	for id, forms := range want {
+		if strings.Join(got[id], "|") != strings.Join(forms, "|") {
+			t.Errorf("parsePO() translation of %q = %q, want %q", id, got[id], forms)
+		}
+	}
+
+	for _, po := range []string{`msgid "unterminated`, `"orphan"`, `msgfoo "bar"`} {
+		if _, err := parsePO(strings.NewReader(po)); err == nil {
+			t.Errorf("parsePO(%q) should fail", po)
+		}
+	}
+}
+
+func TestLoadTranslations(t *testing.T) {
+	root, err := ioutil.TempDir("", "kubectl-trace-i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	defer setTranslations(nil)
+
+	dir := filepath.Join(root, "fr", "LC_MESSAGES")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-trace.po"), []byte(testPO), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadTranslations(root, func() string { return "fr_FR" }); err != nil {
+		t.Fatalf("LoadTranslations() error = %v", err)
+	}
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{T("Get the running traces"), "Afficher les traces en cours"},
+		{T("Attach to an existing trace"), "Attach to an existing trace"},
+		{T("%d trace deleted", 1), "1 trace supprimée"},
+		{T("%d trace deleted", 3), "3 traces supprimées"},
+		{Errorf("the bpftrace program is mandatory: %s", "read.bt").Error(), "le programme bpftrace est obligatoire : read.bt"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("translation = %q, want %q", tt.got, tt.want)
+		}
+	}
+
+	if err := LoadTranslations(root, func() string { return "de_DE" }); err != nil {
+		t.Fatalf("LoadTranslations() error = %v", err)
+	}
+	if got := T("Get the running traces"); got != "Get the running traces" {
+		t.Errorf("T() without translations = %q", got)
+	}
+	if got := T("%d trace deleted", 2); got != "2 trace deleted" {
+		t.Errorf("T() of a count without translations = %q", got)
+	}
+}
+
+func TestLoadSystemLanguage(t *testing.T) {
+	for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if old, ok := os.LookupEnv(v); ok {
+			defer os.Setenv(v, old)
+		} else {
+			defer os.Unsetenv(v)
+		}
+		os.Unsetenv(v)
+	}
+
+	os.Setenv("LANG", "de_DE.UTF-8")
+	os.Setenv("LC_MESSAGES", "fr_FR.UTF-8@euro")
+	if got := loadSystemLanguage(); got != "fr_FR" {
+		t.Errorf("loadSystemLanguage() = %q, want LC_MESSAGES before LANG", got)
+	}
+	os.Setenv("LC_ALL", "C.UTF-8")
+	if got := loadSystemLanguage(); got != "" {
+		t.Errorf("loadSystemLanguage() = %q, want no language for the C locale", got)
+	}
+}
@@ -0,0 +1,120 @@
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// poEntry is a message of a PO file being read.
+type poEntry struct {
+	context bool
+	fuzzy   bool
+	id      string
+	plural  string
+	strs    map[int]*string
+	// last is the field the continuation strings are appended to.
+	last *string
+}
+
+// parsePO reads the translations of a gettext PO file, keyed by their message id. The header, the fuzzy entries,
+// the ones with a context and the ones left untranslated are skipped, as gettext does.
+func parsePO(r io.Reader) (map[string][]string, error) {
+	t := map[string][]string{}
+	e := &poEntry{}
+	flush := func() {
+		if len(e.id) > 0 && !e.fuzzy && !e.context {
+			var forms []string
+			for i := 0; i < len(e.strs); i++ {
+				s, ok := e.strs[i]
+				if !ok || len(*s) == 0 {
+					forms = nil
+					break
+				}
+				forms = append(forms, *s)
+			}
+			if len(forms) > 0 {
+				t[e.id] = forms
+			}
+		}
+		e = &poEntry{}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) == 0:
+			continue
+		case strings.HasPrefix(line, "#,"):
+			if e.strs != nil {
+				flush()
+			}
+			e.fuzzy = strings.Contains(line, "fuzzy")
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, `"`):
+			if e.last == nil {
+				return nil, fmt.Errorf("line %d: string outside of an entry", n)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", n, line)
+			}
+			*e.last += s
+			continue
+		}
+
+		keyword, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i > 0 {
+			keyword, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string %s", n, value)
+		}
+		// A msgctxt or msgid after the strings of an entry starts the next one.
+		if (keyword == "msgctxt" || keyword == "msgid") && e.strs != nil {
+			flush()
+		}
+		switch {
+		case keyword == "msgctxt":
+			e.context = true
+			e.last = new(string)
+		case keyword == "msgid":
+			e.id = s
+			e.last = &e.id
+		case keyword == "msgid_plural":
+			e.plural = s
+			e.last = &e.plural
+		case keyword == "msgstr":
+			e.setStr(0, s)
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			i, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("line %d: invalid keyword %s", n, keyword)
+			}
+			e.setStr(i, s)
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %s", n, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return t, nil
+}
+
+// setStr sets the i-th form of the translation of the entry, and the continuation strings that follow go to it.
+func (e *poEntry) setStr(i int, s string) {
+	if e.strs == nil {
+		e.strs = map[int]*string{}
+	}
+	e.strs[i] = &s
+	e.last = &s
+}
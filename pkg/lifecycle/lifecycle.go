@@ -0,0 +1,85 @@
+// Package lifecycle lets programs embedding kubectl-trace react to the lifecycle of the traces they run.
+package lifecycle
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Event describes the trace an observer is notified about.
+type Event struct {
+	// TraceID identifies the trace.
+	TraceID types.UID
+	// Namespace is the namespace of the objects of the trace.
+	Namespace string
+	// Pod is the name of the trace job pod, empty until it is known.
+	Pod string
+	// Node is the node the trace job pod runs on, empty until it is scheduled.
+	Node string
+	// Time is when the change was seen.
+	Time time.Time
+}
+
+// Observer is notified of the lifecycle of a trace.
+// Its methods are called synchronously, they must return quickly and must not block.
+type Observer interface {
+	// OnCreated is called once the objects of the trace are created.
+	OnCreated(e Event)
+	// OnScheduled is called once the trace job pod is scheduled on a node.
+	OnScheduled(e Event)
+	// OnRunning is called once the tracerunner is running.
+	OnRunning(e Event)
+	// OnOutputLine is called for each line of output of the program, without its line ending.
+	OnOutputLine(e Event, line string)
+	// OnCompleted is called once the trace job pod succeeded.
+	OnCompleted(e Event)
+	// OnFailed is called once the trace job pod failed or could not start.
+	OnFailed(e Event, err error)
+}
+
+// Funcs is an Observer calling the functions that are set.
+type Funcs struct {
+	Created    func(e Event)
+	Scheduled  func(e Event)
+	Running    func(e Event)
+	OutputLine func(e Event, line string)
+	Completed  func(e Event)
+	Failed     func(e Event, err error)
+}
+
+func (f Funcs) OnCreated(e Event) {
+	if f.Created != nil {
+		f.Created(e)
+	}
+}
+
+func (f Funcs) OnScheduled(e Event) {
+	if f.Scheduled != nil {
+		f.Scheduled(e)
+	}
+}
+
+func (f Funcs) OnRunning(e Event) {
+	if f.Running != nil {
+		f.Running(e)
+	}
+}
+
+func (f Funcs) OnOutputLine(e Event, line string) {
+	if f.OutputLine != nil {
+		f.OutputLine(e, line)
+	}
+}
+
+func (f Funcs) OnCompleted(e Event) {
+	if f.Completed != nil {
+		f.Completed(e)
+	}
+}
+
+func (f Funcs) OnFailed(e Event, err error) {
+	if f.Failed != nil {
+		f.Failed(e, err)
+	}
+}
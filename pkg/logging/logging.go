@@ -0,0 +1,100 @@
+// Package logging sets up the logs of kubectl-trace, written with klog like the ones of the kubernetes client libraries.
+package logging
+
+import (
+	"encoding/json"
+	goflag "flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// FormatText writes the lines of klog as they are.
+	FormatText = "text"
+	// FormatJSON writes one JSON object per entry.
+	FormatJSON = "json"
+)
+
+// Verbosity levels used across kubectl-trace, given to klog.V.
+const (
+	// LevelSteps logs the main steps of the commands.
+	LevelSteps klog.Level = 1
+	// LevelStatus logs the status of the trace job pod while waiting for it.
+	LevelStatus klog.Level = 2
+	// LevelRequests logs the requests to the API server.
+	LevelRequests klog.Level = 4
+	// LevelManifests logs the objects generated for the trace, with the program of the trace.
+	LevelManifests klog.Level = 5
+)
+
+// now is overridden in tests.
+var now = time.Now
+
+// Configure makes klog write the messages up to the verbosity level to out, in the format.
+// The verbose messages are not logged until it is called, so that using the packages as a library stays silent.
+func Configure(out io.Writer, level int, format string) error {
+	switch format {
+	case FormatText:
+	case FormatJSON:
+		out = &jsonWriter{out: out}
+	default:
+		return fmt.Errorf("unsupported log format %q, use %s or %s", format, FormatText, FormatJSON)
+	}
+
+	flags := goflag.NewFlagSet("klog", goflag.ContinueOnError)
+	klog.InitFlags(flags)
+	// klog writes to out alone, the errors included, instead of to the standard error or to files.
+	for name, value := range map[string]string{
+		"v":               strconv.Itoa(level),
+		"logtostderr":     "false",
+		"alsologtostderr": "false",
+		"stderrthreshold": "FATAL",
+	} {
+		if err := flags.Set(name, value); err != nil {
+			return err
+		}
+	}
+	// klog writes the entries to the output of their severity and of the ones below it, out is only the one of
+	// the infos for each entry to be written once.
+	for _, severity := range []string{"FATAL", "ERROR", "WARNING"} {
+		klog.SetOutputBySeverity(severity, ioutil.Discard)
+	}
+	klog.SetOutputBySeverity("INFO", out)
+	return nil
+}
+
+// klogHeader matches the header of the entries of klog, like "I0701 10:00:00.000000   12345 job.go:42] ".
+var klogHeader = regexp.MustCompile(`^([IWEF])\d{4} [0-9:.]+ +\d+ ([^\]]+)\] `)
+
+var severities = map[string]string{"I": "info", "W": "warning", "E": "error", "F": "fatal"}
+
+// jsonWriter writes the entries of klog, one per write, as JSON objects with their level, caller and message.
+type jsonWriter struct {
+	out io.Writer
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	entry := map[string]string{"ts": now().UTC().Format(time.RFC3339Nano)}
+	if m := klogHeader.FindStringSubmatch(msg); m != nil {
+		entry["level"] = severities[m[1]]
+		entry["caller"] = m[2]
+		msg = msg[len(m[0]):]
+	}
+	entry["msg"] = msg
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.out.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"k8s.io/klog"
+)
+
+func TestConfigure(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name   string
+		level  int
+		format string
+		log    func()
+		want   *regexp.Regexp
+	}{
+		{
+			name:   "text",
+			level:  int(LevelSteps),
+			format: FormatText,
+			log: func() {
+				klog.V(LevelSteps).Infof("trace job created: job=%s", "kubectl-trace-1")
+			},
+			want: regexp.MustCompile(`^I\d{4} [0-9:.]+ +\d+ logging_test.go:\d+\] trace job created: job=kubectl-trace-1\n$`),
+		},
+		{
+			name:   "level not enabled",
+			level:  int(LevelSteps),
+			format: FormatText,
+			log: func() {
+				klog.V(LevelManifests).Info("generated trace job")
+			},
+			want: regexp.MustCompile(`^$`),
+		},
+		{
+			name:   "error written once",
+			level:  0,
+			format: FormatText,
+			log: func() {
+				klog.Error("watch failed")
+			},
+			want: regexp.MustCompile(`^E[^\n]*\] watch failed\n$`),
+		},
+		{
+			name:   "json",
+			level:  int(LevelRequests),
+			format: FormatJSON,
+			log: func() {
+				klog.V(LevelRequests).Infof("api request: status=%d", 200)
+			},
+			want: regexp.MustCompile(`^\{"caller":"logging_test.go:\d+","level":"info","msg":"api request: status=200","ts":"2019-07-01T10:00:00Z"\}\n$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Configure(&b, tt.level, tt.format); err != nil {
+				t.Fatal(err)
+			}
+			tt.log()
+			if got := b.String(); !tt.want.MatchString(got) {
+				t.Errorf("got %q, want it to match %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := Configure(&bytes.Buffer{}, 1, "yaml"); err == nil {
+		t.Errorf("Configure() with an unsupported format should fail")
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	var b bytes.Buffer
+	w := &jsonWriter{out: &b}
+	// The debug logs of the client library can span several lines, and lines without a header are kept whole.
+	for _, line := range []string{
+		"W0701 10:00:00.000000    4242 reflector.go:302] watch closed\nwith an error\n",
+		"no header\n",
+	} {
+		if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("Write() = %d, %v, want %d", n, err, len(line))
+		}
+	}
+
+	var entries []map[string]string
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		e := map[string]string{}
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	want := []map[string]string{
+		{"ts": "2019-07-01T10:00:00Z", "level": "warning", "caller": "reflector.go:302", "msg": "watch closed\nwith an error"},
+		{"ts": "2019-07-01T10:00:00Z", "msg": "no header"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %v, want %v", entries, want)
+	}
+	for i := range want {
+		for k, v := range want[i] {
+			if entries[i][k] != v || len(entries[i]) != len(want[i]) {
+				t.Errorf("entry %d = %v, want %v", i, entries[i], want[i])
+				break
+			}
+		}
+	}
+}
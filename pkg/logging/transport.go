@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"k8s.io/klog"
+)
+
+type loggingRoundTripper struct {
+	delegate http.RoundTripper
+}
+
+// WrapTransport logs the requests going through rt at the LevelRequests verbosity.
+// It has the signature of the WrapTransport field of rest.Config.
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &loggingRoundTripper{delegate: rt}
+}
+
+func (l *loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	v := klog.V(LevelRequests)
+	if !v {
+		return l.delegate.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := l.delegate.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		v.Infof("api request failed: method=%s url=%s latency=%s error=%q", req.Method, req.URL, latency, err)
+		return resp, err
+	}
+	v.Infof("api request: method=%s url=%s status=%d latency=%s", req.Method, req.URL, resp.StatusCode, latency)
+	return resp, nil
+}
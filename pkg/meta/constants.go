@@ -7,7 +7,47 @@ const (
 	TraceIDLabelKey = "iovisor.org/kubectl-trace-id"
 	// TraceLabelKey is a meta to annotate objects created by this tool
 	TraceLabelKey = "iovisor.org/kubectl-trace"
+	// TraceNamespaceLabelKey labels the node locks held by traces with the namespace of their trace job
+	TraceNamespaceLabelKey = "iovisor.org/kubectl-trace-namespace"
 
 	// ObjectNamePrefix is the prefix used for objects created by kubectl-trace
 	ObjectNamePrefix = "kubectl-trace-"
 )
+
+const (
+	// RunnerUsageMessage is printed by the trace runner before starting the program
+	RunnerUsageMessage = "if your program has maps to print, send a SIGINT using Ctrl-C, if you want to interrupt the execution send SIGINT two times"
+	// RunnerFirstSIGINTMessage is printed by the trace runner when it gets the first SIGINT
+	RunnerFirstSIGINTMessage = "first SIGINT received, now if your program had maps and did not free them it should print them out"
+	// RunnerSIGTERMMessage is printed by the trace runner when its pod is being killed
+	RunnerSIGTERMMessage = "SIGTERM received, the trace is being killed, waiting for the program to print its maps and exit"
+)
+
+const (
+	// TracePhaseAnnotationKey annotates the trace job pods with the phase reported by the trace runner
+	TracePhaseAnnotationKey = "iovisor.org/kubectl-trace-phase"
+	// TraceDeadlineAnnotationKey and TraceDeadlineGracePeriodAnnotationKey annotate the objects of a trace
+	// with its deadline and grace period in seconds, counted from the start of the trace runner container
+	TraceDeadlineAnnotationKey            = "iovisor.org/kubectl-trace-deadline"
+	TraceDeadlineGracePeriodAnnotationKey = "iovisor.org/kubectl-trace-deadline-grace-period"
+
+	// EnvPodName and EnvPodNamespace give the trace runner the pod to report its phase on
+	EnvPodName      = "KUBECTL_TRACE_POD_NAME"
+	EnvPodNamespace = "KUBECTL_TRACE_POD_NAMESPACE"
+)
+
+// Phases reported by the trace runner
+const (
+	// PhaseWaiting is reported while waiting for the beginning of the time window of the trace
+	PhaseWaiting = "Waiting"
+	// PhaseCompiling is reported when the program is being compiled and its probes attached
+	PhaseCompiling = "Compiling"
+	// PhaseRunning is reported once the probes are attached
+	PhaseRunning = "Running"
+	// PhaseDraining is reported when the program is asked to stop and print its maps
+	PhaseDraining = "Draining"
+	// PhaseCompleted is reported when the program exited successfully
+	PhaseCompleted = "Completed"
+	// PhaseFailed is reported when the program failed
+	PhaseFailed = "Failed"
+)
@@ -0,0 +1,84 @@
+package pids
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// pidRE matches the PIDs printed by programs, like "pid 4242", "pid=4242" or "PID: 4242".
+var pidRE = regexp.MustCompile(`(?i)\bpid[=: ]\s*(\d+)`)
+
+// Annotator writes each line written to it to an underlying writer,
+// with the pod and the container of the PIDs it prints, the ones resolved, appended to them.
+type Annotator struct {
+	out     io.Writer
+	resolve ResolveFunc
+	line    []byte
+}
+
+// NewAnnotator provides an Annotator writing to out the PIDs annotated with their owners returned by resolve.
+func NewAnnotator(out io.Writer, resolve ResolveFunc) *Annotator {
+	return &Annotator{out: out, resolve: resolve}
+}
+
+// Write writes the complete lines of p, the last one is kept until it is complete.
+func (a *Annotator) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			a.line = append(a.line, p...)
+			break
+		}
+		a.line = append(a.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := a.Flush(); err != nil {
+			return n - len(p), err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the incomplete line kept, if any.
+func (a *Annotator) Flush() error {
+	if len(a.line) == 0 {
+		return nil
+	}
+	line := a.annotate(a.line)
+	a.line = a.line[:0]
+	_, err := a.out.Write(line)
+	return err
+}
+
+// annotate returns the line with " (namespace/pod/container)" inserted after each of its PIDs that were resolved.
+func (a *Annotator) annotate(line []byte) []byte {
+	matches := pidRE.FindAllSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return append([]byte(nil), line...)
+	}
+	list := make([]int, 0, len(matches))
+	for _, m := range matches {
+		if pid, err := strconv.Atoi(string(line[m[2]:m[3]])); err == nil {
+			list = append(list, pid)
+		}
+	}
+	owners := a.resolve(list...)
+
+	var b bytes.Buffer
+	last := 0
+	for _, m := range matches {
+		b.Write(line[last:m[1]])
+		last = m[1]
+		pid, err := strconv.Atoi(string(line[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		if o, ok := owners[pid]; ok {
+			b.WriteString(" (" + o.String() + ")")
+		}
+	}
+	b.Write(line[last:])
+	return b.Bytes()
+}
@@ -0,0 +1,63 @@
+package pids
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAnnotator(t *testing.T) {
+	resolve := func(pids ...int) map[int]Owner {
+		return map[int]Owner{
+			4242: {Namespace: "default", Pod: "nginx", Container: "nginx"},
+			4300: {Namespace: "kube-system", Pod: "coredns", Container: "coredns"},
+		}
+	}
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "no pid",
+			in:   "Attaching 1 probe...\n",
+			want: "Attaching 1 probe...\n",
+		},
+		{
+			name: "resolved pids",
+			in:   "open pid 4242 /etc/hosts\r\nPID=4300 comm=coredns\n",
+			want: "open pid 4242 (default/nginx/nginx) /etc/hosts\r\nPID=4300 (kube-system/coredns/coredns) comm=coredns\n",
+		},
+		{
+			name: "unresolved pid",
+			in:   "pid: 1 exited, pid: 4242 exited\n",
+			want: "pid: 1 exited, pid: 4242 (default/nginx/nginx) exited\n",
+		},
+		{
+			name: "incomplete line",
+			in:   "pid 4242",
+			want: "pid 4242 (default/nginx/nginx)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			a := NewAnnotator(&out, resolve)
+			// The output comes in arbitrary chunks.
+			for i := 0; i < len(tt.in); i += 5 {
+				end := i + 5
+				if end > len(tt.in) {
+					end = len(tt.in)
+				}
+				if _, err := a.Write([]byte(tt.in[i:end])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := a.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
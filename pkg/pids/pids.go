@@ -0,0 +1,214 @@
+// Package pids resolves the host PIDs seen by a trace to the pods and containers running them.
+package pids
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	tcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Owner is the container of a pod running a process.
+type Owner struct {
+	Node      string `json:"node,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	PodUID    string `json:"-"`
+	Container string `json:"container,omitempty"`
+}
+
+// String returns the owner as namespace/pod/container.
+func (o Owner) String() string {
+	return fmt.Sprintf("%s/%s/%s", o.Namespace, o.Pod, o.Container)
+}
+
+// ResolveFunc returns the owners of the PIDs it resolved.
+type ResolveFunc func(pids ...int) map[int]Owner
+
+// Resolver resolves the PIDs of the node of a trace by looking at their mounts from the trace job pod,
+// which sees the processes of the node: the kubelet mounts the directory of each container of a pod in it.
+// The PIDs are resolved while the trace runs, the processes that are gone or are not in a pod are not resolved.
+type Resolver struct {
+	client    tcorev1.CoreV1Interface
+	config    *restclient.Config
+	traceID   types.UID
+	namespace string
+
+	mu       sync.Mutex
+	tracePod *corev1.Pod
+	owners   map[int]*Owner
+	pods     map[string]corev1.Pod
+}
+
+// NewResolver returns a Resolver of the PIDs of the node of the trace with the given ID.
+func NewResolver(client tcorev1.CoreV1Interface, config *restclient.Config, traceID types.UID, namespace string) *Resolver {
+	return &Resolver{
+		client:    client,
+		config:    config,
+		traceID:   traceID,
+		namespace: namespace,
+		owners:    map[int]*Owner{},
+		pods:      map[string]corev1.Pod{},
+	}
+}
+
+// Resolve returns the owners of the PIDs that could be resolved, remembering them for the next calls.
+func (r *Resolver) Resolve(pids ...int) map[int]Owner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unknown := []int{}
+	for _, pid := range pids {
+		if _, ok := r.owners[pid]; !ok {
+			unknown = append(unknown, pid)
+		}
+	}
+	if len(unknown) > 0 {
+		if err := r.resolve(unknown); err == nil {
+			for _, pid := range unknown {
+				if _, ok := r.owners[pid]; !ok {
+					// Not in a pod, not looked up again.
+					r.owners[pid] = nil
+				}
+			}
+		}
+	}
+
+	owners := map[int]Owner{}
+	for _, pid := range pids {
+		if o := r.owners[pid]; o != nil {
+			owners[pid] = *o
+		}
+	}
+	return owners
+}
+
+// resolve looks up the containers of the PIDs from the trace job pod, then their pods.
+func (r *Resolver) resolve(pids []int) error {
+	if r.tracePod == nil {
+		pl, err := r.client.Pods(r.namespace).List(metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", meta.TraceIDLabelKey, r.traceID),
+		})
+		if err != nil {
+			return err
+		}
+		if len(pl.Items) == 0 || pl.Items[0].Status.Phase != corev1.PodRunning {
+			return fmt.Errorf("the trace job pod is not running")
+		}
+		r.tracePod = &pl.Items[0]
+	}
+
+	var out bytes.Buffer
+	if err := r.exec(mountsCommand(pids), &out); err != nil {
+		return err
+	}
+	containers := parseMounts(out.String())
+
+	for pid, c := range containers {
+		pod, ok := r.pods[c.podUID]
+		if !ok {
+			// The pods are listed again when one is not known yet, it started after the last listing.
+			if err := r.listPods(); err != nil {
+				return err
+			}
+			if pod, ok = r.pods[c.podUID]; !ok {
+				continue
+			}
+		}
+		r.owners[pid] = &Owner{
+			Node:      r.tracePod.Spec.NodeName,
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			PodUID:    c.podUID,
+			Container: c.name,
+		}
+	}
+	return nil
+}
+
+// listPods lists the pods of the node of the trace, by UID.
+func (r *Resolver) listPods() error {
+	pl, err := r.client.Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", r.tracePod.Spec.NodeName).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range pl.Items {
+		r.pods[string(p.UID)] = p
+	}
+	return nil
+}
+
+func (r *Resolver) exec(command []string, out *bytes.Buffer) error {
+	req := r.client.RESTClient().Post().
+		Resource("pods").
+		Name(r.tracePod.Name).
+		Namespace(r.tracePod.Namespace).
+		SubResource("exec")
+	req.VersionedParams(&corev1.PodExecOptions{
+		Container: r.tracePod.Spec.Containers[0].Name,
+		Command:   command,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(r.config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	return exec.Stream(remotecommand.StreamOptions{Stdout: out, Stderr: &bytes.Buffer{}})
+}
+
+// mountsCommand returns the command printing, for each PID, the directory of its pod container mounted by the kubelet.
+func mountsCommand(pids []int) []string {
+	list := make([]string, 0, len(pids))
+	for _, pid := range pids {
+		list = append(list, strconv.Itoa(pid))
+	}
+	return []string{"/bin/sh", "-c", fmt.Sprintf(
+		`for p in %s; do echo "pid $p"; grep -o '/pods/[0-9a-f-]*/containers/[^/ ]*' /proc/$p/mountinfo 2>/dev/null | head -n 1; done`,
+		strings.Join(list, " "))}
+}
+
+type podContainer struct {
+	podUID string
+	name   string
+}
+
+// containerDirRE matches the directory of a pod container, like /var/lib/kubelet/pods/<uid>/containers/<name>.
+var containerDirRE = regexp.MustCompile(`^/pods/([0-9a-f-]+)/containers/([^/ ]+)$`)
+
+// parseMounts parses the output of mountsCommand.
+func parseMounts(output string) map[int]podContainer {
+	containers := map[int]podContainer{}
+	pid := -1
+	for _, l := range strings.Split(output, "\n") {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "pid ") {
+			p, err := strconv.Atoi(strings.TrimPrefix(l, "pid "))
+			if err != nil {
+				pid = -1
+				continue
+			}
+			pid = p
+			continue
+		}
+		if m := containerDirRE.FindStringSubmatch(l); m != nil && pid >= 0 {
+			containers[pid] = podContainer{podUID: m[1], name: m[2]}
+		}
+	}
+	return containers
+}
@@ -0,0 +1,32 @@
+package pids
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMounts(t *testing.T) {
+	output := `pid 1
+pid 4242
+/pods/6d2b4f0e-1c1a-4b47-9d4e-3f1b2a7c9e11/containers/nginx
+pid 4300
+/pods/0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0/containers/sidecar
+pid nope
+/pods/ffffffff-ffff-ffff-ffff-ffffffffffff/containers/ignored
+`
+	want := map[int]podContainer{
+		4242: {podUID: "6d2b4f0e-1c1a-4b47-9d4e-3f1b2a7c9e11", name: "nginx"},
+		4300: {podUID: "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0", name: "sidecar"},
+	}
+	if got := parseMounts(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMounts() = %v, want %v", got, want)
+	}
+}
+
+func TestMountsCommand(t *testing.T) {
+	got := mountsCommand([]int{12, 345})
+	if len(got) != 3 || !strings.HasPrefix(got[2], "for p in 12 345; do") {
+		t.Errorf("mountsCommand() = %q", got)
+	}
+}
@@ -0,0 +1,278 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/pids"
+)
+
+const (
+	// DefaultHz is the default sampling frequency of the stacks, per CPU.
+	DefaultHz = 99
+	// DefaultInterval is the default length of the time buckets of the profile.
+	DefaultInterval = time.Minute
+
+	// bucketEnd is printed by the program after the stacks of each bucket.
+	bucketEnd = "--- end of profile bucket ---"
+	// fileTimeFormat is the format of the time of the end of a bucket in the name of its file.
+	fileTimeFormat = "20060102T150405Z"
+)
+
+const (
+	// FormatFolded writes the folded stacks of flame graphs.
+	FormatFolded = "folded"
+	// FormatDataset writes a JSON record per stack and process, labelled with its node, pod and container.
+	FormatDataset = "dataset"
+)
+
+// Formats are the formats the profile is written in.
+var Formats = []string{FormatFolded, FormatDataset}
+
+// Program returns the bpftrace program sampling the stacks hz times per second and CPU, printing and clearing them
+// at every interval. On a pod, only the stacks of the root process of the container are sampled.
+// The stacks are also keyed by their PID in the dataset format, to tell the pods they come from.
+func Program(hz int, interval time.Duration, pod bool, format string) string {
+	filter := ""
+	if pod {
+		filter = " /pid == $container_pid/"
+	}
+	key := "kstack, ustack, comm"
+	if format == FormatDataset {
+		key += ", pid"
+	}
+	return fmt.Sprintf(`profile:hz:%d%s { @stacks[%s] = count(); }
+interval:s:%d { print(@stacks); clear(@stacks); printf("%s\n"); }
+`, hz, filter, key, int64(interval/time.Second), bucketEnd)
+}
+
+// Sample is a stack sampled count times in a process.
+type Sample struct {
+	Comm string
+	// PID is 0 when the stacks are not keyed by PID.
+	PID int
+	// Frames are the user then kernel frames of the stack, outermost first.
+	Frames []string
+	Count  int64
+}
+
+// entryEnd matches the last line of a stack map entry, giving its end and its count.
+var entryEnd = regexp.MustCompile(`^(.*)\]: (\d+)$`)
+
+// Fold converts the stacks printed by the program to the folded format of flame graphs,
+// one "comm;user frames;kernel frames count" line per stack, outermost frames first.
+func Fold(output string) []string {
+	var folded []string
+	for _, s := range Parse(output) {
+		folded = append(folded, fmt.Sprintf("%s %d", s.stack(), s.Count))
+	}
+	return folded
+}
+
+// stack returns the folded stack of the sample, its command and its frames separated by semicolons.
+func (s Sample) stack() string {
+	return strings.Join(append([]string{s.Comm}, s.Frames...), ";")
+}
+
+// Parse returns the samples of the stacks printed by the program.
+func Parse(output string) []Sample {
+	var samples []Sample
+	var entry []string
+	inEntry := false
+	for _, l := range strings.Split(output, "\n") {
+		l = strings.TrimRight(l, "\r")
+		if !inEntry {
+			if !strings.HasPrefix(l, "@stacks[") {
+				continue
+			}
+			inEntry = true
+			entry = entry[:0]
+			l = strings.TrimPrefix(l, "@stacks[")
+		}
+		if m := entryEnd.FindStringSubmatch(l); m != nil {
+			entry = append(entry, m[1])
+			if s, ok := parseEntry(entry, m[2]); ok {
+				samples = append(samples, s)
+			}
+			inEntry = false
+			continue
+		}
+		entry = append(entry, l)
+	}
+	return samples
+}
+
+// parseEntry parses the lines of a map entry keyed by the kernel stack, the user stack, the command and maybe the PID,
+// the stacks separated by lines starting with a comma and the command and the PID printed on the same line.
+func parseEntry(lines []string, count string) (Sample, bool) {
+	fields := [][]string{nil}
+	for _, l := range lines {
+		if strings.HasPrefix(l, ",") {
+			fields = append(fields, nil)
+			l = l[1:]
+		}
+		if l = strings.TrimSpace(l); len(l) > 0 {
+			fields[len(fields)-1] = append(fields[len(fields)-1], strings.Replace(l, ";", ":", -1))
+		}
+	}
+	if len(fields) != 3 || len(fields[2]) != 1 {
+		return Sample{}, false
+	}
+	s := Sample{Comm: fields[2][0]}
+	if i := strings.LastIndex(s.Comm, ", "); i >= 0 {
+		pid, err := strconv.Atoi(s.Comm[i+2:])
+		if err != nil {
+			return Sample{}, false
+		}
+		s.Comm, s.PID = s.Comm[:i], pid
+	}
+	var err error
+	if s.Count, err = strconv.ParseInt(count, 10, 64); err != nil {
+		return Sample{}, false
+	}
+	// The stacks are printed innermost frame first.
+	for _, stack := range [][]string{fields[1], fields[0]} {
+		for i := len(stack) - 1; i >= 0; i-- {
+			s.Frames = append(s.Frames, stack[i])
+		}
+	}
+	return s, true
+}
+
+// Record is a sample of the dataset format, labelled with the node, the pod and the container of its process.
+// The labels of the pod are empty when the process does not run in a pod or was not resolved.
+type Record struct {
+	Time time.Time `json:"time"`
+	pids.Owner
+	PID   int    `json:"pid"`
+	Comm  string `json:"comm"`
+	Stack string `json:"stack"`
+	Count int64  `json:"count"`
+}
+
+// Writer splits the output of the program into its time buckets,
+// writing the folded stacks or the records of each of them to its own file of the directory.
+type Writer struct {
+	dir     string
+	notify  io.Writer
+	now     func() time.Time
+	dataset bool
+	node    string
+	resolve pids.ResolveFunc
+
+	mu      sync.Mutex
+	partial []byte
+	bucket  bytes.Buffer
+}
+
+// NewWriter returns a Writer of the buckets to dir, created when missing, telling notify about each file written.
+func NewWriter(dir string, notify io.Writer) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir, notify: notify, now: time.Now}, nil
+}
+
+// NewDatasetWriter returns a Writer of the records of the buckets of the stacks sampled on node to dir,
+// labelled with the owners of their PIDs returned by resolve.
+func NewDatasetWriter(dir, node string, resolve pids.ResolveFunc, notify io.Writer) (*Writer, error) {
+	w, err := NewWriter(dir, notify)
+	if err != nil {
+		return nil, err
+	}
+	w.dataset, w.node, w.resolve = true, node, resolve
+	return w, nil
+}
+
+// Write implements io.Writer, writing the bucket that p completes, if any.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+		if strings.TrimSpace(line) == bucketEnd {
+			if err := w.flush(); err != nil {
+				return len(p), err
+			}
+			continue
+		}
+		w.bucket.WriteString(line)
+	}
+}
+
+// Close writes the last bucket, the stacks printed when the program exits.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.bucket.Write(w.partial)
+	w.partial = nil
+	return w.flush()
+}
+
+// flush writes the folded stacks or the records of the current bucket, nothing when it has none.
+func (w *Writer) flush() error {
+	samples := Parse(w.bucket.String())
+	w.bucket.Reset()
+	if len(samples) == 0 {
+		return nil
+	}
+	now := w.now().UTC()
+	var content bytes.Buffer
+	ext := FormatFolded
+	if w.dataset {
+		ext = "jsonl"
+		enc := json.NewEncoder(&content)
+		for _, r := range w.records(now, samples) {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, s := range samples {
+			fmt.Fprintf(&content, "%s %d\n", s.stack(), s.Count)
+		}
+	}
+	path := filepath.Join(w.dir, fmt.Sprintf("profile-%s.%s", now.Format(fileTimeFormat), ext))
+	if err := ioutil.WriteFile(path, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	if w.notify != nil {
+		fmt.Fprintf(w.notify, "profile %s written\n", path)
+	}
+	return nil
+}
+
+// records labels the samples of a bucket, resolving their PIDs.
+func (w *Writer) records(now time.Time, samples []Sample) []Record {
+	var owners map[int]pids.Owner
+	if w.resolve != nil {
+		list := make([]int, 0, len(samples))
+		for _, s := range samples {
+			list = append(list, s.PID)
+		}
+		owners = w.resolve(list...)
+	}
+	records := make([]Record, 0, len(samples))
+	for _, s := range samples {
+		owner := owners[s.PID]
+		owner.Node = w.node
+		records = append(records, Record{Time: now, Owner: owner, PID: s.PID, Comm: s.Comm, Stack: s.stack(), Count: s.Count})
+	}
+	return records
+}
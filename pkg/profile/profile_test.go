@@ -0,0 +1,178 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/pids"
+)
+
+const stacks = `Attaching 2 probes...
+@stacks[
+    do_syscall_64+91
+    entry_SYSCALL_64_after_hwframe+68
+,
+    __GI___libc_write+20
+    main+33
+, nginx]: 12
+@stacks[
+    cpu_idle+16
+,
+, swapper/0]: 40
+`
+
+func TestFold(t *testing.T) {
+	want := []string{
+		"nginx;main+33;__GI___libc_write+20;entry_SYSCALL_64_after_hwframe+68;do_syscall_64+91 12",
+		"swapper/0;cpu_idle+16 40",
+	}
+	if got := Fold(stacks); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fold() = %q, want %q", got, want)
+	}
+}
+
+const pidStacks = `@stacks[
+    do_syscall_64+91
+,
+    main+33
+, nginx, 4242]: 12
+@stacks[
+    cpu_idle+16
+,
+, swapper/0, 0]: 40
+`
+
+func TestParse(t *testing.T) {
+	want := []Sample{
+		{Comm: "nginx", PID: 4242, Frames: []string{"main+33", "do_syscall_64+91"}, Count: 12},
+		{Comm: "swapper/0", Frames: []string{"cpu_idle+16"}, Count: 40},
+	}
+	if got := Parse(pidStacks); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	if got := Program(99, time.Minute, false, FormatDataset); !strings.Contains(got, "@stacks[kstack, ustack, comm, pid]") {
+		t.Errorf("Program() = %q, want the stacks keyed by PID", got)
+	}
+
+	got := Program(49, 30*time.Second, true, FormatFolded)
+	for _, want := range []string{"profile:hz:49 /pid == $container_pid/", "interval:s:30", bucketEnd} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Program() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := []time.Time{
+		time.Date(2019, 1, 2, 14, 31, 0, 0, time.UTC),
+		time.Date(2019, 1, 2, 14, 32, 0, 0, time.UTC),
+		time.Date(2019, 1, 2, 14, 32, 10, 0, time.UTC),
+	}
+	w.now = func() time.Time {
+		now := times[0]
+		times = times[1:]
+		return now
+	}
+
+	// The output comes in arbitrary chunks.
+	output := stacks + bucketEnd + "\r\n" + "Attaching 2 probes...\n" + bucketEnd + "\n" + stacks[:60]
+	for _, chunk := range []string{output[:10], output[10:250], output[250:]} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Write([]byte(stacks[60:])); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.folded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bucket without stacks has no file.
+	want := []string{
+		filepath.Join(dir, "profile-20190102T143100Z.folded"),
+		filepath.Join(dir, "profile-20190102T143200Z.folded"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("files = %q, want %q", files, want)
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(b), "\n"); got != 2 {
+			t.Errorf("%s has %d stacks, want 2", f, got)
+		}
+	}
+}
+
+func TestDatasetWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	resolve := func(list ...int) map[int]pids.Owner {
+		return map[int]pids.Owner{4242: {Namespace: "default", Pod: "nginx", Container: "nginx"}}
+	}
+	w, err := NewDatasetWriter(dir, "node-1", resolve, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 1, 2, 14, 31, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	if _, err := w.Write([]byte(pidStacks + bucketEnd + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "profile-20190102T143100Z.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []Record{
+		{Time: now, Owner: pids.Owner{Node: "node-1", Namespace: "default", Pod: "nginx", Container: "nginx"}, PID: 4242, Comm: "nginx", Stack: "nginx;main+33;do_syscall_64+91", Count: 12},
+		{Time: now, Owner: pids.Owner{Node: "node-1"}, Comm: "swapper/0", Stack: "swapper/0;cpu_idle+16", Count: 40},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxLineSize is the size of the longest event line read, large enough for the output of a whole map.
+const maxLineSize = 16 * 1024 * 1024
+
+// Play writes the output events of the session read from r to out, waiting between them as they were recorded,
+// speed times faster. It stops when ctx is done.
+func Play(ctx context.Context, out io.Writer, r io.Reader, speed float64) (Header, error) {
+	return play(ctx, out, r, speed, sleep)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func play(ctx context.Context, out io.Writer, r io.Reader, speed float64, sleep func(context.Context, time.Duration) error) (Header, error) {
+	if speed <= 0 {
+		return Header{}, fmt.Errorf("the speed must be positive, got %g", speed)
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var h Header
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return h, err
+		}
+		return h, fmt.Errorf("empty session")
+	}
+	if err := json.Unmarshal(s.Bytes(), &h); err != nil {
+		return h, fmt.Errorf("invalid session header: %v", err)
+	}
+	if h.Version != Version {
+		return h, fmt.Errorf("unsupported asciicast version %d, only %d is", h.Version, Version)
+	}
+
+	var last float64
+	for line := 2; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e [3]json.RawMessage
+		var at float64
+		var kind, data string
+		err := json.Unmarshal(s.Bytes(), &e)
+		if err == nil {
+			err = json.Unmarshal(e[0], &at)
+		}
+		if err == nil {
+			err = json.Unmarshal(e[1], &kind)
+		}
+		if err == nil {
+			err = json.Unmarshal(e[2], &data)
+		}
+		if err != nil {
+			return h, fmt.Errorf("invalid event on line %d of the session: %v", line, err)
+		}
+		// The input and resize events are not played back.
+		if kind != "o" {
+			continue
+		}
+		if err := sleep(ctx, time.Duration((at-last)/speed*float64(time.Second))); err != nil {
+			return h, err
+		}
+		if at > last {
+			last = at
+		}
+		if _, err := io.WriteString(out, data); err != nil {
+			return h, err
+		}
+	}
+	return h, s.Err()
+}
@@ -0,0 +1,109 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlay(t *testing.T) {
+	session := `{"version":2,"width":120,"height":40,"timestamp":1546466400,"title":"trace 1"}
+[1.5,"o","Attaching 1 probe...\r\n"]
+[2,"i","q"]
+[3.5,"o","@: 42\r\n"]
+[3.5,"o","\r\n"]
+`
+	tests := []struct {
+		name      string
+		session   string
+		speed     float64
+		wantOut   string
+		wantSleep []time.Duration
+		wantErr   string
+	}{
+		{
+			name:      "recorded speed",
+			session:   session,
+			speed:     1,
+			wantOut:   "Attaching 1 probe...\r\n@: 42\r\n\r\n",
+			wantSleep: []time.Duration{1500 * time.Millisecond, 2 * time.Second, 0},
+		},
+		{
+			name:      "twice as fast",
+			session:   session,
+			speed:     2,
+			wantOut:   "Attaching 1 probe...\r\n@: 42\r\n\r\n",
+			wantSleep: []time.Duration{750 * time.Millisecond, time.Second, 0},
+		},
+		{
+			name:    "not a session",
+			session: "Attaching 1 probe...\n",
+			speed:   1,
+			wantErr: "invalid session header",
+		},
+		{
+			name:    "asciicast v1",
+			session: `{"version":1,"width":80,"height":24}` + "\n",
+			speed:   1,
+			wantErr: "unsupported asciicast version 1",
+		},
+		{
+			name:    "invalid event",
+			session: `{"version":2,"width":80,"height":24}` + "\n[1.5,\"o\"]\n",
+			speed:   1,
+			wantErr: "line 2",
+		},
+		{
+			name:    "null speed",
+			session: session,
+			speed:   0,
+			wantErr: "the speed must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			var slept []time.Duration
+			sleep := func(ctx context.Context, d time.Duration) error {
+				slept = append(slept, d)
+				return nil
+			}
+			_, err := play(context.Background(), &out, strings.NewReader(tt.session), tt.speed, sleep)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.wantOut {
+				t.Errorf("got output %q, want %q", out.String(), tt.wantOut)
+			}
+			if len(slept) != len(tt.wantSleep) {
+				t.Fatalf("slept %v, want %v", slept, tt.wantSleep)
+			}
+			for i := range slept {
+				if d := slept[i] - tt.wantSleep[i]; d > time.Millisecond || d < -time.Millisecond {
+					t.Errorf("slept %v, want %v", slept, tt.wantSleep)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	session := `{"version":2,"width":80,"height":24}` + "\n[60,\"o\",\"late\"]\n"
+	var out bytes.Buffer
+	if _, err := Play(ctx, &out, strings.NewReader(session), 1); err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if out.Len() > 0 {
+		t.Errorf("got output %q after the cancellation", out.String())
+	}
+}
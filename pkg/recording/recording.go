@@ -0,0 +1,104 @@
+// Package recording records the output of attached traces with its timing, as asciicast v2 sessions
+// which asciinema and kubectl trace replay can play back.
+package recording
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of a session, describing the terminal it was recorded in.
+type Header struct {
+	Version   int    `json:"version"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Version is the asciicast version of the sessions.
+const Version = 2
+
+// Recorder writes what it is given as the output events of a session, timed from its creation.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	now   func() time.Time
+	// pending is the beginning of a UTF-8 character cut by the end of the last write, events being strings.
+	pending []byte
+}
+
+// NewRecorder starts a session of the given terminal size on w, writing its header.
+func NewRecorder(w io.Writer, width, height int, title string) (*Recorder, error) {
+	return newRecorder(w, width, height, title, time.Now)
+}
+
+func newRecorder(w io.Writer, width, height int, title string, now func() time.Time) (*Recorder, error) {
+	r := &Recorder{w: w, start: now(), now: now}
+	h, err := json.Marshal(Header{
+		Version:   Version,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(h, '\n')); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records p as an output event.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[end:]...)
+	if end == 0 {
+		return len(p), nil
+	}
+	if err := r.event(string(data[:end])); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush records the cut character left by the last write, if any.
+func (r *Recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return nil
+	}
+	data := string(r.pending)
+	r.pending = nil
+	return r.event(data)
+}
+
+func (r *Recorder) event(data string) error {
+	elapsed := math.Round(r.now().Sub(r.start).Seconds()*1e6) / 1e6
+	e, err := json.Marshal([]interface{}{elapsed, "o", data})
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(e, '\n'))
+	return err
+}
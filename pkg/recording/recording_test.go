@@ -0,0 +1,40 @@
+package recording
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	start := time.Date(2019, 1, 2, 22, 0, 0, 0, time.UTC)
+	now := start
+	var buf bytes.Buffer
+	r, err := newRecorder(&buf, 120, 40, "trace 1", func() time.Time { return now })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = start.Add(1500 * time.Millisecond)
+	r.Write([]byte("Attaching 1 probe...\r\n"))
+	// The é is cut in the middle and recorded with the next write.
+	now = start.Add(2 * time.Second)
+	r.Write([]byte("caf\xc3"))
+	now = start.Add(3 * time.Second)
+	r.Write([]byte("\xa9\r\n"))
+	// A cut character left at the end is recorded as invalid.
+	r.Write([]byte("\xe2\x82"))
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"version":2,"width":120,"height":40,"timestamp":1546466400,"title":"trace 1"}
+[1.5,"o","Attaching 1 probe...\r\n"]
+[2,"o","caf"]
+[3,"o","é\r\n"]
+[3,"o","��"]
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,115 @@
+// Package redact removes the secrets matched by regular expressions from the output of the traces,
+// like the passwords of the command lines they print.
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// Redacted replaces the redacted text.
+const Redacted = "[REDACTED]"
+
+// Compile compiles the regular expressions of the text to redact.
+func Compile(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, e := range exprs {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction %q: %v", e, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Line returns the line with the text matched by the regular expressions replaced by Redacted, in the order of the
+// expressions. The expressions with groups only have their groups replaced, like the value in "password=(\S+)".
+func Line(line []byte, res []*regexp.Regexp) []byte {
+	for _, re := range res {
+		matches := re.FindAllSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var b bytes.Buffer
+		last := 0
+		for _, m := range matches {
+			spans := [][2]int{{m[0], m[1]}}
+			if len(m) > 2 {
+				spans = spans[:0]
+				for i := 2; i < len(m); i += 2 {
+					// The groups that did not participate in the match are -1.
+					if m[i] >= 0 && m[i+1] > m[i] {
+						spans = append(spans, [2]int{m[i], m[i+1]})
+					}
+				}
+			}
+			for _, s := range spans {
+				if s[0] < last {
+					// Nested in a group already redacted.
+					continue
+				}
+				b.Write(line[last:s[0]])
+				b.WriteString(Redacted)
+				last = s[1]
+			}
+		}
+		b.Write(line[last:])
+		line = b.Bytes()
+	}
+	return line
+}
+
+// Writer writes each line written to it to an underlying writer, redacted.
+// The lines are redacted whole, so an incomplete line is kept until it is complete or flushed.
+type Writer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	res  []*regexp.Regexp
+	line []byte
+}
+
+// NewWriter provides a Writer redacting the text matched by res before writing it to out.
+func NewWriter(out io.Writer, res []*regexp.Regexp) *Writer {
+	return &Writer{out: out, res: res}
+}
+
+// Write writes the complete lines of p, the last one is kept until it is complete.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.line = append(w.line, p...)
+			break
+		}
+		w.line = append(w.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := w.flush(); err != nil {
+			return n - len(p), err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the incomplete line kept, if any.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *Writer) flush() error {
+	if len(w.line) == 0 {
+		return nil
+	}
+	line := Line(append([]byte(nil), w.line...), w.res)
+	w.line = w.line[:0]
+	_, err := w.out.Write(line)
+	return err
+}
@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDomain  = "docker.io"
+	dockerRegistry = "registry-1.docker.io"
+	defaultTag     = "latest"
+
+	mediaTypeManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+)
+
+// Reference is a parsed image name.
+type Reference struct {
+	// Domain is the registry the image is pulled from.
+	Domain string
+	// Repository is the path of the image in the registry.
+	Repository string
+	// Reference is the tag or the digest of the image.
+	Reference string
+}
+
+// ParseReference splits an image name the way the container runtimes do, docker hub being the default registry.
+func ParseReference(image string) (Reference, error) {
+	if len(image) == 0 {
+		return Reference{}, fmt.Errorf("empty image name")
+	}
+
+	r := Reference{Reference: defaultTag}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Reference = name[i+1:]
+		name = name[:i]
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		r.Reference = name[i+1:]
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		r.Domain = parts[0]
+		r.Repository = parts[1]
+	} else {
+		r.Domain = defaultDomain
+		r.Repository = name
+	}
+	if r.Domain == defaultDomain && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	if len(r.Repository) == 0 || len(r.Reference) == 0 {
+		return Reference{}, fmt.Errorf("invalid image name %s", image)
+	}
+	return r, nil
+}
+
+// Client reads image metadata from registries implementing the docker registry HTTP API V2.
+// Only anonymous access is supported, which is enough for public images.
+type Client struct {
+	HTTPClient *http.Client
+	// Scheme is https unless testing.
+	Scheme string
+}
+
+// NewClient provides a client with the given timeout for each request.
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: timeout},
+		Scheme:     "https",
+	}
+}
+
+// Labels returns the labels of the image, for linux/amd64 when the image is multi-platform.
+func (c *Client) Labels(image string) (map[string]string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	var token string
+	manifest, err := c.manifest(ref, ref.Reference, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.MediaType == mediaTypeManifestList || manifest.MediaType == mediaTypeOCIIndex || len(manifest.Manifests) > 0 {
+		digest := ""
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				digest = m.Digest
+				break
+			}
+		}
+		if len(digest) == 0 {
+			return nil, fmt.Errorf("image %s has no linux/amd64 variant", image)
+		}
+		if manifest, err = c.manifest(ref, digest, &token); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(manifest.Config.Digest) == 0 {
+		return nil, fmt.Errorf("image %s has no configuration", image)
+	}
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := c.get(ref, "blobs/"+manifest.Config.Digest, "", &token, &config); err != nil {
+		return nil, err
+	}
+	if config.Config.Labels == nil {
+		return map[string]string{}, nil
+	}
+	return config.Config.Labels, nil
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func (c *Client) manifest(ref Reference, reference string, token *string) (*manifest, error) {
+	accept := strings.Join([]string{mediaTypeManifest, mediaTypeManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex}, ", ")
+	m := &manifest{}
+	if err := c.get(ref, "manifests/"+reference, accept, token, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// get decodes the JSON document at the path of the repository into v.
+// When the registry asks for it, an anonymous token is requested and kept for the next requests.
+func (c *Client) get(ref Reference, path, accept string, token *string, v interface{}) error {
+	domain := ref.Domain
+	if domain == defaultDomain {
+		domain = dockerRegistry
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", c.Scheme, domain, ref.Repository, path)
+
+	resp, err := c.do(u, accept, *token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && len(*token) == 0 {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if *token, err = c.token(challenge); err != nil {
+			return err
+		}
+		if resp, err = c.do(u, accept, *token); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(v)
+}
+
+func (c *Client) do(u, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// token gets an anonymous token as described by a Bearer challenge.
+func (c *Client) token(challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("registry authentication without realm")
+	}
+	q := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := params[k]; ok {
+			q.Set(k, v)
+		}
+	}
+
+	resp, err := c.HTTPClient.Get(realm + "?" + q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected status from %s: %s", realm, resp.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	if len(t.Token) > 0 {
+		return t.Token, nil
+	}
+	return t.AccessToken, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of an authentication challenge.
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if comma := strings.Index(s, ","); comma >= 0 {
+			value, s = s[:comma], s[comma:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+	}
+	return params
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image   string
+		want    Reference
+		wantErr bool
+	}{
+		{
+			image: "quay.io/iovisor/kubectl-trace-bpftrace:latest",
+			want:  Reference{Domain: "quay.io", Repository: "iovisor/kubectl-trace-bpftrace", Reference: "latest"},
+		},
+		{
+			image: "ubuntu",
+			want:  Reference{Domain: "docker.io", Repository: "library/ubuntu", Reference: "latest"},
+		},
+		{
+			image: "myorg/bpftrace:v0.9.4",
+			want:  Reference{Domain: "docker.io", Repository: "myorg/bpftrace", Reference: "v0.9.4"},
+		},
+		{
+			image: "localhost:5000/trace@sha256:abcd",
+			want:  Reference{Domain: "localhost:5000", Repository: "trace", Reference: "sha256:abcd"},
+		},
+		{
+			image:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := ParseReference(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabels(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:iovisor/trace:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:iovisor/trace:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/iovisor/trace/manifests/latest":
+			w.Header().Set("Content-Type", mediaTypeManifestList)
+			fmt.Fprint(w, `{"mediaType": "`+mediaTypeManifestList+`", "manifests": [
+				{"digest": "sha256:arm", "platform": {"architecture": "arm64", "os": "linux"}},
+				{"digest": "sha256:amd", "platform": {"architecture": "amd64", "os": "linux"}}]}`)
+		case "/v2/iovisor/trace/manifests/sha256:amd":
+			fmt.Fprint(w, `{"mediaType": "`+mediaTypeManifest+`", "config": {"digest": "sha256:config"}}`)
+		case "/v2/iovisor/trace/blobs/sha256:config":
+			fmt.Fprint(w, `{"config": {"Labels": {"org.iovisor.kubectl-trace.bpftrace-version": "v0.9.4"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(5 * time.Second)
+	c.Scheme = "http"
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	labels, err := c.Labels(host + "/iovisor/trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := labels["org.iovisor.kubectl-trace.bpftrace-version"]; got != "v0.9.4" {
+		t.Errorf("got bpftrace version %q, want v0.9.4", got)
+	}
+
+	if _, err := c.Labels(host + "/iovisor/trace:missing"); err == nil {
+		t.Errorf("expected an error for a missing image")
+	}
+}
@@ -0,0 +1,33 @@
+// Package telemetry lets programs embedding kubectl-trace collect metrics about the traces they run,
+// with the metrics library of their choice. Nothing is collected unless Metrics are set.
+package telemetry
+
+import "time"
+
+// Metrics receives the measurements, it must be safe for concurrent use.
+type Metrics interface {
+	// TraceCreated counts a trace created.
+	TraceCreated(namespace string)
+	// TraceCreateFailed counts a trace that could not be created.
+	TraceCreateFailed(namespace string)
+	// TraceFailed counts a trace whose job pod failed or could not start, as seen while attached to it.
+	TraceFailed(namespace string)
+	// AttachDuration observes how long an attach lasted, and whether it failed.
+	AttachDuration(namespace string, d time.Duration, failed bool)
+}
+
+// Nop discards the measurements.
+type Nop struct{}
+
+func (Nop) TraceCreated(namespace string)                                 {}
+func (Nop) TraceCreateFailed(namespace string)                            {}
+func (Nop) TraceFailed(namespace string)                                  {}
+func (Nop) AttachDuration(namespace string, d time.Duration, failed bool) {}
+
+// OrNop returns m, or Nop when m is nil.
+func OrNop(m Metrics) Metrics {
+	if m == nil {
+		return Nop{}
+	}
+	return m
+}
@@ -0,0 +1,286 @@
+package tracejob
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Target is what a trace job runs against: a node, or a container of a pod running on it.
+type Target struct {
+	// Hostname is the hostname label of the node.
+	Hostname string
+	// PodUID is the UID of the pod, empty when tracing the node.
+	PodUID string
+	// ContainerName is the container of the pod.
+	ContainerName string
+}
+
+// NodeTarget targets the node with the given hostname.
+func NodeTarget(hostname string) Target {
+	return Target{Hostname: hostname}
+}
+
+// PodTarget targets a container of a pod running on the node with the given hostname.
+func PodTarget(hostname, podUID, containerName string) Target {
+	return Target{Hostname: hostname, PodUID: podUID, ContainerName: containerName}
+}
+
+// Builder builds a TraceJob, validating the values as they are set.
+// The first invalid value makes Build fail, the values set after it are ignored.
+type Builder struct {
+	tj  TraceJob
+	err error
+}
+
+// New starts building a trace job with a new ID against the target.
+func New(target Target) *Builder {
+	id := uuid.NewUUID()
+	b := &Builder{
+		tj: TraceJob{
+			Name:           fmt.Sprintf("%s%s", meta.ObjectNamePrefix, string(id)),
+			ID:             id,
+			ServiceAccount: "default",
+			Hostname:       target.Hostname,
+			PodUID:         target.PodUID,
+			ContainerName:  target.ContainerName,
+			IsPod:          len(target.PodUID) > 0,
+			HostPID:        true,
+		},
+	}
+	if len(target.Hostname) == 0 {
+		b.err = fmt.Errorf("the node to run the trace on is required")
+	} else if b.tj.IsPod && len(target.ContainerName) == 0 {
+		b.err = fmt.Errorf("the container to trace is required when tracing a pod")
+	}
+	return b
+}
+
+func (b *Builder) check(ok bool, format string, a ...interface{}) *Builder {
+	if b.err == nil && !ok {
+		b.err = fmt.Errorf(format, a...)
+	}
+	return b
+}
+
+// WithNamespace sets the namespace the trace job is created in.
+func (b *Builder) WithNamespace(namespace string) *Builder {
+	b.tj.Namespace = namespace
+	return b.check(len(namespace) > 0, "the namespace cannot be empty")
+}
+
+// WithProgram sets the bpftrace program.
+func (b *Builder) WithProgram(program string) *Builder {
+	b.tj.Program = program
+	return b.check(len(program) > 0, "the bpftrace program cannot be empty")
+}
+
+// WithShell makes the trace runner wait for the programs run by kubectl trace shell instead of running one itself,
+// keeping the tracer ready with its headers.
+func (b *Builder) WithShell(shell bool) *Builder {
+	b.tj.Shell = shell
+	return b
+}
+
+// WithOnlyTarget restricts the probes of the program to the cgroup of the traced container, so that the probes
+// attached to the whole node only see its processes.
+func (b *Builder) WithOnlyTarget(onlyTarget bool) *Builder {
+	b.tj.OnlyTarget = onlyTarget
+	return b.check(!onlyTarget || b.tj.IsPod, "only the traces of a pod can be restricted to their target")
+}
+
+// MaxBinarySize is the size limit of the binaries run instead of bpftrace, they are shipped in a configmap.
+const MaxBinarySize = 1000 * 1024
+
+// WithBinary sets a statically linked binary, like a libbpf based tool, run by the tracerunner instead of bpftrace.
+func (b *Builder) WithBinary(binary []byte) *Builder {
+	b.tj.Binary = binary
+	b.check(len(binary) > 0, "the binary cannot be empty")
+	return b.check(len(binary) <= MaxBinarySize, "the binary cannot be larger than %d bytes, got %d", MaxBinarySize, len(binary))
+}
+
+// WithServiceAccount sets the service account of the trace job pod.
+func (b *Builder) WithServiceAccount(serviceAccount string) *Builder {
+	b.tj.ServiceAccount = serviceAccount
+	return b.check(len(serviceAccount) > 0, "the service account cannot be empty")
+}
+
+// WithImage sets the tracerunner image.
+func (b *Builder) WithImage(image string) *Builder {
+	b.tj.ImageNameTag = image
+	return b.check(len(image) > 0, "the tracerunner image cannot be empty")
+}
+
+// WithInitImage sets the image of the init container fetching the linux headers.
+func (b *Builder) WithInitImage(image string) *Builder {
+	b.tj.InitImageNameTag = image
+	return b.check(len(image) > 0, "the init image cannot be empty")
+}
+
+// WithFetchHeaders sets whether to fetch the linux headers.
+func (b *Builder) WithFetchHeaders(fetchHeaders bool) *Builder {
+	b.tj.FetchHeaders = fetchHeaders
+	return b
+}
+
+// WithDeadline sets the maximum time the trace runs, in seconds.
+func (b *Builder) WithDeadline(seconds int64) *Builder {
+	b.tj.Deadline = seconds
+	return b.check(seconds > 0, "the deadline must be positive, got %d", seconds)
+}
+
+// WithDeadlineGracePeriod sets the time left to print the maps after the deadline, in seconds.
+func (b *Builder) WithDeadlineGracePeriod(seconds int64) *Builder {
+	b.tj.DeadlineGracePeriod = seconds
+	return b.check(seconds >= 0, "the deadline grace period cannot be negative, got %d", seconds)
+}
+
+// WithExclusive sets whether to refuse to run when another exclusive trace runs on the same node.
+func (b *Builder) WithExclusive(exclusive bool) *Builder {
+	b.tj.Exclusive = exclusive
+	return b
+}
+
+// WithUnsafe sets whether to run bpftrace in unsafe mode, allowing actions like system() and signal().
+func (b *Builder) WithUnsafe(unsafe bool) *Builder {
+	b.tj.Unsafe = unsafe
+	return b
+}
+
+// WithTunables sets the limits of bpftrace.
+func (b *Builder) WithTunables(t Tunables) *Builder {
+	b.tj.Tunables = t
+	if err := t.validate(); err != nil {
+		return b.check(false, "%v", err)
+	}
+	return b
+}
+
+// BufferingModes are the output buffering modes of bpftrace.
+var BufferingModes = []string{"none", "line", "full"}
+
+// WithBuffering sets the output buffering mode of bpftrace, one of BufferingModes, its default when empty.
+func (b *Builder) WithBuffering(mode string) *Builder {
+	b.tj.Buffering = mode
+	valid := len(mode) == 0
+	for _, m := range BufferingModes {
+		valid = valid || mode == m
+	}
+	return b.check(valid, "the buffering mode must be one of %s, got %q", strings.Join(BufferingModes, ", "), mode)
+}
+
+// WithSnapshotInterval sets the interval at which bpftrace prints its maps, never when 0.
+func (b *Builder) WithSnapshotInterval(interval time.Duration) *Builder {
+	b.tj.SnapshotInterval = interval
+	return b.check(interval == 0 || interval >= time.Second, "the snapshot interval must be at least 1s, got %s", interval)
+}
+
+// WithTimeWindow restricts the trace to run between notBefore and notAfter, the trace runner waiting for the beginning
+// of the window and stopping the program at its end. Either of them is unset when zero.
+func (b *Builder) WithTimeWindow(notBefore, notAfter time.Time) *Builder {
+	b.tj.NotBefore = notBefore
+	b.tj.NotAfter = notAfter
+	b.check(notBefore.IsZero() || notAfter.IsZero() || notAfter.After(notBefore),
+		"the end of the time window must be after its beginning, got %s and %s", notBefore.Format(time.RFC3339), notAfter.Format(time.RFC3339))
+	return b.check(notAfter.IsZero() || notAfter.After(time.Now()), "the time window already ended at %s", notAfter.Format(time.RFC3339))
+}
+
+// WithMaxOutput sets the number of bytes of output of the program after which the trace runner drops the rest,
+// unlimited when 0.
+func (b *Builder) WithMaxOutput(bytes int64) *Builder {
+	b.tj.MaxOutput = bytes
+	return b.check(bytes >= 0, "the maximum output size cannot be negative, got %d", bytes)
+}
+
+// WithAvoidPods keeps the trace job off its node while pods matching the selector run there, in the namespaces or in
+// the namespace of the trace when there are none, as a pod anti-affinity.
+func (b *Builder) WithAvoidPods(selector *metav1.LabelSelector, namespaces []string) *Builder {
+	if selector == nil {
+		b.tj.AvoidPods = nil
+		return b
+	}
+	b.tj.AvoidPods = &apiv1.PodAffinityTerm{
+		LabelSelector: selector,
+		Namespaces:    namespaces,
+		TopologyKey:   "kubernetes.io/hostname",
+	}
+	return b
+}
+
+// WithRuntimeClass sets the runtime class of the trace job pod, the default one of the cluster when empty.
+// Host level tracing needs a runtime running the pod on the host, not in a sandbox.
+func (b *Builder) WithRuntimeClass(name string) *Builder {
+	b.tj.RuntimeClass = name
+	return b
+}
+
+// WithHostNamespaces sets whether the trace job pod runs in the PID and network namespaces of the host.
+// The host PID namespace is used by default, for the programs to see the processes of the host as they are,
+// the host network namespace is not.
+func (b *Builder) WithHostNamespaces(pid, network bool) *Builder {
+	b.tj.HostPID = pid
+	b.tj.HostNetwork = network
+	return b
+}
+
+// WithNameResolution adds the host aliases to /etc/hosts of the trace job pod and the DNS configuration to the one
+// of the cluster, for the endpoints only resolvable through internal DNS servers or fixed addresses.
+func (b *Builder) WithNameResolution(hostAliases []apiv1.HostAlias, dnsConfig *apiv1.PodDNSConfig) *Builder {
+	b.tj.HostAliases = hostAliases
+	b.tj.DNSConfig = dnsConfig
+	return b
+}
+
+// WithProxy sets the proxy the trace job pod reaches the network through, to fetch the linux headers.
+func (b *Builder) WithProxy(p Proxy) *Builder {
+	b.tj.Proxy = p
+	return b
+}
+
+// WithCABundle sets the bundle of CA certificates trusted by the trace job pod instead of the ones of its images,
+// the key of a configmap of the namespace of the trace, DefaultCABundleKey when empty. None when the configmap is empty.
+func (b *Builder) WithCABundle(configMap, key string) *Builder {
+	if len(configMap) > 0 && len(key) == 0 {
+		key = DefaultCABundleKey
+	}
+	b.tj.CABundle = CABundle{ConfigMap: configMap, Key: key}
+	return b
+}
+
+// WithTracerFlags sets flags appended verbatim to the bpftrace command line, split on white spaces.
+func (b *Builder) WithTracerFlags(flags string) *Builder {
+	b.tj.TracerFlags = flags
+	return b
+}
+
+// WithResources sets the compute resources of the tracerunner, nil for the defaults.
+func (b *Builder) WithResources(resources *apiv1.ResourceRequirements) *Builder {
+	b.tj.Resources = resources
+	return b
+}
+
+// Build returns the trace job, or the first invalid value found.
+func (b *Builder) Build() (TraceJob, error) {
+	if b.err != nil {
+		return TraceJob{}, b.err
+	}
+	b.check(len(b.tj.Namespace) > 0, "the namespace is required")
+	b.check(len(b.tj.Program) > 0 || len(b.tj.Binary) > 0 || b.tj.Shell, "the bpftrace program is required")
+	b.check(!b.tj.Shell || (len(b.tj.Program) == 0 && len(b.tj.Binary) == 0), "a shell trace runs the programs it is given, not one of its own")
+	b.check(len(b.tj.Program) == 0 || len(b.tj.Binary) == 0, "a trace runs either a bpftrace program or a binary, not both")
+	b.check(len(b.tj.Binary) == 0 || (!b.tj.Unsafe && len(b.tj.Buffering) == 0 && b.tj.SnapshotInterval == 0 && !b.tj.OnlyTarget),
+		"the unsafe mode, the buffering mode, the snapshot interval and the restriction to the target only apply to bpftrace programs")
+	b.check(b.tj.HostPID || !b.tj.IsPod, "tracing a pod needs the host PID namespace, to find the processes of its container")
+	b.check(len(b.tj.ImageNameTag) > 0, "the tracerunner image is required")
+	b.check(!b.tj.FetchHeaders || len(b.tj.InitImageNameTag) > 0, "the init image is required to fetch the linux headers")
+	b.check(b.tj.Deadline > 0, "the deadline is required")
+	if b.err != nil {
+		return TraceJob{}, b.err
+	}
+	return b.tj, nil
+}
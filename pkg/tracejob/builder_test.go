@@ -0,0 +1,191 @@
+package tracejob
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+		wantErr string
+	}{
+		{
+			name: "node trace",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+		},
+		{
+			name:    "pod without container",
+			builder: New(PodTarget("node-1", "uid", "")),
+			wantErr: "the container to trace is required",
+		},
+		{
+			name: "first invalid value wins",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("").
+				WithDeadline(-1),
+			wantErr: "the bpftrace program cannot be empty",
+		},
+		{
+			name: "missing values",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithDeadline(60),
+			wantErr: "the tracerunner image is required",
+		},
+		{
+			name: "headers without init image",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60).
+				WithFetchHeaders(true),
+			wantErr: "the init image is required",
+		},
+		{
+			name: "binary",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithBinary([]byte("\x7fELF")).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+		},
+		{
+			name: "binary and program",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithBinary([]byte("\x7fELF")).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+			wantErr: "either a bpftrace program or a binary",
+		},
+		{
+			name: "binary too large",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithBinary(make([]byte, MaxBinarySize+1)),
+			wantErr: "the binary cannot be larger than",
+		},
+		{
+			name: "snapshot interval too short",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithSnapshotInterval(100 * time.Millisecond),
+			wantErr: "the snapshot interval must be at least 1s",
+		},
+		{
+			name: "shell",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithShell(true).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+		},
+		{
+			name: "shell with a program",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithShell(true).
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+			wantErr: "a shell trace runs the programs it is given",
+		},
+		{
+			name: "only target",
+			builder: New(PodTarget("node-1", "6d2b4f0e", "nginx")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithOnlyTarget(true).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+		},
+		{
+			name: "only target on a node",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithOnlyTarget(true),
+			wantErr: "only the traces of a pod can be restricted",
+		},
+		{
+			name: "node without host namespaces",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithHostNamespaces(false, false).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+		},
+		{
+			name: "pod without the host PID namespace",
+			builder: New(PodTarget("node-1", "6d2b4f0e", "nginx")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithHostNamespaces(false, true).
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60),
+			wantErr: "tracing a pod needs the host PID namespace",
+		},
+		{
+			name: "time window",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60).
+				WithTimeWindow(time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)),
+		},
+		{
+			name: "time window ending before it begins",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithTimeWindow(time.Now().Add(2*time.Hour), time.Now().Add(time.Hour)),
+			wantErr: "the end of the time window must be after its beginning",
+		},
+		{
+			name: "time window ended",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithTimeWindow(time.Time{}, time.Now().Add(-time.Hour)),
+			wantErr: "the time window already ended",
+		},
+		{
+			name: "invalid buffering mode",
+			builder: New(NodeTarget("node-1")).
+				WithNamespace("default").
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+				WithDeadline(60).
+				WithBuffering("block"),
+			wantErr: "the buffering mode must be one of none, line, full",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tj, err := tt.builder.Build()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(tj.ID) == 0 || !strings.HasSuffix(tj.Name, string(tj.ID)) || tj.ServiceAccount != "default" {
+					t.Errorf("unexpected trace job %+v", tj)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
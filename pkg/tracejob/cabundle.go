@@ -0,0 +1,59 @@
+package tracejob
+
+import (
+	"path"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultCABundleKey is the key of the bundle in its configmap when none is given, the one of the kube-root-ca.crt
+	// configmaps and of the bundles of trust-manager.
+	DefaultCABundleKey = "ca.crt"
+
+	caBundleVolume = "ca-bundle"
+	caBundleDir    = "/etc/kubectl-trace/ca"
+)
+
+// CABundle is a bundle of PEM CA certificates, the key of a configmap of the namespace of the trace, trusted by the
+// init container and the trace runner instead of the CA certificates of their images.
+type CABundle struct {
+	ConfigMap string
+	Key       string
+}
+
+// addTo mounts the bundle in the containers of the pod and points the TLS clients of Go and curl to it.
+func (b CABundle) addTo(spec *apiv1.PodSpec) {
+	spec.Volumes = append(spec.Volumes, apiv1.Volume{
+		Name: caBundleVolume,
+		VolumeSource: apiv1.VolumeSource{
+			ConfigMap: &apiv1.ConfigMapVolumeSource{
+				LocalObjectReference: apiv1.LocalObjectReference{Name: b.ConfigMap},
+				Items:                []apiv1.KeyToPath{{Key: b.Key, Path: b.Key}},
+			},
+		},
+	})
+	file := path.Join(caBundleDir, b.Key)
+	add := func(c *apiv1.Container) {
+		c.VolumeMounts = append(c.VolumeMounts, apiv1.VolumeMount{Name: caBundleVolume, MountPath: caBundleDir, ReadOnly: true})
+		c.Env = append(c.Env,
+			apiv1.EnvVar{Name: "SSL_CERT_FILE", Value: file},
+			apiv1.EnvVar{Name: "CURL_CA_BUNDLE", Value: file})
+	}
+	for i := range spec.InitContainers {
+		add(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		add(&spec.Containers[i])
+	}
+}
+
+// caBundleFrom reads back the bundle mounted by addTo, unset when there is none.
+func caBundleFrom(spec apiv1.PodSpec) CABundle {
+	for _, v := range spec.Volumes {
+		if v.Name == caBundleVolume && v.ConfigMap != nil && len(v.ConfigMap.Items) > 0 {
+			return CABundle{ConfigMap: v.ConfigMap.Name, Key: v.ConfigMap.Items[0].Key}
+		}
+	}
+	return CABundle{}
+}
@@ -0,0 +1,41 @@
+package tracejob
+
+import (
+	"testing"
+)
+
+func TestCABundle(t *testing.T) {
+	tj, err := New(NodeTarget("node-1")).
+		WithNamespace("default").
+		WithProgram("kprobe:do_sys_open { @ = count(); }").
+		WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+		WithFetchHeaders(true).
+		WithInitImage("quay.io/iovisor/kubectl-trace-init:latest").
+		WithDeadline(60).
+		WithCABundle("corp-ca", "bundle.pem").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, job, err := tj.manifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		mounted := false
+		for _, m := range c.VolumeMounts {
+			mounted = mounted || (m.Name == caBundleVolume && m.MountPath == caBundleDir)
+		}
+		env := map[string]string{}
+		for _, v := range c.Env {
+			env[v.Name] = v.Value
+		}
+		if !mounted || env["SSL_CERT_FILE"] != "/etc/kubectl-trace/ca/bundle.pem" || env["CURL_CA_BUNDLE"] != "/etc/kubectl-trace/ca/bundle.pem" {
+			t.Errorf("container %s does not trust the bundle, mounts %v, env %v", c.Name, c.VolumeMounts, c.Env)
+		}
+	}
+	if got := caBundleFrom(spec); got != (CABundle{ConfigMap: "corp-ca", Key: "bundle.pem"}) {
+		t.Errorf("caBundleFrom() = %+v", got)
+	}
+}
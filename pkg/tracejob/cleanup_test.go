@@ -0,0 +1,208 @@
+package tracejob_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	"github.com/iovisor/kubectl-trace/pkg/tracetest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// traceMeta is the metadata of an object of the trace with the ID, created at the time.
+func traceMeta(namespace, id string, created time.Time) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              meta.ObjectNamePrefix + id,
+		Namespace:         namespace,
+		Labels:            map[string]string{meta.TraceIDLabelKey: id},
+		CreationTimestamp: metav1.NewTime(created),
+	}
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Minute)
+	job := func(namespace, id string, created time.Time) runtime.Object {
+		return &batchv1.Job{ObjectMeta: traceMeta(namespace, id, created)}
+	}
+	configMap := func(namespace, id string) runtime.Object {
+		return &corev1.ConfigMap{ObjectMeta: traceMeta(namespace, id, old)}
+	}
+	pod := func(namespace, id string) runtime.Object {
+		m := traceMeta(namespace, id, old)
+		m.Name += "-x7k2p"
+		return &corev1.Pod{ObjectMeta: m}
+	}
+
+	tests := []struct {
+		name           string
+		namespace      string
+		objects        []runtime.Object
+		wantJobs       []string
+		wantConfigMaps []string
+		wantPods       []string
+	}{
+		{
+			name:           "complete trace",
+			namespace:      "default",
+			objects:        []runtime.Object{job("default", "1", old), configMap("default", "1"), pod("default", "1")},
+			wantJobs:       []string{"default/kubectl-trace-1"},
+			wantConfigMaps: []string{"default/kubectl-trace-1"},
+			wantPods:       []string{"default/kubectl-trace-1-x7k2p"},
+		},
+		{
+			name:      "job without configmap older than the grace period",
+			namespace: "default",
+			objects:   []runtime.Object{job("default", "1", old), pod("default", "1")},
+			wantPods:  []string{"default/kubectl-trace-1-x7k2p"},
+		},
+		{
+			name:      "job without configmap within the grace period",
+			namespace: "default",
+			objects:   []runtime.Object{job("default", "1", now)},
+			wantJobs:  []string{"default/kubectl-trace-1"},
+		},
+		{
+			name:      "configmap and pod without job",
+			namespace: "default",
+			objects:   []runtime.Object{configMap("default", "1"), pod("default", "1")},
+		},
+		{
+			name:           "objects of another namespace",
+			namespace:      "default",
+			objects:        []runtime.Object{configMap("tracing", "1"), pod("tracing", "1")},
+			wantConfigMaps: []string{"tracing/kubectl-trace-1"},
+			wantPods:       []string{"tracing/kubectl-trace-1-x7k2p"},
+		},
+		{
+			name:      "trace split across namespaces",
+			namespace: metav1.NamespaceAll,
+			objects:   []runtime.Object{job("default", "1", old), configMap("tracing", "1"), pod("tracing", "1")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tracetest.NewAPIServer()
+			defer s.Close()
+			if err := s.Add(tt.objects...); err != nil {
+				t.Fatal(err)
+			}
+			batch, err := batchv1client.NewForConfig(s.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			core, err := corev1client.NewForConfig(s.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc := &tracejob.TraceJobClient{
+				JobClient:    batch.Jobs(tt.namespace),
+				ConfigClient: core.ConfigMaps(tt.namespace),
+				PodClient:    core.Pods(tt.namespace),
+				// Deleting the objects of the traces spanning all the namespaces needs the cluster clients.
+				ClusterJobClient:    batch,
+				ClusterConfigClient: core,
+				ClusterPodClient:    core,
+			}
+			tc.WithOutStream(&bytes.Buffer{})
+
+			if err := tc.CleanupOrphans(context.Background()); err != nil {
+				t.Fatalf("CleanupOrphans() error = %v", err)
+			}
+			for _, r := range []struct {
+				resource string
+				want     []string
+			}{
+				{"jobs", tt.wantJobs},
+				{"configmaps", tt.wantConfigMaps},
+				{"pods", tt.wantPods},
+			} {
+				want := r.want
+				if want == nil {
+					want = []string{}
+				}
+				if got := s.Names(r.resource); !reflect.DeepEqual(got, want) {
+					t.Errorf("CleanupOrphans() left %s %v, want %v", r.resource, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanupOrphansTraceCreatedBetweenLists(t *testing.T) {
+	old := time.Now().Add(-2 * time.Minute)
+	tests := []struct {
+		name    string
+		created time.Time
+	}{
+		// The configmap and pod are too young to be orphans.
+		{name: "new trace", created: time.Now()},
+		// The job is found when looked up again before deleting them.
+		{name: "trace with an old timestamp", created: old},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tracetest.NewAPIServer()
+			defer s.Close()
+			created := false
+			// The trace is created once the jobs are listed, before its configmap and pod are.
+			s.BeforeRequest = func(r *http.Request) {
+				if created || r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/configmaps") {
+					return
+				}
+				created = true
+				pod := &corev1.Pod{ObjectMeta: traceMeta("default", "1", tt.created)}
+				pod.Name += "-x7k2p"
+				err := s.Add(
+					&batchv1.Job{ObjectMeta: traceMeta("default", "1", tt.created)},
+					&corev1.ConfigMap{ObjectMeta: traceMeta("default", "1", tt.created)},
+					pod,
+				)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+			batch, err := batchv1client.NewForConfig(s.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			core, err := corev1client.NewForConfig(s.Config())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc := &tracejob.TraceJobClient{
+				JobClient:    batch.Jobs("default"),
+				ConfigClient: core.ConfigMaps("default"),
+				PodClient:    core.Pods("default"),
+			}
+			tc.WithOutStream(&bytes.Buffer{})
+
+			if err := tc.CleanupOrphans(context.Background()); err != nil {
+				t.Fatalf("CleanupOrphans() error = %v", err)
+			}
+			if !created {
+				t.Fatal("the trace was not created between the lists")
+			}
+			for resource, want := range map[string][]string{
+				"jobs":       {"default/kubectl-trace-1"},
+				"configmaps": {"default/kubectl-trace-1"},
+				"pods":       {"default/kubectl-trace-1-x7k2p"},
+			} {
+				if got := s.Names(resource); !reflect.DeepEqual(got, want) {
+					t.Errorf("CleanupOrphans() left %s %v, want %v", resource, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package tracejob
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// DryRunModes are the values of --dry-run: none creates the trace, client prints its manifests, server submits them
+// with the server side dry-run.
+var DryRunModes = []string{"none", "client", "server"}
+
+// Manifests returns the configmap and the job that creating the trace job would create, with their kind and API
+// version so that they can be printed and applied as they are.
+func Manifests(nj TraceJob) (*apiv1.ConfigMap, *batchv1.Job, error) {
+	cm, job, err := nj.manifests()
+	if err != nil {
+		return nil, nil, err
+	}
+	cm.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+	job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+	return cm, job, nil
+}
+
+// DryRun submits the configmap and the job of the trace job with the server side dry-run, through the REST clients of
+// the batch and core APIs, so that they are validated and go through the admission webhooks without being created.
+// It returns them as the server would have created them.
+// The limits, the quotas and the node lock are not checked, the quotas are by the admission.
+func DryRun(batch, core rest.Interface, nj TraceJob) (*apiv1.ConfigMap, *batchv1.Job, error) {
+	cm, job, err := Manifests(nj)
+	if err != nil {
+		return nil, nil, err
+	}
+	dj := &batchv1.Job{}
+	err = batch.Post().
+		Namespace(nj.Namespace).
+		Resource("jobs").
+		Param("dryRun", metav1.DryRunAll).
+		Body(job).
+		Do().
+		Into(dj)
+	if err != nil {
+		return nil, nil, err
+	}
+	dcm := &apiv1.ConfigMap{}
+	err = core.Post().
+		Namespace(nj.Namespace).
+		Resource("configmaps").
+		Param("dryRun", metav1.DryRunAll).
+		Body(cm).
+		Do().
+		Into(dcm)
+	if err != nil {
+		return nil, nil, err
+	}
+	dcm.TypeMeta, dj.TypeMeta = cm.TypeMeta, job.TypeMeta
+	return dcm, dj, nil
+}
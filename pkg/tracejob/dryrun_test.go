@@ -0,0 +1,96 @@
+package tracejob
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+func dryRunJob(t *testing.T) TraceJob {
+	tj, err := New(NodeTarget("node-1")).
+		WithNamespace("default").
+		WithProgram("kprobe:do_sys_open { @ = count(); }").
+		WithImage("quay.io/iovisor/kubectl-trace-bpftrace:latest").
+		WithDeadline(60).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tj
+}
+
+func TestManifests(t *testing.T) {
+	tj := dryRunJob(t)
+	cm, job, err := Manifests(tj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Kind != "ConfigMap" || cm.APIVersion != "v1" || job.Kind != "Job" || job.APIVersion != "batch/v1" {
+		t.Errorf("got kinds %s %s and %s %s", cm.APIVersion, cm.Kind, job.APIVersion, job.Kind)
+	}
+	if cm.Name != tj.Name || job.Name != tj.Name || job.Namespace != "default" {
+		t.Errorf("got configmap %s and job %s/%s, want %s", cm.Name, job.Namespace, job.Name, tj.Name)
+	}
+	if cm.Data["program.bt"] != tj.Program {
+		t.Errorf("got program %q, want %q", cm.Data["program.bt"], tj.Program)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		mu.Unlock()
+		// The server answers with what it would have created.
+		body, _ := ioutil.ReadAll(r.Body)
+		var obj map[string]interface{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			t.Error(err)
+		}
+		obj["metadata"].(map[string]interface{})["uid"] = "dry-run-uid"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(obj)
+	}))
+	defer srv.Close()
+
+	config := &rest.Config{Host: srv.URL}
+	batch, err := batchv1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, err := corev1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tj := dryRunJob(t)
+	cm, job, err := DryRun(batch.RESTClient(), core.RESTClient(), tj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.UID != "dry-run-uid" || cm.UID != "dry-run-uid" || job.Kind != "Job" || cm.Kind != "ConfigMap" {
+		t.Errorf("got job %s %s and configmap %s %s", job.Kind, job.UID, cm.Kind, cm.UID)
+	}
+	want := []string{
+		"POST /apis/batch/v1/namespaces/default/jobs?dryRun=All",
+		"POST /api/v1/namespaces/default/configmaps?dryRun=All",
+	}
+	if len(requests) != len(want) {
+		t.Fatalf("got requests %v, want %v", requests, want)
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("got request %q, want %q", requests[i], want[i])
+		}
+	}
+}
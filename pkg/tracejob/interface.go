@@ -0,0 +1,18 @@
+package tracejob
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// Interface manages the trace jobs of a namespace, it is implemented by TraceJobClient
+// and by the fake of the tracetest package.
+type Interface interface {
+	CreateJob(ctx context.Context, nj TraceJob) (*batchv1.Job, error)
+	GetJob(ctx context.Context, nf TraceJobFilter) ([]TraceJob, error)
+	DeleteJobs(ctx context.Context, nf TraceJobFilter) error
+	CleanupOrphans(ctx context.Context) error
+}
+
+var _ Interface = &TraceJobClient{}
@@ -1,25 +1,58 @@
 package tracejob
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strconv"
+	"time"
 
+	"github.com/iovisor/kubectl-trace/pkg/diagnostics"
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	"github.com/iovisor/kubectl-trace/pkg/logging"
 	"github.com/iovisor/kubectl-trace/pkg/meta"
+	"github.com/iovisor/kubectl-trace/pkg/telemetry"
 	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	batchv1typed "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1typed "k8s.io/client-go/kubernetes/typed/coordination/v1"
 	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog"
 )
 
+// orphanGracePeriod is how old a job must be before a missing configmap makes it an orphan, and a configmap or pod
+// before a missing job does.
+const orphanGracePeriod = time.Minute
+
 type TraceJobClient struct {
 	JobClient    batchv1typed.JobInterface
 	ConfigClient corev1typed.ConfigMapInterface
-	outStream    io.Writer
+	PodClient    corev1typed.PodInterface
+	// LeaseClient locks the nodes of the exclusive traces, in LockNamespace.
+	LeaseClient coordinationv1typed.LeasesGetter
+	// LockNamespace is the namespace of the leases locking the nodes, DefaultLockNamespace when empty.
+	LockNamespace string
+	// ClusterJobClient finds the trace jobs of any namespace: those holding the node locks, to take over the locks
+	// of the ones that are gone, and those counted against the limits. Without it, the locks are only taken over
+	// once they expired, and the limits are not checked.
+	ClusterJobClient batchv1typed.JobsGetter
+	// ClusterConfigClient reads the limits of the traces of the cluster, in LimitsNamespace. The limits are not
+	// checked without it.
+	ClusterConfigClient corev1typed.ConfigMapsGetter
+	// ClusterPodClient, with ClusterJobClient and ClusterConfigClient, deletes the orphan objects in their own
+	// namespace, needed when the other clients list the objects of all the namespaces.
+	ClusterPodClient corev1typed.PodsGetter
+	// QuotaClient checks the traces against the resource quotas of their namespace before creating them, when set.
+	QuotaClient corev1typed.ResourceQuotaInterface
+	// Metrics counts the traces created and the ones that could not be, when set.
+	Metrics   telemetry.Metrics
+	outStream io.Writer
 }
 
 // TraceJob is a container of info needed to create the job responsible for tracing.
@@ -30,6 +63,7 @@ type TraceJob struct {
 	ServiceAccount      string
 	Hostname            string
 	Program             string
+	Binary              []byte
 	PodUID              string
 	ContainerName       string
 	IsPod               bool
@@ -38,8 +72,43 @@ type TraceJob struct {
 	FetchHeaders        bool
 	Deadline            int64
 	DeadlineGracePeriod int64
-	StartTime           *metav1.Time
-	Status              TraceJobStatus
+	Exclusive           bool
+	Unsafe              bool
+	Tunables            Tunables
+	Buffering           string
+	TracerFlags         string
+	SnapshotInterval    time.Duration
+	// Shell keeps the trace runner waiting for the programs run by kubectl trace shell.
+	Shell bool
+	// OnlyTarget restricts the probes of the program to the cgroup of the traced container.
+	OnlyTarget bool
+	// NotBefore and NotAfter bound the time window the program runs in, unset when zero.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// MaxOutput is the number of bytes of output of the program after which the rest is dropped, unlimited when 0.
+	MaxOutput int64
+	// AvoidPods keeps the trace job off its node while the pods it selects run there, unset when nil.
+	AvoidPods *apiv1.PodAffinityTerm
+	// RuntimeClass is the runtime class of the trace job pod, the default one of the cluster when empty.
+	RuntimeClass string
+	// HostPID and HostNetwork run the trace job pod in the PID and network namespaces of the host.
+	HostPID     bool
+	HostNetwork bool
+	// HostAliases and DNSConfig are the additions to the name resolution of the trace job pod.
+	HostAliases []apiv1.HostAlias
+	DNSConfig   *apiv1.PodDNSConfig
+	// Proxy is the proxy the pod reaches the network through, none when unset.
+	Proxy Proxy
+	// CABundle is the bundle of CA certificates trusted by the pod instead of the ones of its images, unset when its
+	// configmap is empty.
+	CABundle  CABundle
+	Resources *apiv1.ResourceRequirements
+	StartTime *metav1.Time
+	Status    TraceJobStatus
+	// Phase is the phase reported by the trace runner, empty when it did not report one.
+	Phase string
+	// Reason explains the status of the trace, like why it is pending or why it failed.
+	Reason string
 }
 
 // WithOutStream setup a file stream to output trace job operation information
@@ -79,7 +148,10 @@ func (nf TraceJobFilter) selectorOptions() metav1.ListOptions {
 	return selectorOptions
 }
 
-func (t *TraceJobClient) findJobsWithFilter(nf TraceJobFilter) ([]batchv1.Job, error) {
+func (t *TraceJobClient) findJobsWithFilter(ctx context.Context, nf TraceJobFilter) ([]batchv1.Job, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	selectorOptions := nf.selectorOptions()
 	if len(selectorOptions.LabelSelector) == 0 {
@@ -94,7 +166,10 @@ func (t *TraceJobClient) findJobsWithFilter(nf TraceJobFilter) ([]batchv1.Job, e
 	return jl.Items, nil
 }
 
-func (t *TraceJobClient) findConfigMapsWithFilter(nf TraceJobFilter) ([]apiv1.ConfigMap, error) {
+func (t *TraceJobClient) findConfigMapsWithFilter(ctx context.Context, nf TraceJobFilter) ([]apiv1.ConfigMap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	selectorOptions := nf.selectorOptions()
 	if len(selectorOptions.LabelSelector) == 0 {
 		return []apiv1.ConfigMap{}, nil
@@ -108,8 +183,13 @@ func (t *TraceJobClient) findConfigMapsWithFilter(nf TraceJobFilter) ([]apiv1.Co
 	return cm.Items, nil
 }
 
-func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
-	jl, err := t.findJobsWithFilter(nf)
+// GetJob returns the trace jobs matching the filter.
+func (t *TraceJobClient) GetJob(ctx context.Context, nf TraceJobFilter) ([]TraceJob, error) {
+	jl, err := t.findJobsWithFilter(ctx, nf)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := t.findPods(ctx, nf)
 	if err != nil {
 		return nil, err
 	}
@@ -136,6 +216,13 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 			Hostname:  hostname,
 			StartTime: j.Status.StartTime,
 			Status:    jobStatus(j),
+			Reason:    jobReason(j),
+		}
+		if pod, ok := pods[traceKey(j.ObjectMeta)]; ok {
+			tj.Phase = pod.Annotations[meta.TracePhaseAnnotationKey]
+			if reason := diagnostics.Reason(pod); len(reason) > 0 {
+				tj.Reason = reason
+			}
 		}
 		tjobs = append(tjobs, tj)
 	}
@@ -143,15 +230,55 @@ func (t *TraceJobClient) GetJob(nf TraceJobFilter) ([]TraceJob, error) {
 	return tjobs, nil
 }
 
-func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
+// findPods returns the last created pod of each trace matching the filter, by trace key.
+// It returns none when the client has no pod client.
+func (t *TraceJobClient) findPods(ctx context.Context, nf TraceJobFilter) (map[string]*apiv1.Pod, error) {
+	pods := map[string]*apiv1.Pod{}
+	if t.PodClient == nil {
+		return pods, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pl, err := t.PodClient.List(nf.selectorOptions())
+	if err != nil {
+		return nil, err
+	}
+	for i := range pl.Items {
+		p := &pl.Items[i]
+		k := traceKey(p.ObjectMeta)
+		if last, ok := pods[k]; !ok || last.CreationTimestamp.Before(&p.CreationTimestamp) {
+			pods[k] = p
+		}
+	}
+	return pods, nil
+}
+
+// jobReason explains why the job failed, from its conditions. It is empty when the deadline was exceeded,
+// the status of the job tells it already.
+func jobReason(j batchv1.Job) string {
+	for _, c := range j.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == apiv1.ConditionTrue && c.Reason != jobDeadlineExceededReason {
+			return "Failed: " + c.Reason
+		}
+	}
+	return ""
+}
+
+// DeleteJobs deletes the trace jobs matching the filter and their configurations.
+// When ctx is done it stops before the next deletion.
+func (t *TraceJobClient) DeleteJobs(ctx context.Context, nf TraceJobFilter) error {
 	nothingDeleted := true
-	jl, err := t.findJobsWithFilter(nf)
+	jl, err := t.findJobsWithFilter(ctx, nf)
 	if err != nil {
 		return err
 	}
 
 	dp := metav1.DeletePropagationForeground
 	for _, j := range jl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := t.JobClient.Delete(j.Name, &metav1.DeleteOptions{
 			GracePeriodSeconds: int64Ptr(0),
 			PropagationPolicy:  &dp,
@@ -163,13 +290,16 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 		nothingDeleted = false
 	}
 
-	cl, err := t.findConfigMapsWithFilter(nf)
+	cl, err := t.findConfigMapsWithFilter(ctx, nf)
 
 	if err != nil {
 		return err
 	}
 
 	for _, c := range cl {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := t.ConfigClient.Delete(c.Name, nil)
 		if err != nil {
 			return err
@@ -184,16 +314,174 @@ func (t *TraceJobClient) DeleteJobs(nf TraceJobFilter) error {
 	return nil
 }
 
-func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
+// CleanupOrphans removes the objects left behind by traces that no longer have all their parts:
+// configmaps and pods whose job is gone, and jobs whose program configmap is gone.
+// Objects younger than orphanGracePeriod are never considered orphans, because the other parts of their trace
+// may still be in the process of being created, and the job of a configmap or pod is looked up again right before
+// deleting it, in case it was created after the jobs were listed.
+func (t *TraceJobClient) CleanupOrphans(ctx context.Context) error {
+	nf := TraceJobFilter{}
+
+	jl, err := t.findJobsWithFilter(ctx, nf)
+	if err != nil {
+		return err
+	}
+	cl, err := t.findConfigMapsWithFilter(ctx, nf)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pl, err := t.PodClient.List(nf.selectorOptions())
+	if err != nil {
+		return err
+	}
+
+	jobs := map[string]bool{}
+	for _, j := range jl {
+		jobs[traceKey(j.ObjectMeta)] = true
+	}
+	configs := map[string]bool{}
+	for _, c := range cl {
+		configs[traceKey(c.ObjectMeta)] = true
+	}
+
+	reclaimed := 0
+	dp := metav1.DeletePropagationForeground
+	for _, j := range jl {
+		if configs[traceKey(j.ObjectMeta)] || time.Since(j.CreationTimestamp.Time) < orphanGracePeriod {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := t.jobClientOf(j.Namespace).Delete(j.Name, &metav1.DeleteOptions{
+			GracePeriodSeconds: int64Ptr(0),
+			PropagationPolicy:  &dp,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		fmt.Fprintf(t.outStream, "orphan trace job %s deleted\n", j.Name)
+		reclaimed++
+	}
+
+	for _, c := range cl {
+		if jobs[traceKey(c.ObjectMeta)] || time.Since(c.CreationTimestamp.Time) < orphanGracePeriod {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		exists, err := t.jobExists(c.ObjectMeta)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		configClient := t.ConfigClient
+		if t.ClusterConfigClient != nil {
+			configClient = t.ClusterConfigClient.ConfigMaps(c.Namespace)
+		}
+		if err := configClient.Delete(c.Name, nil); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		fmt.Fprintf(t.outStream, "orphan trace configuration %s deleted\n", c.Name)
+		reclaimed++
+	}
+
+	for _, p := range pl.Items {
+		if jobs[traceKey(p.ObjectMeta)] || time.Since(p.CreationTimestamp.Time) < orphanGracePeriod {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		exists, err := t.jobExists(p.ObjectMeta)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		podClient := t.PodClient
+		if t.ClusterPodClient != nil {
+			podClient = t.ClusterPodClient.Pods(p.Namespace)
+		}
+		err = podClient.Delete(p.Name, &metav1.DeleteOptions{
+			GracePeriodSeconds: int64Ptr(0),
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		fmt.Fprintf(t.outStream, "orphan trace pod %s deleted\n", p.Name)
+		reclaimed++
+	}
+
+	fmt.Fprintf(t.outStream, "%d orphan objects reclaimed\n", reclaimed)
+	return nil
+}
+
+// jobClientOf returns the client of the jobs of the namespace, the cluster one when set.
+func (t *TraceJobClient) jobClientOf(namespace string) batchv1typed.JobInterface {
+	if t.ClusterJobClient != nil {
+		return t.ClusterJobClient.Jobs(namespace)
+	}
+	return t.JobClient
+}
+
+// jobExists tells whether the job of the trace of the object exists in its namespace.
+func (t *TraceJobClient) jobExists(om metav1.ObjectMeta) (bool, error) {
+	jl, err := t.jobClientOf(om.Namespace).List(metav1.ListOptions{
+		LabelSelector: meta.TraceIDLabelKey + "=" + om.Labels[meta.TraceIDLabelKey],
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(jl.Items) > 0, nil
+}
+
+// traceKey identifies the trace an object belongs to across namespaces.
+func traceKey(om metav1.ObjectMeta) string {
+	return om.Namespace + "/" + om.Labels[meta.TraceIDLabelKey]
+}
+
+// CreateJob creates the trace job, its configuration and, for exclusive traces, the lock of the node.
+// When ctx is done before all of them are created, the ones already created are removed.
+// Requests in flight are not interrupted, ctx is checked between them.
+// The errors are classified as errdefs.ErrJobCreateFailed.
+func (t *TraceJobClient) CreateJob(ctx context.Context, nj TraceJob) (*batchv1.Job, error) {
+	j, err := t.createJob(ctx, nj)
+	if err != nil {
+		telemetry.OrNop(t.Metrics).TraceCreateFailed(nj.Namespace)
+		return nil, errdefs.Wrap(errdefs.ErrJobCreateFailed, err)
+	}
+	telemetry.OrNop(t.Metrics).TraceCreated(nj.Namespace)
+	return j, nil
+}
+
+// manifests returns the configmap holding the program of the trace job and the job running it.
+func (nj TraceJob) manifests() (*apiv1.ConfigMap, *batchv1.Job, error) {
+	deadline := nj.runDeadline(time.Now())
+	if deadline <= 0 {
+		return nil, nil, fmt.Errorf("the time window of the trace ended at %s", nj.NotAfter.Format(time.RFC3339))
+	}
 
 	bpfTraceCmd := []string{
 		"/bin/timeout",
 		"--preserve-status",
 		"--signal",
 		"INT",
-		strconv.FormatInt(nj.Deadline, 10),
+		strconv.FormatInt(deadline, 10),
 		"/bin/trace-runner",
-		"--program=/programs/program.bt",
+	}
+
+	if len(nj.Binary) > 0 {
+		bpfTraceCmd = append(bpfTraceCmd, "--binary=/programs/program")
+	} else {
+		bpfTraceCmd = append(bpfTraceCmd, "--program=/programs/program.bt")
 	}
 
 	if nj.IsPod {
@@ -202,6 +490,69 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 		bpfTraceCmd = append(bpfTraceCmd, "--poduid="+nj.PodUID)
 	}
 
+	if nj.Unsafe {
+		bpfTraceCmd = append(bpfTraceCmd, "--unsafe")
+	}
+
+	if len(nj.Buffering) > 0 {
+		bpfTraceCmd = append(bpfTraceCmd, "--buffering="+nj.Buffering)
+	}
+
+	if nj.SnapshotInterval > 0 {
+		bpfTraceCmd = append(bpfTraceCmd, "--snapshot-interval="+nj.SnapshotInterval.String())
+	}
+
+	if len(nj.TracerFlags) > 0 {
+		bpfTraceCmd = append(bpfTraceCmd, "--tracer-flags="+nj.TracerFlags)
+	}
+
+	if nj.Shell {
+		bpfTraceCmd = append(bpfTraceCmd, "--shell")
+	}
+
+	if nj.OnlyTarget {
+		bpfTraceCmd = append(bpfTraceCmd, "--only-target")
+	}
+
+	if !nj.NotBefore.IsZero() {
+		bpfTraceCmd = append(bpfTraceCmd, "--not-before="+nj.NotBefore.UTC().Format(time.RFC3339))
+	}
+
+	if !nj.NotAfter.IsZero() {
+		bpfTraceCmd = append(bpfTraceCmd, "--not-after="+nj.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	if nj.MaxOutput > 0 {
+		bpfTraceCmd = append(bpfTraceCmd, "--max-output="+strconv.FormatInt(nj.MaxOutput, 10))
+	}
+
+	affinity := &apiv1.Affinity{
+		NodeAffinity: &apiv1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+				NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+					apiv1.NodeSelectorTerm{
+						MatchExpressions: []apiv1.NodeSelectorRequirement{
+							apiv1.NodeSelectorRequirement{
+								Key:      "kubernetes.io/hostname",
+								Operator: apiv1.NodeSelectorOpIn,
+								Values:   []string{nj.Hostname},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	var runtimeClass *string
+	if len(nj.RuntimeClass) > 0 {
+		runtimeClass = &nj.RuntimeClass
+	}
+	if nj.AvoidPods != nil {
+		affinity.PodAntiAffinity = &apiv1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []apiv1.PodAffinityTerm{*nj.AvoidPods},
+		}
+	}
+
 	commonMeta := metav1.ObjectMeta{
 		Name:      nj.Name,
 		Namespace: nj.Namespace,
@@ -210,8 +561,10 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 			meta.TraceIDLabelKey: string(nj.ID),
 		},
 		Annotations: map[string]string{
-			meta.TraceLabelKey:   nj.Name,
-			meta.TraceIDLabelKey: string(nj.ID),
+			meta.TraceLabelKey:                         nj.Name,
+			meta.TraceIDLabelKey:                       string(nj.ID),
+			meta.TraceDeadlineAnnotationKey:            strconv.FormatInt(deadline, 10),
+			meta.TraceDeadlineGracePeriodAnnotationKey: strconv.FormatInt(nj.DeadlineGracePeriod, 10),
 		},
 	}
 
@@ -221,11 +574,23 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 			"program.bt": nj.Program,
 		},
 	}
+	programMode := int32(0644)
+	tracerName := "bpftrace"
+	if len(nj.Binary) > 0 {
+		tracerName = "program"
+		cm.Data = nil
+		cm.BinaryData = map[string][]byte{
+			"program": nj.Binary,
+		}
+		programMode = 0755
+	}
+
+	resources := mergeResources(nj.Resources)
 
 	job := &batchv1.Job{
 		ObjectMeta: commonMeta,
 		Spec: batchv1.JobSpec{
-			ActiveDeadlineSeconds:   int64Ptr(nj.Deadline + nj.DeadlineGracePeriod),
+			ActiveDeadlineSeconds:   int64Ptr(deadline + nj.DeadlineGracePeriod),
 			TTLSecondsAfterFinished: int32Ptr(5),
 			Parallelism:             int32Ptr(1),
 			Completions:             int32Ptr(1),
@@ -233,8 +598,12 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: commonMeta,
 				Spec: apiv1.PodSpec{
-					HostPID:            true,
+					HostPID:            nj.HostPID,
+					HostNetwork:        nj.HostNetwork,
+					HostAliases:        nj.HostAliases,
+					DNSConfig:          nj.DNSConfig,
 					ServiceAccountName: nj.ServiceAccount,
+					RuntimeClassName:   runtimeClass,
 					Volumes: []apiv1.Volume{
 						apiv1.Volume{
 							Name: "program",
@@ -243,6 +612,7 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 									LocalObjectReference: apiv1.LocalObjectReference{
 										Name: cm.Name,
 									},
+									DefaultMode: &programMode,
 								},
 							},
 						},
@@ -273,21 +643,15 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 					},
 					Containers: []apiv1.Container{
 						apiv1.Container{
-							Name:    nj.Name,
-							Image:   nj.ImageNameTag,
-							Command: bpfTraceCmd,
-							TTY:     true,
-							Stdin:   true,
-							Resources: apiv1.ResourceRequirements{
-								Requests: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse("100m"),
-									apiv1.ResourceMemory: resource.MustParse("100Mi"),
-								},
-								Limits: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse("1"),
-									apiv1.ResourceMemory: resource.MustParse("1G"),
-								},
-							},
+							Name:      nj.Name,
+							Image:     nj.ImageNameTag,
+							Command:   bpfTraceCmd,
+							Env:       append(append(nj.Tunables.env(), podEnv()...), nj.Proxy.env()...),
+							TTY:       true,
+							Stdin:     true,
+							Resources: resources,
+							// Crashes of the trace runner are explained by its last output.
+							TerminationMessagePolicy: apiv1.TerminationMessageFallbackToLogsOnError,
 							VolumeMounts: []apiv1.VolumeMount{
 								apiv1.VolumeMount{
 									Name:      "program",
@@ -312,7 +676,7 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 										Command: []string{
 											"/bin/bash",
 											"-c",
-											fmt.Sprintf("kill -SIGINT $(pidof bpftrace) && sleep %s", strconv.FormatInt(nj.DeadlineGracePeriod, 10)),
+											fmt.Sprintf("kill -SIGINT $(pidof %s) && sleep %s", tracerName, strconv.FormatInt(nj.DeadlineGracePeriod, 10)),
 										},
 									},
 								},
@@ -320,23 +684,7 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 						},
 					},
 					RestartPolicy: "Never",
-					Affinity: &apiv1.Affinity{
-						NodeAffinity: &apiv1.NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
-								NodeSelectorTerms: []apiv1.NodeSelectorTerm{
-									apiv1.NodeSelectorTerm{
-										MatchExpressions: []apiv1.NodeSelectorRequirement{
-											apiv1.NodeSelectorRequirement{
-												Key:      "kubernetes.io/hostname",
-												Operator: apiv1.NodeSelectorOpIn,
-												Values:   []string{nj.Hostname},
-											},
-										},
-									},
-								},
-							},
-						},
-					},
+					Affinity:      affinity,
 					Tolerations: []apiv1.Toleration{
 						apiv1.Toleration{
 							Effect:   apiv1.TaintEffectNoSchedule,
@@ -354,6 +702,7 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 			apiv1.Container{
 				Name:  "kubectl-trace-init",
 				Image: nj.InitImageNameTag,
+				Env:   nj.Proxy.env(),
 				Resources: apiv1.ResourceRequirements{
 					Requests: apiv1.ResourceList{
 						apiv1.ResourceCPU:    resource.MustParse("100m"),
@@ -469,10 +818,176 @@ func (t *TraceJobClient) CreateJob(nj TraceJob) (*batchv1.Job, error) {
 				ReadOnly:  true,
 			})
 	}
-	if _, err := t.ConfigClient.Create(cm); err != nil {
+
+	if len(nj.CABundle.ConfigMap) > 0 {
+		nj.CABundle.addTo(&job.Spec.Template.Spec)
+	}
+	return cm, job, nil
+}
+
+func (t *TraceJobClient) createJob(ctx context.Context, nj TraceJob) (*batchv1.Job, error) {
+	cm, job, err := nj.manifests()
+	if err != nil {
 		return nil, err
 	}
-	return t.JobClient.Create(job)
+	if t.QuotaClient != nil {
+		ql, err := t.QuotaClient.List(metav1.ListOptions{})
+		// The quotas are checked as a courtesy, the users who cannot list them learn about them from the job.
+		if err != nil && !errors.IsForbidden(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := checkQuotas(ql.Items, job, nj.Resources == nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	logManifests(cm, job)
+
+	if err := t.waitForSlot(ctx, nj); err != nil {
+		return nil, err
+	}
+
+	var lock *NodeLock
+	if nj.Exclusive {
+		var err error
+		if lock, err = t.lockNode(ctx, nj); err != nil {
+			return nil, err
+		}
+		klog.V(logging.LevelSteps).Infof("node locked: node=%s lease=%s", nj.Hostname, lock.Lease.Name)
+	}
+
+	var j *batchv1.Job
+	err = retryOnTransient(ctx, createBackoff, func() error {
+		var err error
+		j, err = t.JobClient.Create(job)
+		if errors.IsAlreadyExists(err) {
+			// a previous attempt went through even if its response got lost
+			j, err = t.JobClient.Get(job.Name, metav1.GetOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		if lock != nil {
+			if lerr := t.nodeLocks().Release(lock); lerr != nil {
+				return nil, fmt.Errorf("trace job %s not created, trace configuration %s not created, lock %s not released (%v): %v", job.Name, cm.Name, lock.Lease.Name, lerr, err)
+			}
+		}
+		return nil, fmt.Errorf("trace job %s not created, trace configuration %s not created: %v", job.Name, cm.Name, err)
+	}
+
+	klog.V(logging.LevelSteps).Infof("trace job created: job=%s namespace=%s uid=%s", j.Name, j.Namespace, j.UID)
+
+	// The job owns the configmap so that the garbage collector removes the program
+	// once the job is gone, either by TTL or by an explicit delete.
+	cm.OwnerReferences = []metav1.OwnerReference{jobOwnerReference(j)}
+	err = retryOnTransient(ctx, createBackoff, func() error {
+		_, err := t.ConfigClient.Create(cm)
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		// Without its program the job would wait forever, do not leave it around.
+		// This also happens when ctx is done, so it is not bound to ctx.
+		dp := metav1.DeletePropagationForeground
+		derr := retryOnTransient(context.Background(), createBackoff, func() error {
+			err := t.JobClient.Delete(j.Name, &metav1.DeleteOptions{
+				GracePeriodSeconds: int64Ptr(0),
+				PropagationPolicy:  &dp,
+			})
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		})
+		if derr != nil {
+			return nil, fmt.Errorf("trace job %s created but could not be deleted (%v), trace configuration %s not created: %v", j.Name, derr, cm.Name, err)
+		}
+		return nil, fmt.Errorf("trace job %s created and deleted, trace configuration %s not created: %v", j.Name, cm.Name, err)
+	}
+	klog.V(logging.LevelSteps).Infof("trace configuration created: configmap=%s namespace=%s", cm.Name, cm.Namespace)
+	return j, nil
+}
+
+// defaultResources are the compute resources of the tracerunner.
+func defaultResources() apiv1.ResourceRequirements {
+	return apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("100m"),
+			apiv1.ResourceMemory: resource.MustParse("100Mi"),
+		},
+		Limits: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("1"),
+			apiv1.ResourceMemory: resource.MustParse("1G"),
+		},
+	}
+}
+
+// mergeResources returns the default resources with the requests and limits of r set over them resource by resource.
+// The default limits below the requests of r are raised to them, and the default requests above the limits of r
+// lowered to them, for the requests not to exceed the limits.
+func mergeResources(r *apiv1.ResourceRequirements) apiv1.ResourceRequirements {
+	merged := defaultResources()
+	if r == nil {
+		return merged
+	}
+	for name, v := range r.Requests {
+		merged.Requests[name] = v.DeepCopy()
+		if _, set := r.Limits[name]; set {
+			continue
+		}
+		if limit, ok := merged.Limits[name]; ok && limit.Cmp(v) < 0 {
+			merged.Limits[name] = v.DeepCopy()
+		}
+	}
+	for name, v := range r.Limits {
+		merged.Limits[name] = v.DeepCopy()
+		if _, set := r.Requests[name]; set {
+			continue
+		}
+		if request, ok := merged.Requests[name]; ok && request.Cmp(v) > 0 {
+			merged.Requests[name] = v.DeepCopy()
+		}
+	}
+	return merged
+}
+
+// logManifests logs the generated configuration, with the program of the trace, and job, with the passwords of the
+// proxy redacted.
+func logManifests(cm *apiv1.ConfigMap, job *batchv1.Job) {
+	v := klog.V(logging.LevelManifests)
+	if !v {
+		return
+	}
+	job = job.DeepCopy()
+	redactProxyPasswords(&job.Spec.Template.Spec)
+	for _, m := range []struct {
+		kind string
+		obj  interface{}
+	}{{"configuration", cm}, {"job", job}} {
+		data, err := json.Marshal(m.obj)
+		if err != nil {
+			v.Infof("could not encode the generated trace %s: %v", m.kind, err)
+			continue
+		}
+		v.Infof("generated trace %s: %s", m.kind, data)
+	}
+}
+
+// jobOwnerReference makes the trace job own one of the objects of its trace. The deletion of the job waits for the
+// garbage collector to delete the object, with the foreground propagation of kubectl trace delete and of the TTL
+// controller, so that the job is only gone once everything of the trace is.
+func jobOwnerReference(j *batchv1.Job) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         batchv1.SchemeGroupVersion.String(),
+		Kind:               "Job",
+		Name:               j.Name,
+		UID:                j.UID,
+		BlockOwnerDeletion: boolPtr(true),
+	}
 }
 
 func int32Ptr(i int32) *int32 { return &i }
@@ -531,14 +1046,31 @@ const (
 	TraceJobCompleted TraceJobStatus = "Completed"
 	// TraceJobFailed means the trace job does not have any active or success pod and has fpods that failed.
 	TraceJobFailed TraceJobStatus = "Failed"
+	// TraceJobDeadlineExceeded means the trace job was killed because its program did not exit within its deadline
+	// and grace period.
+	TraceJobDeadlineExceeded TraceJobStatus = "DeadlineExceeded"
 	// TraceJobUnknown means that for some reason we do not have the information to determine the status.
 	TraceJobUnknown TraceJobStatus = "Unknown"
 )
 
+// jobDeadlineExceededReason is the reason of the failure of the jobs that ran past their active deadline.
+const jobDeadlineExceededReason = "DeadlineExceeded"
+
+// Terminal tells whether the trace job is over, whatever its outcome.
+func (s TraceJobStatus) Terminal() bool {
+	return s == TraceJobCompleted || s == TraceJobFailed || s == TraceJobDeadlineExceeded
+}
+
 func jobStatus(j batchv1.Job) TraceJobStatus {
 	if j.Status.Active > 0 {
 		return TraceJobRunning
 	}
+	// The job controller deletes the pods it kills at the deadline, the job may not count them as failed.
+	for _, c := range j.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == apiv1.ConditionTrue && c.Reason == jobDeadlineExceededReason {
+			return TraceJobDeadlineExceeded
+		}
+	}
 	if j.Status.Succeeded > 0 {
 		return TraceJobCompleted
 	}
@@ -547,3 +1079,17 @@ func jobStatus(j batchv1.Job) TraceJobStatus {
 	}
 	return TraceJobUnknown
 }
+
+// podEnv gives the trace runner the pod it reports its phase on.
+func podEnv() []apiv1.EnvVar {
+	return []apiv1.EnvVar{
+		apiv1.EnvVar{
+			Name:      meta.EnvPodName,
+			ValueFrom: &apiv1.EnvVarSource{FieldRef: &apiv1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+		},
+		apiv1.EnvVar{
+			Name:      meta.EnvPodNamespace,
+			ValueFrom: &apiv1.EnvVarSource{FieldRef: &apiv1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package tracejob
+
+import (
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestJobStatus(t *testing.T) {
+	failed := func(reason string) []batchv1.JobCondition {
+		return []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: reason}}
+	}
+	tests := []struct {
+		name       string
+		status     batchv1.JobStatus
+		want       TraceJobStatus
+		wantReason string
+	}{
+		{name: "running", status: batchv1.JobStatus{Active: 1}, want: TraceJobRunning},
+		{name: "completed", status: batchv1.JobStatus{Succeeded: 1}, want: TraceJobCompleted},
+		{name: "failed", status: batchv1.JobStatus{Failed: 1, Conditions: failed("BackoffLimitExceeded")}, want: TraceJobFailed, wantReason: "Failed: BackoffLimitExceeded"},
+		{name: "deadline exceeded", status: batchv1.JobStatus{Failed: 1, Conditions: failed("DeadlineExceeded")}, want: TraceJobDeadlineExceeded},
+		{name: "deadline exceeded with its pod deleted", status: batchv1.JobStatus{Conditions: failed("DeadlineExceeded")}, want: TraceJobDeadlineExceeded},
+		{name: "unknown", want: TraceJobUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := batchv1.Job{Status: tt.status}
+			if got := jobStatus(j); got != tt.want {
+				t.Errorf("jobStatus() = %s, want %s", got, tt.want)
+			}
+			if got := jobReason(j); got != tt.wantReason {
+				t.Errorf("jobReason() = %q, want %q", got, tt.wantReason)
+			}
+			if terminal := tt.want != TraceJobRunning && tt.want != TraceJobUnknown; tt.want.Terminal() != terminal {
+				t.Errorf("Terminal() = %v, want %v", tt.want.Terminal(), terminal)
+			}
+		})
+	}
+}
+
+func TestMergeResources(t *testing.T) {
+	list := func(cpu, memory string) apiv1.ResourceList {
+		l := apiv1.ResourceList{}
+		if len(cpu) > 0 {
+			l[apiv1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if len(memory) > 0 {
+			l[apiv1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return l
+	}
+	tests := []struct {
+		name         string
+		resources    *apiv1.ResourceRequirements
+		wantRequests apiv1.ResourceList
+		wantLimits   apiv1.ResourceList
+	}{
+		{
+			name:         "defaults",
+			wantRequests: list("100m", "100Mi"),
+			wantLimits:   list("1", "1G"),
+		},
+		{
+			name:         "memory limit",
+			resources:    &apiv1.ResourceRequirements{Limits: list("", "2G")},
+			wantRequests: list("100m", "100Mi"),
+			wantLimits:   list("1", "2G"),
+		},
+		{
+			name:         "cpu request above the default limit",
+			resources:    &apiv1.ResourceRequirements{Requests: list("2", "")},
+			wantRequests: list("2", "100Mi"),
+			wantLimits:   list("2", "1G"),
+		},
+		{
+			name:         "memory limit below the default request",
+			resources:    &apiv1.ResourceRequirements{Limits: list("", "64Mi")},
+			wantRequests: list("100m", "64Mi"),
+			wantLimits:   list("1", "64Mi"),
+		},
+		{
+			name:         "request and limit",
+			resources:    &apiv1.ResourceRequirements{Requests: list("2", ""), Limits: list("4", "")},
+			wantRequests: list("2", "100Mi"),
+			wantLimits:   list("4", "1G"),
+		},
+		{
+			name:         "other resource",
+			resources:    &apiv1.ResourceRequirements{Limits: apiv1.ResourceList{apiv1.ResourceEphemeralStorage: resource.MustParse("1Gi")}},
+			wantRequests: list("100m", "100Mi"),
+			wantLimits:   apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1"), apiv1.ResourceMemory: resource.MustParse("1G"), apiv1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeResources(tt.resources)
+			for _, l := range []struct {
+				kind      string
+				got, want apiv1.ResourceList
+			}{{"requests", got.Requests, tt.wantRequests}, {"limits", got.Limits, tt.wantLimits}} {
+				if len(l.got) != len(l.want) {
+					t.Errorf("mergeResources() %s = %v, want %v", l.kind, l.got, l.want)
+					continue
+				}
+				for name, want := range l.want {
+					if v := l.got[name]; v.Cmp(want) != 0 {
+						t.Errorf("mergeResources() %s %s = %s, want %s", l.kind, name, v.String(), want.String())
+					}
+				}
+			}
+		})
+	}
+}
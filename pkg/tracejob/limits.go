@@ -0,0 +1,118 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// LimitsNamespace is the namespace of the limits configmap. By default only the administrators of the cluster
+	// can read and change its configmaps, the users creating traces have to be allowed to get the limits configmap.
+	LimitsNamespace = "kube-public"
+	// LimitsConfigMapName is the configmap capping how many traces run at once in the cluster, whatever their
+	// namespace, shared by everyone creating traces.
+	LimitsConfigMapName = meta.ObjectNamePrefix + "limits"
+	// LimitMaxTraces is the key of the limits configmap capping the traces running in the cluster.
+	LimitMaxTraces = "maxTraces"
+	// LimitMaxTracesPerNode is the key of the limits configmap capping the traces running on each node.
+	LimitMaxTracesPerNode = "maxTracesPerNode"
+)
+
+// queuePollInterval is how often a queued trace checks whether it can be created.
+const queuePollInterval = 5 * time.Second
+
+// Limits cap the number of traces running at once, unlimited when 0.
+type Limits struct {
+	MaxTraces        int
+	MaxTracesPerNode int
+}
+
+// parseLimits reads the limits of the configmap.
+func parseLimits(cm *apiv1.ConfigMap) (Limits, error) {
+	l := Limits{}
+	for key, v := range map[string]*int{LimitMaxTraces: &l.MaxTraces, LimitMaxTracesPerNode: &l.MaxTracesPerNode} {
+		s, ok := cm.Data[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("invalid %s in configmap %s: %q is not a positive number", key, cm.Name, s)
+		}
+		*v = n
+	}
+	return l, nil
+}
+
+// exceeded explains why one more trace on the node would exceed the limits given the running trace jobs,
+// empty when it would not.
+func (l Limits) exceeded(jobs []batchv1.Job, hostname string) string {
+	total, onNode := 0, 0
+	for _, j := range jobs {
+		if jobStatus(j).Terminal() {
+			continue
+		}
+		total++
+		if h, err := jobHostname(j); err == nil && h == hostname {
+			onNode++
+		}
+	}
+	if l.MaxTracesPerNode > 0 && onNode >= l.MaxTracesPerNode {
+		return fmt.Sprintf("%d traces run on node %s, the limit is %d", onNode, hostname, l.MaxTracesPerNode)
+	}
+	if l.MaxTraces > 0 && total >= l.MaxTraces {
+		return fmt.Sprintf("%d traces run, the limit is %d", total, l.MaxTraces)
+	}
+	return ""
+}
+
+// waitForSlot queues the trace until it can run within the limits of the cluster, if any, or until ctx is done,
+// counting the running traces of all the namespaces. The limits are checked by the clients creating the traces,
+// two of them checking at the same time can both go, and a queued trace only exists in the client queueing it.
+// The users who cannot read the limits configmap have no limits, like the ones of clusters without it.
+func (t *TraceJobClient) waitForSlot(ctx context.Context, nj TraceJob) error {
+	if t.ClusterConfigClient == nil || t.ClusterJobClient == nil {
+		return nil
+	}
+	cm, err := t.ClusterConfigClient.ConfigMaps(LimitsNamespace).Get(LimitsConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) || errors.IsForbidden(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	limits, err := parseLimits(cm)
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	err = wait.PollImmediateUntil(queuePollInterval, func() (bool, error) {
+		jl, err := t.ClusterJobClient.Jobs(metav1.NamespaceAll).List(metav1.ListOptions{LabelSelector: meta.TraceIDLabelKey})
+		if err != nil {
+			return false, fmt.Errorf("counting the traces of the cluster against the limits: %v", err)
+		}
+		reason := limits.exceeded(jl.Items, nj.Hostname)
+		if len(reason) == 0 {
+			return true, nil
+		}
+		if !queued && t.outStream != nil {
+			fmt.Fprintf(t.outStream, "trace %s queued: %s\n", nj.ID, reason)
+		}
+		queued = true
+		return false, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("trace %s not created, interrupted while queued", nj.ID)
+	}
+	return err
+}
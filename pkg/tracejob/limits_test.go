@@ -0,0 +1,159 @@
+package tracejob
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    Limits
+		wantErr bool
+	}{
+		{name: "none", data: map[string]string{}},
+		{name: "both", data: map[string]string{"maxTraces": "10", "maxTracesPerNode": "2"}, want: Limits{MaxTraces: 10, MaxTracesPerNode: 2}},
+		{name: "invalid", data: map[string]string{"maxTracesPerNode": "two"}, wantErr: true},
+		{name: "negative", data: map[string]string{"maxTraces": "-1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLimits(&apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: LimitsConfigMapName}, Data: tt.data})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseLimits() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitsExceeded(t *testing.T) {
+	job := func(hostname string, status batchv1.JobStatus) batchv1.Job {
+		return batchv1.Job{
+			Spec: batchv1.JobSpec{Template: apiv1.PodTemplateSpec{Spec: apiv1.PodSpec{Affinity: &apiv1.Affinity{
+				NodeAffinity: &apiv1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+					NodeSelectorTerms: []apiv1.NodeSelectorTerm{{MatchExpressions: []apiv1.NodeSelectorRequirement{
+						{Key: "kubernetes.io/hostname", Operator: apiv1.NodeSelectorOpIn, Values: []string{hostname}},
+					}}},
+				}},
+			}}}},
+			Status: status,
+		}
+	}
+	jobs := []batchv1.Job{
+		job("node-1", batchv1.JobStatus{Active: 1}),
+		job("node-1", batchv1.JobStatus{}),
+		job("node-1", batchv1.JobStatus{Succeeded: 1}),
+		job("node-1", batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: "DeadlineExceeded"},
+		}}),
+		job("node-2", batchv1.JobStatus{Active: 1}),
+	}
+	tests := []struct {
+		name     string
+		limits   Limits
+		hostname string
+		want     string
+	}{
+		{name: "unlimited", hostname: "node-1"},
+		{name: "node full", limits: Limits{MaxTracesPerNode: 2}, hostname: "node-1", want: "2 traces run on node node-1, the limit is 2"},
+		{name: "other node", limits: Limits{MaxTracesPerNode: 2}, hostname: "node-2"},
+		{name: "namespace full", limits: Limits{MaxTraces: 3, MaxTracesPerNode: 2}, hostname: "node-3", want: "3 traces run, the limit is 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.exceeded(jobs, tt.hostname); got != tt.want {
+				t.Errorf("exceeded() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForSlot(t *testing.T) {
+	// One trace runs in another namespace than the queued one, the limits of the cluster count it.
+	running := batchv1.JobList{Items: []batchv1.Job{
+		{ObjectMeta: metav1.ObjectMeta{Name: "kubectl-trace-other", Namespace: "other"}, Status: batchv1.JobStatus{Active: 1}},
+	}}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/namespaces/" + LimitsNamespace + "/configmaps/" + LimitsConfigMapName:
+			json.NewEncoder(w).Encode(apiv1.ConfigMap{Data: map[string]string{LimitMaxTraces: "1"}})
+		case "/apis/batch/v1/jobs":
+			json.NewEncoder(w).Encode(running)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonNotFound, Code: http.StatusNotFound})
+		}
+	}))
+	defer srv.Close()
+
+	config := &rest.Config{Host: srv.URL}
+	batch, err := batchv1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, err := corev1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	client := &TraceJobClient{ClusterJobClient: batch, ClusterConfigClient: core, outStream: out}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = client.waitForSlot(ctx, TraceJob{ID: "1234", Namespace: "default", Hostname: "node-1"})
+	if err == nil || !strings.Contains(err.Error(), "interrupted while queued") {
+		t.Errorf("waitForSlot() error = %v, want the trace to stay queued", err)
+	}
+	if got, want := out.String(), "trace 1234 queued: 1 traces run, the limit is 1\n"; got != want {
+		t.Errorf("waitForSlot() printed %q, want %q", got, want)
+	}
+
+	srv.Close()
+	if err := (&TraceJobClient{}).waitForSlot(context.Background(), TraceJob{ID: "1234"}); err != nil {
+		t.Errorf("waitForSlot() without the cluster clients error = %v, want no limits", err)
+	}
+	for _, p := range paths {
+		if strings.Contains(p, "/namespaces/default/") {
+			t.Errorf("waitForSlot() requested %s, want the limits of the cluster only", p)
+		}
+	}
+
+	// The users who cannot read kube-public run their traces without limits.
+	forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonForbidden, Code: http.StatusForbidden})
+	}))
+	defer forbidden.Close()
+	config = &rest.Config{Host: forbidden.URL}
+	if batch, err = batchv1client.NewForConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if core, err = corev1client.NewForConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	client = &TraceJobClient{ClusterJobClient: batch, ClusterConfigClient: core, outStream: out}
+	if err := client.waitForSlot(context.Background(), TraceJob{ID: "1234", Hostname: "node-1"}); err != nil {
+		t.Errorf("waitForSlot() forbidden to read the limits error = %v, want no limits", err)
+	}
+}
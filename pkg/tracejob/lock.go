@@ -0,0 +1,225 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1typed "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1typed "k8s.io/client-go/kubernetes/typed/coordination/v1"
+)
+
+// DefaultLockNamespace is the default namespace of the leases locking the nodes, whatever the namespace of the traces
+// and of the schedulers taking the locks, so that they all see each other's locks. It is dedicated to the locks, for
+// their users to be allowed to manage its leases only, and is created by the administrators of the cluster.
+const DefaultLockNamespace = "kubectl-trace-locks"
+
+// ErrNodeLocked is the error, checked with errors.Is, of the acquisition of a node lock held by someone else,
+// and of the renewal of a lock taken over since.
+var ErrNodeLocked = fmt.Errorf("node locked")
+
+// lockedError is an ErrNodeLocked telling who holds the lock.
+type lockedError string
+
+func (e lockedError) Error() string { return string(e) }
+
+func (e lockedError) Is(target error) bool { return target == ErrNodeLocked }
+
+// NodeLocks are the locks giving exclusive access to the nodes, as leases of a namespace shared by everyone taking
+// them. The exclusive traces take them, and so can the controllers and schedulers placing traces, to coordinate
+// with them.
+type NodeLocks struct {
+	LeaseClient coordinationv1typed.LeasesGetter
+	// Namespace is the namespace of the leases, DefaultLockNamespace when empty.
+	Namespace string
+	// JobClient, when set, releases the locks of the trace jobs that are gone before their locks expire,
+	// looking the jobs up in the namespaces of their traces.
+	JobClient batchv1typed.JobsGetter
+}
+
+// leases are the leases of the locks.
+func (l NodeLocks) leases() coordinationv1typed.LeaseInterface {
+	if len(l.Namespace) == 0 {
+		return l.LeaseClient.Leases(DefaultLockNamespace)
+	}
+	return l.LeaseClient.Leases(l.Namespace)
+}
+
+// NodeLock is a lock held on a node.
+type NodeLock struct {
+	Node   string
+	Holder string
+	// Lease is the lease backing the lock, as last written by its holder.
+	Lease *coordinationv1.Lease
+}
+
+// nodeLockName is the name of the lease that gives a trace exclusive access to a node.
+func nodeLockName(hostname string) string {
+	return fmt.Sprintf("%snode-%s", meta.ObjectNamePrefix, hostname)
+}
+
+// Acquire locks the node for the holder for ttl, rounded down to the second. A lock held by another holder is only
+// taken over when it is expired, or when its holder is a trace job that is gone, otherwise Acquire fails with
+// ErrNodeLocked.
+func (l NodeLocks) Acquire(ctx context.Context, node, holder string, ttl time.Duration) (*NodeLock, error) {
+	return l.acquire(ctx, node, holder, ttl, nil)
+}
+
+// acquire locks the node, labelling the lease with labels.
+func (l NodeLocks) acquire(ctx context.Context, node, holder string, ttl time.Duration, labels map[string]string) (*NodeLock, error) {
+	if ttl < time.Second {
+		return nil, fmt.Errorf("the lock of a node must last at least 1s, got %s", ttl)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := metav1.NowMicro()
+	duration := int32(ttl / time.Second)
+	name := nodeLockName(node)
+
+	lease, err := l.leases().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: labels,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		lease, err = l.leases().Create(lease)
+		if errors.IsAlreadyExists(err) {
+			return nil, lockedError(fmt.Sprintf("node %s is locked by another holder", node))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &NodeLock{Node: node, Holder: holder, Lease: lease}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lease.Spec.HolderIdentity != nil && !l.released(lease) {
+		return nil, lockedError(fmt.Sprintf("node %s is locked by %s", node, lockHolder(lease)))
+	}
+
+	transitions := int32(1)
+	if lease.Spec.LeaseTransitions != nil {
+		transitions = *lease.Spec.LeaseTransitions + 1
+	}
+	lease.Labels = labels
+	lease.OwnerReferences = nil
+	lease.Spec = coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+		LeaseTransitions:     &transitions,
+	}
+	// The update fails with a conflict if someone else took the lease in the meantime.
+	lease, err = l.leases().Update(lease)
+	if errors.IsConflict(err) {
+		return nil, lockedError(fmt.Sprintf("node %s is locked by another holder", node))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &NodeLock{Node: node, Holder: holder, Lease: lease}, nil
+}
+
+// lockHolder describes the holder of the lease for the errors.
+func lockHolder(lease *coordinationv1.Lease) string {
+	if namespace, ok := traceHolderNamespace(lease); ok {
+		return fmt.Sprintf("trace %s in namespace %s", *lease.Spec.HolderIdentity, namespace)
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+// traceHolderNamespace returns the namespace of the trace job holding the lease, if a trace holds it.
+func traceHolderNamespace(lease *coordinationv1.Lease) (string, bool) {
+	namespace := lease.Labels[meta.TraceNamespaceLabelKey]
+	if len(namespace) == 0 || lease.Labels[meta.TraceLabelKey] != *lease.Spec.HolderIdentity {
+		return "", false
+	}
+	return namespace, true
+}
+
+// released tells whether the holder of the lease is not using it anymore.
+func (l NodeLocks) released(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if time.Now().After(expiry) {
+			return true
+		}
+	}
+	// Only the traces hold the locks in the name of their job.
+	namespace, ok := traceHolderNamespace(lease)
+	if l.JobClient == nil || !ok {
+		return false
+	}
+	_, err := l.JobClient.Jobs(namespace).Get(*lease.Spec.HolderIdentity, metav1.GetOptions{})
+	return errors.IsNotFound(err)
+}
+
+// Renew extends the lock for ttl from now. It fails with ErrNodeLocked when the lock was released or taken over.
+func (l NodeLocks) Renew(lock *NodeLock, ttl time.Duration) error {
+	if ttl < time.Second {
+		return fmt.Errorf("the lock of a node must last at least 1s, got %s", ttl)
+	}
+	now := metav1.NowMicro()
+	duration := int32(ttl / time.Second)
+	lease := lock.Lease.DeepCopy()
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease, err := l.leases().Update(lease)
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		return lockedError(fmt.Sprintf("the lock of node %s held by %s was lost", lock.Node, lock.Holder))
+	}
+	if err != nil {
+		return err
+	}
+	lock.Lease = lease
+	return nil
+}
+
+// Release releases the lock, unless it has been taken over or recreated in the meantime.
+func (l NodeLocks) Release(lock *NodeLock) error {
+	err := l.leases().Delete(lock.Lease.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &lock.Lease.UID, ResourceVersion: &lock.Lease.ResourceVersion},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+// nodeLocks are the locks of the nodes of the trace job client.
+func (t *TraceJobClient) nodeLocks() NodeLocks {
+	return NodeLocks{LeaseClient: t.LeaseClient, Namespace: t.LockNamespace, JobClient: t.ClusterJobClient}
+}
+
+// lockNode acquires the lock of the node the trace job is going to run on, until its deadline.
+// The lease cannot be owned by a job of another namespace, it is left behind once the job is gone and the next
+// holder takes it over.
+func (t *TraceJobClient) lockNode(ctx context.Context, nj TraceJob) (*NodeLock, error) {
+	if t.LeaseClient == nil {
+		return nil, fmt.Errorf("a lease client is required to run exclusive traces")
+	}
+	ttl := time.Duration(nj.Deadline+nj.DeadlineGracePeriod) * time.Second
+	labels := map[string]string{
+		meta.TraceLabelKey:          nj.Name,
+		meta.TraceIDLabelKey:        string(nj.ID),
+		meta.TraceNamespaceLabelKey: nj.Namespace,
+	}
+	return t.nodeLocks().acquire(ctx, nj.Hostname, nj.Name, ttl, labels)
+}
@@ -0,0 +1,258 @@
+package tracejob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	batchv1client "k8s.io/client-go/kubernetes/typed/batch/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/rest"
+)
+
+// leaseServer serves the leases of its namespace from memory, with the optimistic concurrency of the API
+// server, and the jobs of the jobs set, keyed by namespace/name.
+type leaseServer struct {
+	mu        sync.Mutex
+	namespace string
+	leases    map[string]*coordinationv1.Lease
+	jobs      map[string]bool
+	version   int
+}
+
+func (s *leaseServer) status(w http.ResponseWriter, code int, reason metav1.StatusReason) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: reason, Code: int32(code)})
+}
+
+func (s *leaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	name := path.Base(r.URL.Path)
+	if strings.Contains(r.URL.Path, "/jobs/") {
+		namespace := path.Base(path.Dir(path.Dir(r.URL.Path)))
+		if !s.jobs[namespace+"/"+name] {
+			s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"metadata": map[string]string{"name": name}})
+		return
+	}
+	if !strings.Contains(r.URL.Path, "/namespaces/"+s.namespace+"/") {
+		s.status(w, http.StatusForbidden, metav1.StatusReasonForbidden)
+		return
+	}
+	existing := s.leases[name]
+	switch r.Method {
+	case http.MethodGet:
+		if existing == nil {
+			s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(existing)
+	case http.MethodPost, http.MethodPut:
+		lease := &coordinationv1.Lease{}
+		if err := json.NewDecoder(r.Body).Decode(lease); err != nil {
+			s.status(w, http.StatusBadRequest, metav1.StatusReasonBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost && s.leases[lease.Name] != nil {
+			s.status(w, http.StatusConflict, metav1.StatusReasonAlreadyExists)
+			return
+		}
+		if r.Method == http.MethodPut && (existing == nil || existing.ResourceVersion != lease.ResourceVersion) {
+			s.status(w, http.StatusConflict, metav1.StatusReasonConflict)
+			return
+		}
+		if existing == nil {
+			lease.UID = types.UID("uid-" + lease.Name)
+		}
+		s.version++
+		lease.ResourceVersion = strconv.Itoa(s.version)
+		s.leases[lease.Name] = lease
+		json.NewEncoder(w).Encode(lease)
+	case http.MethodDelete:
+		opts := &metav1.DeleteOptions{}
+		json.NewDecoder(r.Body).Decode(opts)
+		if existing == nil {
+			s.status(w, http.StatusNotFound, metav1.StatusReasonNotFound)
+			return
+		}
+		if p := opts.Preconditions; p != nil && p.ResourceVersion != nil && *p.ResourceVersion != existing.ResourceVersion {
+			s.status(w, http.StatusConflict, metav1.StatusReasonConflict)
+			return
+		}
+		delete(s.leases, name)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusSuccess})
+	}
+}
+
+func newTestNodeLocks(t *testing.T) (NodeLocks, *leaseServer, func()) {
+	s := &leaseServer{namespace: DefaultLockNamespace, leases: map[string]*coordinationv1.Lease{}, jobs: map[string]bool{}}
+	srv := httptest.NewServer(s)
+	config := &rest.Config{Host: srv.URL}
+	coordination, err := coordinationv1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := batchv1client.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NodeLocks{LeaseClient: coordination, JobClient: batch}, s, srv.Close
+}
+
+func TestNodeLocks(t *testing.T) {
+	ctx := context.Background()
+	locks, _, done := newTestNodeLocks(t)
+	defer done()
+
+	lock, err := locks.Acquire(ctx, "node-1", "scheduler-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := locks.Acquire(ctx, "node-1", "scheduler-b", time.Minute); !errors.Is(err, ErrNodeLocked) {
+		t.Fatalf("Acquire() of a held lock error = %v, want ErrNodeLocked", err)
+	}
+	if _, err := locks.Acquire(ctx, "node-2", "scheduler-b", time.Minute); err != nil {
+		t.Fatalf("Acquire() of another node error = %v", err)
+	}
+	if err := locks.Renew(lock, 2*time.Minute); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if got := *lock.Lease.Spec.LeaseDurationSeconds; got != 120 {
+		t.Errorf("Renew() lease duration = %d, want 120", got)
+	}
+	if err := locks.Release(lock); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := locks.Acquire(ctx, "node-1", "scheduler-b", time.Minute); err != nil {
+		t.Fatalf("Acquire() of a released lock error = %v", err)
+	}
+	if err := locks.Renew(lock, time.Minute); !errors.Is(err, ErrNodeLocked) {
+		t.Errorf("Renew() of a lock taken over error = %v, want ErrNodeLocked", err)
+	}
+}
+
+func TestNodeLocksTakeOver(t *testing.T) {
+	ctx := context.Background()
+	traceLabels := map[string]string{meta.TraceLabelKey: "kubectl-trace-1", meta.TraceNamespaceLabelKey: "team-a"}
+	tests := []struct {
+		name     string
+		holder   string
+		labels   map[string]string
+		renewed  time.Duration
+		jobs     []string
+		wantTake bool
+	}{
+		{name: "expired", holder: "scheduler-a", renewed: -2 * time.Minute, wantTake: true},
+		{name: "held", holder: "scheduler-a", renewed: 0},
+		{name: "trace job gone", holder: "kubectl-trace-1", labels: traceLabels, wantTake: true},
+		{name: "trace job running", holder: "kubectl-trace-1", labels: traceLabels, jobs: []string{"team-a/kubectl-trace-1"}},
+		{name: "trace job of the same name in another namespace", holder: "kubectl-trace-1", labels: traceLabels, jobs: []string{"team-b/kubectl-trace-1"}, wantTake: true},
+		{name: "trace job without namespace", holder: "kubectl-trace-1", labels: map[string]string{meta.TraceLabelKey: "kubectl-trace-1"}},
+		{name: "holder without a job", holder: "kubectl-trace-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locks, s, done := newTestNodeLocks(t)
+			defer done()
+			for _, j := range tt.jobs {
+				s.jobs[j] = true
+			}
+			lock, err := locks.acquire(ctx, "node-1", tt.holder, time.Minute, tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			renewed := metav1.NewMicroTime(time.Now().Add(tt.renewed))
+			s.leases[lock.Lease.Name].Spec.RenewTime = &renewed
+
+			_, err = locks.Acquire(ctx, "node-1", "scheduler-b", time.Minute)
+			if tt.wantTake && err != nil {
+				t.Errorf("Acquire() error = %v, want the lock taken over", err)
+			}
+			if !tt.wantTake && !errors.Is(err, ErrNodeLocked) {
+				t.Errorf("Acquire() error = %v, want ErrNodeLocked", err)
+			}
+		})
+	}
+}
+
+func TestLockNodeAcrossNamespaces(t *testing.T) {
+	ctx := context.Background()
+	locks, s, done := newTestNodeLocks(t)
+	defer done()
+	tc := &TraceJobClient{LeaseClient: locks.LeaseClient, ClusterJobClient: locks.JobClient}
+	a := TraceJob{Name: "kubectl-trace-a", Namespace: "team-a", Hostname: "node-1", Deadline: 60}
+	b := TraceJob{Name: "kubectl-trace-b", Namespace: "team-b", Hostname: "node-1", Deadline: 60}
+
+	s.jobs["team-a/kubectl-trace-a"] = true
+	if _, err := tc.lockNode(ctx, a); err != nil {
+		t.Fatalf("lockNode() error = %v", err)
+	}
+	_, err := tc.lockNode(ctx, b)
+	if !errors.Is(err, ErrNodeLocked) || !strings.Contains(err.Error(), "kubectl-trace-a in namespace team-a") {
+		t.Fatalf("lockNode() from another namespace error = %v, want the node locked by the first trace", err)
+	}
+
+	delete(s.jobs, "team-a/kubectl-trace-a")
+	if _, err := tc.lockNode(ctx, b); err != nil {
+		t.Errorf("lockNode() once the first trace is gone error = %v", err)
+	}
+}
+
+func TestNodeLocksSharedWithTraces(t *testing.T) {
+	ctx := context.Background()
+	locks, _, done := newTestNodeLocks(t)
+	defer done()
+	tc := &TraceJobClient{LeaseClient: locks.LeaseClient, ClusterJobClient: locks.JobClient}
+
+	lock, err := locks.Acquire(ctx, "node-1", "my-scheduler", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := tc.lockNode(ctx, TraceJob{Name: "kubectl-trace-a", Namespace: "team-a", Hostname: "node-1", Deadline: 60}); !errors.Is(err, ErrNodeLocked) {
+		t.Errorf("lockNode() of a node locked by a scheduler error = %v, want ErrNodeLocked", err)
+	}
+	if err := locks.Release(lock); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := tc.lockNode(ctx, TraceJob{Name: "kubectl-trace-a", Namespace: "team-a", Hostname: "node-1", Deadline: 60}); err != nil {
+		t.Errorf("lockNode() of a released node error = %v", err)
+	}
+}
+
+func TestLockNamespace(t *testing.T) {
+	ctx := context.Background()
+	locks, s, done := newTestNodeLocks(t)
+	defer done()
+	s.namespace = "tracing-locks"
+	tc := &TraceJobClient{LeaseClient: locks.LeaseClient, ClusterJobClient: locks.JobClient}
+	trace := TraceJob{Name: "kubectl-trace-a", Namespace: "team-a", Hostname: "node-1", Deadline: 60}
+	s.jobs["team-a/kubectl-trace-a"] = true
+
+	if _, err := tc.lockNode(ctx, trace); err == nil {
+		t.Fatalf("lockNode() in the default namespace should fail when the locks are in another one")
+	}
+	tc.LockNamespace = "tracing-locks"
+	if _, err := tc.lockNode(ctx, trace); err != nil {
+		t.Fatalf("lockNode() error = %v", err)
+	}
+	locks.Namespace = "tracing-locks"
+	if _, err := locks.Acquire(ctx, "node-1", "my-scheduler", time.Minute); !errors.Is(err, ErrNodeLocked) {
+		t.Errorf("Acquire() of a node locked by a trace error = %v, want ErrNodeLocked", err)
+	}
+}
@@ -0,0 +1,84 @@
+package tracejob
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1typed "k8s.io/client-go/kubernetes/typed/rbac/v1"
+)
+
+// runnerRoleName is the role of the service account of the trace jobs in the namespaces created for them.
+const runnerRoleName = "kubectl-trace-runner"
+
+// NamespaceObjects returns the objects CreateNamespace creates for the trace jobs of a namespace run with the given
+// service account: the namespace, labelled for the pod security admission to allow their privileged pods,
+// the service account unless it is the default one that kubernetes creates, and the role with its binding letting
+// the trace runners report their phases on their pods.
+func NamespaceObjects(namespace, serviceAccount string) (*apiv1.Namespace, *apiv1.ServiceAccount, *rbacv1.Role, *rbacv1.RoleBinding) {
+	labels := map[string]string{"app.kubernetes.io/managed-by": "kubectl-trace"}
+	ns := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   namespace,
+			Labels: map[string]string{},
+		},
+	}
+	for k, v := range labels {
+		ns.Labels[k] = v
+	}
+	// The trace jobs run privileged pods with the host PID namespace.
+	for _, mode := range []string{"enforce", "audit", "warn"} {
+		ns.Labels["pod-security.kubernetes.io/"+mode] = "privileged"
+	}
+	var sa *apiv1.ServiceAccount
+	if serviceAccount != "default" {
+		sa = &apiv1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: serviceAccount, Namespace: namespace, Labels: labels},
+		}
+	}
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: runnerRoleName, Namespace: namespace, Labels: labels},
+		Rules: []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "patch"}},
+		},
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: runnerRoleName + "-" + serviceAccount, Namespace: namespace, Labels: labels},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: runnerRoleName},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: namespace},
+		},
+	}
+	return ns, sa, role, binding
+}
+
+// CreateNamespace creates the namespace of NamespaceObjects along with its service account and role, unless it
+// already exists, and tells whether it created it. The objects already created by an interrupted run are left as
+// they are.
+func CreateNamespace(core corev1typed.CoreV1Interface, rbac rbacv1typed.RbacV1Interface, namespace, serviceAccount string) (bool, error) {
+	_, err := core.Namespaces().Get(namespace, metav1.GetOptions{})
+	if err == nil {
+		return false, nil
+	}
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	ns, sa, role, binding := NamespaceObjects(namespace, serviceAccount)
+	if _, err := core.Namespaces().Create(ns); err != nil && !errors.IsAlreadyExists(err) {
+		return false, err
+	}
+	if sa != nil {
+		if _, err := core.ServiceAccounts(namespace).Create(sa); err != nil && !errors.IsAlreadyExists(err) {
+			return true, err
+		}
+	}
+	if _, err := rbac.Roles(namespace).Create(role); err != nil && !errors.IsAlreadyExists(err) {
+		return true, err
+	}
+	if _, err := rbac.RoleBindings(namespace).Create(binding); err != nil && !errors.IsAlreadyExists(err) {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,110 @@
+package tracejob
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestCreateNamespace(t *testing.T) {
+	tests := []struct {
+		name           string
+		exists         bool
+		serviceAccount string
+		wantCreated    bool
+		wantRequests   []string
+	}{
+		{
+			name:           "existing namespace",
+			exists:         true,
+			serviceAccount: "tracer",
+			wantRequests:   []string{"GET /api/v1/namespaces/tracing"},
+		},
+		{
+			name:           "service account of its own",
+			serviceAccount: "tracer",
+			wantCreated:    true,
+			wantRequests: []string{
+				"GET /api/v1/namespaces/tracing",
+				"POST /api/v1/namespaces",
+				"POST /api/v1/namespaces/tracing/serviceaccounts",
+				"POST /apis/rbac.authorization.k8s.io/v1/namespaces/tracing/roles",
+				"POST /apis/rbac.authorization.k8s.io/v1/namespaces/tracing/rolebindings",
+			},
+		},
+		{
+			name:           "default service account",
+			serviceAccount: "default",
+			wantCreated:    true,
+			wantRequests: []string{
+				"GET /api/v1/namespaces/tracing",
+				"POST /api/v1/namespaces",
+				"POST /apis/rbac.authorization.k8s.io/v1/namespaces/tracing/roles",
+				"POST /apis/rbac.authorization.k8s.io/v1/namespaces/tracing/rolebindings",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				w.Header().Set("Content-Type", "application/json")
+				if r.Method == http.MethodGet {
+					if !tt.exists {
+						w.WriteHeader(http.StatusNotFound)
+						json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonNotFound, Code: http.StatusNotFound})
+						return
+					}
+					json.NewEncoder(w).Encode(map[string]interface{}{"metadata": map[string]string{"name": "tracing"}})
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusCreated)
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			config := &rest.Config{Host: srv.URL}
+			core, err := corev1client.NewForConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rbac, err := rbacv1client.NewForConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, err := CreateNamespace(core, rbac, "tracing", tt.serviceAccount)
+			if err != nil {
+				t.Fatalf("CreateNamespace() error = %v", err)
+			}
+			if created != tt.wantCreated {
+				t.Errorf("CreateNamespace() = %v, want %v", created, tt.wantCreated)
+			}
+			if !reflect.DeepEqual(requests, tt.wantRequests) {
+				t.Errorf("got requests %v, want %v", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestNamespaceObjects(t *testing.T) {
+	ns, sa, role, binding := NamespaceObjects("tracing", "tracer")
+	if ns.Labels["pod-security.kubernetes.io/enforce"] != "privileged" {
+		t.Errorf("namespace labels = %v, want the privileged pod security level enforced", ns.Labels)
+	}
+	if sa == nil || sa.Name != "tracer" || sa.Namespace != "tracing" {
+		t.Errorf("service account = %v", sa)
+	}
+	if binding.RoleRef.Name != role.Name || len(binding.Subjects) != 1 || binding.Subjects[0].Name != "tracer" {
+		t.Errorf("role binding = %v, want the role bound to the service account", binding)
+	}
+}
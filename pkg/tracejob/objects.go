@@ -0,0 +1,110 @@
+package tracejob
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/meta"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FromObjects reads back the trace job that created the job and the configmap, to run it again as it was.
+// The time window and whether the trace was exclusive are not recorded in the objects and are left unset,
+// the deadline is the one the job was created with.
+func FromObjects(job *batchv1.Job, cm *apiv1.ConfigMap) (TraceJob, error) {
+	containers := job.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return TraceJob{}, fmt.Errorf("the job %s has no trace runner container", job.Name)
+	}
+	c := containers[0]
+	hostname, err := jobHostname(*job)
+	if err != nil {
+		return TraceJob{}, err
+	}
+	tunables, err := tunablesFromEnv(c.Env)
+	if err != nil {
+		return TraceJob{}, err
+	}
+	resources := c.Resources
+	nj := TraceJob{
+		Name:           job.Labels[meta.TraceLabelKey],
+		ID:             types.UID(job.Labels[meta.TraceIDLabelKey]),
+		Namespace:      job.Namespace,
+		ServiceAccount: job.Spec.Template.Spec.ServiceAccountName,
+		HostPID:        job.Spec.Template.Spec.HostPID,
+		HostNetwork:    job.Spec.Template.Spec.HostNetwork,
+		HostAliases:    job.Spec.Template.Spec.HostAliases,
+		DNSConfig:      job.Spec.Template.Spec.DNSConfig,
+		Hostname:       hostname,
+		Program:        cm.Data["program.bt"],
+		Binary:         cm.BinaryData["program"],
+		ImageNameTag:   c.Image,
+		Tunables:       tunables,
+		Proxy:          proxyFromEnv(c.Env),
+		CABundle:       caBundleFrom(job.Spec.Template.Spec),
+		Resources:      &resources,
+	}
+	if a := job.Spec.Template.Spec.Affinity; a != nil && a.PodAntiAffinity != nil && len(a.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution) > 0 {
+		nj.AvoidPods = &a.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0]
+	}
+	if rc := job.Spec.Template.Spec.RuntimeClassName; rc != nil {
+		nj.RuntimeClass = *rc
+	}
+	if inits := job.Spec.Template.Spec.InitContainers; len(inits) > 0 {
+		nj.FetchHeaders = true
+		nj.InitImageNameTag = inits[0].Image
+	}
+	for key, v := range map[string]*int64{
+		meta.TraceDeadlineAnnotationKey:            &nj.Deadline,
+		meta.TraceDeadlineGracePeriodAnnotationKey: &nj.DeadlineGracePeriod,
+	} {
+		if *v, err = strconv.ParseInt(job.Annotations[key], 10, 64); err != nil {
+			return TraceJob{}, fmt.Errorf("invalid %s annotation of the job %s: %v", key, job.Name, err)
+		}
+	}
+	if err := nj.readRunnerFlags(c.Command); err != nil {
+		return TraceJob{}, fmt.Errorf("invalid command of the job %s: %v", job.Name, err)
+	}
+	return nj, nil
+}
+
+// readRunnerFlags sets the fields of the trace job passed as flags to the trace runner by manifests.
+func (nj *TraceJob) readRunnerFlags(command []string) error {
+	for _, arg := range command {
+		name, value := arg, ""
+		if i := strings.Index(arg, "="); i >= 0 {
+			name, value = arg[:i], arg[i+1:]
+		}
+		var err error
+		switch name {
+		case "--inpod":
+			nj.IsPod = true
+		case "--container":
+			nj.ContainerName = value
+		case "--poduid":
+			nj.PodUID = value
+		case "--unsafe":
+			nj.Unsafe = true
+		case "--buffering":
+			nj.Buffering = value
+		case "--snapshot-interval":
+			nj.SnapshotInterval, err = time.ParseDuration(value)
+		case "--tracer-flags":
+			nj.TracerFlags = value
+		case "--shell":
+			nj.Shell = true
+		case "--only-target":
+			nj.OnlyTarget = true
+		case "--max-output":
+			nj.MaxOutput, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
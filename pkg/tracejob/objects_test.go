@@ -0,0 +1,81 @@
+package tracejob
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFromObjects(t *testing.T) {
+	resources := &apiv1.ResourceRequirements{
+		Limits: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("2G")},
+	}
+	tests := []struct {
+		name    string
+		builder *Builder
+	}{
+		{
+			name: "node trace",
+			builder: New(NodeTarget("node-1")).
+				WithProgram("kprobe:do_sys_open { @ = count(); }").
+				WithFetchHeaders(true).
+				WithInitImage("quay.io/iovisor/kubectl-trace-init:latest").
+				WithTunables(Tunables{Strlen: 200, PerfRBPages: 128}).
+				WithBuffering("line").
+				WithSnapshotInterval(time.Minute).
+				WithMaxOutput(100*1000*1000).
+				WithHostNamespaces(false, true).
+				WithAvoidPods(&metav1.LabelSelector{MatchLabels: map[string]string{"tier": "latency-critical"}}, []string{"payments"}).
+				WithTracerFlags("-k -v"),
+		},
+		{
+			name: "pod trace",
+			builder: New(PodTarget("node-1", "uid-1", "nginx")).
+				WithProgram("tracepoint:syscalls:sys_enter_openat { @ = count(); }").
+				WithServiceAccount("tracer").
+				WithRuntimeClass("runc").
+				WithCABundle("corp-ca", "").
+				WithProxy(Proxy{HTTP: "http://proxy.internal:3128", HTTPS: "http://proxy.internal:3128", NoProxy: "10.0.0.0/8"}).
+				WithNameResolution([]apiv1.HostAlias{{IP: "10.0.0.7", Hostnames: []string{"sink.internal"}}}, &apiv1.PodDNSConfig{Searches: []string{"corp.internal"}}).
+				WithUnsafe(true).
+				WithOnlyTarget(true).
+				WithResources(resources),
+		},
+		{
+			name: "binary",
+			builder: New(NodeTarget("node-1")).
+				WithBinary([]byte("\x7fELF")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tt.builder.
+				WithNamespace("default").
+				WithImage("quay.io/iovisor/kubectl-trace-bpftrace@sha256:0123").
+				WithDeadline(60).
+				WithDeadlineGracePeriod(10).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cm, job, err := want.manifests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FromObjects(job, cm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The resources are read back merged into the defaults.
+			resources := mergeResources(want.Resources)
+			want.Resources = &resources
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package tracejob
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/iovisor/kubectl-trace/pkg/redact"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Proxy is the proxy the init container fetching the linux headers and the trace runner reach the network through.
+type Proxy struct {
+	// HTTP and HTTPS are the URLs of the proxies of the HTTP and HTTPS requests, none when empty.
+	HTTP  string
+	HTTPS string
+	// NoProxy lists the hosts, domains and networks reached directly, separated by commas.
+	NoProxy string
+}
+
+// kubernetesServiceHost is the address of the API server in the pods, expanded by kubernetes in the environment
+// variables, so that the trace runner reports its phases without going through the proxy.
+const kubernetesServiceHost = "$(KUBERNETES_SERVICE_HOST)"
+
+// env returns the proxy environment variables, in both cases since tools like curl only read some of them
+// in upper case.
+func (p Proxy) env() []apiv1.EnvVar {
+	if len(p.HTTP) == 0 && len(p.HTTPS) == 0 {
+		return nil
+	}
+	noProxy := kubernetesServiceHost
+	if len(p.NoProxy) > 0 {
+		noProxy = p.NoProxy + "," + noProxy
+	}
+	var vars []apiv1.EnvVar
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", p.HTTP},
+		{"HTTPS_PROXY", p.HTTPS},
+		{"NO_PROXY", noProxy},
+	} {
+		if len(v.value) > 0 {
+			vars = append(vars,
+				apiv1.EnvVar{Name: v.name, Value: v.value},
+				apiv1.EnvVar{Name: strings.ToLower(v.name), Value: v.value})
+		}
+	}
+	return vars
+}
+
+// proxyFromEnv reads back the proxy set by env.
+func proxyFromEnv(vars []apiv1.EnvVar) Proxy {
+	var p Proxy
+	for _, v := range vars {
+		switch v.Name {
+		case "HTTP_PROXY":
+			p.HTTP = v.Value
+		case "HTTPS_PROXY":
+			p.HTTPS = v.Value
+		case "NO_PROXY":
+			p.NoProxy = strings.TrimSuffix(strings.TrimSuffix(v.Value, kubernetesServiceHost), ",")
+		}
+	}
+	return p
+}
+
+// redactProxyPasswords replaces the passwords of the proxy URLs set by env in the containers of the pod, for the job
+// to be logged. The URLs that cannot be parsed are replaced as a whole.
+func redactProxyPasswords(spec *apiv1.PodSpec) {
+	for _, containers := range [][]apiv1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for j, v := range containers[i].Env {
+				switch strings.ToUpper(v.Name) {
+				case "HTTP_PROXY", "HTTPS_PROXY":
+					containers[i].Env[j].Value = redactURLPassword(v.Value)
+				}
+			}
+		}
+	}
+}
+
+func redactURLPassword(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return redact.Redacted
+	}
+	if u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	redacted := strings.Replace(value, u.User.String()+"@", u.User.Username()+":"+redact.Redacted+"@", 1)
+	if redacted == value {
+		// The user information is not escaped like url would, the password cannot be told apart.
+		return redact.Redacted
+	}
+	return redacted
+}
@@ -0,0 +1,154 @@
+package tracejob
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quotaCounts are the objects of a trace counted by resource quotas, one of each.
+var quotaCounts = []apiv1.ResourceName{
+	apiv1.ResourcePods,
+	apiv1.ResourceConfigMaps,
+	"count/pods",
+	"count/configmaps",
+	"count/jobs.batch",
+}
+
+// quotaResources are the resources of the trace pod counted by resource quotas, with the resource of the containers
+// they sum and whether they sum the limits rather than the requests.
+var quotaResources = []struct {
+	name     apiv1.ResourceName
+	resource apiv1.ResourceName
+	limits   bool
+}{
+	{apiv1.ResourceCPU, apiv1.ResourceCPU, false},
+	{apiv1.ResourceMemory, apiv1.ResourceMemory, false},
+	{apiv1.ResourceRequestsCPU, apiv1.ResourceCPU, false},
+	{apiv1.ResourceRequestsMemory, apiv1.ResourceMemory, false},
+	{apiv1.ResourceLimitsCPU, apiv1.ResourceCPU, true},
+	{apiv1.ResourceLimitsMemory, apiv1.ResourceMemory, true},
+}
+
+// checkQuotas checks the trace job against the resource quotas of its namespace: a job whose pod exceeds a quota is
+// created, but never gets its pod. When adjust is true, for the default resources, the limits of the containers are
+// lowered to what the quotas leave, as long as they stay above the requests.
+// The quotas selecting pods by priority class are not checked, the trace pods have none.
+func checkQuotas(quotas []apiv1.ResourceQuota, job *batchv1.Job, adjust bool) error {
+	spec := &job.Spec.Template.Spec
+	for _, q := range quotas {
+		if !quotaApplies(q, spec) {
+			continue
+		}
+		for _, name := range quotaCounts {
+			hard, ok := q.Status.Hard[name]
+			if !ok {
+				continue
+			}
+			used := q.Status.Used[name]
+			if used.Cmp(hard) >= 0 {
+				return fmt.Errorf("the resource quota %s of namespace %s is exceeded: %s used %s of %s", q.Name, q.Namespace, name, used.String(), hard.String())
+			}
+		}
+		for _, r := range quotaResources {
+			hard, ok := q.Status.Hard[r.name]
+			if !ok {
+				continue
+			}
+			left := hard.DeepCopy()
+			left.Sub(q.Status.Used[r.name])
+			if r.limits && adjust {
+				lowerLimits(spec, r.resource, left)
+			}
+			need := podResource(spec, r.resource, r.limits)
+			if need.Cmp(left) > 0 {
+				return fmt.Errorf("the resource quota %s of namespace %s is exceeded: the trace needs %s %s, %s of %s are left",
+					q.Name, q.Namespace, need.String(), r.name, left.String(), hard.String())
+			}
+		}
+	}
+	return nil
+}
+
+// quotaApplies tells whether the quota counts the pod, from its scopes.
+func quotaApplies(q apiv1.ResourceQuota, spec *apiv1.PodSpec) bool {
+	if q.Spec.ScopeSelector != nil {
+		return false
+	}
+	for _, s := range q.Spec.Scopes {
+		switch s {
+		case apiv1.ResourceQuotaScopeTerminating:
+			if spec.ActiveDeadlineSeconds == nil {
+				return false
+			}
+		case apiv1.ResourceQuotaScopeNotTerminating:
+			if spec.ActiveDeadlineSeconds != nil {
+				return false
+			}
+		case apiv1.ResourceQuotaScopeBestEffort:
+			if !bestEffort(spec) {
+				return false
+			}
+		case apiv1.ResourceQuotaScopeNotBestEffort:
+			if bestEffort(spec) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// bestEffort tells whether no container of the pod has requests or limits.
+func bestEffort(spec *apiv1.PodSpec) bool {
+	for _, c := range append(append([]apiv1.Container{}, spec.InitContainers...), spec.Containers...) {
+		if len(c.Resources.Requests) > 0 || len(c.Resources.Limits) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// podResource returns the requests, or the limits, of the pod for the resource: the largest of the sum of its containers
+// and of each of its init containers, which run one after the other before them.
+func podResource(spec *apiv1.PodSpec, name apiv1.ResourceName, limits bool) resource.Quantity {
+	list := func(c apiv1.Container) apiv1.ResourceList {
+		if limits {
+			return c.Resources.Limits
+		}
+		return c.Resources.Requests
+	}
+	var total resource.Quantity
+	for _, c := range spec.Containers {
+		if v, ok := list(c)[name]; ok {
+			total.Add(v)
+		}
+	}
+	for _, c := range spec.InitContainers {
+		if v, ok := list(c)[name]; ok && v.Cmp(total) > 0 {
+			total = v.DeepCopy()
+		}
+	}
+	return total
+}
+
+// lowerLimits lowers the limits of the containers for the resource to left, when their requests fit in it.
+// The trace pod has one container, and one init container running before it.
+func lowerLimits(spec *apiv1.PodSpec, name apiv1.ResourceName, left resource.Quantity) {
+	for _, containers := range [][]apiv1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			r := &containers[i].Resources
+			limit, ok := r.Limits[name]
+			if !ok || limit.Cmp(left) <= 0 {
+				continue
+			}
+			if request, ok := r.Requests[name]; ok && request.Cmp(left) > 0 {
+				continue
+			}
+			r.Limits[name] = left.DeepCopy()
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tracejob
+
+import (
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func quotaJob() *batchv1.Job {
+	resources := func() apiv1.ResourceRequirements {
+		return apiv1.ResourceRequirements{
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m"), apiv1.ResourceMemory: resource.MustParse("100Mi")},
+			Limits:   apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1"), apiv1.ResourceMemory: resource.MustParse("1G")},
+		}
+	}
+	return &batchv1.Job{Spec: batchv1.JobSpec{Template: apiv1.PodTemplateSpec{Spec: apiv1.PodSpec{
+		InitContainers: []apiv1.Container{{Name: "init", Resources: resources()}},
+		Containers:     []apiv1.Container{{Name: "trace", Resources: resources()}},
+	}}}}
+}
+
+func quota(scopes []apiv1.ResourceQuotaScope, hard, used apiv1.ResourceList) apiv1.ResourceQuota {
+	return apiv1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "team", Namespace: "default"},
+		Spec:       apiv1.ResourceQuotaSpec{Scopes: scopes},
+		Status:     apiv1.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+func TestCheckQuotas(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     apiv1.ResourceQuota
+		adjust    bool
+		wantErr   string
+		wantLimit string
+	}{
+		{
+			name:      "within the quota",
+			quota:     quota(nil, apiv1.ResourceList{"requests.cpu": resource.MustParse("2"), "pods": resource.MustParse("10")}, apiv1.ResourceList{"requests.cpu": resource.MustParse("1"), "pods": resource.MustParse("3")}),
+			wantLimit: "1G",
+		},
+		{
+			name:    "no pod left",
+			quota:   quota(nil, apiv1.ResourceList{"pods": resource.MustParse("10")}, apiv1.ResourceList{"pods": resource.MustParse("10")}),
+			wantErr: "the resource quota team of namespace default is exceeded: pods used 10 of 10",
+		},
+		{
+			name:    "requests exceeded",
+			quota:   quota(nil, apiv1.ResourceList{"requests.memory": resource.MustParse("1Gi")}, apiv1.ResourceList{"requests.memory": resource.MustParse("1000Mi")}),
+			wantErr: "the trace needs 100Mi requests.memory, 24Mi of 1Gi are left",
+		},
+		{
+			name:    "limits exceeded",
+			quota:   quota(nil, apiv1.ResourceList{"limits.memory": resource.MustParse("2Gi")}, apiv1.ResourceList{"limits.memory": resource.MustParse("1536Mi")}),
+			wantErr: "the trace needs 1G limits.memory, 512Mi of 2Gi are left",
+		},
+		{
+			name:      "limits lowered",
+			quota:     quota(nil, apiv1.ResourceList{"limits.memory": resource.MustParse("2Gi")}, apiv1.ResourceList{"limits.memory": resource.MustParse("1536Mi")}),
+			adjust:    true,
+			wantLimit: "512Mi",
+		},
+		{
+			name:    "limits below the requests",
+			quota:   quota(nil, apiv1.ResourceList{"limits.memory": resource.MustParse("2Gi")}, apiv1.ResourceList{"limits.memory": resource.MustParse("2000Mi")}),
+			adjust:  true,
+			wantErr: "the trace needs 1G limits.memory, 48Mi of 2Gi are left",
+		},
+		{
+			name:      "other scope",
+			quota:     quota([]apiv1.ResourceQuotaScope{apiv1.ResourceQuotaScopeBestEffort}, apiv1.ResourceList{"pods": resource.MustParse("1")}, apiv1.ResourceList{"pods": resource.MustParse("1")}),
+			wantLimit: "1G",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := quotaJob()
+			err := checkQuotas([]apiv1.ResourceQuota{tt.quota}, job, tt.adjust)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkQuotas() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkQuotas() error = %v", err)
+			}
+			for _, c := range append(job.Spec.Template.Spec.InitContainers, job.Spec.Template.Spec.Containers...) {
+				if got := c.Resources.Limits[apiv1.ResourceMemory]; got.String() != tt.wantLimit {
+					t.Errorf("memory limit of %s = %s, want %s", c.Name, got.String(), tt.wantLimit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package tracejob
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRetryOnTransient(t *testing.T) {
+	jobs := schema.GroupResource{Group: "batch", Resource: "jobs"}
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "success at first attempt",
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		{
+			name:      "throttled then success",
+			errs:      []error{errors.NewTooManyRequests("slow down", 1), nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "conflict then success",
+			errs:      []error{errors.NewConflict(jobs, "kubectl-trace-1", fmt.Errorf("conflict")), nil},
+			wantCalls: 2,
+		},
+		{
+			name:      "non transient error",
+			errs:      []error{errors.NewForbidden(jobs, "kubectl-trace-1", fmt.Errorf("forbidden"))},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name: "backoff exhausted",
+			errs: []error{
+				errors.NewServiceUnavailable("unavailable"),
+				errors.NewServiceUnavailable("unavailable"),
+				errors.NewServiceUnavailable("unavailable"),
+			},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryOnTransient(context.Background(), wait.Backoff{Steps: 3}, func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("retryOnTransient() calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retryOnTransient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryOnTransientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := retryOnTransient(ctx, wait.Backoff{Duration: time.Hour, Steps: 3}, func() error {
+		calls++
+		cancel()
+		return errors.NewServiceUnavailable("unavailable")
+	})
+	if calls != 1 {
+		t.Errorf("retryOnTransient() calls = %d, want 1", calls)
+	}
+	if err != context.Canceled {
+		t.Errorf("retryOnTransient() error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,71 @@
+package tracejob
+
+import (
+	"fmt"
+
+	"github.com/iovisor/kubectl-trace/pkg/errdefs"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1typed "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// HostnameLabel is the label of the nodes the trace job pods are scheduled with.
+const HostnameLabel = "kubernetes.io/hostname"
+
+// NodeHostname returns the hostname label of the node.
+func NodeHostname(node *apiv1.Node) (string, error) {
+	hostname, ok := node.Labels[HostnameLabel]
+	if !ok {
+		return "", fmt.Errorf("label %s not found in node %s", HostnameLabel, node.Name)
+	}
+	return hostname, nil
+}
+
+// ResolveNodeTarget returns the target of a trace of the node with the given name.
+func ResolveNodeTarget(nodes corev1typed.NodesGetter, name string) (Target, error) {
+	node, err := nodes.Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return Target{}, targetNotFound(err)
+	}
+	hostname, err := NodeHostname(node)
+	if err != nil {
+		return Target{}, err
+	}
+	return NodeTarget(hostname), nil
+}
+
+// ResolvePodTarget returns the target of a trace of the container of the pod, the first one when container is empty,
+// getting the node the pod is scheduled on.
+func ResolvePodTarget(nodes corev1typed.NodesGetter, pod *apiv1.Pod, container string) (Target, error) {
+	if len(pod.Spec.NodeName) == 0 {
+		return Target{}, fmt.Errorf("cannot attach a trace program to a pod that is not currently scheduled on a node")
+	}
+	container, err := podContainer(pod, container)
+	if err != nil {
+		return Target{}, err
+	}
+	t, err := ResolveNodeTarget(nodes, pod.Spec.NodeName)
+	if err != nil {
+		return Target{}, err
+	}
+	return PodTarget(t.Hostname, string(pod.UID), container), nil
+}
+
+// podContainer returns the container of the pod to trace, the first one when none is given.
+func podContainer(pod *apiv1.Pod, name string) (string, error) {
+	for _, c := range pod.Spec.Containers {
+		if len(name) == 0 || c.Name == name {
+			return c.Name, nil
+		}
+	}
+	return "", errdefs.Errorf(errdefs.ErrContainerNotFound, "no containers found for the provided pod/container combination")
+}
+
+// targetNotFound classifies the errors of the API server telling the target does not exist.
+func targetNotFound(err error) error {
+	if errors.IsNotFound(err) {
+		return errdefs.Wrap(errdefs.ErrTargetNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package tracejob
+
+import (
+	"fmt"
+	"strconv"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Tunables are the limits bpftrace reads from its environment.
+// The zero values keep the defaults of bpftrace.
+type Tunables struct {
+	// MapKeysMax is the maximum number of keys of a map, BPFTRACE_MAP_KEYS_MAX.
+	MapKeysMax int64
+	// Strlen is the number of bytes kept by str(), BPFTRACE_STRLEN.
+	Strlen int64
+	// PerfRBPages is the number of pages of the perf ring buffer of each CPU, BPFTRACE_PERF_RB_PAGES.
+	PerfRBPages int64
+	// CatBytesMax is the maximum number of bytes printed by cat(), BPFTRACE_CAT_BYTES_MAX.
+	CatBytesMax int64
+}
+
+// tunable is a field of Tunables and the environment variable setting it.
+type tunable struct {
+	env   string
+	value *int64
+}
+
+func (t *Tunables) tunables() []tunable {
+	return []tunable{
+		{"BPFTRACE_MAP_KEYS_MAX", &t.MapKeysMax},
+		{"BPFTRACE_STRLEN", &t.Strlen},
+		{"BPFTRACE_PERF_RB_PAGES", &t.PerfRBPages},
+		{"BPFTRACE_CAT_BYTES_MAX", &t.CatBytesMax},
+	}
+}
+
+func (t Tunables) validate() error {
+	for _, tu := range t.tunables() {
+		if *tu.value < 0 {
+			return fmt.Errorf("%s cannot be negative, got %d", tu.env, *tu.value)
+		}
+	}
+	if t.PerfRBPages&(t.PerfRBPages-1) != 0 {
+		return fmt.Errorf("BPFTRACE_PERF_RB_PAGES must be a power of 2, got %d", t.PerfRBPages)
+	}
+	return nil
+}
+
+// env returns the environment variables of the tunables that are set.
+func (t Tunables) env() []apiv1.EnvVar {
+	var vars []apiv1.EnvVar
+	for _, tu := range t.tunables() {
+		if *tu.value > 0 {
+			vars = append(vars, apiv1.EnvVar{Name: tu.env, Value: strconv.FormatInt(*tu.value, 10)})
+		}
+	}
+	return vars
+}
+
+// tunablesFromEnv reads back the tunables set by env.
+func tunablesFromEnv(vars []apiv1.EnvVar) (Tunables, error) {
+	var t Tunables
+	for _, tu := range t.tunables() {
+		for _, v := range vars {
+			if v.Name != tu.env {
+				continue
+			}
+			n, err := strconv.ParseInt(v.Value, 10, 64)
+			if err != nil {
+				return Tunables{}, fmt.Errorf("invalid %s: %v", tu.env, err)
+			}
+			*tu.value = n
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,54 @@
+package tracejob
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestTunables(t *testing.T) {
+	tests := []struct {
+		name     string
+		tunables Tunables
+		wantEnv  []apiv1.EnvVar
+		wantErr  bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:     "some set",
+			tunables: Tunables{Strlen: 200, PerfRBPages: 256},
+			wantEnv: []apiv1.EnvVar{
+				{Name: "BPFTRACE_STRLEN", Value: "200"},
+				{Name: "BPFTRACE_PERF_RB_PAGES", Value: "256"},
+			},
+		},
+		{
+			name:     "negative",
+			tunables: Tunables{MapKeysMax: -1},
+			wantErr:  true,
+		},
+		{
+			name:     "pages not a power of 2",
+			tunables: Tunables{PerfRBPages: 100},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tunables.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if env := tt.tunables.env(); !reflect.DeepEqual(env, tt.wantEnv) {
+				t.Errorf("env() = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package tracejob
+
+import (
+	"time"
+)
+
+// runDeadline returns how long the trace runner is allowed to run when started at now, in seconds:
+// its wait for the beginning of the time window, then the deadline of the trace, cut at the end of the window.
+// It is not positive when the window already ended.
+func (nj TraceJob) runDeadline(now time.Time) int64 {
+	deadline := nj.Deadline
+	if !nj.NotBefore.IsZero() && nj.NotBefore.After(now) {
+		deadline += int64(nj.NotBefore.Sub(now).Round(time.Second) / time.Second)
+	}
+	if !nj.NotAfter.IsZero() {
+		if left := int64(nj.NotAfter.Sub(now) / time.Second); left < deadline {
+			deadline = left
+		}
+	}
+	return deadline
+}
@@ -0,0 +1,33 @@
+package tracejob
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunDeadline(t *testing.T) {
+	now := time.Date(2019, 1, 2, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		want      int64
+	}{
+		{name: "no window", want: 600},
+		{name: "window started", notBefore: now.Add(-time.Hour), want: 600},
+		{name: "wait for the window", notBefore: now.Add(5 * time.Minute), want: 900},
+		{name: "window ends before the deadline", notAfter: now.Add(2 * time.Minute), want: 120},
+		{name: "window ends after the deadline", notAfter: now.Add(time.Hour), want: 600},
+		{name: "wait then cut", notBefore: now.Add(5 * time.Minute), notAfter: now.Add(8 * time.Minute), want: 480},
+		{name: "window ended", notAfter: now.Add(-time.Minute), want: -60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nj := TraceJob{Deadline: 600, NotBefore: tt.notBefore, NotAfter: tt.notAfter}
+			if got := nj.runDeadline(now); got != tt.want {
+				t.Errorf("runDeadline() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
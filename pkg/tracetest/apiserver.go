@@ -0,0 +1,333 @@
+package tracetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// APIServer is an in-memory Kubernetes API server, for the clients of client-go to be tested without a cluster.
+// It stores the objects of any resource at the paths of the API, like the jobs, configmaps and pods of the traces,
+// and lists them with label selectors, and with field selectors on their name and namespace.
+// It runs no controllers: deleting a job leaves its pods, and statuses only change when set with Add.
+// Watches, patches and subresources are not served.
+type APIServer struct {
+	mu      sync.Mutex
+	server  *httptest.Server
+	objects map[objectKey]map[string]interface{}
+	version int
+
+	// Requests are the requests served, like "DELETE /apis/batch/v1/namespaces/default/jobs/kubectl-trace-1".
+	Requests []string
+	// BeforeRequest, when set, is called before serving each request, and may call Add, for the objects to change
+	// between the requests of the code tested.
+	BeforeRequest func(r *http.Request)
+}
+
+// objectKey identifies an object of the server, its namespace is empty for the cluster scoped ones.
+type objectKey struct {
+	resource  string
+	namespace string
+	name      string
+}
+
+// NewAPIServer starts an API server without objects, to be closed with Close.
+func NewAPIServer() *APIServer {
+	s := &APIServer{objects: map[objectKey]map[string]interface{}{}}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// Config is the configuration of the clients of the server.
+func (s *APIServer) Config() *rest.Config {
+	return &rest.Config{Host: s.server.URL}
+}
+
+// Close stops the server.
+func (s *APIServer) Close() {
+	s.server.Close()
+}
+
+// Add stores the objects, replacing the ones with the same name. Their creation timestamp defaults to now.
+func (s *APIServer) Add(objects ...runtime.Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, obj := range objects {
+		resource, err := resourceOf(obj)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		o := map[string]interface{}{}
+		if err := json.Unmarshal(data, &o); err != nil {
+			return err
+		}
+		m := metadata(o)
+		name, _ := m["name"].(string)
+		namespace, _ := m["namespace"].(string)
+		s.store(objectKey{resource: resource, namespace: namespace, name: name}, o)
+	}
+	return nil
+}
+
+// Names returns the objects of the resource, like jobs, as namespace/name sorted, or name for the cluster scoped ones.
+func (s *APIServer) Names(resource string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for k := range s.objects {
+		if k.resource != resource {
+			continue
+		}
+		if len(k.namespace) == 0 {
+			names = append(names, k.name)
+		} else {
+			names = append(names, k.namespace+"/"+k.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceOf returns the resource of the object by its type, for the types of the objects of the traces.
+func resourceOf(obj runtime.Object) (string, error) {
+	switch obj.(type) {
+	case *batchv1.Job:
+		return "jobs", nil
+	case *corev1.ConfigMap:
+		return "configmaps", nil
+	case *corev1.Pod:
+		return "pods", nil
+	case *corev1.Node:
+		return "nodes", nil
+	case *corev1.Namespace:
+		return "namespaces", nil
+	case *corev1.ResourceQuota:
+		return "resourcequotas", nil
+	case *coordinationv1.Lease:
+		return "leases", nil
+	}
+	return "", fmt.Errorf("objects of type %T are not supported", obj)
+}
+
+func metadata(o map[string]interface{}) map[string]interface{} {
+	m, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		o["metadata"] = m
+	}
+	return m
+}
+
+// store sets the fields set by the API server and stores the object.
+func (s *APIServer) store(k objectKey, o map[string]interface{}) {
+	s.version++
+	m := metadata(o)
+	m["name"] = k.name
+	if len(k.namespace) > 0 {
+		m["namespace"] = k.namespace
+	}
+	if uid, _ := m["uid"].(string); len(uid) == 0 {
+		m["uid"] = fmt.Sprintf("uid-%d", s.version)
+	}
+	if m["creationTimestamp"] == nil {
+		m["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	m["resourceVersion"] = strconv.Itoa(s.version)
+	s.objects[k] = o
+}
+
+// parsePath returns the object or the list of objects of the path, ok false for the paths not served.
+func parsePath(p string) (k objectKey, ok bool) {
+	var rest string
+	switch {
+	case strings.HasPrefix(p, "/api/v1/"):
+		rest = p[len("/api/v1/"):]
+	case strings.HasPrefix(p, "/apis/"):
+		// /apis/<group>/<version>/...
+		parts := strings.SplitN(p[len("/apis/"):], "/", 3)
+		if len(parts) < 3 {
+			return k, false
+		}
+		rest = parts[2]
+	default:
+		return k, false
+	}
+	segments := strings.Split(strings.Trim(rest, "/"), "/")
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		k.namespace, segments = segments[1], segments[2:]
+	}
+	switch len(segments) {
+	case 1:
+		k.resource = segments[0]
+	case 2:
+		k.resource, k.name = segments[0], segments[1]
+	default:
+		return k, false
+	}
+	return k, true
+}
+
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.BeforeRequest != nil {
+		s.BeforeRequest(r)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Requests = append(s.Requests, r.Method+" "+r.URL.Path)
+	w.Header().Set("Content-Type", "application/json")
+
+	k, ok := parsePath(r.URL.Path)
+	if !ok || r.URL.Query().Get("watch") == "true" {
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, r.URL.Path+" is not served")
+		return
+	}
+	dryRun := len(r.URL.Query().Get("dryRun")) > 0
+
+	switch {
+	case r.Method == http.MethodGet && len(k.name) == 0:
+		s.list(w, r, k)
+	case r.Method == http.MethodGet:
+		o, ok := s.objects[k]
+		if !ok {
+			writeNotFound(w, k)
+			return
+		}
+		json.NewEncoder(w).Encode(o)
+	case r.Method == http.MethodPost && len(k.name) == 0:
+		o := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+		m := metadata(o)
+		k.name, _ = m["name"].(string)
+		if generateName, _ := m["generateName"].(string); len(k.name) == 0 && len(generateName) > 0 {
+			k.name = generateName + strconv.Itoa(s.version+1)
+		}
+		if _, exists := s.objects[k]; exists {
+			writeStatus(w, http.StatusConflict, metav1.StatusReasonAlreadyExists, fmt.Sprintf("%s %q already exists", k.resource, k.name))
+			return
+		}
+		if !dryRun {
+			s.store(k, o)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(o)
+	case r.Method == http.MethodPut && len(k.name) > 0:
+		existing, ok := s.objects[k]
+		if !ok {
+			writeNotFound(w, k)
+			return
+		}
+		o := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+		version, _ := metadata(o)["resourceVersion"].(string)
+		if len(version) > 0 && version != metadata(existing)["resourceVersion"] {
+			writeStatus(w, http.StatusConflict, metav1.StatusReasonConflict, fmt.Sprintf("%s %q has been modified", k.resource, k.name))
+			return
+		}
+		metadata(o)["uid"] = metadata(existing)["uid"]
+		metadata(o)["creationTimestamp"] = metadata(existing)["creationTimestamp"]
+		if !dryRun {
+			s.store(k, o)
+		}
+		json.NewEncoder(w).Encode(o)
+	case r.Method == http.MethodDelete && len(k.name) > 0:
+		if _, ok := s.objects[k]; !ok {
+			writeNotFound(w, k)
+			return
+		}
+		if !dryRun {
+			delete(s.objects, k)
+		}
+		json.NewEncoder(w).Encode(metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusSuccess,
+		})
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed, r.Method+" "+r.URL.Path+" is not served")
+	}
+}
+
+// list writes the objects of the resource, of the namespace of the path when there is one, matching the selectors.
+func (s *APIServer) list(w http.ResponseWriter, r *http.Request, k objectKey) {
+	ls, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+	fs, err := fields.ParseSelector(r.URL.Query().Get("fieldSelector"))
+	if err != nil {
+		writeStatus(w, http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+		return
+	}
+
+	var keys []objectKey
+	for ok := range s.objects {
+		if ok.resource == k.resource && (len(k.namespace) == 0 || ok.namespace == k.namespace) {
+			keys = append(keys, ok)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	items := []interface{}{}
+	for _, ok := range keys {
+		o := s.objects[ok]
+		objectLabels := labels.Set{}
+		if l, isMap := metadata(o)["labels"].(map[string]interface{}); isMap {
+			for key, v := range l {
+				objectLabels[key], _ = v.(string)
+			}
+		}
+		objectFields := fields.Set{"metadata.name": ok.name, "metadata.namespace": ok.namespace}
+		if ls.Matches(objectLabels) && fs.Matches(objectFields) {
+			items = append(items, o)
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metadata": map[string]string{"resourceVersion": strconv.Itoa(s.version)},
+		"items":    items,
+	})
+}
+
+func writeNotFound(w http.ResponseWriter, k objectKey) {
+	writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("%s %q not found", k.resource, k.name))
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Reason:   reason,
+		Code:     int32(code),
+		Message:  message,
+	})
+}
@@ -0,0 +1,168 @@
+// Package tracetest provides fakes of the kubectl-trace clients, to test programs running traces without a cluster.
+package tracetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/iovisor/kubectl-trace/pkg/attacher"
+	"github.com/iovisor/kubectl-trace/pkg/tracejob"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TraceJobClient is an in-memory tracejob.Interface.
+// Its fields can be set before using it, and read to check what happened.
+type TraceJobClient struct {
+	mu sync.Mutex
+
+	// Namespace restricts the trace jobs returned and deleted to the ones of this namespace, all of them when empty.
+	Namespace string
+	// Jobs are the trace jobs that exist, created ones are appended with the Running status.
+	Jobs []tracejob.TraceJob
+	// Deleted are the trace jobs deleted.
+	Deleted []tracejob.TraceJob
+
+	// CreateErr, GetErr and DeleteErr are returned by the corresponding methods when set.
+	CreateErr error
+	GetErr    error
+	DeleteErr error
+	// CleanupCalls counts the calls to CleanupOrphans.
+	CleanupCalls int
+}
+
+var _ tracejob.Interface = &TraceJobClient{}
+
+// NewTraceJobClient provides a fake with the given existing trace jobs.
+func NewTraceJobClient(jobs ...tracejob.TraceJob) *TraceJobClient {
+	return &TraceJobClient{Jobs: jobs}
+}
+
+// CreateJob records the trace job, returning a job named like it.
+func (c *TraceJobClient) CreateJob(ctx context.Context, nj tracejob.TraceJob) (*batchv1.Job, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.CreateErr != nil {
+		return nil, c.CreateErr
+	}
+	now := metav1.NewTime(time.Now())
+	nj.StartTime = &now
+	nj.Status = tracejob.TraceJobRunning
+	c.Jobs = append(c.Jobs, nj)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nj.Name,
+			Namespace: nj.Namespace,
+			UID:       types.UID(fmt.Sprintf("job-%s", nj.ID)),
+		},
+	}, nil
+}
+
+// GetJob returns the trace jobs matching the filter.
+func (c *TraceJobClient) GetJob(ctx context.Context, nf tracejob.TraceJobFilter) ([]tracejob.TraceJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.GetErr != nil {
+		return nil, c.GetErr
+	}
+	jobs := []tracejob.TraceJob{}
+	for _, j := range c.Jobs {
+		if c.matches(j, nf) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+// DeleteJobs removes the trace jobs matching the filter.
+func (c *TraceJobClient) DeleteJobs(ctx context.Context, nf tracejob.TraceJobFilter) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.DeleteErr != nil {
+		return c.DeleteErr
+	}
+	kept := c.Jobs[:0]
+	for _, j := range c.Jobs {
+		if c.matches(j, nf) {
+			c.Deleted = append(c.Deleted, j)
+		} else {
+			kept = append(kept, j)
+		}
+	}
+	c.Jobs = kept
+	return nil
+}
+
+// CleanupOrphans only counts the calls, the fake has no orphans.
+func (c *TraceJobClient) CleanupOrphans(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.CleanupCalls++
+	return ctx.Err()
+}
+
+// matches filters like the label selectors of TraceJobClient: by ID first, then by name.
+func (c *TraceJobClient) matches(j tracejob.TraceJob, nf tracejob.TraceJobFilter) bool {
+	if len(c.Namespace) > 0 && j.Namespace != c.Namespace {
+		return false
+	}
+	if nf.ID != nil {
+		return j.ID == *nf.ID
+	}
+	if nf.Name != nil {
+		return j.Name == *nf.Name
+	}
+	return true
+}
+
+// Attacher is an attacher.Interface writing canned output instead of streaming the one of the trace job.
+type Attacher struct {
+	mu sync.Mutex
+
+	// Output is written to the output stream of each attach.
+	Output string
+	// Err is returned by each attach when set, after writing the output.
+	Err error
+	// Attached are the IDs of the trace jobs attached to, in order.
+	Attached []types.UID
+	// Out is the output stream of AttachJob.
+	Out io.Writer
+}
+
+var _ attacher.Interface = &Attacher{}
+
+// NewAttacher provides a fake writing output to the streams it attaches with.
+func NewAttacher(out io.Writer, output string) *Attacher {
+	return &Attacher{Out: out, Output: output}
+}
+
+// AttachJob writes the output to Out.
+func (a *Attacher) AttachJob(traceJobID types.UID, namespace string) error {
+	return a.AttachJobTo(traceJobID, namespace, attacher.Streams{Out: a.Out})
+}
+
+// AttachJobTo writes the output to the output stream of s.
+func (a *Attacher) AttachJobTo(traceJobID types.UID, namespace string, s attacher.Streams) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Attached = append(a.Attached, traceJobID)
+	if s.Out != nil {
+		if _, err := io.WriteString(s.Out, a.Output); err != nil {
+			return err
+		}
+	}
+	return a.Err
+}
@@ -37,3 +37,20 @@ func String() string {
 	}
 	return fmt.Sprintf(versionFormat, GitCommit(), ts.String())
 }
+
+// Labels of the kubectl-trace images, set when building them.
+const (
+	// ImageLabelGitCommit is the git commit the image was built from.
+	ImageLabelGitCommit = "org.iovisor.kubectl-trace.git-commit"
+	// ImageLabelBpftraceVersion is the version of bpftrace in the tracerunner image.
+	ImageLabelBpftraceVersion = "org.iovisor.kubectl-trace.bpftrace-version"
+	// ImageLabelBCCVersion is the version of BCC in the tracerunner image, when it has one.
+	ImageLabelBCCVersion = "org.iovisor.kubectl-trace.bcc-version"
+	// ImageLabelRunnerProtocol is the RunnerProtocol the tracerunner image implements.
+	ImageLabelRunnerProtocol = "org.iovisor.kubectl-trace.runner-protocol"
+)
+
+// RunnerProtocol is the version of the interface between the trace jobs created by kubectl-trace
+// and the trace runner, like its command line. It must be increased, along with the label in
+// build/Dockerfile.tracerunner, when a change makes older images incompatible.
+const RunnerProtocol = "1"